@@ -78,11 +78,13 @@ func (c *ClusterDatabase) Exec(client resp.Connection, args [][]byte) resp.Reply
 func (c *ClusterDatabase) extractKey(cmdName string, args [][]byte) string {
 	switch cmdName {
 	case "get", "set", "setnx", "getset", "strlen", "append", "setex",
-		"exists", "del", "type", "expire", "ttl", "persist", "flushdb":
+		"exists", "del", "type", "expire", "ttl", "persist",
+		"dump", "restore", "getrange", "substr", "setrange", "getdel", "getex",
+		"incr", "incrby", "decr", "decrby", "incrbyfloat":
 		if len(args) > 1 {
 			return string(args[1])
 		}
-	case "mget", "mset":
+	case "mget", "mset", "msetnx":
 		if len(args) > 1 {
 			return string(args[1]) // return first key for routing
 		}
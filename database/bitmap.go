@@ -0,0 +1,468 @@
+package database
+
+import (
+	"Redis_Go/datastruct/bitmap"
+	"Redis_Go/interface/database"
+	"Redis_Go/interface/resp"
+	"Redis_Go/lib/utils"
+	"Redis_Go/resp/reply"
+	"strconv"
+	"strings"
+)
+
+// maxBitOffset is the largest bit offset a string of maxStringLength can hold
+const maxBitOffset = maxStringLength*8 - 1
+
+// parseBitOffset parses the offset argument of SETBIT, GETBIT and BITFIELD.
+// With hashAllowed, an offset of the form #N is multiplied by width, as BITFIELD does
+func parseBitOffset(raw []byte, hashAllowed bool, width uint) (int64, resp.Reply) {
+	multiply := false
+	if hashAllowed && len(raw) > 0 && raw[0] == '#' {
+		multiply = true
+		raw = raw[1:]
+	}
+	offset, err := strconv.ParseInt(string(raw), 10, 64)
+	if multiply {
+		offset *= int64(width)
+	}
+	if err != nil || offset < 0 || offset+int64(width)-1 > maxBitOffset {
+		return 0, reply.GetStandardErrorReply("ERR bit offset is not an integer or out of range")
+	}
+	return offset, nil
+}
+
+// parseBitRange parses the optional start, end and BYTE|BIT arguments of BITCOUNT and BITPOS,
+// returning the inclusive bit range they select in a string of size bytes.
+// A missing end selects up to the end of the string; ok is false if the range is empty
+func parseBitRange(args [][]byte, size int64) (start, end int64, ok bool, errReply resp.Reply) {
+	bitMode := false
+	if len(args) == 3 {
+		switch strings.ToUpper(string(args[2])) {
+		case "BYTE":
+		case "BIT":
+			bitMode = true
+		default:
+			return 0, 0, false, reply.GetSyntaxErrReply()
+		}
+	}
+
+	total := size
+	if bitMode {
+		total = size * 8
+	}
+	start, end = 0, total-1
+	var err error
+	if len(args) >= 1 {
+		if start, err = strconv.ParseInt(string(args[0]), 10, 64); err != nil {
+			return 0, 0, false, reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+		}
+	}
+	if len(args) >= 2 {
+		if end, err = strconv.ParseInt(string(args[1]), 10, 64); err != nil {
+			return 0, 0, false, reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+		}
+	}
+
+	// 负数下标从末尾开始计算, 与 GETRANGE 相同
+	if start < 0 && end < 0 && start > end {
+		return 0, 0, false, nil
+	}
+	if start < 0 {
+		start = max(total+start, 0)
+	}
+	if end < 0 {
+		end = max(total+end, 0)
+	}
+	end = min(end, total-1)
+	if start > end {
+		return 0, 0, false, nil
+	}
+	if !bitMode {
+		start, end = start*8, end*8+7
+	}
+	return start, end, true, nil
+}
+
+// execSetBit sets or clears the bit at offset in the string stored at key and returns its previous value.
+// The string is zero-padded if offset is past its current length
+// SETBIT key offset value
+func execSetBit(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	offset, errReply := parseBitOffset(args[1], false, 1)
+	if errReply != nil {
+		return errReply
+	}
+	value := string(args[2])
+	if value != "0" && value != "1" {
+		return reply.GetStandardErrorReply("ERR bit is not an integer or out of range")
+	}
+
+	var result resp.Reply
+	db.WithKeyLock(key, func() {
+		old, _, errReply := db.getAsString(key)
+		if errReply != nil {
+			result = errReply
+			return
+		}
+		// 总是复制一份新的切片, 读者可能仍持有旧值
+		newVal := make([]byte, max(int64(len(old)), offset/8+1))
+		copy(newVal, old)
+		oldBit := bitmap.GetBit(newVal, offset)
+		bitmap.SetBit(newVal, offset, value[0]-'0')
+
+		db.PutEntity(key, &database.DataEntity{Data: newVal})
+		db.addAof(utils.ToCmdLineWithName("SETBIT", args...))
+		result = reply.GetIntReply(int64(oldBit))
+	})
+	return result
+}
+
+// execGetBit returns the bit at offset in the string stored at key
+// GETBIT key offset
+func execGetBit(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	offset, errReply := parseBitOffset(args[1], false, 1)
+	if errReply != nil {
+		return errReply
+	}
+	val, _, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	return reply.GetIntReply(int64(bitmap.GetBit(val, offset)))
+}
+
+// execBitCount counts the set bits of the string stored at key, optionally within a byte or bit range
+// BITCOUNT key [start end [BYTE|BIT]]
+func execBitCount(db *DB, args [][]byte) resp.Reply {
+	if len(args) == 2 || len(args) > 4 {
+		return reply.GetSyntaxErrReply()
+	}
+	key := string(args[0])
+	val, _, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	start, end, ok, errReply := parseBitRange(args[1:], int64(len(val)))
+	if errReply != nil {
+		return errReply
+	}
+	if !ok {
+		return reply.GetIntReply(0)
+	}
+	return reply.GetIntReply(bitmap.Count(val, start, end))
+}
+
+// execBitPos returns the position of the first bit set to 0 or 1 in the string stored at key
+// BITPOS key bit [start [end [BYTE|BIT]]]
+func execBitPos(db *DB, args [][]byte) resp.Reply {
+	if len(args) > 5 {
+		return reply.GetSyntaxErrReply()
+	}
+	key := string(args[0])
+	bitArg := string(args[1])
+	if bitArg != "0" && bitArg != "1" {
+		return reply.GetStandardErrorReply("ERR The bit argument must be 1 or 0.")
+	}
+	bit := bitArg[0] - '0'
+
+	val, exists, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	if !exists {
+		// 不存在的键视为无限长的全 0 字符串
+		if bit == 1 {
+			return reply.GetIntReply(-1)
+		}
+		return reply.GetIntReply(0)
+	}
+
+	start, end, ok, errReply := parseBitRange(args[2:], int64(len(val)))
+	if errReply != nil {
+		return errReply
+	}
+	if !ok {
+		return reply.GetIntReply(-1)
+	}
+	pos := bitmap.Pos(val, bit, start, end)
+	// Without an explicit end the string is treated as padded with zeros to the right
+	if pos == -1 && bit == 0 && len(args) < 4 {
+		pos = int64(len(val)) * 8
+	}
+	return reply.GetIntReply(pos)
+}
+
+// execBitOp stores the bitwise AND, OR, XOR or NOT of the source strings in destkey
+// and returns the length of the result
+// BITOP AND|OR|XOR|NOT destkey key [key ...]
+func execBitOp(db *DB, args [][]byte) resp.Reply {
+	var op bitmap.Op
+	switch strings.ToUpper(string(args[0])) {
+	case "AND":
+		op = bitmap.OpAnd
+	case "OR":
+		op = bitmap.OpOr
+	case "XOR":
+		op = bitmap.OpXor
+	case "NOT":
+		op = bitmap.OpNot
+	default:
+		return reply.GetSyntaxErrReply()
+	}
+	dest := string(args[1])
+	keys := make([]string, len(args)-2)
+	for i, arg := range args[2:] {
+		keys[i] = string(arg)
+	}
+	if op == bitmap.OpNot && len(keys) != 1 {
+		return reply.GetStandardErrorReply("ERR BITOP NOT must be called with a single source key.")
+	}
+
+	handle := db.lockMgr.LockKeys(append([]string{dest}, keys...))
+	defer db.lockMgr.UnlockKeys(handle)
+
+	srcs := make([][]byte, len(keys))
+	for i, key := range keys {
+		val, _, errReply := db.getAsString(key)
+		if errReply != nil {
+			return errReply
+		}
+		srcs[i] = val
+	}
+	result := bitmap.Apply(op, srcs)
+
+	if len(result) == 0 {
+		db.Remove(dest)
+	} else {
+		db.PutEntity(dest, &database.DataEntity{Data: result})
+		db.Persist(dest)
+	}
+	db.addAof(utils.ToCmdLineWithName("BITOP", args...))
+	return reply.GetIntReply(int64(len(result)))
+}
+
+const (
+	bitfieldGet = iota
+	bitfieldSet
+	bitfieldIncrBy
+)
+
+// bitfieldOp is one GET, SET or INCRBY subcommand of BITFIELD
+type bitfieldOp struct {
+	kind     int
+	signed   bool
+	width    uint
+	offset   int64
+	value    int64 // the value of SET or the increment of INCRBY
+	overflow bitmap.Overflow
+}
+
+// parseBitfieldType parses a field type such as i16 or u8
+func parseBitfieldType(raw []byte) (signed bool, width uint, ok bool) {
+	if len(raw) < 2 {
+		return false, 0, false
+	}
+	switch raw[0] {
+	case 'i', 'I':
+		signed = true
+	case 'u', 'U':
+	default:
+		return false, 0, false
+	}
+	n, err := strconv.Atoi(string(raw[1:]))
+	if err != nil || n < 1 || (signed && n > 64) || (!signed && n > 63) {
+		return false, 0, false
+	}
+	return signed, uint(n), true
+}
+
+// parseBitfieldOps parses the subcommands of BITFIELD. With readOnly only GET is accepted
+func parseBitfieldOps(args [][]byte, readOnly bool) ([]bitfieldOp, resp.Reply) {
+	var ops []bitfieldOp
+	overflow := bitmap.OverflowWrap
+	for i := 0; i < len(args); {
+		name := strings.ToUpper(string(args[i]))
+		if name == "OVERFLOW" && !readOnly {
+			if i+1 >= len(args) {
+				return nil, reply.GetSyntaxErrReply()
+			}
+			switch strings.ToUpper(string(args[i+1])) {
+			case "WRAP":
+				overflow = bitmap.OverflowWrap
+			case "SAT":
+				overflow = bitmap.OverflowSat
+			case "FAIL":
+				overflow = bitmap.OverflowFail
+			default:
+				return nil, reply.GetStandardErrorReply("ERR Invalid OVERFLOW type specified")
+			}
+			i += 2
+			continue
+		}
+
+		op := bitfieldOp{overflow: overflow}
+		argc := 3
+		switch name {
+		case "GET":
+			op.kind = bitfieldGet
+		case "SET":
+			op.kind, argc = bitfieldSet, 4
+		case "INCRBY":
+			op.kind, argc = bitfieldIncrBy, 4
+		default:
+			if readOnly {
+				return nil, reply.GetStandardErrorReply("ERR BITFIELD_RO only supports the GET subcommand")
+			}
+			return nil, reply.GetSyntaxErrReply()
+		}
+		if readOnly && op.kind != bitfieldGet {
+			return nil, reply.GetStandardErrorReply("ERR BITFIELD_RO only supports the GET subcommand")
+		}
+		if i+argc > len(args) {
+			return nil, reply.GetSyntaxErrReply()
+		}
+
+		var ok bool
+		op.signed, op.width, ok = parseBitfieldType(args[i+1])
+		if !ok {
+			return nil, reply.GetStandardErrorReply("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+		}
+		var errReply resp.Reply
+		if op.offset, errReply = parseBitOffset(args[i+2], true, op.width); errReply != nil {
+			return nil, errReply
+		}
+		if argc == 4 {
+			value, err := strconv.ParseInt(string(args[i+3]), 10, 64)
+			if err != nil {
+				return nil, reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+			}
+			op.value = value
+		}
+		ops = append(ops, op)
+		i += argc
+	}
+	return ops, nil
+}
+
+// apply runs op against buf, which must be long enough for it to write.
+// It returns the reply of the subcommand and whether buf was written
+func (op *bitfieldOp) apply(buf []byte) (resp.Reply, bool) {
+	if op.signed {
+		old := bitmap.GetSigned(buf, op.offset, op.width)
+		switch op.kind {
+		case bitfieldGet:
+			return reply.GetIntReply(old), false
+		case bitfieldSet:
+			value, ok := bitmap.AddSigned(op.value, 0, op.width, op.overflow)
+			if !ok {
+				return reply.GetNullBulkReply(), false
+			}
+			bitmap.SetInteger(buf, op.offset, op.width, uint64(value))
+			return reply.GetIntReply(old), true
+		default:
+			value, ok := bitmap.AddSigned(old, op.value, op.width, op.overflow)
+			if !ok {
+				return reply.GetNullBulkReply(), false
+			}
+			bitmap.SetInteger(buf, op.offset, op.width, uint64(value))
+			return reply.GetIntReply(value), true
+		}
+	}
+
+	old := bitmap.GetUnsigned(buf, op.offset, op.width)
+	switch op.kind {
+	case bitfieldGet:
+		return reply.GetIntReply(int64(old)), false
+	case bitfieldSet:
+		value, ok := bitmap.AddUnsigned(uint64(op.value), 0, op.width, op.overflow)
+		if !ok {
+			return reply.GetNullBulkReply(), false
+		}
+		bitmap.SetInteger(buf, op.offset, op.width, value)
+		return reply.GetIntReply(int64(old)), true
+	default:
+		value, ok := bitmap.AddUnsigned(old, op.value, op.width, op.overflow)
+		if !ok {
+			return reply.GetNullBulkReply(), false
+		}
+		bitmap.SetInteger(buf, op.offset, op.width, value)
+		return reply.GetIntReply(int64(value)), true
+	}
+}
+
+// bitfieldGeneric runs the subcommands of BITFIELD and BITFIELD_RO
+func bitfieldGeneric(db *DB, args [][]byte, readOnly bool) resp.Reply {
+	key := string(args[0])
+	ops, errReply := parseBitfieldOps(args[1:], readOnly)
+	if errReply != nil {
+		return errReply
+	}
+
+	// 只读时与 GETBIT 一样不加锁
+	size := int64(0)
+	for _, op := range ops {
+		if op.kind != bitfieldGet {
+			size = max(size, (op.offset+int64(op.width)+7)/8)
+		}
+	}
+	if size == 0 {
+		val, _, errReply := db.getAsString(key)
+		if errReply != nil {
+			return errReply
+		}
+		replies := make([]resp.Reply, len(ops))
+		for i := range ops {
+			replies[i], _ = ops[i].apply(val)
+		}
+		return reply.GetMultiRawReply(replies)
+	}
+
+	var result resp.Reply
+	db.WithKeyLock(key, func() {
+		old, _, errReply := db.getAsString(key)
+		if errReply != nil {
+			result = errReply
+			return
+		}
+		// 在副本上修改, 读者可能仍持有旧值
+		newVal := make([]byte, max(int64(len(old)), size))
+		copy(newVal, old)
+
+		changed := false
+		replies := make([]resp.Reply, len(ops))
+		for i := range ops {
+			var written bool
+			replies[i], written = ops[i].apply(newVal)
+			changed = changed || written
+		}
+		if changed {
+			db.PutEntity(key, &database.DataEntity{Data: newVal})
+			db.addAof(utils.ToCmdLineWithName("BITFIELD", args...))
+		}
+		result = reply.GetMultiRawReply(replies)
+	})
+	return result
+}
+
+// execBitField reads and writes integers of arbitrary width at arbitrary bit offsets of the string stored at key
+// BITFIELD key [GET type offset] [SET type offset value] [INCRBY type offset increment] [OVERFLOW WRAP|SAT|FAIL] ...
+func execBitField(db *DB, args [][]byte) resp.Reply {
+	return bitfieldGeneric(db, args, false)
+}
+
+// execBitFieldRO is the read-only variant of BITFIELD
+// BITFIELD_RO key [GET type offset] ...
+func execBitFieldRO(db *DB, args [][]byte) resp.Reply {
+	return bitfieldGeneric(db, args, true)
+}
+
+func init() {
+	RegisterCommand("SETBIT", execSetBit, 4)           // SETBIT key offset value
+	RegisterCommand("GETBIT", execGetBit, 3)           // GETBIT key offset
+	RegisterCommand("BITCOUNT", execBitCount, -2)      // BITCOUNT key [start end [BYTE|BIT]]
+	RegisterCommand("BITPOS", execBitPos, -3)          // BITPOS key bit [start [end [BYTE|BIT]]]
+	RegisterCommand("BITOP", execBitOp, -4)            // BITOP AND|OR|XOR|NOT destkey key [key ...]
+	RegisterCommand("BITFIELD", execBitField, -2)      // BITFIELD key [GET|SET|INCRBY type offset [value]] [OVERFLOW WRAP|SAT|FAIL] ...
+	RegisterCommand("BITFIELD_RO", execBitFieldRO, -2) // BITFIELD_RO key [GET type offset] ...
+}
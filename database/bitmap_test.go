@@ -0,0 +1,95 @@
+package database
+
+import "testing"
+
+func TestBitCount(t *testing.T) {
+	foobar := [][]string{{"SET", "k", "foobar"}}
+	runCmdCases(t, []cmdCase{
+		{"whole string", foobar, []string{"BITCOUNT", "k"}, ":26"},
+		{"first byte", foobar, []string{"BITCOUNT", "k", "0", "0"}, ":4"},
+		{"second byte", foobar, []string{"BITCOUNT", "k", "1", "1"}, ":6"},
+		{"explicit BYTE", foobar, []string{"BITCOUNT", "k", "1", "1", "BYTE"}, ":6"},
+		{"negative bytes", foobar, []string{"BITCOUNT", "k", "-2", "-1"}, ":7"},
+		{"bytes past the end", foobar, []string{"BITCOUNT", "k", "0", "100"}, ":26"},
+		{"start after end", foobar, []string{"BITCOUNT", "k", "3", "1"}, ":0"},
+		{"bit range", foobar, []string{"BITCOUNT", "k", "5", "30", "BIT"}, ":17"},
+		{"negative bit range", foobar, []string{"BITCOUNT", "k", "-8", "-1", "bit"}, ":4"},
+		{"single bit", foobar, []string{"BITCOUNT", "k", "1", "1", "BIT"}, ":1"},
+		{"missing key", nil, []string{"BITCOUNT", "nokey"}, ":0"},
+		{"start without end", foobar, []string{"BITCOUNT", "k", "0"}, "-ERR syntax error"},
+		{"bad unit", foobar, []string{"BITCOUNT", "k", "0", "1", "WORD"}, "-ERR syntax error"},
+		{"wrong type", [][]string{{"SADD", "k", "a"}}, []string{"BITCOUNT", "k"},
+			"-WRONGTYPE Operation against a key holding the wrong kind of value"},
+	})
+}
+
+func TestBitPos(t *testing.T) {
+	ones := [][]string{{"SET", "k", "\xff\xf0\x00"}}
+	mixed := [][]string{{"SET", "k", "\x00\xff\xf0"}}
+	zeros := [][]string{{"SET", "k", "\x00\x00\x00"}}
+	full := [][]string{{"SET", "k", "\xff\xff\xff"}}
+	runCmdCases(t, []cmdCase{
+		{"first clear bit", ones, []string{"BITPOS", "k", "0"}, ":12"},
+		{"first set bit", mixed, []string{"BITPOS", "k", "1", "0"}, ":8"},
+		{"set bit from byte", mixed, []string{"BITPOS", "k", "1", "2"}, ":16"},
+		{"set bit in byte range", mixed, []string{"BITPOS", "k", "1", "2", "-1", "BYTE"}, ":16"},
+		{"set bit in bit range", mixed, []string{"BITPOS", "k", "1", "7", "15", "BIT"}, ":8"},
+		{"no set bit", zeros, []string{"BITPOS", "k", "1"}, ":-1"},
+		{"no set bit in bit range", zeros, []string{"BITPOS", "k", "1", "7", "-3", "BIT"}, ":-1"},
+		// 只查找 0 且没有给出 end 时, 字符串右边视为补了 0
+		{"clear bit past the end", full, []string{"BITPOS", "k", "0"}, ":24"},
+		{"clear bit past the end from start", full, []string{"BITPOS", "k", "0", "1"}, ":24"},
+		{"clear bit with end", full, []string{"BITPOS", "k", "0", "0", "-1"}, ":-1"},
+		{"clear bit with bit end", full, []string{"BITPOS", "k", "0", "8", "23", "BIT"}, ":-1"},
+		{"start past the end", mixed, []string{"BITPOS", "k", "1", "10"}, ":-1"},
+		{"missing key clear", nil, []string{"BITPOS", "nokey", "0"}, ":0"},
+		{"missing key set", nil, []string{"BITPOS", "nokey", "1"}, ":-1"},
+		{"bad bit", mixed, []string{"BITPOS", "k", "2"}, "-ERR The bit argument must be 1 or 0."},
+	})
+}
+
+func TestBitField(t *testing.T) {
+	// INCRBY u2 100 1 与 INCRBY u2 102 1 分别按 WRAP 和 SAT 溢出
+	incrWrapSat := []string{"BITFIELD", "k", "INCRBY", "u2", "100", "1", "OVERFLOW", "SAT", "INCRBY", "u2", "102", "1"}
+	incrFail := []string{"BITFIELD", "k", "OVERFLOW", "FAIL", "INCRBY", "u2", "102", "1"}
+	runCmdCases(t, []cmdCase{
+		{"incrby and get", nil, []string{"BITFIELD", "k", "INCRBY", "i5", "100", "1", "GET", "u4", "0"}, "*2 :1 :0"},
+		{"wrap and sat once", nil, incrWrapSat, "*2 :1 :1"},
+		{"wrap and sat at the top", [][]string{incrWrapSat, incrWrapSat}, incrWrapSat, "*2 :3 :3"},
+		{"wrap and sat past the top", [][]string{incrWrapSat, incrWrapSat, incrWrapSat}, incrWrapSat, "*2 :0 :3"},
+		{"fail at the top", [][]string{incrFail, incrFail}, incrFail, "*1 :3"},
+		{"fail past the top", [][]string{incrFail, incrFail, incrFail}, incrFail, "*1 $-1"},
+		{"fail keeps the value", [][]string{incrFail, incrFail, incrFail, incrFail},
+			[]string{"BITFIELD_RO", "k", "GET", "u2", "102"}, "*1 :3"},
+
+		{"signed wrap", nil, []string{"BITFIELD", "k", "SET", "i8", "0", "127", "INCRBY", "i8", "0", "1"}, "*2 :0 :-128"},
+		{"signed sat", nil, []string{"BITFIELD", "k", "SET", "i8", "0", "127", "OVERFLOW", "SAT", "INCRBY", "i8", "0", "1"}, "*2 :0 :127"},
+		{"signed fail", nil, []string{"BITFIELD", "k", "SET", "i8", "0", "127", "OVERFLOW", "FAIL", "INCRBY", "i8", "0", "1", "GET", "i8", "0"},
+			"*3 :0 $-1 :127"},
+		{"signed sat below", nil, []string{"BITFIELD", "k", "OVERFLOW", "SAT", "INCRBY", "i4", "0", "-100"}, "*1 :-8"},
+		{"signed wrap below", nil, []string{"BITFIELD", "k", "INCRBY", "i4", "0", "-9"}, "*1 :7"},
+		{"signed sat above from negative", [][]string{{"BITFIELD", "k", "SET", "i4", "0", "-1"}},
+			[]string{"BITFIELD", "k", "OVERFLOW", "SAT", "INCRBY", "i4", "0", "100"}, "*1 :7"},
+		{"i64 wrap", [][]string{{"BITFIELD", "k", "SET", "i64", "0", "9223372036854775807"}},
+			[]string{"BITFIELD", "k", "INCRBY", "i64", "0", "1"}, "*1 :-9223372036854775808"},
+		{"i64 sat from negative", [][]string{{"BITFIELD", "k", "SET", "i64", "0", "-1"}},
+			[]string{"BITFIELD", "k", "OVERFLOW", "SAT", "INCRBY", "i64", "0", "9223372036854775807"}, "*1 :9223372036854775806"},
+		{"unsigned wrap below", nil, []string{"BITFIELD", "k", "INCRBY", "u4", "0", "-1"}, "*1 :15"},
+		{"unsigned sat below", nil, []string{"BITFIELD", "k", "OVERFLOW", "SAT", "INCRBY", "u4", "0", "-1"}, "*1 :0"},
+		{"unsigned fail below", nil, []string{"BITFIELD", "k", "OVERFLOW", "FAIL", "INCRBY", "u4", "0", "-1"}, "*1 $-1"},
+
+		{"set wrap", nil, []string{"BITFIELD", "k", "SET", "u8", "0", "300", "GET", "u8", "0"}, "*2 :0 :44"},
+		{"set sat", nil, []string{"BITFIELD", "k", "OVERFLOW", "SAT", "SET", "u8", "0", "300", "GET", "u8", "0"}, "*2 :0 :255"},
+		{"set fail", nil, []string{"BITFIELD", "k", "OVERFLOW", "FAIL", "SET", "u8", "0", "300", "GET", "u8", "0"}, "*2 $-1 :0"},
+		{"set returns the old value", [][]string{{"SET", "k", "A"}}, []string{"BITFIELD", "k", "SET", "u8", "0", "66", "GET", "u8", "0"}, "*2 :65 :66"},
+		{"offset in units of the type", nil, []string{"BITFIELD", "k", "SET", "u8", "#1", "200", "GET", "u8", "8"}, "*2 :0 :200"},
+
+		{"get signed", [][]string{{"SET", "k", "\xff"}}, []string{"BITFIELD_RO", "k", "GET", "i8", "0", "GET", "u4", "4"}, "*2 :-1 :15"},
+		{"get past the end", [][]string{{"SET", "k", "\xff"}}, []string{"BITFIELD_RO", "k", "GET", "u8", "4"}, "*1 :240"},
+		{"read only rejects set", nil, []string{"BITFIELD_RO", "k", "SET", "u8", "0", "1"},
+			"-ERR BITFIELD_RO only supports the GET subcommand"},
+		{"bad overflow", nil, []string{"BITFIELD", "k", "OVERFLOW", "CLAMP", "GET", "u8", "0"}, "-ERR Invalid OVERFLOW type specified"},
+		{"u64 rejected", nil, []string{"BITFIELD", "k", "GET", "u64", "0"},
+			"-ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is."},
+	})
+}
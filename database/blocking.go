@@ -0,0 +1,104 @@
+package database
+
+import (
+	"Redis_Go/interface/resp"
+	"sync"
+	"time"
+)
+
+// blockingReply is returned by a command that has nothing to serve yet and was asked to block, like XREAD BLOCK.
+// Exec then waits without holding any key lock, running retry again whenever one of keys is written,
+// until it serves something or timeout expires.
+//
+// Commands run from a Lua script don't block, they get timedOut right away as in Redis
+type blockingReply struct {
+	keys     []string
+	timeout  time.Duration // 0 blocks forever
+	retry    func() resp.Reply
+	timedOut resp.Reply
+}
+
+func (r *blockingReply) ToBytes() []byte {
+	return r.timedOut.ToBytes()
+}
+
+// keyWaiters tracks the blocked clients waiting for each key to be written
+type keyWaiters struct {
+	mu      sync.Mutex
+	waiters map[string]map[chan struct{}]struct{}
+}
+
+func newKeyWaiters() *keyWaiters {
+	return &keyWaiters{waiters: make(map[string]map[chan struct{}]struct{})}
+}
+
+func (w *keyWaiters) add(keys []string, ch chan struct{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, key := range keys {
+		set, ok := w.waiters[key]
+		if !ok {
+			set = make(map[chan struct{}]struct{})
+			w.waiters[key] = set
+		}
+		set[ch] = struct{}{}
+	}
+}
+
+func (w *keyWaiters) remove(keys []string, ch chan struct{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, key := range keys {
+		if set, ok := w.waiters[key]; ok {
+			delete(set, ch)
+			if len(set) == 0 {
+				delete(w.waiters, key)
+			}
+		}
+	}
+}
+
+// signal wakes the clients waiting for key
+func (w *keyWaiters) signal(key string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for ch := range w.waiters[key] {
+		// 通道带 1 个缓冲, 已有未处理的通知时不必重复发送
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// signalKey wakes the clients blocked on key, to be called after writing it
+func (db *DB) signalKey(key string) {
+	db.waiters.signal(key)
+}
+
+// block waits until the command of b serves something or times out
+func (db *DB) block(b *blockingReply) resp.Reply {
+	var deadline <-chan time.Time
+	if b.timeout > 0 {
+		timer := time.NewTimer(b.timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	ch := make(chan struct{}, 1)
+	db.waiters.add(b.keys, ch)
+	defer db.waiters.remove(b.keys, ch)
+	for {
+		// 先登记再重试, 不会错过两者之间的写入
+		if result := b.retry(); result != nil {
+			return result
+		}
+		select {
+		case <-ch:
+		case <-deadline:
+			return b.timedOut
+		case <-db.stopSweep:
+			return b.timedOut
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package database
+
+import (
+	"Redis_Go/datastruct/bloom"
+	"Redis_Go/interface/database"
+	"Redis_Go/interface/resp"
+	"Redis_Go/lib/utils"
+	"Redis_Go/resp/reply"
+	"strconv"
+	"strings"
+)
+
+// getAsBloom returns the Bloom filter stored at key, errReply is a WRONGTYPE error if the key holds another type
+func (db *DB) getAsBloom(key string) (f *bloom.Filter, exists bool, errReply resp.Reply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, false, nil
+	}
+	f, ok := entity.Data.(*bloom.Filter)
+	if !ok {
+		return nil, true, reply.GetWrongTypeErrReply()
+	}
+	return f, true, nil
+}
+
+// execBFReserve creates an empty Bloom filter holding capacity items with the given false positive rate
+// before it scales. Each new sub-filter has expansion times the capacity of the previous one,
+// NONSCALING filters refuse items once full instead
+// BF.RESERVE key error_rate capacity [EXPANSION expansion] [NONSCALING]
+func execBFReserve(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	errorRate, err := strconv.ParseFloat(string(args[1]), 64)
+	if err != nil {
+		return reply.GetStandardErrorReply("ERR bad error rate")
+	}
+	capacity, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return reply.GetStandardErrorReply("ERR bad capacity")
+	}
+	if capacity <= 0 {
+		return reply.GetStandardErrorReply("ERR (capacity should be larger than 0)")
+	}
+
+	expansion, expansionGiven, nonScaling := int64(bloom.DefaultExpansion), false, false
+	for i := 3; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		switch {
+		case option == "NONSCALING":
+			nonScaling = true
+		case option == "EXPANSION" && i+1 < len(args):
+			if expansion, err = strconv.ParseInt(string(args[i+1]), 10, 64); err != nil || expansion < 1 {
+				return reply.GetStandardErrorReply("ERR expansion should be greater or equal to 1")
+			}
+			expansionGiven = true
+			i++
+		default:
+			return reply.GetSyntaxErrReply()
+		}
+	}
+	if nonScaling {
+		if expansionGiven {
+			return reply.GetStandardErrorReply("ERR Nonscaling filters cannot expand")
+		}
+		expansion = 0
+	}
+	if err := bloom.Validate(errorRate, uint64(capacity), uint64(expansion)); err != nil {
+		return reply.GetStandardErrorReply(err.Error())
+	}
+
+	var result resp.Reply
+	db.WithKeyLock(key, func() {
+		if _, exists := db.GetEntity(key); exists {
+			result = reply.GetStandardErrorReply("ERR item exists")
+			return
+		}
+		db.PutEntity(key, &database.DataEntity{Data: bloom.New(errorRate, uint64(capacity), uint64(expansion))})
+		db.addAof(utils.ToCmdLineWithName("BF.RESERVE", args...))
+		result = reply.GetOKReply()
+	})
+	return result
+}
+
+// bfAdd adds the items to the Bloom filter at key, creating it with the default settings if needed,
+// and returns 1 for each item that wasn't in the filter and 0 for each that may have been
+func bfAdd(db *DB, cmdName string, args [][]byte) ([]resp.Reply, resp.Reply) {
+	key := string(args[0])
+	var results []resp.Reply
+	var errReply resp.Reply
+	db.WithKeyLock(key, func() {
+		f, exists, err := db.getAsBloom(key)
+		if err != nil {
+			errReply = err
+			return
+		}
+		if !exists {
+			f = bloom.New(bloom.DefaultErrorRate, bloom.DefaultCapacity, bloom.DefaultExpansion)
+			db.PutEntity(key, &database.DataEntity{Data: f})
+		}
+
+		changed := !exists
+		results = make([]resp.Reply, len(args)-1)
+		for i, item := range args[1:] {
+			added, err := f.Add(item)
+			switch {
+			case err != nil:
+				results[i] = reply.GetStandardErrorReply(err.Error())
+			case added:
+				results[i] = reply.GetIntReply(1)
+				changed = true
+			default:
+				results[i] = reply.GetIntReply(0)
+			}
+		}
+		if changed {
+			db.addAof(utils.ToCmdLineWithName(cmdName, args...))
+		}
+	})
+	return results, errReply
+}
+
+// execBFAdd adds an item to a Bloom filter
+// BF.ADD key item
+func execBFAdd(db *DB, args [][]byte) resp.Reply {
+	results, errReply := bfAdd(db, "BF.ADD", args)
+	if errReply != nil {
+		return errReply
+	}
+	return results[0]
+}
+
+// execBFMAdd adds items to a Bloom filter
+// BF.MADD key item [item ...]
+func execBFMAdd(db *DB, args [][]byte) resp.Reply {
+	results, errReply := bfAdd(db, "BF.MADD", args)
+	if errReply != nil {
+		return errReply
+	}
+	return reply.GetMultiRawReply(results)
+}
+
+// bfExists returns 1 for each item that may be in the Bloom filter at key and 0 for each that isn't for sure
+func bfExists(db *DB, args [][]byte) ([]int64, resp.Reply) {
+	key := string(args[0])
+	results := make([]int64, len(args)-1)
+	var errReply resp.Reply
+	db.WithRKeyLock(key, func() {
+		f, exists, err := db.getAsBloom(key)
+		if err != nil || !exists {
+			errReply = err
+			return
+		}
+		for i, item := range args[1:] {
+			if f.Exists(item) {
+				results[i] = 1
+			}
+		}
+	})
+	return results, errReply
+}
+
+// execBFExists checks whether an item may be in a Bloom filter
+// BF.EXISTS key item
+func execBFExists(db *DB, args [][]byte) resp.Reply {
+	results, errReply := bfExists(db, args)
+	if errReply != nil {
+		return errReply
+	}
+	return reply.GetIntReply(results[0])
+}
+
+// execBFMExists checks whether items may be in a Bloom filter
+// BF.MEXISTS key item [item ...]
+func execBFMExists(db *DB, args [][]byte) resp.Reply {
+	results, errReply := bfExists(db, args)
+	if errReply != nil {
+		return errReply
+	}
+	replies := make([]resp.Reply, len(results))
+	for i, result := range results {
+		replies[i] = reply.GetIntReply(result)
+	}
+	return reply.GetMultiRawReply(replies)
+}
+
+func init() {
+	RegisterCommand("BF.RESERVE", execBFReserve, -4) // key error_rate capacity [EXPANSION expansion] [NONSCALING]
+	RegisterCommand("BF.ADD", execBFAdd, 3)          // key item
+	RegisterCommand("BF.MADD", execBFMAdd, -3)       // key item [item ...]
+	RegisterCommand("BF.EXISTS", execBFExists, 3)    // key item
+	RegisterCommand("BF.MEXISTS", execBFMExists, -3) // key item [item ...]
+}
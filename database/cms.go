@@ -0,0 +1,207 @@
+package database
+
+import (
+	"Redis_Go/datastruct/cms"
+	"Redis_Go/interface/database"
+	"Redis_Go/interface/resp"
+	"Redis_Go/lib/utils"
+	"Redis_Go/resp/reply"
+	"strconv"
+	"strings"
+)
+
+// maxCMSCounters caps the size of a Count-Min sketch, 1GB of counters
+const maxCMSCounters = 1 << 27
+
+// getAsCMS returns the Count-Min sketch stored at key, errReply is a WRONGTYPE error if the key holds another type
+func (db *DB) getAsCMS(key string) (s *cms.Sketch, exists bool, errReply resp.Reply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, false, nil
+	}
+	s, ok := entity.Data.(*cms.Sketch)
+	if !ok {
+		return nil, true, reply.GetWrongTypeErrReply()
+	}
+	return s, true, nil
+}
+
+// cmsInit stores a new sketch with the given dimensions at key, unless the key exists
+func cmsInit(db *DB, cmdName string, args [][]byte, width, depth uint64) resp.Reply {
+	if depth > 0 && width > maxCMSCounters/depth {
+		return reply.GetStandardErrorReply("ERR CMS: width * depth is too large")
+	}
+	key := string(args[0])
+
+	var result resp.Reply
+	db.WithKeyLock(key, func() {
+		if _, exists := db.GetEntity(key); exists {
+			result = reply.GetStandardErrorReply("ERR CMS: key already exists")
+			return
+		}
+		db.PutEntity(key, &database.DataEntity{Data: cms.New(width, depth)})
+		db.addAof(utils.ToCmdLineWithName(cmdName, args...))
+		result = reply.GetOKReply()
+	})
+	return result
+}
+
+// execCMSInitByDim creates a Count-Min sketch with the given dimensions
+// CMS.INITBYDIM key width depth
+func execCMSInitByDim(db *DB, args [][]byte) resp.Reply {
+	width, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil || width == 0 {
+		return reply.GetStandardErrorReply("ERR CMS: invalid width")
+	}
+	depth, err := strconv.ParseUint(string(args[2]), 10, 64)
+	if err != nil || depth == 0 {
+		return reply.GetStandardErrorReply("ERR CMS: invalid depth")
+	}
+	return cmsInit(db, "CMS.INITBYDIM", args, width, depth)
+}
+
+// execCMSInitByProb creates a Count-Min sketch whose estimates exceed the true counts by more than
+// error times the total count with at most the given probability
+// CMS.INITBYPROB key error probability
+func execCMSInitByProb(db *DB, args [][]byte) resp.Reply {
+	overestimation, err := strconv.ParseFloat(string(args[1]), 64)
+	if err != nil || overestimation <= 0 || overestimation >= 1 {
+		return reply.GetStandardErrorReply("ERR CMS: invalid overestimation value")
+	}
+	probability, err := strconv.ParseFloat(string(args[2]), 64)
+	if err != nil || probability <= 0 || probability >= 1 {
+		return reply.GetStandardErrorReply("ERR CMS: invalid prob value")
+	}
+	width, depth := cms.DimensionsForError(overestimation, probability)
+	return cmsInit(db, "CMS.INITBYPROB", args, width, depth)
+}
+
+// execCMSIncrBy increments the counts of the items and returns their new estimates
+// CMS.INCRBY key item increment [item increment ...]
+func execCMSIncrBy(db *DB, args [][]byte) resp.Reply {
+	if len(args)%2 != 1 {
+		return reply.GetArgNumErrReply("cms.incrby")
+	}
+	key := string(args[0])
+	increments := make([]uint64, 0, len(args)/2)
+	for i := 2; i < len(args); i += 2 {
+		increment, err := strconv.ParseUint(string(args[i]), 10, 64)
+		if err != nil {
+			return reply.GetStandardErrorReply("ERR CMS: Cannot parse number")
+		}
+		increments = append(increments, increment)
+	}
+
+	var result resp.Reply
+	db.WithKeyLock(key, func() {
+		s, exists, errReply := db.getAsCMS(key)
+		if errReply != nil {
+			result = errReply
+			return
+		}
+		if !exists {
+			result = reply.GetStandardErrorReply("ERR CMS: key does not exist")
+			return
+		}
+		replies := make([]resp.Reply, len(increments))
+		for i, increment := range increments {
+			replies[i] = reply.GetIntReply(int64(min(s.IncrBy(args[1+2*i], increment), 1<<63-1)))
+		}
+		db.addAof(utils.ToCmdLineWithName("CMS.INCRBY", args...))
+		result = reply.GetMultiRawReply(replies)
+	})
+	return result
+}
+
+// execCMSQuery returns the estimated counts of the items
+// CMS.QUERY key item [item ...]
+func execCMSQuery(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+
+	var result resp.Reply
+	db.WithRKeyLock(key, func() {
+		s, exists, errReply := db.getAsCMS(key)
+		if errReply != nil {
+			result = errReply
+			return
+		}
+		if !exists {
+			result = reply.GetStandardErrorReply("ERR CMS: key does not exist")
+			return
+		}
+		replies := make([]resp.Reply, len(args)-1)
+		for i, item := range args[1:] {
+			replies[i] = reply.GetIntReply(int64(min(s.Query(item), 1<<63-1)))
+		}
+		result = reply.GetMultiRawReply(replies)
+	})
+	return result
+}
+
+// execCMSMerge sets the sketch at destination to the sum of the sources, multiplied by their weights.
+// All of them must exist and have the same dimensions
+// CMS.MERGE destination numKeys source [source ...] [WEIGHTS weight [weight ...]]
+func execCMSMerge(db *DB, args [][]byte) resp.Reply {
+	dest := string(args[0])
+	numKeys, err := strconv.Atoi(string(args[1]))
+	if err != nil || numKeys < 1 {
+		return reply.GetStandardErrorReply("ERR CMS: invalid numkeys")
+	}
+	if len(args) < 2+numKeys {
+		return reply.GetArgNumErrReply("cms.merge")
+	}
+	srcKeys := make([]string, numKeys)
+	for i := range srcKeys {
+		srcKeys[i] = string(args[2+i])
+	}
+	weights := make([]uint64, numKeys)
+	for i := range weights {
+		weights[i] = 1
+	}
+	if rest := args[2+numKeys:]; len(rest) > 0 {
+		if strings.ToUpper(string(rest[0])) != "WEIGHTS" || len(rest) != 1+numKeys {
+			return reply.GetSyntaxErrReply()
+		}
+		for i, arg := range rest[1:] {
+			if weights[i], err = strconv.ParseUint(string(arg), 10, 64); err != nil {
+				return reply.GetStandardErrorReply("ERR CMS: invalid weight value")
+			}
+		}
+	}
+
+	handle := db.lockMgr.LockKeys(append([]string{dest}, srcKeys...))
+	defer db.lockMgr.UnlockKeys(handle)
+
+	destSketch, exists, errReply := db.getAsCMS(dest)
+	if errReply != nil {
+		return errReply
+	}
+	if !exists {
+		return reply.GetStandardErrorReply("ERR CMS: key does not exist")
+	}
+	sources := make([]*cms.Sketch, numKeys)
+	for i, key := range srcKeys {
+		src, exists, errReply := db.getAsCMS(key)
+		if errReply != nil {
+			return errReply
+		}
+		if !exists {
+			return reply.GetStandardErrorReply("ERR CMS: key does not exist")
+		}
+		if src.Width() != destSketch.Width() || src.Depth() != destSketch.Depth() {
+			return reply.GetStandardErrorReply("ERR CMS: width/depth is not equal")
+		}
+		sources[i] = src
+	}
+	destSketch.Merge(sources, weights)
+	db.addAof(utils.ToCmdLineWithName("CMS.MERGE", args...))
+	return reply.GetOKReply()
+}
+
+func init() {
+	RegisterCommand("CMS.INITBYDIM", execCMSInitByDim, 4)   // key width depth
+	RegisterCommand("CMS.INITBYPROB", execCMSInitByProb, 4) // key error probability
+	RegisterCommand("CMS.INCRBY", execCMSIncrBy, -4)        // key item increment [item increment ...]
+	RegisterCommand("CMS.QUERY", execCMSQuery, -3)          // key item [item ...]
+	RegisterCommand("CMS.MERGE", execCMSMerge, -4)          // destination numKeys source [source ...] [WEIGHTS weight [weight ...]]
+}
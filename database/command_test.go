@@ -0,0 +1,35 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+// cmdCase runs setup on an empty DB, then cmd, and expects the RESP reply of cmd with CRLF replaced by spaces.
+// The expected replies are those of Redis 7
+type cmdCase struct {
+	name  string
+	setup [][]string
+	cmd   []string
+	want  string
+}
+
+func execLine(db *DB, line ...string) string {
+	args := make([][]byte, len(line))
+	for i, arg := range line {
+		args[i] = []byte(arg)
+	}
+	return strings.TrimSpace(strings.ReplaceAll(string(db.Exec(nil, args).ToBytes()), "\r\n", " "))
+}
+
+func runCmdCases(t *testing.T, cases []cmdCase) {
+	for _, tc := range cases {
+		db := NewDB()
+		for _, line := range tc.setup {
+			execLine(db, line...)
+		}
+		if got := execLine(db, tc.cmd...); got != tc.want {
+			t.Errorf("%s: %s replied %q, want %q", tc.name, strings.Join(tc.cmd, " "), got, tc.want)
+		}
+	}
+}
@@ -10,10 +10,13 @@ import (
 	"Redis_Go/resp/reply"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 type Database struct {
 	dbSet      []DatabaseInterface.Database
+	mu         sync.RWMutex // guards the elements of dbSet, which SWAPDB swaps
+	aofMu      sync.Mutex   // held while a DB index is read to log a command, so that SWAPDB can't change it meanwhile
 	aofHandler *aof.AofHandler
 }
 
@@ -79,6 +82,8 @@ func CreateDatabases(args ...string) DatabaseInterface.Database {
             sdb := db
             if sdb, ok := sdb.(*DB); ok {
                 sdb.addAof = func(line CmdLine) {
+                    databases.aofMu.Lock()
+                    defer databases.aofMu.Unlock()
                     aofHandler.AddAof(sdb.index, line)
                 }
             }
@@ -122,8 +127,16 @@ func (d *Database) Exec(client resp.Connection, args [][]byte) (result resp.Repl
         return execSelect(client, d, args[1:])
     }
 
+    // 处理跨 DB 的命令
+    if cmd, ok := multiDBCmdTable[cmdName]; ok {
+        if !validateArgCnt(cmd.argCnt, args) {
+            return reply.GetArgNumErrReply(cmdName)
+        }
+        return cmd.exec(client, d, args[1:])
+    }
+
     // 执行命令
-    db := d.dbSet[client.GetDBIndex()]
+    db := d.getDB(client.GetDBIndex())
     return db.Exec(client, args)
 }
 
@@ -6,19 +6,56 @@ import (
 	"Redis_Go/datastruct/zset"
 	"Redis_Go/interface/database"
 	"Redis_Go/interface/resp"
+	"Redis_Go/lib/utils"
 	"Redis_Go/resp/reply"
 	"runtime"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// dataDictShards is the number of shards of the keyspace dict
+	dataDictShards = 1024
+	// auxDictShards is the number of shards of the dicts that only hold some of the keys
+	auxDictShards = 64
 )
 
 type DB struct {
-	index   int
-	data    dict.Dict
-	addAof  func(CmdLine)
-	lockMgr *KeyLockManager
+	index     int
+	lockOrder int // DBs take key locks in several DBs in this order, fixed unlike index which SWAPDB changes
+	dicts     atomic.Pointer[dbDicts]
+	addAof    func(CmdLine)
+	lockMgr   *KeyLockManager
+	waiters   *keyWaiters // clients blocked until a key is written
+	stopSweep chan struct{}
+	closeOnce sync.Once
+}
+
+// dbDicts holds the dicts of a DB. FLUSHDB and FLUSHALL replace them together in a single swap, so a method
+// that loads them once never sees the keys of one generation with the expiration times of another
+type dbDicts struct {
+	data        dict.Dict
+	ttlMap      dict.Dict // key -> expiration time.Time
+	hashTTLKeys dict.Dict // keys of hashes that have fields with an expiration time
+}
+
+func newDBDicts() *dbDicts {
+	return &dbDicts{
+		data:        dict.GetConcurrentDict(dataDictShards),
+		ttlMap:      dict.GetConcurrentDict(auxDictShards),
+		hashTTLKeys: dict.GetConcurrentDict(auxDictShards),
+	}
+}
+
+// clear empties the dicts, which must have been swapped out of their DB
+func (d *dbDicts) clear() {
+	d.data.Clear()
+	d.ttlMap.Clear()
+	d.hashTTLKeys.Clear()
 }
 
 func NewDB(dbIndex ...int) *DB {
@@ -27,13 +64,18 @@ func NewDB(dbIndex ...int) *DB {
 		idx = dbIndex[0]
 	}
 
-	return &DB{
-		index: idx,
-		data:  dict.GetSyncDict(),
+	db := &DB{
+		index:     idx,
+		lockOrder: idx,
 		addAof: func(line CmdLine) {
 		},
-		lockMgr: NewKeyLockManager(),
+		lockMgr:   NewKeyLockManager(),
+		waiters:   newKeyWaiters(),
+		stopSweep: make(chan struct{}),
 	}
+	db.dicts.Store(newDBDicts())
+	go db.sweepHashFieldsLoop()
+	return db
 }
 
 type ExecFunc func(db *DB, args [][]byte) resp.Reply
@@ -49,7 +91,11 @@ func (db *DB) Exec(c resp.Connection, cmdLine CmdLine) resp.Reply {
 	if !validateArgCnt(cmd.argCnt, cmdLine) {
 		return reply.GetArgNumErrReply(cmdName)
 	}
-	return cmd.exec(db, cmdLine[1:])
+	result := cmd.exec(db, cmdLine[1:])
+	if blocking, ok := result.(*blockingReply); ok {
+		return db.block(blocking)
+	}
+	return result
 }
 
 // ExecWithoutLock 执行命令但不获取键级锁（用于 Lua 脚本内部调用）
@@ -63,7 +109,12 @@ func (db *DB) ExecWithoutLock(cmdLine CmdLine) resp.Reply {
 	if !validateArgCnt(cmd.argCnt, cmdLine) {
 		return reply.GetArgNumErrReply(cmdName)
 	}
-	return cmd.exec(db, cmdLine[1:])
+	result := cmd.exec(db, cmdLine[1:])
+	// 脚本持有键锁, 不能阻塞
+	if blocking, ok := result.(*blockingReply); ok {
+		return blocking.timedOut
+	}
+	return result
 }
 
 func validateArgCnt(argCnt int, args [][]byte) bool {
@@ -75,35 +126,69 @@ func validateArgCnt(argCnt int, args [][]byte) bool {
 	}
 }
 
-// GetEntity returns DataEntity bind to the given key
+// GetEntity returns DataEntity bind to the given key, and records the access
 func (db *DB) GetEntity(key string) (*database.DataEntity, bool) {
-	raw, ok := db.data.Get(key)
+	entity, ok := db.peekEntity(key)
+	if ok {
+		touchEntity(entity)
+	}
+	return entity, ok
+}
+
+// peekEntity returns DataEntity bind to the given key without recording the access,
+// for introspection commands like OBJECT that shouldn't change what they report
+func (db *DB) peekEntity(key string) (*database.DataEntity, bool) {
+	raw, ok := db.dicts.Load().data.Get(key)
 	if !ok {
 		return nil, false
 	}
+	if db.IsExpired(key) {
+		db.removeExpired(key)
+		return nil, false
+	}
 	entity, _ := raw.(*database.DataEntity)
 	return entity, true
 }
 
+// removeExpired deletes an expired key. Readers get here without holding the write lock of key,
+// so the key is only deleted if the lock is free or already held by this goroutine, and if it has
+// still expired once locked: a writer may have replaced the value meanwhile. Otherwise a later access deletes it
+func (db *DB) removeExpired(key string) {
+	lock := db.lockMgr.TryLock(key)
+	if lock == nil {
+		return
+	}
+	defer db.lockMgr.Unlock(lock)
+	if db.IsExpired(key) {
+		db.Remove(key)
+	}
+}
+
 // PutEntity stores the given DataEntity in the database
 func (db *DB) PutEntity(key string, entity *database.DataEntity) int {
-	return db.data.Put(key, entity)
+	db.trackHashFieldTTL(key, entity)
+	initEntityAccess(entity)
+	return db.dicts.Load().data.Put(key, entity)
 }
 
 // PutIfExists edit the given DataEntity in the database
 func (db *DB) PutIfExists(key string, entity *database.DataEntity) int {
-	return db.data.PutIfExists(key, entity)
+	initEntityAccess(entity)
+	return db.dicts.Load().data.PutIfExists(key, entity)
 }
 
 // PutIfAbsent stores the given DataEntity in the database if it doesn't already exist
 func (db *DB) PutIfAbsent(key string, entity *database.DataEntity) int {
-	return db.data.PutIfAbsent(key, entity)
+	initEntityAccess(entity)
+	return db.dicts.Load().data.PutIfAbsent(key, entity)
 }
 
 // Remove deletes the DataEntity associated with the given key from the database
 // 注意：调用方必须先持有该 key 的锁
 func (db *DB) Remove(key string) int {
-	result := db.data.Remove(key)
+	dicts := db.dicts.Load()
+	result := dicts.data.Remove(key)
+	dicts.ttlMap.Remove(key)
 	if result > 0 {
 		db.lockMgr.RemoveLock(key)
 	}
@@ -113,9 +198,11 @@ func (db *DB) Remove(key string) int {
 // Removes deletes the DataEntity associated with the given keys from the database
 // 注意：调用方必须先持有这些 key 的锁
 func (db *DB) Removes(keys ...string) int {
+	dicts := db.dicts.Load()
 	deleted := 0
 	for _, key := range keys {
-		result := db.data.Remove(key)
+		result := dicts.data.Remove(key)
+		dicts.ttlMap.Remove(key)
 		if result > 0 {
 			deleted++
 			db.lockMgr.RemoveLock(key)
@@ -124,10 +211,47 @@ func (db *DB) Removes(keys ...string) int {
 	return deleted
 }
 
-// Flush clears the database by removing all DataEntity objects
+// Flush clears the database: it swaps in empty dicts, keys, expiration times and hash field
+// expirations at once, then releases the old contents
 func (db *DB) Flush() {
-	db.data.Clear()
+	old := db.dicts.Swap(newDBDicts())
+	db.lockMgr.Clear()
+	old.clear()
+}
+
+// FlushAsync clears the database like Flush, but releases the old contents on the lazy free goroutine
+func (db *DB) FlushAsync() {
+	old := db.dicts.Swap(newDBDicts())
 	db.lockMgr.Clear()
+	lazyFree(old.clear)
+}
+
+// Expire sets the expiration time of the given key
+func (db *DB) Expire(key string, expireTime time.Time) {
+	db.dicts.Load().ttlMap.Put(key, expireTime)
+}
+
+// Persist removes the expiration time of the given key
+func (db *DB) Persist(key string) {
+	db.dicts.Load().ttlMap.Remove(key)
+}
+
+// ExpireTime returns the expiration time of the given key, if it has one
+func (db *DB) ExpireTime(key string) (time.Time, bool) {
+	raw, ok := db.dicts.Load().ttlMap.Get(key)
+	if !ok {
+		return time.Time{}, false
+	}
+	return raw.(time.Time), true
+}
+
+// IsExpired checks whether the given key has passed its expiration time
+func (db *DB) IsExpired(key string) bool {
+	expireTime, ok := db.ExpireTime(key)
+	if !ok {
+		return false
+	}
+	return time.Now().After(expireTime)
 }
 
 // AfterClientClose is called when a client connection is closed
@@ -137,10 +261,14 @@ func (db *DB) AfterClientClose(c resp.Connection) {
 
 // Close closes the database and releases resources
 func (db *DB) Close() {
-	db.data.Clear()
+	db.closeOnce.Do(func() {
+		close(db.stopSweep)
+	})
+	db.dicts.Load().clear()
 }
 
-// getAsHash returns a hash value stored at key, or nil if it doesn't exist
+// getAsHash returns a hash value stored at key, or nil if it doesn't exist.
+// A hash whose fields have all expired is reported as missing
 func (db *DB) getAsHash(key string) (*hash.Hash, bool) {
 	entity, exists := db.GetEntity(key)
 	if !exists {
@@ -151,16 +279,26 @@ func (db *DB) getAsHash(key string) (*hash.Hash, bool) {
 	if !ok {
 		return nil, true // key exists but not a hash
 	}
+	if hashObj.HasExpires() && hashObj.Len() == 0 {
+		return nil, false
+	}
 	return hashObj, true
 }
 
 // getOrCreateHash gets or creates a hash
+// The caller holds the write lock of key, so expired fields are reclaimed here
 func (db *DB) getOrCreateHash(key string) (*hash.Hash, bool) {
 	hashObj, exists := db.getAsHash(key)
 	if exists {
+		if hashObj != nil {
+			hashObj.RemoveExpired()
+		}
 		return hashObj, true
 	}
 
+	// Drop a hash whose fields have all expired, together with its key expiration time
+	db.Remove(key)
+
 	// Create a new hash
 	hashObj = hash.MakeHash()
 	db.PutEntity(key, &database.DataEntity{Data: hashObj})
@@ -260,7 +398,7 @@ func goID() int64 {
 	// 找到 "goroutine " 后面的数字
 	str := string(payload)
 	// 跳过 "goroutine " 前缀
-	start := 9
+	start := len("goroutine ")
 	if len(str) < start {
 		return 0
 	}
@@ -298,6 +436,32 @@ func (klm *KeyLockManager) Lock(key string) *KeyLockHandle {
 	return &KeyLockHandle{key: key, entry: entry}
 }
 
+// TryLock 尝试获取指定 key 的写锁，不等待（支持重入），锁被其他持有者占用时返回 nil
+func (klm *KeyLockManager) TryLock(key string) *KeyLockHandle {
+	entry := klm.acquireEntry(key)
+
+	gid := goID()
+
+	entry.metaMu.Lock()
+	if entry.writeOwner == gid {
+		entry.writeRecursion++
+		entry.metaMu.Unlock()
+		return &KeyLockHandle{key: key, entry: entry}
+	}
+	entry.metaMu.Unlock()
+
+	if !entry.lock.TryLock() {
+		klm.releaseEntry(key, entry)
+		return nil
+	}
+	entry.metaMu.Lock()
+	entry.writeOwner = gid
+	entry.writeRecursion = 1
+	entry.metaMu.Unlock()
+
+	return &KeyLockHandle{key: key, entry: entry}
+}
+
 // Unlock 释放写锁（支持重入）
 func (klm *KeyLockManager) Unlock(handle *KeyLockHandle) {
 	if handle == nil || handle.entry == nil {
@@ -429,13 +593,22 @@ func (klm *KeyLockManager) LockKeys(keys []string) *MultiKeyLockHandle {
 	}
 	sort.Strings(uniqueKeys)
 
-	// 按顺序获取所有锁
+	// 按顺序获取所有锁（支持重入：当前 goroutine 已持有写锁的键只增加递归计数）
+	gid := goID()
 	entries := make([]*keyLockEntry, len(uniqueKeys))
 	for i, key := range uniqueKeys {
 		entries[i] = klm.acquireEntry(key)
+		entries[i].metaMu.Lock()
+		if entries[i].writeOwner == gid {
+			entries[i].writeRecursion++
+			entries[i].metaMu.Unlock()
+			continue
+		}
+		entries[i].metaMu.Unlock()
+
 		entries[i].lock.Lock()
 		entries[i].metaMu.Lock()
-		entries[i].writeOwner = goID()
+		entries[i].writeOwner = gid
 		entries[i].writeRecursion = 1
 		entries[i].metaMu.Unlock()
 	}
@@ -446,19 +619,27 @@ func (klm *KeyLockManager) LockKeys(keys []string) *MultiKeyLockHandle {
 	}
 }
 
-// UnlockKeys 释放批量锁
+// UnlockKeys 释放批量锁（支持重入）
 func (klm *KeyLockManager) UnlockKeys(handle *MultiKeyLockHandle) {
 	if handle == nil {
 		return
 	}
 	// 按逆序释放锁
 	for i := len(handle.entries) - 1; i >= 0; i-- {
-		handle.entries[i].metaMu.Lock()
-		handle.entries[i].writeOwner = 0
-		handle.entries[i].writeRecursion = 0
-		handle.entries[i].metaMu.Unlock()
-		handle.entries[i].lock.Unlock()
-		klm.releaseEntry(handle.keys[i], handle.entries[i])
+		entry := handle.entries[i]
+		entry.metaMu.Lock()
+		entry.writeRecursion--
+		if entry.writeRecursion > 0 {
+			// 还有外层持有者，不释放底层锁
+			entry.metaMu.Unlock()
+			klm.releaseEntry(handle.keys[i], entry)
+			continue
+		}
+		entry.writeOwner = 0
+		entry.writeRecursion = 0
+		entry.metaMu.Unlock()
+		entry.lock.Unlock()
+		klm.releaseEntry(handle.keys[i], entry)
 	}
 }
 
@@ -505,6 +686,21 @@ func (db *DB) WithRKeyLock(key string, fn func()) {
 	fn()
 }
 
+// withRKeyLocks runs fn holding the read locks of keys
+func (db *DB) withRKeyLocks(keys []string, fn func()) {
+	sortedKeys := utils.DedupSortedKeys(keys)
+	locks := make([]*KeyLockHandle, len(sortedKeys))
+	for i, key := range sortedKeys {
+		locks[i] = db.lockMgr.RLock(key)
+	}
+	defer func() {
+		for _, lock := range locks {
+			db.lockMgr.RUnlock(lock)
+		}
+	}()
+	fn()
+}
+
 func (db *DB) WithKeyLockReturn(key string, fn func() interface{}) interface{} {
 	lock := db.lockMgr.Lock(key)
 	defer db.lockMgr.Unlock(lock)
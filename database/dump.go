@@ -0,0 +1,230 @@
+package database
+
+import (
+	"Redis_Go/datastruct/bloom"
+	"Redis_Go/datastruct/cms"
+	"Redis_Go/datastruct/hash"
+	"Redis_Go/datastruct/jsondoc"
+	"Redis_Go/datastruct/list"
+	"Redis_Go/datastruct/set"
+	"Redis_Go/datastruct/stream"
+	"Redis_Go/datastruct/zset"
+	"Redis_Go/interface/database"
+	"Redis_Go/interface/resp"
+	"Redis_Go/lib/utils"
+	"Redis_Go/resp/reply"
+	"encoding/binary"
+	"errors"
+	"hash/crc64"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A DUMP payload is laid out as
+//
+//	[type byte][body][version uint16 LE][crc64 LE]
+//
+// where the checksum covers everything before it.
+const (
+	dumpVersion = 1
+
+	dumpTypeString = 0
+	dumpTypeList   = 1
+	dumpTypeSet    = 2
+	dumpTypeZSet   = 3
+	dumpTypeHash   = 4
+	dumpTypeStream = 15
+	dumpTypeJSON   = 16
+	dumpTypeBloom  = 17
+	dumpTypeCMS    = 18
+)
+
+var (
+	dumpCRCTable = crc64.MakeTable(crc64.ECMA)
+
+	errDumpChecksum  = errors.New("ERR DUMP payload version or checksum are wrong")
+	errDumpBadFormat = errors.New("ERR Bad data format")
+)
+
+// marshalEntity serializes the value of a DataEntity into a DUMP payload
+func marshalEntity(entity *database.DataEntity) ([]byte, bool) {
+	var buf []byte
+	if str, ok := stringBytes(entity); ok {
+		buf = append([]byte{dumpTypeString}, str...)
+	}
+	switch val := entity.Data.(type) {
+	case *list.List:
+		buf = append([]byte{dumpTypeList}, val.Marshal()...)
+	case *set.Set:
+		buf = append([]byte{dumpTypeSet}, val.Marshal()...)
+	case zset.ZSet:
+		buf = append([]byte{dumpTypeZSet}, val.Marshal()...)
+	case *hash.Hash:
+		buf = append([]byte{dumpTypeHash}, val.Marshal()...)
+	case *stream.Stream:
+		buf = append([]byte{dumpTypeStream}, val.Marshal()...)
+	case *jsondoc.Document:
+		buf = append([]byte{dumpTypeJSON}, jsondoc.Marshal(val.Root)...)
+	case *bloom.Filter:
+		buf = append([]byte{dumpTypeBloom}, val.Marshal()...)
+	case *cms.Sketch:
+		buf = append([]byte{dumpTypeCMS}, val.Marshal()...)
+	}
+	if buf == nil {
+		return nil, false
+	}
+	buf = binary.LittleEndian.AppendUint16(buf, dumpVersion)
+	buf = binary.LittleEndian.AppendUint64(buf, crc64.Checksum(buf, dumpCRCTable))
+	return buf, true
+}
+
+// unmarshalEntity verifies a DUMP payload and rebuilds the DataEntity it describes
+func unmarshalEntity(payload []byte) (*database.DataEntity, error) {
+	// type byte + version + checksum
+	if len(payload) < 1+2+8 {
+		return nil, errDumpChecksum
+	}
+	footer := len(payload) - 10
+	version := binary.LittleEndian.Uint16(payload[footer:])
+	checksum := binary.LittleEndian.Uint64(payload[footer+2:])
+	if version != dumpVersion || checksum != crc64.Checksum(payload[:footer+2], dumpCRCTable) {
+		return nil, errDumpChecksum
+	}
+
+	body := payload[1:footer]
+	var (
+		data interface{}
+		err  error
+	)
+	switch payload[0] {
+	case dumpTypeString:
+		return newStringEntity(append([]byte{}, body...)), nil
+	case dumpTypeList:
+		data, err = list.Unmarshal(body)
+	case dumpTypeSet:
+		data, err = set.UnmarshalSet(body)
+	case dumpTypeZSet:
+		data, err = zset.UnmarshalZSet(body)
+	case dumpTypeHash:
+		data, err = hash.UnmarshalHash(body)
+	case dumpTypeStream:
+		data, err = stream.Unmarshal(body)
+	case dumpTypeJSON:
+		var root any
+		root, err = jsondoc.Parse(body)
+		data = &jsondoc.Document{Root: root}
+	case dumpTypeBloom:
+		data, err = bloom.Unmarshal(body)
+	case dumpTypeCMS:
+		data, err = cms.Unmarshal(body)
+	default:
+		return nil, errDumpBadFormat
+	}
+	if err != nil {
+		return nil, errDumpBadFormat
+	}
+	return &database.DataEntity{Data: data}, nil
+}
+
+// execDump implements the DUMP command
+// DUMP key
+func execDump(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+
+	var result resp.Reply
+	db.WithRKeyLock(key, func() {
+		entity, exists := db.GetEntity(key)
+		if !exists {
+			result = reply.GetNullBulkReply()
+			return
+		}
+		payload, ok := marshalEntity(entity)
+		if !ok {
+			result = reply.GetStandardErrorReply("ERR DUMP is not supported for this type")
+			return
+		}
+		result = reply.GetBulkReply(payload)
+	})
+	return result
+}
+
+// execRestore implements the RESTORE command
+// RESTORE key ttl serialized-value [REPLACE] [ABSTTL]
+func execRestore(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	ttl, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+	}
+	if ttl < 0 {
+		return reply.GetStandardErrorReply("ERR Invalid TTL value, must be >= 0")
+	}
+	payload := args[2]
+
+	replace, absTTL := false, false
+	for _, arg := range args[3:] {
+		switch strings.ToUpper(string(arg)) {
+		case "REPLACE":
+			replace = true
+		case "ABSTTL":
+			absTTL = true
+		default:
+			return reply.GetSyntaxErrReply()
+		}
+	}
+
+	var expireTime time.Time
+	if ttl > 0 {
+		if absTTL {
+			expireTime = time.UnixMilli(ttl)
+		} else {
+			expireTime = time.Now().Add(time.Duration(ttl) * time.Millisecond)
+		}
+	}
+
+	var result resp.Reply
+	db.WithKeyLock(key, func() {
+		if _, exists := db.GetEntity(key); exists && !replace {
+			result = reply.GetStandardErrorReply("BUSYKEY Target key name already exists.")
+			return
+		}
+
+		entity, err := unmarshalEntity(payload)
+		if err != nil {
+			result = reply.GetStandardErrorReply(err.Error())
+			return
+		}
+
+		// Always log an absolute, replacing form so that replaying the AOF
+		// neither depends on when it is replayed nor trips over BUSYKEY
+		aofTTL := []byte("0")
+		if !expireTime.IsZero() {
+			aofTTL = []byte(strconv.FormatInt(expireTime.UnixMilli(), 10))
+		}
+		aofLine := utils.ToCmdLineWithName("RESTORE", args[0], aofTTL, payload, []byte("REPLACE"), []byte("ABSTTL"))
+
+		// An absolute TTL in the past behaves like restoring then expiring the key immediately
+		if !expireTime.IsZero() && !expireTime.After(time.Now()) {
+			db.Remove(key)
+			db.addAof(aofLine)
+			result = reply.GetOKReply()
+			return
+		}
+
+		db.PutEntity(key, entity)
+		if expireTime.IsZero() {
+			db.Persist(key)
+		} else {
+			db.Expire(key, expireTime)
+		}
+		db.addAof(aofLine)
+		result = reply.GetOKReply()
+	})
+	return result
+}
+
+func init() {
+	RegisterCommand("DUMP", execDump, 2)        // DUMP key
+	RegisterCommand("RESTORE", execRestore, -4) // RESTORE key ttl serialized-value [REPLACE] [ABSTTL]
+}
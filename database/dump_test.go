@@ -0,0 +1,205 @@
+package database
+
+import (
+	"Redis_Go/lib/codec"
+	"Redis_Go/resp/reply"
+	"encoding/binary"
+	"hash/crc64"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dumpPayload frames body as a DUMP payload of type typ, with the version and checksum RESTORE expects
+func dumpPayload(typ byte, body []byte) string {
+	buf := append([]byte{typ}, body...)
+	buf = binary.LittleEndian.AppendUint16(buf, dumpVersion)
+	buf = binary.LittleEndian.AppendUint64(buf, crc64.Checksum(buf, dumpCRCTable))
+	return string(buf)
+}
+
+// bloomBody serializes a filter of error rate 0.01 and capacity 100 that doesn't scale, with a single
+// sub-filter of the given shape followed by words zero words
+func bloomBody(numBits, hashes, capacity, count uint64, words int) []byte {
+	buf := codec.AppendFloat(nil, 0.01)
+	buf = codec.AppendUvarint(buf, 100)
+	buf = codec.AppendUvarint(buf, 0)
+	buf = codec.AppendUvarint(buf, 1)
+	buf = codec.AppendUvarint(buf, numBits)
+	buf = codec.AppendUvarint(buf, hashes)
+	buf = codec.AppendUvarint(buf, capacity)
+	buf = codec.AppendUvarint(buf, count)
+	return append(buf, make([]byte, words*8)...)
+}
+
+func TestRestoreRejectsCraftedBloom(t *testing.T) {
+	restore := func(body []byte) []string {
+		return []string{"RESTORE", "b", "0", dumpPayload(dumpTypeBloom, body)}
+	}
+	// 错误率 0.01 的第一个子过滤器错误率为 0.005: 每项 11.03 位, 共 1103 位 (18 个字), 8 个哈希函数
+	valid := bloomBody(1103, 8, 100, 0, 18)
+	bad := "-ERR Bad data format"
+	runCmdCases(t, []cmdCase{
+		{"valid", nil, restore(valid), "+OK"},
+		{"valid filter works", [][]string{restore(valid), {"BF.ADD", "b", "x"}}, []string{"BF.EXISTS", "b", "x"}, ":1"},
+		// (numBits+63)/64 溢出为 0 个字, 之后的查询会越界
+		{"bit count wraps", nil, restore(bloomBody(1<<64-1, 8, 100, 0, 0)), bad},
+		{"bit count past MaxBits", nil, restore(bloomBody(1<<34, 8, 100, 0, 0)), bad},
+		{"bit count off by one", nil, restore(bloomBody(1104, 8, 100, 0, 18)), bad},
+		// 每次查询都要计算这么多个哈希
+		{"too many hashes", nil, restore(bloomBody(1103, 1<<40, 100, 0, 18)), bad},
+		{"zero hashes", nil, restore(bloomBody(1103, 0, 100, 0, 18)), bad},
+		{"capacity differs", nil, restore(bloomBody(1103, 8, 1<<60, 0, 18)), bad},
+		{"count past capacity", nil, restore(bloomBody(1103, 8, 100, 101, 18)), bad},
+		{"missing words", nil, restore(bloomBody(1103, 8, 100, 0, 17)), bad},
+		{"trailing words", nil, restore(bloomBody(1103, 8, 100, 0, 19)), bad},
+		{"rejected payload creates nothing", [][]string{restore(bloomBody(1<<64-1, 8, 100, 0, 0))}, []string{"EXISTS", "b"}, ":0"},
+	})
+}
+
+// dump returns the DUMP payload of key, nil if it doesn't exist
+func dump(t *testing.T, db *DB, key string) []byte {
+	t.Helper()
+	switch r := db.Exec(nil, [][]byte{[]byte("DUMP"), []byte(key)}).(type) {
+	case *reply.BulkReply:
+		return r.Arg
+	case *reply.NullBulkReply:
+		return nil
+	default:
+		t.Fatalf("DUMP %s replied %q", key, r.ToBytes())
+		return nil
+	}
+}
+
+func TestDumpRestoreRoundTrip(t *testing.T) {
+	many := func(cmd ...string) []string {
+		for i := 0; i < 200; i++ {
+			n := strconv.Itoa(i)
+			switch cmd[0] {
+			case "ZADD":
+				cmd = append(cmd, n, "m"+n)
+			case "HSET":
+				cmd = append(cmd, "f"+n, "v"+n)
+			default:
+				cmd = append(cmd, "m"+n)
+			}
+		}
+		return cmd
+	}
+	// 每种类型的 reads 分别在 src 和恢复出的 dst 上执行, 结果应当相同
+	cases := []struct {
+		name  string
+		setup [][]string
+		reads [][]string
+	}{
+		{"string", [][]string{{"SET", "src", "a\r\nb\x00c"}},
+			[][]string{{"GET", "src"}, {"TYPE", "src"}}},
+		{"integer string", [][]string{{"SET", "src", "12345"}},
+			[][]string{{"GET", "src"}, {"OBJECT", "ENCODING", "src"}, {"INCR", "src"}}},
+		{"list", [][]string{{"SADD", "tmp", "3", "1", "2"}, {"SORT", "tmp", "STORE", "src"}},
+			[][]string{{"LRANGE", "src", "0", "-1"}, {"TYPE", "src"}}},
+		{"intset", [][]string{{"SADD", "src", "3", "-1", "2"}},
+			[][]string{{"SORT", "src"}, {"SENCODING", "src"}}},
+		{"set", [][]string{many("SADD", "src")},
+			[][]string{{"SCARD", "src"}, {"SORT", "src", "ALPHA"}, {"SENCODING", "src"}}},
+		{"small zset", [][]string{{"ZADD", "src", "-inf", "a", "1.5", "b", "+inf", "c"}},
+			[][]string{{"ZRANGE", "src", "0", "-1", "WITHSCORES"}, {"ZTYPE", "src"}}},
+		{"zset", [][]string{many("ZADD", "src")},
+			[][]string{{"ZRANGE", "src", "0", "-1", "WITHSCORES"}, {"ZRANK", "src", "m150"}, {"ZTYPE", "src"}}},
+		{"small hash", [][]string{{"HSET", "src", "a", "1", "b", "2"}},
+			[][]string{{"HGET", "src", "a"}, {"HMGET", "src", "a", "b", "c"}, {"HENCODING", "src"}}},
+		{"hash", [][]string{many("HSET", "src")},
+			[][]string{{"HLEN", "src"}, {"HGET", "src", "f150"}, {"HENCODING", "src"}}},
+		// 字段的过期时间随值一起恢复
+		{"hash with field TTLs", [][]string{{"HSET", "src", "a", "1", "b", "2", "c", "3"},
+			{"HPEXPIREAT", "src", "99999999999999", "FIELDS", "1", "a"}, {"HPEXPIRE", "src", "1", "FIELDS", "1", "b"},
+			{"SLEEP"}},
+			[][]string{{"HLEN", "src"}, {"HMGET", "src", "a", "b", "c"}, {"HPTTL", "src", "FIELDS", "2", "a", "c"}}},
+		{"stream", [][]string{
+			{"XADD", "src", "1-1", "f", "a"}, {"XADD", "src", "2-1", "f", "b"}, {"XADD", "src", "3-1", "f", "c"},
+			{"XDEL", "src", "2-1"}, {"XGROUP", "CREATE", "src", "g", "0"},
+			{"XREADGROUP", "GROUP", "g", "alice", "COUNT", "1", "STREAMS", "src", ">"}},
+			[][]string{{"XRANGE", "src", "-", "+"}, {"XLEN", "src"}, {"XPENDING", "src", "g"},
+				{"XREADGROUP", "GROUP", "g", "bob", "STREAMS", "src", ">"},
+				// 最后一个 ID 也会恢复
+				{"XADD", "src", "3-1", "f", "d"}, {"XADD", "src", "3-2", "f", "d"}}},
+		{"json", [][]string{{"JSON.SET", "src", "$", `{"a":[1,2.5,"x",null,true,{"b":[]}],"c":{}}`}},
+			[][]string{{"JSON.GET", "src"}, {"JSON.TYPE", "src", "$.a[*]"}}},
+		{"bloom", [][]string{{"BF.RESERVE", "src", "0.01", "10", "EXPANSION", "2"}, many("BF.MADD", "src")},
+			[][]string{{"BF.MEXISTS", "src", "m0", "m199", "missing"}, {"BF.ADD", "src", "m7"}}},
+		{"cms", [][]string{{"CMS.INITBYDIM", "src", "100", "4"}, {"CMS.INCRBY", "src", "a", "3", "b", "5"}},
+			[][]string{{"CMS.QUERY", "src", "a", "b", "c"}}},
+	}
+
+	for _, tc := range cases {
+		db := NewDB()
+		for _, line := range tc.setup {
+			if line[0] == "SLEEP" {
+				time.Sleep(5 * time.Millisecond)
+				continue
+			}
+			execLine(db, line...)
+		}
+		payload := dump(t, db, "src")
+		if payload == nil {
+			t.Fatalf("%s: DUMP returned nil", tc.name)
+		}
+		if got := execLine(db, "RESTORE", "dst", "0", string(payload)); got != "+OK" {
+			t.Fatalf("%s: RESTORE replied %q", tc.name, got)
+		}
+		// 哈希表的遍历顺序不固定, 只比较大小
+		if got := dump(t, db, "dst"); len(got) != len(payload) {
+			t.Errorf("%s: the restored value dumps to %d bytes, the original to %d", tc.name, len(got), len(payload))
+		}
+		for _, read := range tc.reads {
+			dstRead := make([]string, len(read))
+			for i, arg := range read {
+				dstRead[i] = strings.ReplaceAll(arg, "src", "dst")
+			}
+			want, got := execLine(db, read...), execLine(db, dstRead...)
+			if tc.name == "hash with field TTLs" && read[0] == "HPTTL" {
+				// 剩余时间在两次调用之间可能减少
+				want, got = want[:8], got[:8]
+			}
+			if got != strings.ReplaceAll(want, "src", "dst") {
+				t.Errorf("%s: %s replied %q on the restored key, %q on the original", tc.name, read[0], got, want)
+			}
+		}
+	}
+}
+
+func TestRestoreOptions(t *testing.T) {
+	db := NewDB()
+	execLine(db, "SET", "src", "v")
+	payload := string(dump(t, db, "src"))
+
+	steps := []struct {
+		cmd  []string
+		want string
+	}{
+		{[]string{"RESTORE", "src", "0", payload}, "-BUSYKEY Target key name already exists."},
+		{[]string{"RESTORE", "src", "0", payload, "REPLACE"}, "+OK"},
+		{[]string{"RESTORE", "dst", "-1", payload}, "-ERR Invalid TTL value, must be >= 0"},
+		{[]string{"RESTORE", "dst", "0", payload, "FOO"}, "-ERR syntax error"},
+		{[]string{"RESTORE", "dst", "0", payload[:len(payload)-1] + "x"}, "-ERR DUMP payload version or checksum are wrong"},
+		// 过去的绝对时间相当于恢复后立即过期
+		{[]string{"RESTORE", "dst", "1", payload, "ABSTTL"}, "+OK"},
+		{[]string{"EXISTS", "dst"}, ":0"},
+		{[]string{"RESTORE", "dst", "100000", payload}, "+OK"},
+		{[]string{"GET", "dst"}, "$1 v"},
+		{[]string{"DUMP", "missing"}, "$-1"},
+	}
+	for _, step := range steps {
+		if got := execLine(db, step.cmd...); got != step.want {
+			t.Fatalf("%s replied %q, want %q", step.cmd[0], got, step.want)
+		}
+	}
+	expireTime, ok := db.ExpireTime("dst")
+	if remaining := time.Until(expireTime); !ok || remaining <= 0 || remaining > 100*time.Second {
+		t.Fatalf("restored key expires in %v, want within 100s", remaining)
+	}
+	if _, ok := db.ExpireTime("src"); ok {
+		t.Fatal("RESTORE 0 REPLACE left a TTL")
+	}
+}
@@ -0,0 +1,475 @@
+package database
+
+import (
+	"Redis_Go/datastruct/zset"
+	"Redis_Go/interface/database"
+	"Redis_Go/interface/resp"
+	"Redis_Go/lib/geohash"
+	"Redis_Go/lib/utils"
+	"Redis_Go/resp/reply"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// parseDistanceUnit returns the number of meters in unit
+func parseDistanceUnit(unit string) (float64, resp.Reply) {
+	switch strings.ToLower(unit) {
+	case "m":
+		return 1, nil
+	case "km":
+		return 1000, nil
+	case "ft":
+		return 0.3048, nil
+	case "mi":
+		return 1609.34, nil
+	}
+	return 0, reply.GetStandardErrorReply("ERR unsupported unit provided. please use M, KM, FT, MI")
+}
+
+// parseLonLat parses a longitude, latitude pair and checks that it can be indexed
+func parseLonLat(rawLon, rawLat []byte) (lon, lat float64, errReply resp.Reply) {
+	if lon, errReply = parseFloat(string(rawLon)); errReply != nil {
+		return 0, 0, errReply
+	}
+	if lat, errReply = parseFloat(string(rawLat)); errReply != nil {
+		return 0, 0, errReply
+	}
+	if !geohash.Valid(lon, lat) {
+		return 0, 0, reply.GetStandardErrorReply(fmt.Sprintf("ERR invalid longitude,latitude pair %f,%f", lon, lat))
+	}
+	return lon, lat, nil
+}
+
+// formatCoordinate formats a coordinate with 17 decimals, dropping trailing zeros
+func formatCoordinate(v float64) []byte {
+	s := strconv.FormatFloat(v, 'f', 17, 64)
+	s = strings.TrimRight(s, "0")
+	return []byte(strings.TrimSuffix(s, "."))
+}
+
+// formatDistance formats a distance the way GEODIST and WITHDIST do
+func formatDistance(meters, unit float64) []byte {
+	return []byte(strconv.FormatFloat(meters/unit, 'f', 4, 64))
+}
+
+func coordinateReply(score float64) resp.Reply {
+	lon, lat := geohash.DecodeScore(score)
+	return reply.GetMultiBulkReply([][]byte{formatCoordinate(lon), formatCoordinate(lat)})
+}
+
+// execGeoAdd adds members at the given coordinates to the zset at key, with their geohash as score
+// GEOADD key [NX|XX] [CH] longitude latitude member [longitude latitude member ...]
+func execGeoAdd(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+
+	flags := zaddFlags{}
+	i := 1
+	for ; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		if option != "NX" && option != "XX" && option != "CH" {
+			break
+		}
+		flags.set(option)
+	}
+	triples := args[i:]
+	if len(triples) == 0 || len(triples)%3 != 0 {
+		return reply.GetSyntaxErrReply()
+	}
+	if flags.nx && flags.xx {
+		return reply.GetStandardErrorReply("ERR XX and NX options at the same time are not compatible")
+	}
+
+	size := len(triples) / 3
+	scores := make([]float64, size)
+	members := make([]string, size)
+	for j := 0; j < size; j++ {
+		lon, lat, errReply := parseLonLat(triples[3*j], triples[3*j+1])
+		if errReply != nil {
+			return errReply
+		}
+		scores[j] = float64(geohash.Encode(lon, lat, geohash.MaxStep).Bits)
+		members[j] = string(triples[3*j+2])
+	}
+	// AOF 中记录为 ZADD, 回放时不必重新计算 geohash
+	return zaddGeneric(db, key, flags, scores, members)
+}
+
+// execGeoPos returns the coordinates of the members
+// GEOPOS key [member [member ...]]
+func execGeoPos(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+
+	var result resp.Reply
+	db.WithRKeyLock(key, func() {
+		zsetObj, exists := getAsZSet(db, key)
+		if exists && zsetObj == nil {
+			result = reply.GetWrongTypeErrReply()
+			return
+		}
+		replies := make([]resp.Reply, len(args)-1)
+		for i, member := range args[1:] {
+			score, ok := zsetObj.Score(string(member))
+			if !ok {
+				replies[i] = reply.GetNullBulkReply()
+				continue
+			}
+			replies[i] = coordinateReply(score)
+		}
+		result = reply.GetMultiRawReply(replies)
+	})
+	return result
+}
+
+// execGeoDist returns the distance between two members
+// GEODIST key member1 member2 [M|KM|FT|MI]
+func execGeoDist(db *DB, args [][]byte) resp.Reply {
+	if len(args) > 4 {
+		return reply.GetSyntaxErrReply()
+	}
+	key := string(args[0])
+	unit := 1.0
+	if len(args) == 4 {
+		var errReply resp.Reply
+		if unit, errReply = parseDistanceUnit(string(args[3])); errReply != nil {
+			return errReply
+		}
+	}
+
+	var result resp.Reply
+	db.WithRKeyLock(key, func() {
+		zsetObj, exists := getAsZSet(db, key)
+		if exists && zsetObj == nil {
+			result = reply.GetWrongTypeErrReply()
+			return
+		}
+		score1, ok1 := zsetObj.Score(string(args[1]))
+		score2, ok2 := zsetObj.Score(string(args[2]))
+		if !ok1 || !ok2 {
+			result = reply.GetNullBulkReply()
+			return
+		}
+		lon1, lat1 := geohash.DecodeScore(score1)
+		lon2, lat2 := geohash.DecodeScore(score2)
+		result = reply.GetBulkReply(formatDistance(geohash.Distance(lon1, lat1, lon2, lat2), unit))
+	})
+	return result
+}
+
+// execGeoHash returns the geohash.org strings of the members
+// GEOHASH key [member [member ...]]
+func execGeoHash(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+
+	var result resp.Reply
+	db.WithRKeyLock(key, func() {
+		zsetObj, exists := getAsZSet(db, key)
+		if exists && zsetObj == nil {
+			result = reply.GetWrongTypeErrReply()
+			return
+		}
+		hashes := make([][]byte, len(args)-1)
+		for i, member := range args[1:] {
+			if score, ok := zsetObj.Score(string(member)); ok {
+				hashes[i] = []byte(geohash.String(score))
+			}
+		}
+		result = reply.GetMultiBulkReply(hashes)
+	})
+	return result
+}
+
+// geoSearchSpec holds the parsed options of GEOSEARCH and GEOSEARCHSTORE
+type geoSearchSpec struct {
+	fromMember string
+	fromLonLat bool
+	lon, lat   float64
+
+	byRadius      bool
+	radius        float64 // meters
+	width, height float64 // meters
+	unit          float64 // meters per unit of the request
+
+	sort       int // 0 none, 1 ASC, -1 DESC
+	count      int // 0 for no limit
+	any        bool
+	withCoord  bool
+	withDist   bool
+	withHash   bool
+	storeDist  bool
+	centerSeen bool
+	shapeSeen  bool
+}
+
+// geoMatch is a member found by a search
+type geoMatch struct {
+	member string
+	score  float64
+	dist   float64 // meters
+}
+
+// parseGeoSearchSpec parses the options of GEOSEARCH, or of GEOSEARCHSTORE if store is true
+func parseGeoSearchSpec(cmdName string, args [][]byte, store bool) (*geoSearchSpec, resp.Reply) {
+	spec := &geoSearchSpec{}
+	var errReply resp.Reply
+	for i := 0; i < len(args); i++ {
+		remaining := len(args) - i - 1
+		switch option := strings.ToUpper(string(args[i])); {
+		case option == "FROMMEMBER" && remaining >= 1:
+			if spec.centerSeen {
+				return nil, reply.GetStandardErrorReply("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for " + cmdName)
+			}
+			spec.fromMember, spec.centerSeen = string(args[i+1]), true
+			i++
+		case option == "FROMLONLAT" && remaining >= 2:
+			if spec.centerSeen {
+				return nil, reply.GetStandardErrorReply("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for " + cmdName)
+			}
+			if spec.lon, spec.lat, errReply = parseLonLat(args[i+1], args[i+2]); errReply != nil {
+				return nil, errReply
+			}
+			spec.fromLonLat, spec.centerSeen = true, true
+			i += 2
+		case option == "BYRADIUS" && remaining >= 2:
+			if spec.shapeSeen {
+				return nil, reply.GetStandardErrorReply("ERR exactly one of BYRADIUS and BYBOX can be specified for " + cmdName)
+			}
+			if spec.radius, errReply = parseFloat(string(args[i+1])); errReply != nil {
+				return nil, errReply
+			}
+			if spec.radius < 0 {
+				return nil, reply.GetStandardErrorReply("ERR radius cannot be negative")
+			}
+			if spec.unit, errReply = parseDistanceUnit(string(args[i+2])); errReply != nil {
+				return nil, errReply
+			}
+			spec.radius *= spec.unit
+			spec.byRadius, spec.shapeSeen = true, true
+			i += 2
+		case option == "BYBOX" && remaining >= 3:
+			if spec.shapeSeen {
+				return nil, reply.GetStandardErrorReply("ERR exactly one of BYRADIUS and BYBOX can be specified for " + cmdName)
+			}
+			if spec.width, errReply = parseFloat(string(args[i+1])); errReply != nil {
+				return nil, errReply
+			}
+			if spec.height, errReply = parseFloat(string(args[i+2])); errReply != nil {
+				return nil, errReply
+			}
+			if spec.width < 0 || spec.height < 0 {
+				return nil, reply.GetStandardErrorReply("ERR height or width cannot be negative")
+			}
+			if spec.unit, errReply = parseDistanceUnit(string(args[i+3])); errReply != nil {
+				return nil, errReply
+			}
+			spec.width *= spec.unit
+			spec.height *= spec.unit
+			spec.shapeSeen = true
+			i += 3
+		case option == "ASC":
+			spec.sort = 1
+		case option == "DESC":
+			spec.sort = -1
+		case option == "COUNT" && remaining >= 1:
+			count, err := strconv.Atoi(string(args[i+1]))
+			if err != nil {
+				return nil, reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+			}
+			if count <= 0 {
+				return nil, reply.GetStandardErrorReply("ERR COUNT must be > 0")
+			}
+			spec.count = count
+			i++
+			if i+1 < len(args) && strings.ToUpper(string(args[i+1])) == "ANY" {
+				spec.any = true
+				i++
+			}
+		case option == "WITHCOORD" && !store:
+			spec.withCoord = true
+		case option == "WITHDIST" && !store:
+			spec.withDist = true
+		case option == "WITHHASH" && !store:
+			spec.withHash = true
+		case option == "STOREDIST" && store:
+			spec.storeDist = true
+		default:
+			return nil, reply.GetSyntaxErrReply()
+		}
+	}
+
+	if !spec.centerSeen {
+		return nil, reply.GetStandardErrorReply("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for " + cmdName)
+	}
+	if !spec.shapeSeen {
+		return nil, reply.GetStandardErrorReply("ERR exactly one of BYRADIUS and BYBOX can be specified for " + cmdName)
+	}
+	// 有 COUNT 但没有 ANY 时, 需要先排序才能取出最近的成员
+	if spec.count > 0 && !spec.any && spec.sort == 0 {
+		spec.sort = 1
+	}
+	return spec, nil
+}
+
+// search returns the members of zsetObj within the shape of spec.
+// Only the zset score ranges of the geohash cells around the center are visited
+func (spec *geoSearchSpec) search(zsetObj zset.ZSet) ([]geoMatch, resp.Reply) {
+	if !spec.fromLonLat {
+		score, ok := zsetObj.Score(spec.fromMember)
+		if !ok {
+			return nil, reply.GetStandardErrorReply("ERR could not decode requested zset member")
+		}
+		spec.lon, spec.lat = geohash.DecodeScore(score)
+	}
+
+	width, height, radius := spec.width, spec.height, spec.radius
+	if spec.byRadius {
+		width, height = radius*2, radius*2
+	} else {
+		// 用外接圆的半径估算单元格精度
+		radius = math.Hypot(width/2, height/2)
+	}
+
+	var matches []geoMatch
+	for _, hash := range geohash.SearchAreas(spec.lon, spec.lat, width, height, radius) {
+		minScore, maxScore := geohash.ScoreRange(hash)
+		elements := zsetObj.RangeByScoreElements(
+			zset.ScoreBorder{Value: float64(minScore)},
+			zset.ScoreBorder{Value: float64(maxScore), Exclude: true},
+			0, -1, false)
+		for _, element := range elements {
+			lon, lat := geohash.DecodeScore(element.Score)
+			var dist float64
+			var ok bool
+			if spec.byRadius {
+				dist, ok = geohash.InRadius(spec.lon, spec.lat, lon, lat, spec.radius)
+			} else {
+				dist, ok = geohash.InBox(spec.lon, spec.lat, lon, lat, spec.width, spec.height)
+			}
+			if !ok {
+				continue
+			}
+			matches = append(matches, geoMatch{member: element.Member, score: element.Score, dist: dist})
+			if spec.any && len(matches) == spec.count {
+				break
+			}
+		}
+		if spec.any && len(matches) == spec.count {
+			break
+		}
+	}
+
+	switch spec.sort {
+	case 1:
+		sort.SliceStable(matches, func(i, j int) bool { return matches[i].dist < matches[j].dist })
+	case -1:
+		sort.SliceStable(matches, func(i, j int) bool { return matches[i].dist > matches[j].dist })
+	}
+	if spec.count > 0 && len(matches) > spec.count {
+		matches = matches[:spec.count]
+	}
+	return matches, nil
+}
+
+// execGeoSearch returns the members within a radius or box around a member or a position
+// GEOSEARCH key FROMMEMBER member|FROMLONLAT longitude latitude BYRADIUS radius unit|BYBOX width height unit
+// [ASC|DESC] [COUNT count [ANY]] [WITHCOORD] [WITHDIST] [WITHHASH]
+func execGeoSearch(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	spec, errReply := parseGeoSearchSpec("GEOSEARCH", args[1:], false)
+	if errReply != nil {
+		return errReply
+	}
+
+	var result resp.Reply
+	db.WithRKeyLock(key, func() {
+		zsetObj, exists := getAsZSet(db, key)
+		if exists && zsetObj == nil {
+			result = reply.GetWrongTypeErrReply()
+			return
+		}
+		if !exists {
+			result = reply.GetMultiRawReply(nil)
+			return
+		}
+		matches, errReply := spec.search(zsetObj)
+		if errReply != nil {
+			result = errReply
+			return
+		}
+
+		replies := make([]resp.Reply, len(matches))
+		for i, match := range matches {
+			if !spec.withDist && !spec.withHash && !spec.withCoord {
+				replies[i] = reply.GetBulkReply([]byte(match.member))
+				continue
+			}
+			item := []resp.Reply{reply.GetBulkReply([]byte(match.member))}
+			if spec.withDist {
+				item = append(item, reply.GetBulkReply(formatDistance(match.dist, spec.unit)))
+			}
+			if spec.withHash {
+				item = append(item, reply.GetIntReply(int64(match.score)))
+			}
+			if spec.withCoord {
+				item = append(item, coordinateReply(match.score))
+			}
+			replies[i] = reply.GetMultiRawReply(item)
+		}
+		result = reply.GetMultiRawReply(replies)
+	})
+	return result
+}
+
+// execGeoSearchStore stores the result of a GEOSEARCH in destination as a zset, and returns its size.
+// The scores are the geohashes of the members, or their distances with STOREDIST
+// GEOSEARCHSTORE destination source FROMMEMBER member|FROMLONLAT longitude latitude
+// BYRADIUS radius unit|BYBOX width height unit [ASC|DESC] [COUNT count [ANY]] [STOREDIST]
+func execGeoSearchStore(db *DB, args [][]byte) resp.Reply {
+	dst, src := string(args[0]), string(args[1])
+	spec, errReply := parseGeoSearchSpec("GEOSEARCHSTORE", args[2:], true)
+	if errReply != nil {
+		return errReply
+	}
+
+	handle := db.lockMgr.LockKeys([]string{dst, src})
+	defer db.lockMgr.UnlockKeys(handle)
+
+	zsetObj, exists := getAsZSet(db, src)
+	if exists && zsetObj == nil {
+		return reply.GetWrongTypeErrReply()
+	}
+	var matches []geoMatch
+	if exists {
+		if matches, errReply = spec.search(zsetObj); errReply != nil {
+			return errReply
+		}
+	}
+
+	if len(matches) == 0 {
+		db.Remove(dst)
+	} else {
+		destZSet := zset.NewZSet()
+		for _, match := range matches {
+			score := match.score
+			if spec.storeDist {
+				score = match.dist / spec.unit
+			}
+			destZSet.Add(match.member, score)
+		}
+		db.PutEntity(dst, &database.DataEntity{Data: destZSet})
+		db.Persist(dst)
+	}
+	db.addAof(utils.ToCmdLineWithName("GEOSEARCHSTORE", args...))
+	return reply.GetIntReply(int64(len(matches)))
+}
+
+func init() {
+	RegisterCommand("GEOADD", execGeoAdd, -5)                 // key [NX|XX] [CH] longitude latitude member [longitude latitude member ...]
+	RegisterCommand("GEOPOS", execGeoPos, -2)                 // key [member [member ...]]
+	RegisterCommand("GEODIST", execGeoDist, -4)               // key member1 member2 [M|KM|FT|MI]
+	RegisterCommand("GEOHASH", execGeoHash, -2)               // key [member [member ...]]
+	RegisterCommand("GEOSEARCH", execGeoSearch, -7)           // key FROMMEMBER|FROMLONLAT ... BYRADIUS|BYBOX ... [ASC|DESC] [COUNT count [ANY]] [WITH...]
+	RegisterCommand("GEOSEARCHSTORE", execGeoSearchStore, -8) // dst src FROMMEMBER|FROMLONLAT ... BYRADIUS|BYBOX ... [ASC|DESC] [COUNT count [ANY]] [STOREDIST]
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"Redis_Go/lib/geohash"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestGeoSearchRadius(t *testing.T) {
+	// 与 Redis 文档中的例子相同
+	sicily := [][]string{{"GEOADD", "Sicily", "13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania"}}
+	runCmdCases(t, []cmdCase{
+		{"geodist", sicily, []string{"GEODIST", "Sicily", "Palermo", "Catania"}, "$11 166274.1516"},
+		{"geodist km", sicily, []string{"GEODIST", "Sicily", "Palermo", "Catania", "km"}, "$8 166.2742"},
+		{"geohash", sicily, []string{"GEOHASH", "Sicily", "Palermo", "Catania"}, "*2 $11 sqc8b49rny0 $11 sqdtr74hyu0"},
+		{"geopos", sicily, []string{"GEOPOS", "Sicily", "Palermo", "missing"},
+			"*2 *2 $20 13.36138933897018433 $20 38.11555639549629859 $-1"},
+		{"radius with dist", sicily, []string{"GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "ASC", "WITHDIST"},
+			"*2 *2 $7 Catania $7 56.4413 *2 $7 Palermo $8 190.4424"},
+		{"radius desc", sicily, []string{"GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "DESC"},
+			"*2 $7 Palermo $7 Catania"},
+		{"radius excludes the farther member", sicily, []string{"GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "190", "km"},
+			"*1 $7 Catania"},
+		{"box", sicily, []string{"GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYBOX", "400", "400", "km", "ASC", "WITHHASH"},
+			"*2 *2 $7 Catania :3479447370796909 *2 $7 Palermo :3479099956230698"},
+		{"count", sicily, []string{"GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "COUNT", "1"},
+			"*1 $7 Catania"},
+		// 半径恰好等于距离时成员在范围内; 实际距离是 166274.15157 米
+		{"radius just above the distance", sicily, []string{"GEOSEARCH", "Sicily", "FROMMEMBER", "Palermo", "BYRADIUS", "166274.1516", "m", "ASC"},
+			"*2 $7 Palermo $7 Catania"},
+		{"radius just below the distance", sicily, []string{"GEOSEARCH", "Sicily", "FROMMEMBER", "Palermo", "BYRADIUS", "166274.1515", "m"},
+			"*1 $7 Palermo"},
+		{"zero radius", sicily, []string{"GEOSEARCH", "Sicily", "FROMMEMBER", "Palermo", "BYRADIUS", "0", "m"}, "*1 $7 Palermo"},
+		{"missing member", sicily, []string{"GEOSEARCH", "Sicily", "FROMMEMBER", "Rome", "BYRADIUS", "1", "m"},
+			"-ERR could not decode requested zset member"},
+		{"negative radius", sicily, []string{"GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "-1", "m"},
+			"-ERR radius cannot be negative"},
+		{"missing key", nil, []string{"GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "1", "m"}, "*0"},
+		{"store dist", sicily, []string{"GEOSEARCHSTORE", "dst", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "STOREDIST"}, ":2"},
+	})
+}
+
+// TestGeoSearchMatchesBruteForce checks the members GEOSEARCH finds, which only looks at the geohash cells
+// around the center, against the distances of every member
+func TestGeoSearchMatchesBruteForce(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, center := range [][2]float64{{13.4, 38.1}, {-0.1, 51.5}, {0.0001, -0.0001}, {-73.9, 40.7}, {25, 70}} {
+		db := NewDB()
+		line := []string{"GEOADD", "points"}
+		for i := 0; i < 500; i++ {
+			// 离中心约 0 到 2 度的点
+			spread := float64(rnd.Intn(3)) + rnd.Float64()
+			lon := center[0] + (rnd.Float64()*2-1)*spread
+			lat := center[1] + (rnd.Float64()*2-1)*spread
+			line = append(line, strconv.FormatFloat(lon, 'f', 6, 64), strconv.FormatFloat(lat, 'f', 6, 64), "p"+strconv.Itoa(i))
+		}
+		execLine(db, line...)
+		zsetObj, _ := getAsZSet(db, "points")
+
+		for _, radius := range []float64{10, 1000, 50000, 150000} {
+			var want []string
+			for _, element := range zsetObj.RangeByRankElements(0, -1, false) {
+				lon, lat := geohash.DecodeScore(element.Score)
+				if _, ok := geohash.InRadius(center[0], center[1], lon, lat, radius); ok {
+					want = append(want, element.Member)
+				}
+			}
+			sort.Strings(want)
+
+			got := execLine(db, "GEOSEARCH", "points",
+				"FROMLONLAT", strconv.FormatFloat(center[0], 'f', -1, 64), strconv.FormatFloat(center[1], 'f', -1, 64),
+				"BYRADIUS", strconv.FormatFloat(radius, 'f', -1, 64), "m")
+			var members []string
+			for _, field := range strings.Fields(got)[1:] {
+				if !strings.HasPrefix(field, "$") {
+					members = append(members, field)
+				}
+			}
+			sort.Strings(members)
+			if strings.Join(members, " ") != strings.Join(want, " ") {
+				t.Fatalf("center %v radius %.0f: found %v, want %v", center, radius, members, want)
+			}
+		}
+	}
+}
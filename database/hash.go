@@ -4,23 +4,38 @@ import (
 	"Redis_Go/interface/resp"
 	"Redis_Go/lib/utils"
 	"Redis_Go/resp/reply"
+	"math"
+	"strconv"
+	"strings"
 )
 
-// HSet sets field in the hash stored at key to value
+// HSet sets fields in the hash stored at key to their values
+// HSET key field value [field value ...]
 func execHSet(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
-	field := string(args[1])
-	value := string(args[2])
 
-	var result int
+	if len(args)%2 == 0 {
+		return reply.GetArgNumErrReply("hset")
+	}
+
+	var result resp.Reply
 	// 保证线程安全
 	db.WithKeyLock(key, func() {
 		hashObj, _ := db.getOrCreateHash(key)
-		result = hashObj.Set(field, value)
+		if hashObj == nil {
+			result = reply.GetWrongTypeErrReply()
+			return
+		}
+
+		added := 0
+		for i := 1; i < len(args); i += 2 {
+			added += hashObj.Set(string(args[i]), string(args[i+1]))
+		}
 
 		db.addAof(utils.ToCmdLineWithName("HSET", args...))
+		result = reply.GetIntReply(int64(added))
 	})
-	return reply.GetIntReply(int64(result))
+	return result
 }
 
 // HGet gets the value of a field in hash
@@ -64,6 +79,10 @@ func execHExists(db *DB, args [][]byte) resp.Reply {
 			result = reply.GetIntReply(0)
 			return
 		}
+		if hash == nil {
+			result = reply.GetWrongTypeErrReply()
+			return
+		}
 
 		exists = hash.Exists(field)
 		if exists {
@@ -86,6 +105,10 @@ func execHDel(db *DB, args [][]byte) resp.Reply {
 			result = reply.GetIntReply(0)
 			return
 		}
+		if hash == nil {
+			result = reply.GetWrongTypeErrReply()
+			return
+		}
 
 		deleted := 0
 		for _, field := range args[1:] {
@@ -116,6 +139,10 @@ func execHLen(db *DB, args [][]byte) resp.Reply {
 			result = reply.GetIntReply(0)
 			return
 		}
+		if hash == nil {
+			result = reply.GetWrongTypeErrReply()
+			return
+		}
 
 		result = reply.GetIntReply(int64(hash.Len()))
 	})
@@ -133,6 +160,10 @@ func execHGetAll(db *DB, args [][]byte) resp.Reply {
 			result = reply.GetEmptyMultiBulkReply()
 			return
 		}
+		if hash == nil {
+			result = reply.GetWrongTypeErrReply()
+			return
+		}
 
 		allMap := hash.GetAll()
 		arr := make([][]byte, 0, len(allMap)*2)
@@ -157,6 +188,10 @@ func execHKeys(db *DB, args [][]byte) resp.Reply {
 			result = reply.GetEmptyMultiBulkReply()
 			return
 		}
+		if hash == nil {
+			result = reply.GetWrongTypeErrReply()
+			return
+		}
 
 		fields := hash.Fields()
 		arr := make([][]byte, len(fields))
@@ -180,6 +215,10 @@ func execHVals(db *DB, args [][]byte) resp.Reply {
 			result = reply.GetEmptyMultiBulkReply()
 			return
 		}
+		if hash == nil {
+			result = reply.GetWrongTypeErrReply()
+			return
+		}
 
 		values := hash.Values()
 		arr := make([][]byte, len(values))
@@ -207,6 +246,10 @@ func execHMGet(db *DB, args [][]byte) resp.Reply {
 			result = reply.GetMultiBulkReply(results)
 			return
 		}
+		if hash == nil {
+			result = reply.GetWrongTypeErrReply()
+			return
+		}
 
 		results := make([][]byte, len(args)-1)
 		for i, field := range args[1:] {
@@ -235,6 +278,10 @@ func execHMSet(db *DB, args [][]byte) resp.Reply {
 	var result resp.Reply
 	db.WithKeyLock(key, func() {
 		hash, _ := db.getOrCreateHash(key)
+		if hash == nil {
+			result = reply.GetWrongTypeErrReply()
+			return
+		}
 
 		for i := 1; i < len(args); i += 2 {
 			field := string(args[i])
@@ -249,23 +296,10 @@ func execHMSet(db *DB, args [][]byte) resp.Reply {
 	return result
 }
 
-// HEncoding returns the encoding of the hash.
-// 0 for listpack, 1 for dict.
-// This is a diy function to check the encoding of the hash.
+// execHEncoding is an alias of OBJECT ENCODING, kept for compatibility
+// HENCODING key
 func execHEncoding(db *DB, args [][]byte) resp.Reply {
-	key := string(args[0])
-
-	var result resp.Reply
-	db.WithRKeyLock(key, func() {
-		hash, exists := db.getAsHash(key)
-		if !exists {
-			result = reply.GetNullBulkReply()
-			return
-		}
-
-		result = reply.GetIntReply(int64(hash.Encoding()))
-	})
-	return result
+	return objectEncodingReply(db, string(args[0]))
 }
 
 // execHSetNX sets field in the hash stored at key to value, only if field does not exist
@@ -278,6 +312,10 @@ func execHSetNX(db *DB, args [][]byte) resp.Reply {
 	var result resp.Reply
 	db.WithKeyLock(key, func() {
 		hash, _ := db.getOrCreateHash(key)
+		if hash == nil {
+			result = reply.GetWrongTypeErrReply()
+			return
+		}
 
 		_, exists := hash.Get(field)
 		if exists {
@@ -294,18 +332,246 @@ func execHSetNX(db *DB, args [][]byte) resp.Reply {
 	return result
 }
 
+// execHIncrBy increments the integer value of a field by the given amount
+// HINCRBY key field increment
+func execHIncrBy(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	field := string(args[1])
+	delta, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+	}
+
+	var result resp.Reply
+	db.WithKeyLock(key, func() {
+		hashObj, _ := db.getOrCreateHash(key)
+		if hashObj == nil {
+			result = reply.GetWrongTypeErrReply()
+			return
+		}
+
+		newValue, err := hashObj.IncrBy(field, delta)
+		if err != nil {
+			if hashObj.Len() == 0 {
+				db.Remove(key)
+			}
+			result = reply.GetStandardErrorReply(err.Error())
+			return
+		}
+
+		db.addAof(utils.ToCmdLineWithName("HINCRBY", args...))
+		result = reply.GetIntReply(newValue)
+	})
+	return result
+}
+
+// execHIncrByFloat increments the float value of a field by the given amount
+// HINCRBYFLOAT key field increment
+func execHIncrByFloat(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	field := string(args[1])
+	delta, ok := parseStrictFloat(args[2])
+	if !ok {
+		return reply.GetStandardErrorReply("ERR value is not a valid float")
+	}
+
+	var result resp.Reply
+	db.WithKeyLock(key, func() {
+		hashObj, _ := db.getOrCreateHash(key)
+		if hashObj == nil {
+			result = reply.GetWrongTypeErrReply()
+			return
+		}
+
+		newValue, err := hashObj.IncrByFloat(field, delta)
+		if err != nil {
+			if hashObj.Len() == 0 {
+				db.Remove(key)
+			}
+			result = reply.GetStandardErrorReply(err.Error())
+			return
+		}
+
+		// Log the resulting value so that replay doesn't depend on float arithmetic
+		db.addAof(utils.ToCmdLineWithName("HSET", args[0], args[1], []byte(newValue)))
+		// HSET clears the expiration time of the field, which HINCRBYFLOAT keeps
+		if expireAt, _, hasTTL := hashObj.ExpireTime(field); hasTTL {
+			db.addAof(utils.ToCmdLineWithName("HPEXPIREAT", args[0], []byte(strconv.FormatInt(expireAt, 10)),
+				[]byte("FIELDS"), []byte("1"), args[1]))
+		}
+		result = reply.GetBulkReply([]byte(newValue))
+	})
+	return result
+}
+
+// execHStrLen returns the length of the value of a field
+// HSTRLEN key field
+func execHStrLen(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	field := string(args[1])
+
+	var result resp.Reply
+	db.WithRKeyLock(key, func() {
+		hashObj, exists := db.getAsHash(key)
+		if !exists {
+			result = reply.GetIntReply(0)
+			return
+		}
+		if hashObj == nil {
+			result = reply.GetWrongTypeErrReply()
+			return
+		}
+		result = reply.GetIntReply(int64(hashObj.StrLen(field)))
+	})
+	return result
+}
+
+// maxRandomReplyLen bounds the reply of HRANDFIELD and ZRANDMEMBER. Redis streams the reply of a negative
+// count to the client, while here it is built in memory first, so a huge count must not get that far
+const maxRandomReplyLen = 1 << 24
+
+// checkRandomCount returns an error if the reply to count random elements, with their values if pairs,
+// would overflow (-count for math.MinInt64, or twice a huge count) or be longer than maxRandomReplyLen
+func checkRandomCount(count int64, pairs bool) resp.Reply {
+	if count == math.MinInt64 {
+		return reply.GetStandardErrorReply("ERR value is out of range")
+	}
+	if count < 0 {
+		count = -count
+	}
+	if pairs && count > math.MaxInt64/2 {
+		return reply.GetStandardErrorReply("ERR value is out of range")
+	}
+	if pairs {
+		count *= 2
+	}
+	if count > maxRandomReplyLen {
+		return reply.GetStandardErrorReply("ERR value is out of range")
+	}
+	return nil
+}
+
+// execHRandField returns random fields from the hash.
+// A positive count returns distinct fields, a negative one may repeat them
+// HRANDFIELD key [count [WITHVALUES]]
+func execHRandField(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	if len(args) > 3 {
+		return reply.GetSyntaxErrReply()
+	}
+
+	hasCount := len(args) >= 2
+	var count int64 = 1
+	if hasCount {
+		var err error
+		count, err = strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil {
+			return reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+		}
+	}
+	withValues := false
+	if len(args) == 3 {
+		if strings.ToUpper(string(args[2])) != "WITHVALUES" {
+			return reply.GetSyntaxErrReply()
+		}
+		withValues = true
+	}
+	if errReply := checkRandomCount(count, withValues); errReply != nil {
+		return errReply
+	}
+
+	var result resp.Reply
+	db.WithRKeyLock(key, func() {
+		hashObj, exists := db.getAsHash(key)
+		if exists && hashObj == nil {
+			result = reply.GetWrongTypeErrReply()
+			return
+		}
+		if !exists {
+			if hasCount {
+				result = reply.GetMultiRawReply(nil)
+			} else {
+				result = reply.GetNullBulkReply()
+			}
+			return
+		}
+
+		if !hasCount {
+			fields := hashObj.RandomFields(1, true)
+			result = reply.GetBulkReply([]byte(fields[0]))
+			return
+		}
+
+		var fields []string
+		if count >= 0 {
+			fields = hashObj.RandomFields(int(count), true)
+		} else {
+			fields = hashObj.RandomFields(int(-count), false)
+		}
+		arr := make([][]byte, 0, len(fields)*2)
+		for _, field := range fields {
+			arr = append(arr, []byte(field))
+			if withValues {
+				value, _ := hashObj.Get(field)
+				arr = append(arr, []byte(value))
+			}
+		}
+		result = reply.GetMultiBulkReply(arr)
+	})
+	return result
+}
+
+// execHScan incrementally iterates the fields of a hash
+// HSCAN key cursor [MATCH pattern] [COUNT count] [NOVALUES]
+func execHScan(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	cursor, pattern, count, noValues, errReply := parseElementScanArgs(args[1:], "NOVALUES")
+	if errReply != nil {
+		return errReply
+	}
+
+	var result resp.Reply
+	db.WithRKeyLock(key, func() {
+		hashObj, exists := db.getAsHash(key)
+		if !exists {
+			result = reply.GetScanReply(0, [][]byte{})
+			return
+		}
+		if hashObj == nil {
+			result = reply.GetWrongTypeErrReply()
+			return
+		}
+
+		fields, values, next := hashObj.Scan(cursor, count, pattern)
+		arr := make([][]byte, 0, len(fields)*2)
+		for i, field := range fields {
+			arr = append(arr, []byte(field))
+			if !noValues {
+				arr = append(arr, []byte(values[i]))
+			}
+		}
+		result = reply.GetScanReply(int64(next), arr)
+	})
+	return result
+}
+
 func init() {
 	// Register hash commands
-	RegisterCommand("HSET", execHSet, 4)           // HSET key field value
-	RegisterCommand("HGET", execHGet, 3)           // HGET key field
-	RegisterCommand("HEXISTS", execHExists, 3)     // HEXISTS key field
-	RegisterCommand("HDEL", execHDel, -3)          // HDEL key field [field ...] (at least 2 args plus command name)
-	RegisterCommand("HLEN", execHLen, 2)           // HLEN key
-	RegisterCommand("HGETALL", execHGetAll, 2)     // HGETALL key
-	RegisterCommand("HKEYS", execHKeys, 2)         // HKEYS key
-	RegisterCommand("HVALS", execHVals, 2)         // HVALS key
-	RegisterCommand("HMGET", execHMGet, -3)        // HMGET key field [field ...] (at least 2 args plus command name)
-	RegisterCommand("HMSET", execHMSet, -4)        // HMSET key field value [field value ...] (at least 3 args plus command name)
-	RegisterCommand("HENCODING", execHEncoding, 2) // HENCODING key
-	RegisterCommand("HSETNX", execHSetNX, 4)       // HSETNX key field value
+	RegisterCommand("HSET", execHSet, -4)                // HSET key field value [field value ...]
+	RegisterCommand("HGET", execHGet, 3)                 // HGET key field
+	RegisterCommand("HEXISTS", execHExists, 3)           // HEXISTS key field
+	RegisterCommand("HDEL", execHDel, -3)                // HDEL key field [field ...] (at least 2 args plus command name)
+	RegisterCommand("HLEN", execHLen, 2)                 // HLEN key
+	RegisterCommand("HGETALL", execHGetAll, 2)           // HGETALL key
+	RegisterCommand("HKEYS", execHKeys, 2)               // HKEYS key
+	RegisterCommand("HVALS", execHVals, 2)               // HVALS key
+	RegisterCommand("HMGET", execHMGet, -3)              // HMGET key field [field ...] (at least 2 args plus command name)
+	RegisterCommand("HMSET", execHMSet, -4)              // HMSET key field value [field value ...] (at least 3 args plus command name)
+	RegisterCommand("HENCODING", execHEncoding, 2)       // HENCODING key
+	RegisterCommand("HSETNX", execHSetNX, 4)             // HSETNX key field value
+	RegisterCommand("HINCRBY", execHIncrBy, 4)           // HINCRBY key field increment
+	RegisterCommand("HINCRBYFLOAT", execHIncrByFloat, 4) // HINCRBYFLOAT key field increment
+	RegisterCommand("HSTRLEN", execHStrLen, 3)           // HSTRLEN key field
+	RegisterCommand("HRANDFIELD", execHRandField, -2)    // HRANDFIELD key [count [WITHVALUES]]
+	RegisterCommand("HSCAN", execHScan, -3)              // HSCAN key cursor [MATCH pattern] [COUNT count] [NOVALUES]
 }
@@ -0,0 +1,56 @@
+package database
+
+import "testing"
+
+func TestHashCommands(t *testing.T) {
+	abc := [][]string{{"HSET", "h", "a", "1", "b", "2", "c", "3"}}
+	wrongType := "-WRONGTYPE Operation against a key holding the wrong kind of value"
+	str := [][]string{{"SET", "h", "v"}}
+	runCmdCases(t, []cmdCase{
+		{"hset counts new fields", abc, []string{"HSET", "h", "a", "9", "d", "4"}, ":1"},
+		{"hset odd arguments", nil, []string{"HSET", "h", "a", "1", "b"}, "-ERR wrong number of arguments for 'hset' command"},
+		{"hset wrong type", str, []string{"HSET", "h", "a", "1"}, wrongType},
+		{"hmset wrong type", str, []string{"HMSET", "h", "a", "1"}, wrongType},
+		{"hsetnx wrong type", str, []string{"HSETNX", "h", "a", "1"}, wrongType},
+		{"hget wrong type", str, []string{"HGET", "h", "a"}, wrongType},
+		{"hexists wrong type", str, []string{"HEXISTS", "h", "a"}, wrongType},
+		{"hdel wrong type", str, []string{"HDEL", "h", "a"}, wrongType},
+		{"hlen wrong type", str, []string{"HLEN", "h"}, wrongType},
+		{"hgetall wrong type", str, []string{"HGETALL", "h"}, wrongType},
+		{"hkeys wrong type", str, []string{"HKEYS", "h"}, wrongType},
+		{"hvals wrong type", str, []string{"HVALS", "h"}, wrongType},
+		{"hmget wrong type", str, []string{"HMGET", "h", "a"}, wrongType},
+
+		{"hincrby new field", nil, []string{"HINCRBY", "h", "n", "5"}, ":5"},
+		{"hincrby negative", abc, []string{"HINCRBY", "h", "a", "-3"}, ":-2"},
+		{"hincrby overflow", [][]string{{"HSET", "h", "n", "9223372036854775807"}}, []string{"HINCRBY", "h", "n", "1"},
+			"-ERR increment or decrement would overflow"},
+		{"hincrby underflow", [][]string{{"HSET", "h", "n", "-9223372036854775808"}}, []string{"HINCRBY", "h", "n", "-1"},
+			"-ERR increment or decrement would overflow"},
+		{"hincrby overflow keeps the value", [][]string{{"HSET", "h", "n", "9223372036854775807"}, {"HINCRBY", "h", "n", "1"}},
+			[]string{"HGET", "h", "n"}, "$19 9223372036854775807"},
+		{"hincrby not an integer", [][]string{{"HSET", "h", "n", "x"}}, []string{"HINCRBY", "h", "n", "1"},
+			"-ERR hash value is not an integer"},
+		{"hincrby bad increment", abc, []string{"HINCRBY", "h", "a", "1.5"}, "-ERR value is not an integer or out of range"},
+		{"hincrby wrong type", str, []string{"HINCRBY", "h", "n", "1"}, wrongType},
+		{"hincrby failure creates nothing", [][]string{{"HINCRBY", "h", "n", "x"}}, []string{"EXISTS", "h"}, ":0"},
+		{"hincrbyfloat", [][]string{{"HSET", "h", "n", "10.5"}}, []string{"HINCRBYFLOAT", "h", "n", "0.1"}, "$4 10.6"},
+		{"hincrbyfloat not a float", [][]string{{"HSET", "h", "n", "x"}}, []string{"HINCRBYFLOAT", "h", "n", "1"},
+			"-ERR hash value is not a float"},
+		{"hincrbyfloat wrong type", str, []string{"HINCRBYFLOAT", "h", "n", "1"}, wrongType},
+
+		{"hrandfield missing key", nil, []string{"HRANDFIELD", "h", "-5"}, "*0"},
+		{"hrandfield whole hash", abc, []string{"HRANDFIELD", "h", "10"}, "*3 $1 a $1 b $1 c"},
+		{"hrandfield repeated", [][]string{{"HSET", "h", "a", "1"}}, []string{"HRANDFIELD", "h", "-3", "WITHVALUES"},
+			"*6 $1 a $1 1 $1 a $1 1 $1 a $1 1"},
+		// 负数 count 的回复是先在内存中构造的, 过大时直接拒绝
+		{"hrandfield min int64", abc, []string{"HRANDFIELD", "h", "-9223372036854775808"}, "-ERR value is out of range"},
+		{"hrandfield huge negative", abc, []string{"HRANDFIELD", "h", "-9223372036854775807"}, "-ERR value is out of range"},
+		{"hrandfield pairs overflow", abc, []string{"HRANDFIELD", "h", "-4611686018427387904", "WITHVALUES"},
+			"-ERR value is out of range"},
+		{"hrandfield reply too long", abc, []string{"HRANDFIELD", "h", "-16777216", "WITHVALUES"},
+			"-ERR value is out of range"},
+		{"hrandfield huge on missing key", nil, []string{"HRANDFIELD", "h", "-9223372036854775807"}, "-ERR value is out of range"},
+		{"hrandfield wrong type", str, []string{"HRANDFIELD", "h", "1"}, wrongType},
+	})
+}
@@ -0,0 +1,347 @@
+package database
+
+import (
+	"Redis_Go/datastruct/hash"
+	"Redis_Go/interface/database"
+	"Redis_Go/interface/resp"
+	"Redis_Go/lib/utils"
+	"Redis_Go/resp/reply"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Hash fields can expire on their own. Expired fields are hidden from every read as soon as
+// their time has passed, reclaimed by the next write to the hash, and otherwise reclaimed by
+// a background sweep over the hashes listed in the hashTTLKeys dict of a DB.
+//
+// Every change is written to the AOF as HPEXPIREAT with an absolute time, so replaying it
+// later deletes the fields that have expired in the meantime.
+
+const (
+	// hashFieldSweepInterval is how often the background sweep reclaims expired fields
+	hashFieldSweepInterval = 100 * time.Millisecond
+	// hashFieldMaxExpireTime is the largest expiration time accepted, in unix milliseconds
+	hashFieldMaxExpireTime = 1<<48 - 1
+)
+
+// Per-field results of the expiration commands
+const (
+	hashFieldNotFound  = -2
+	hashFieldNoTTL     = -1
+	hashFieldNotSet    = 0
+	hashFieldSet       = 1
+	hashFieldDeleted   = 2
+	hashFieldPersisted = 1
+)
+
+// trackHashFieldTTL registers key with the background sweep if entity is a hash with expiring fields
+func (db *DB) trackHashFieldTTL(key string, entity *database.DataEntity) {
+	if hashObj, ok := entity.Data.(*hash.Hash); ok && hashObj.HasExpires() {
+		db.dicts.Load().hashTTLKeys.Put(key, struct{}{})
+	}
+}
+
+// sweepHashFieldsLoop reclaims expired hash fields until the DB is closed
+func (db *DB) sweepHashFieldsLoop() {
+	ticker := time.NewTicker(hashFieldSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-db.stopSweep:
+			return
+		case <-ticker.C:
+			db.sweepHashFields()
+		}
+	}
+}
+
+// sweepHashFields reclaims the expired fields of every tracked hash,
+// deleting hashes left empty and forgetting hashes that no longer have expiring fields
+func (db *DB) sweepHashFields() {
+	for _, key := range db.dicts.Load().hashTTLKeys.Keys() {
+		db.WithKeyLock(key, func() {
+			entity, exists := db.GetEntity(key)
+			if !exists {
+				db.dicts.Load().hashTTLKeys.Remove(key)
+				return
+			}
+			hashObj, ok := entity.Data.(*hash.Hash)
+			if !ok {
+				db.dicts.Load().hashTTLKeys.Remove(key)
+				return
+			}
+
+			hashObj.RemoveExpired()
+			if hashObj.Len() == 0 {
+				db.Remove(key)
+			}
+			if hashObj.Len() == 0 || !hashObj.HasExpires() {
+				db.dicts.Load().hashTTLKeys.Remove(key)
+			}
+		})
+	}
+}
+
+// parseHashFields parses the trailing "FIELDS numfields field [field ...]" of a hash expiration command
+func parseHashFields(args [][]byte) ([]string, resp.Reply) {
+	if len(args) < 2 || strings.ToUpper(string(args[0])) != "FIELDS" {
+		return nil, reply.GetStandardErrorReply("ERR Mandatory argument FIELDS is missing or not at the right position")
+	}
+	numFields, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return nil, reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+	}
+	if numFields <= 0 {
+		return nil, reply.GetStandardErrorReply("ERR Parameter `numFields` should be greater than 0")
+	}
+	if numFields != int64(len(args)-2) {
+		return nil, reply.GetStandardErrorReply("ERR The `numfields` parameter must match the number of arguments")
+	}
+
+	fields := make([]string, numFields)
+	for i, field := range args[2:] {
+		fields[i] = string(field)
+	}
+	return fields, nil
+}
+
+// hashFieldExpireGeneric implements HEXPIRE, HPEXPIRE, HEXPIREAT and HPEXPIREAT.
+// unit converts the time argument to milliseconds and absolute tells whether it is a unix time
+// HEXPIRE key seconds [NX|XX|GT|LT] FIELDS numfields field [field ...]
+func hashFieldExpireGeneric(db *DB, args [][]byte, unit int64, absolute bool) resp.Reply {
+	key := string(args[0])
+	invalidTimeErr := reply.GetStandardErrorReply("ERR invalid expire time, must be >= 0 && <= " +
+		strconv.FormatInt(hashFieldMaxExpireTime, 10))
+
+	raw, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+	}
+	if raw < 0 || raw > math.MaxInt64/unit {
+		return invalidTimeErr
+	}
+	expireAt := raw * unit
+	if !absolute {
+		now := time.Now().UnixMilli()
+		if expireAt > math.MaxInt64-now {
+			return invalidTimeErr
+		}
+		expireAt += now
+	}
+	if expireAt > hashFieldMaxExpireTime {
+		return invalidTimeErr
+	}
+
+	rest := args[2:]
+	cond := ""
+	if len(rest) > 0 {
+		switch upper := strings.ToUpper(string(rest[0])); upper {
+		case "NX", "XX", "GT", "LT":
+			cond = upper
+			rest = rest[1:]
+		}
+	}
+	fields, errReply := parseHashFields(rest)
+	if errReply != nil {
+		return errReply
+	}
+
+	var result resp.Reply
+	db.WithKeyLock(key, func() {
+		hashObj, exists := db.getAsHash(key)
+		if exists && hashObj == nil {
+			result = reply.GetWrongTypeErrReply()
+			return
+		}
+
+		codes := make([]resp.Reply, len(fields))
+		changed := make([][]byte, 0, len(fields))
+		now := time.Now().UnixMilli()
+		for i, field := range fields {
+			if !exists {
+				codes[i] = reply.GetIntReply(hashFieldNotFound)
+				continue
+			}
+			current, fieldExists, hasTTL := hashObj.ExpireTime(field)
+			if !fieldExists {
+				codes[i] = reply.GetIntReply(hashFieldNotFound)
+				continue
+			}
+
+			skip := false
+			switch cond {
+			case "NX":
+				skip = hasTTL
+			case "XX":
+				skip = !hasTTL
+			case "GT":
+				// A field without expiration time never expires, so nothing is greater
+				skip = !hasTTL || expireAt <= current
+			case "LT":
+				skip = hasTTL && expireAt >= current
+			}
+			if skip {
+				codes[i] = reply.GetIntReply(hashFieldNotSet)
+				continue
+			}
+
+			changed = append(changed, []byte(field))
+			if expireAt <= now {
+				hashObj.Delete(field)
+				codes[i] = reply.GetIntReply(hashFieldDeleted)
+				continue
+			}
+			hashObj.SetExpire(field, expireAt)
+			codes[i] = reply.GetIntReply(hashFieldSet)
+		}
+
+		if exists {
+			if hashObj.Len() == 0 {
+				db.Remove(key)
+			} else if hashObj.HasExpires() {
+				db.dicts.Load().hashTTLKeys.Put(key, struct{}{})
+			}
+		}
+		if len(changed) > 0 {
+			// Log an absolute time so that replaying deletes fields that have expired since
+			aofArgs := [][]byte{args[0], []byte(strconv.FormatInt(expireAt, 10)),
+				[]byte("FIELDS"), []byte(strconv.Itoa(len(changed)))}
+			db.addAof(utils.ToCmdLineWithName("HPEXPIREAT", append(aofArgs, changed...)...))
+		}
+		result = reply.GetMultiRawReply(codes)
+	})
+	return result
+}
+
+// execHExpire sets a time to live in seconds on hash fields
+// HEXPIRE key seconds [NX|XX|GT|LT] FIELDS numfields field [field ...]
+func execHExpire(db *DB, args [][]byte) resp.Reply {
+	return hashFieldExpireGeneric(db, args, 1000, false)
+}
+
+// execHPExpire sets a time to live in milliseconds on hash fields
+// HPEXPIRE key milliseconds [NX|XX|GT|LT] FIELDS numfields field [field ...]
+func execHPExpire(db *DB, args [][]byte) resp.Reply {
+	return hashFieldExpireGeneric(db, args, 1, false)
+}
+
+// execHExpireAt sets hash fields to expire at a unix time in seconds
+// HEXPIREAT key unix-time-seconds [NX|XX|GT|LT] FIELDS numfields field [field ...]
+func execHExpireAt(db *DB, args [][]byte) resp.Reply {
+	return hashFieldExpireGeneric(db, args, 1000, true)
+}
+
+// execHPExpireAt sets hash fields to expire at a unix time in milliseconds
+// HPEXPIREAT key unix-time-milliseconds [NX|XX|GT|LT] FIELDS numfields field [field ...]
+func execHPExpireAt(db *DB, args [][]byte) resp.Reply {
+	return hashFieldExpireGeneric(db, args, 1, true)
+}
+
+// hashFieldTTLGeneric implements HTTL and HPTTL, reporting the remaining time to live in the given unit
+// HTTL key FIELDS numfields field [field ...]
+func hashFieldTTLGeneric(db *DB, args [][]byte, unit int64) resp.Reply {
+	key := string(args[0])
+	fields, errReply := parseHashFields(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+
+	var result resp.Reply
+	db.WithRKeyLock(key, func() {
+		hashObj, exists := db.getAsHash(key)
+		if exists && hashObj == nil {
+			result = reply.GetWrongTypeErrReply()
+			return
+		}
+
+		codes := make([]resp.Reply, len(fields))
+		now := time.Now().UnixMilli()
+		for i, field := range fields {
+			if !exists {
+				codes[i] = reply.GetIntReply(hashFieldNotFound)
+				continue
+			}
+			expireAt, fieldExists, hasTTL := hashObj.ExpireTime(field)
+			switch {
+			case !fieldExists:
+				codes[i] = reply.GetIntReply(hashFieldNotFound)
+			case !hasTTL:
+				codes[i] = reply.GetIntReply(hashFieldNoTTL)
+			default:
+				// Round to the nearest unit, as TTL does
+				codes[i] = reply.GetIntReply((expireAt - now + unit/2) / unit)
+			}
+		}
+		result = reply.GetMultiRawReply(codes)
+	})
+	return result
+}
+
+// execHTTL returns the remaining time to live of hash fields in seconds
+// HTTL key FIELDS numfields field [field ...]
+func execHTTL(db *DB, args [][]byte) resp.Reply {
+	return hashFieldTTLGeneric(db, args, 1000)
+}
+
+// execHPTTL returns the remaining time to live of hash fields in milliseconds
+// HPTTL key FIELDS numfields field [field ...]
+func execHPTTL(db *DB, args [][]byte) resp.Reply {
+	return hashFieldTTLGeneric(db, args, 1)
+}
+
+// execHPersist removes the expiration time of hash fields
+// HPERSIST key FIELDS numfields field [field ...]
+func execHPersist(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	fields, errReply := parseHashFields(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+
+	var result resp.Reply
+	db.WithKeyLock(key, func() {
+		hashObj, exists := db.getAsHash(key)
+		if exists && hashObj == nil {
+			result = reply.GetWrongTypeErrReply()
+			return
+		}
+
+		codes := make([]resp.Reply, len(fields))
+		persisted := make([][]byte, 0, len(fields))
+		for i, field := range fields {
+			if !exists {
+				codes[i] = reply.GetIntReply(hashFieldNotFound)
+				continue
+			}
+			_, fieldExists, _ := hashObj.ExpireTime(field)
+			switch {
+			case !fieldExists:
+				codes[i] = reply.GetIntReply(hashFieldNotFound)
+			case hashObj.Persist(field):
+				codes[i] = reply.GetIntReply(hashFieldPersisted)
+				persisted = append(persisted, []byte(field))
+			default:
+				codes[i] = reply.GetIntReply(hashFieldNoTTL)
+			}
+		}
+
+		if len(persisted) > 0 {
+			aofArgs := [][]byte{args[0], []byte("FIELDS"), []byte(strconv.Itoa(len(persisted)))}
+			db.addAof(utils.ToCmdLineWithName("HPERSIST", append(aofArgs, persisted...)...))
+		}
+		result = reply.GetMultiRawReply(codes)
+	})
+	return result
+}
+
+func init() {
+	RegisterCommand("HEXPIRE", execHExpire, -6)       // HEXPIRE key seconds [NX|XX|GT|LT] FIELDS numfields field [field ...]
+	RegisterCommand("HPEXPIRE", execHPExpire, -6)     // HPEXPIRE key milliseconds [NX|XX|GT|LT] FIELDS numfields field [field ...]
+	RegisterCommand("HEXPIREAT", execHExpireAt, -6)   // HEXPIREAT key unix-time-seconds [NX|XX|GT|LT] FIELDS numfields field [field ...]
+	RegisterCommand("HPEXPIREAT", execHPExpireAt, -6) // HPEXPIREAT key unix-time-milliseconds [NX|XX|GT|LT] FIELDS numfields field [field ...]
+	RegisterCommand("HTTL", execHTTL, -5)             // HTTL key FIELDS numfields field [field ...]
+	RegisterCommand("HPTTL", execHPTTL, -5)           // HPTTL key FIELDS numfields field [field ...]
+	RegisterCommand("HPERSIST", execHPersist, -5)     // HPERSIST key FIELDS numfields field [field ...]
+}
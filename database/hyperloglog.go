@@ -0,0 +1,160 @@
+package database
+
+import (
+	"Redis_Go/datastruct/hyperloglog"
+	"Redis_Go/interface/database"
+	"Redis_Go/interface/resp"
+	"Redis_Go/lib/utils"
+	"Redis_Go/resp/reply"
+)
+
+// getAsHyperLogLog returns the HyperLogLog stored at key.
+// HyperLogLogs are strings, errReply is a WRONGTYPE error if the key holds another value or a string that isn't one
+func (db *DB) getAsHyperLogLog(key string) (val []byte, exists bool, errReply resp.Reply) {
+	val, exists, errReply = db.getAsString(key)
+	if errReply != nil || !exists {
+		return nil, exists, errReply
+	}
+	if !hyperloglog.Valid(val) {
+		return nil, true, reply.GetStandardErrorReply("WRONGTYPE Key is not a valid HyperLogLog string value.")
+	}
+	return val, true, nil
+}
+
+// execPFAdd adds the elements to the HyperLogLog stored at key, creating it if needed.
+// It returns 1 if the estimated cardinality may have changed, 0 otherwise
+// PFADD key [element [element ...]]
+func execPFAdd(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+
+	var result resp.Reply
+	db.WithKeyLock(key, func() {
+		old, exists, errReply := db.getAsHyperLogLog(key)
+		if errReply != nil {
+			result = errReply
+			return
+		}
+
+		var hll []byte
+		changed := !exists
+		if exists {
+			// 在副本上修改, 读者可能仍持有旧值
+			hll = append([]byte{}, old...)
+		} else {
+			hll = hyperloglog.New()
+		}
+		for _, element := range args[1:] {
+			var added bool
+			hll, added = hyperloglog.Add(hll, element)
+			changed = changed || added
+		}
+
+		if !changed {
+			result = reply.GetIntReply(0)
+			return
+		}
+		db.PutEntity(key, &database.DataEntity{Data: hll})
+		db.addAof(utils.ToCmdLineWithName("PFADD", args...))
+		result = reply.GetIntReply(1)
+	})
+	return result
+}
+
+// execPFCount returns the estimated cardinality of the union of the HyperLogLogs stored at the keys.
+// With a single key the estimate is cached in the value until the next change
+// PFCOUNT key [key ...]
+func execPFCount(db *DB, args [][]byte) resp.Reply {
+	if len(args) == 1 {
+		return pfCountSingle(db, string(args[0]))
+	}
+
+	keys := make([]string, len(args))
+	for i, arg := range args {
+		keys[i] = string(arg)
+	}
+	sortedKeys := utils.DedupSortedKeys(keys)
+	locks := make([]*KeyLockHandle, len(sortedKeys))
+	for i, key := range sortedKeys {
+		locks[i] = db.lockMgr.RLock(key)
+	}
+	defer func() {
+		for _, lock := range locks {
+			db.lockMgr.RUnlock(lock)
+		}
+	}()
+
+	var registers hyperloglog.Registers
+	for _, key := range keys {
+		hll, exists, errReply := db.getAsHyperLogLog(key)
+		if errReply != nil {
+			return errReply
+		}
+		if exists {
+			registers.Merge(hll)
+		}
+	}
+	return reply.GetIntReply(int64(registers.Count()))
+}
+
+func pfCountSingle(db *DB, key string) resp.Reply {
+	var result resp.Reply
+	db.WithKeyLock(key, func() {
+		hll, exists, errReply := db.getAsHyperLogLog(key)
+		if errReply != nil {
+			result = errReply
+			return
+		}
+		if !exists {
+			result = reply.GetIntReply(0)
+			return
+		}
+		if count, ok := hyperloglog.CachedCount(hll); ok {
+			result = reply.GetIntReply(int64(count))
+			return
+		}
+
+		count := hyperloglog.Count(hll)
+		// 缓存写回副本; 缓存可由寄存器重新算出, 不需要写入 AOF
+		cached := append([]byte{}, hll...)
+		hyperloglog.SetCachedCount(cached, count)
+		db.PutEntity(key, &database.DataEntity{Data: cached})
+		result = reply.GetIntReply(int64(count))
+	})
+	return result
+}
+
+// execPFMerge stores the union of the HyperLogLogs stored at destkey and the source keys in destkey
+// PFMERGE destkey [sourcekey [sourcekey ...]]
+func execPFMerge(db *DB, args [][]byte) resp.Reply {
+	keys := make([]string, len(args))
+	for i, arg := range args {
+		keys[i] = string(arg)
+	}
+	dest := keys[0]
+	handle := db.lockMgr.LockKeys(keys)
+	defer db.lockMgr.UnlockKeys(handle)
+
+	// destkey 本身也参与合并, 结果只有在所有输入都是稀疏表示时才保持稀疏
+	var registers hyperloglog.Registers
+	sparse := true
+	for _, key := range keys {
+		hll, exists, errReply := db.getAsHyperLogLog(key)
+		if errReply != nil {
+			return errReply
+		}
+		if exists {
+			registers.Merge(hll)
+			sparse = sparse && hyperloglog.IsSparse(hll)
+		}
+	}
+
+	db.PutEntity(dest, &database.DataEntity{Data: registers.Encode(sparse)})
+	db.addAof(utils.ToCmdLineWithName("PFMERGE", args...))
+	return reply.GetOKReply()
+}
+
+func init() {
+	RegisterCommand("PFADD", execPFAdd, -2)     // PFADD key [element [element ...]]
+	RegisterCommand("PFCOUNT", execPFCount, -2) // PFCOUNT key [key ...]
+	RegisterCommand("PFMERGE", execPFMerge, -2) // PFMERGE destkey [sourcekey [sourcekey ...]]
+}
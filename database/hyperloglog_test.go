@@ -0,0 +1,90 @@
+package database
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+// pfAddRange adds the elements e<from> to e<to-1> to the HyperLogLog at key
+func pfAddRange(db *DB, key string, from, to int) {
+	line := []string{"PFADD", key}
+	for i := from; i < to; i++ {
+		line = append(line, "e"+strconv.Itoa(i))
+	}
+	execLine(db, line...)
+}
+
+func pfCount(t *testing.T, db *DB, keys ...string) int {
+	got := execLine(db, append([]string{"PFCOUNT"}, keys...)...)
+	count, err := strconv.Atoi(got[1:])
+	if got[0] != ':' || err != nil {
+		t.Fatalf("PFCOUNT %v replied %q", keys, got)
+	}
+	return count
+}
+
+func TestPFMergeUnion(t *testing.T) {
+	// 标准误差 0.81%, 允许 3 倍
+	within := func(count, want int) bool {
+		return math.Abs(float64(count-want)) <= 3*0.0081*float64(want)
+	}
+
+	db := NewDB()
+	// 有重叠的三个集合: [0, 3000), [2000, 5000), [4000, 9000), 并集有 9000 个元素
+	pfAddRange(db, "a", 0, 3000)
+	pfAddRange(db, "b", 2000, 5000)
+	pfAddRange(db, "c", 4000, 9000)
+	for key, want := range map[string]int{"a": 3000, "b": 3000, "c": 5000} {
+		if count := pfCount(t, db, key); !within(count, want) {
+			t.Errorf("PFCOUNT %s = %d, want about %d", key, count, want)
+		}
+	}
+
+	union := pfCount(t, db, "a", "b", "c")
+	if !within(union, 9000) {
+		t.Fatalf("PFCOUNT a b c = %d, want about 9000", union)
+	}
+	// 重复的键和不存在的键不影响并集
+	if count := pfCount(t, db, "a", "b", "missing", "c", "a"); count != union {
+		t.Fatalf("PFCOUNT with duplicate and missing keys = %d, want %d", count, union)
+	}
+
+	if got := execLine(db, "PFMERGE", "dest", "a", "b", "c"); got != "+OK" {
+		t.Fatalf("PFMERGE replied %q", got)
+	}
+	if count := pfCount(t, db, "dest"); count != union {
+		t.Fatalf("PFCOUNT dest = %d, want the union count %d", count, union)
+	}
+	// 源键不变
+	if count := pfCount(t, db, "a"); !within(count, 3000) {
+		t.Fatalf("PFCOUNT a = %d after the merge", count)
+	}
+
+	// destkey 自身也参与合并
+	pfAddRange(db, "d", 9000, 10000)
+	execLine(db, "PFMERGE", "dest", "d")
+	if count := pfCount(t, db, "dest"); !within(count, 10000) || count != pfCount(t, db, "a", "b", "c", "d") {
+		t.Fatalf("PFCOUNT dest = %d after merging d into it, want about 10000", count)
+	}
+
+	// 一个集合与自身的并集就是它本身
+	pfAddRange(db, "e", 0, 3000)
+	if count := pfCount(t, db, "a", "e"); count != pfCount(t, db, "a") {
+		t.Fatalf("PFCOUNT a e = %d, want PFCOUNT a", count)
+	}
+}
+
+func TestPFErrors(t *testing.T) {
+	const wrongType = "-WRONGTYPE Key is not a valid HyperLogLog string value."
+	str := [][]string{{"SET", "s", "not a hll"}, {"PFADD", "h", "x"}}
+	runCmdCases(t, []cmdCase{
+		{"pfcount missing", nil, []string{"PFCOUNT", "h"}, ":0"},
+		{"pfadd new key without elements", nil, []string{"PFADD", "h"}, ":1"},
+		{"pfadd existing element", str, []string{"PFADD", "h", "x"}, ":0"},
+		{"pfcount string", str, []string{"PFCOUNT", "s"}, wrongType},
+		{"pfcount union with string", str, []string{"PFCOUNT", "h", "s"}, wrongType},
+		{"pfmerge string source", str, []string{"PFMERGE", "d", "h", "s"}, wrongType},
+		{"pfadd string", str, []string{"PFADD", "s", "x"}, wrongType},
+	})
+}
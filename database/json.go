@@ -0,0 +1,644 @@
+package database
+
+import (
+	"Redis_Go/datastruct/jsondoc"
+	"Redis_Go/interface/database"
+	"Redis_Go/interface/resp"
+	"Redis_Go/lib/utils"
+	"Redis_Go/resp/reply"
+	"math"
+	"strings"
+)
+
+// getAsJSON returns the JSON document stored at key, errReply is a WRONGTYPE error if the key holds another type
+func (db *DB) getAsJSON(key string) (doc *jsondoc.Document, exists bool, errReply resp.Reply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, false, nil
+	}
+	doc, ok := entity.Data.(*jsondoc.Document)
+	if !ok {
+		return nil, true, reply.GetWrongTypeErrReply()
+	}
+	return doc, true, nil
+}
+
+func parseJSONPath(arg []byte) (*jsondoc.Path, resp.Reply) {
+	path, err := jsondoc.ParsePath(string(arg))
+	if err != nil {
+		return nil, reply.GetStandardErrorReply(err.Error() + " '" + string(arg) + "'")
+	}
+	return path, nil
+}
+
+func parseJSONValue(arg []byte) (any, resp.Reply) {
+	v, err := jsondoc.Parse(arg)
+	if err != nil {
+		return nil, reply.GetStandardErrorReply("ERR invalid JSON value: " + err.Error())
+	}
+	return v, nil
+}
+
+func jsonPathNotExistReply(path *jsondoc.Path) resp.Reply {
+	return reply.GetStandardErrorReply("ERR Path '" + path.String() + "' does not exist")
+}
+
+func jsonNoSuchKeyReply() resp.Reply {
+	return reply.GetStandardErrorReply("ERR could not perform this operation on a key that doesn't exist")
+}
+
+// findJSON returns the matches of path in doc. A legacy path addresses its first match only
+func findJSON(doc *jsondoc.Document, path *jsondoc.Path) []*jsondoc.Match {
+	matches := path.Find(doc.Root)
+	if path.Legacy && len(matches) > 1 {
+		matches = matches[:1]
+	}
+	return matches
+}
+
+// jsonResultsReply replies with the result for each match, nil for the matches of the wrong type.
+// For a legacy path it replies with the result of the single match, or an error if there is none
+// or it isn't of the expected type
+func jsonResultsReply(path *jsondoc.Path, matches []*jsondoc.Match, results []resp.Reply, expected string) resp.Reply {
+	if path.Legacy {
+		if len(matches) == 0 {
+			return jsonPathNotExistReply(path)
+		}
+		if results[0] == nil {
+			return reply.GetStandardErrorReply("ERR wrong type of path value - expected " + expected +
+				" but found " + jsondoc.TypeName(matches[0].Value))
+		}
+		return results[0]
+	}
+	replies := make([]resp.Reply, len(results))
+	for i, result := range results {
+		if result == nil {
+			result = reply.GetNullBulkReply()
+		}
+		replies[i] = result
+	}
+	return reply.GetMultiRawReply(replies)
+}
+
+// execJSONSet sets the values path matches, or adds the key path ends with to the objects its parent matches.
+// A new document must be set at the root. NX only adds and XX only replaces
+// JSON.SET key path value [NX|XX]
+func execJSONSet(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	path, errReply := parseJSONPath(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	value, errReply := parseJSONValue(args[2])
+	if errReply != nil {
+		return errReply
+	}
+	nx, xx := false, false
+	if len(args) > 3 {
+		switch strings.ToUpper(string(args[3])) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		default:
+			return reply.GetSyntaxErrReply()
+		}
+		if len(args) > 4 {
+			return reply.GetSyntaxErrReply()
+		}
+	}
+
+	var result resp.Reply
+	db.WithKeyLock(key, func() {
+		doc, exists, errReply := db.getAsJSON(key)
+		if errReply != nil {
+			result = errReply
+			return
+		}
+
+		set := func() bool {
+			if !exists || path.IsRoot() {
+				if !path.IsRoot() {
+					errReply = reply.GetStandardErrorReply("ERR new objects must be created at the root")
+					return false
+				}
+				if (exists && nx) || (!exists && xx) {
+					return false
+				}
+				if !exists {
+					doc = &jsondoc.Document{}
+					db.PutEntity(key, &database.DataEntity{Data: doc})
+				}
+				doc.Root = value
+				return true
+			}
+
+			if matches := path.Find(doc.Root); len(matches) > 0 {
+				if nx {
+					return false
+				}
+				for i, m := range matches {
+					// 每个位置需要独立的副本
+					if i > 0 {
+						doc.Replace(m, jsondoc.Clone(value))
+					} else {
+						doc.Replace(m, value)
+					}
+				}
+				return true
+			}
+
+			// 路径以名字结尾时, 在父路径匹配的对象中新增该键
+			parentPath, name, ok := path.Parent()
+			if xx || !ok {
+				return false
+			}
+			created := 0
+			for _, m := range parentPath.Find(doc.Root) {
+				if obj, isObject := m.Value.(*jsondoc.Object); isObject {
+					if created > 0 {
+						obj.Set(name, jsondoc.Clone(value))
+					} else {
+						obj.Set(name, value)
+					}
+					created++
+				}
+			}
+			return created > 0
+		}
+
+		if !set() {
+			if errReply != nil {
+				result = errReply
+			} else {
+				result = reply.GetNullBulkReply()
+			}
+			return
+		}
+		db.addAof(utils.ToCmdLineWithName("JSON.SET", args[0], args[1], jsondoc.Marshal(value)))
+		result = reply.GetOKReply()
+	})
+	return result
+}
+
+// execJSONGet returns the values the paths match as JSON, the whole document if no path is given.
+// A single JSONPath gives the array of its matches, a single legacy path its first match,
+// and several paths an object mapping each path to what it would give alone
+// JSON.GET key [INDENT indent] [NEWLINE newline] [SPACE space] [path ...]
+func execJSONGet(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	var indent, newline, space string
+	i := 1
+options:
+	for ; i+1 < len(args); i += 2 {
+		switch strings.ToUpper(string(args[i])) {
+		case "INDENT":
+			indent = string(args[i+1])
+		case "NEWLINE":
+			newline = string(args[i+1])
+		case "SPACE":
+			space = string(args[i+1])
+		default:
+			break options
+		}
+	}
+
+	var paths []*jsondoc.Path
+	for _, arg := range args[i:] {
+		path, errReply := parseJSONPath(arg)
+		if errReply != nil {
+			return errReply
+		}
+		paths = append(paths, path)
+	}
+	if len(paths) == 0 {
+		paths = append(paths, &jsondoc.Path{Legacy: true})
+	}
+
+	var result resp.Reply
+	db.WithRKeyLock(key, func() {
+		doc, exists, errReply := db.getAsJSON(key)
+		if errReply != nil {
+			result = errReply
+			return
+		}
+		if !exists {
+			result = reply.GetNullBulkReply()
+			return
+		}
+
+		legacy := true
+		for _, path := range paths {
+			legacy = legacy && path.Legacy
+		}
+		values := make([]any, len(paths))
+		for j, path := range paths {
+			matches := path.Find(doc.Root)
+			if legacy {
+				if len(matches) == 0 {
+					result = jsonPathNotExistReply(path)
+					return
+				}
+				values[j] = matches[0].Value
+				continue
+			}
+			arr := &jsondoc.Array{Elems: make([]any, len(matches))}
+			for k, m := range matches {
+				arr.Elems[k] = m.Value
+			}
+			values[j] = arr
+		}
+
+		out := values[0]
+		if len(paths) > 1 {
+			obj := jsondoc.NewObject()
+			for j, path := range paths {
+				obj.Set(path.String(), values[j])
+			}
+			out = obj
+		}
+		result = reply.GetBulkReply(jsondoc.MarshalIndent(out, indent, newline, space))
+	})
+	return result
+}
+
+// execJSONDel deletes the values path matches, the whole key for the root, and returns how many were deleted
+// JSON.DEL key [path]
+func execJSONDel(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	pathArg := []byte(".")
+	if len(args) > 1 {
+		pathArg = args[1]
+	}
+	if len(args) > 2 {
+		return reply.GetArgNumErrReply("json.del")
+	}
+	path, errReply := parseJSONPath(pathArg)
+	if errReply != nil {
+		return errReply
+	}
+
+	var result resp.Reply
+	db.WithKeyLock(key, func() {
+		doc, exists, errReply := db.getAsJSON(key)
+		if errReply != nil {
+			result = errReply
+			return
+		}
+		if !exists {
+			result = reply.GetIntReply(0)
+			return
+		}
+
+		deleted := 0
+		if path.IsRoot() {
+			db.Remove(key)
+			deleted = 1
+		} else {
+			deleted = doc.Delete(path.Find(doc.Root))
+		}
+		if deleted > 0 {
+			db.addAof(utils.ToCmdLineWithName("JSON.DEL", args[0], pathArg))
+		}
+		result = reply.GetIntReply(int64(deleted))
+	})
+	return result
+}
+
+// withJSONMatches runs fn with the matches of the optional path argument under the read lock of key.
+// It replies with nil if the key doesn't exist
+func withJSONMatches(db *DB, args [][]byte, cmdName string,
+	fn func(path *jsondoc.Path, matches []*jsondoc.Match) resp.Reply) resp.Reply {
+	key := string(args[0])
+	pathArg := []byte(".")
+	if len(args) > 1 {
+		pathArg = args[1]
+	}
+	if len(args) > 2 {
+		return reply.GetArgNumErrReply(cmdName)
+	}
+	path, errReply := parseJSONPath(pathArg)
+	if errReply != nil {
+		return errReply
+	}
+
+	var result resp.Reply
+	db.WithRKeyLock(key, func() {
+		doc, exists, errReply := db.getAsJSON(key)
+		switch {
+		case errReply != nil:
+			result = errReply
+		case !exists:
+			result = reply.GetNullBulkReply()
+		default:
+			result = fn(path, findJSON(doc, path))
+		}
+	})
+	return result
+}
+
+// execJSONType returns the JSON type of the values path matches
+// JSON.TYPE key [path]
+func execJSONType(db *DB, args [][]byte) resp.Reply {
+	return withJSONMatches(db, args, "json.type", func(path *jsondoc.Path, matches []*jsondoc.Match) resp.Reply {
+		if path.Legacy {
+			if len(matches) == 0 {
+				return reply.GetNullBulkReply()
+			}
+			return reply.GetStatusReply(jsondoc.TypeName(matches[0].Value))
+		}
+		types := make([][]byte, len(matches))
+		for i, m := range matches {
+			types[i] = []byte(jsondoc.TypeName(m.Value))
+		}
+		return reply.GetMultiBulkReply(types)
+	})
+}
+
+// execJSONArrLen returns the length of the arrays path matches
+// JSON.ARRLEN key [path]
+func execJSONArrLen(db *DB, args [][]byte) resp.Reply {
+	return withJSONMatches(db, args, "json.arrlen", func(path *jsondoc.Path, matches []*jsondoc.Match) resp.Reply {
+		results := make([]resp.Reply, len(matches))
+		for i, m := range matches {
+			if arr, ok := m.Value.(*jsondoc.Array); ok {
+				results[i] = reply.GetIntReply(int64(len(arr.Elems)))
+			}
+		}
+		return jsonResultsReply(path, matches, results, "array")
+	})
+}
+
+// execJSONObjKeys returns the keys of the objects path matches
+// JSON.OBJKEYS key [path]
+func execJSONObjKeys(db *DB, args [][]byte) resp.Reply {
+	return withJSONMatches(db, args, "json.objkeys", func(path *jsondoc.Path, matches []*jsondoc.Match) resp.Reply {
+		results := make([]resp.Reply, len(matches))
+		for i, m := range matches {
+			if obj, ok := m.Value.(*jsondoc.Object); ok {
+				keys := obj.Keys()
+				replyKeys := make([][]byte, len(keys))
+				for j, k := range keys {
+					replyKeys[j] = []byte(k)
+				}
+				results[i] = reply.GetMultiBulkReply(replyKeys)
+			}
+		}
+		return jsonResultsReply(path, matches, results, "object")
+	})
+}
+
+// execJSONArrAppend appends the values to the arrays path matches and returns their new lengths
+// JSON.ARRAPPEND key path value [value ...]
+func execJSONArrAppend(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	path, errReply := parseJSONPath(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	values := make([]any, len(args)-2)
+	canonical := make([][]byte, len(values))
+	for i, arg := range args[2:] {
+		if values[i], errReply = parseJSONValue(arg); errReply != nil {
+			return errReply
+		}
+		canonical[i] = jsondoc.Marshal(values[i])
+	}
+
+	var result resp.Reply
+	db.WithKeyLock(key, func() {
+		doc, exists, errReply := db.getAsJSON(key)
+		if errReply != nil {
+			result = errReply
+			return
+		}
+		if !exists {
+			result = jsonNoSuchKeyReply()
+			return
+		}
+
+		matches := findJSON(doc, path)
+		results := make([]resp.Reply, len(matches))
+		appended := false
+		for i, m := range matches {
+			arr, ok := m.Value.(*jsondoc.Array)
+			if !ok {
+				continue
+			}
+			for _, v := range values {
+				arr.Elems = append(arr.Elems, jsondoc.Clone(v))
+			}
+			results[i] = reply.GetIntReply(int64(len(arr.Elems)))
+			appended = true
+		}
+		if appended {
+			db.addAof(append(utils.ToCmdLineWithName("JSON.ARRAPPEND", args[0], args[1]), canonical...))
+		}
+		result = jsonResultsReply(path, matches, results, "array")
+	})
+	return result
+}
+
+// addNumbers adds two JSON numbers, keeping the sum an integer when both are and it doesn't overflow
+func addNumbers(a, b any) (any, bool) {
+	x, xIsInt := a.(int64)
+	y, yIsInt := b.(int64)
+	if xIsInt && yIsInt {
+		if (y > 0 && x <= math.MaxInt64-y) || (y <= 0 && x >= math.MinInt64-y) {
+			return x + y, true
+		}
+	}
+	toFloat := func(v any) (float64, bool) {
+		switch n := v.(type) {
+		case int64:
+			return float64(n), true
+		case float64:
+			return n, true
+		}
+		return 0, false
+	}
+	fx, ok := toFloat(a)
+	if !ok {
+		return nil, false
+	}
+	fy, _ := toFloat(b)
+	return fx + fy, true
+}
+
+// execJSONNumIncrBy adds number to the numbers path matches and returns the results as JSON,
+// an array of them for a JSONPath with null for the values that aren't numbers
+// JSON.NUMINCRBY key path number
+func execJSONNumIncrBy(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	path, errReply := parseJSONPath(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	incr, errReply := parseJSONValue(args[2])
+	if errReply != nil {
+		return errReply
+	}
+	switch incr.(type) {
+	case int64, float64:
+	default:
+		return reply.GetStandardErrorReply("ERR expected a number but found " + jsondoc.TypeName(incr))
+	}
+
+	var result resp.Reply
+	db.WithKeyLock(key, func() {
+		doc, exists, errReply := db.getAsJSON(key)
+		if errReply != nil {
+			result = errReply
+			return
+		}
+		if !exists {
+			result = jsonNoSuchKeyReply()
+			return
+		}
+
+		// 先算出全部结果, 出错时不做任何修改
+		matches := findJSON(doc, path)
+		sums := make([]any, len(matches))
+		isNumber := make([]bool, len(matches))
+		for i, m := range matches {
+			sums[i], isNumber[i] = addNumbers(m.Value, incr)
+			if f, ok := sums[i].(float64); ok && (math.IsInf(f, 0) || math.IsNaN(f)) {
+				result = reply.GetStandardErrorReply("ERR result is not a finite number")
+				return
+			}
+		}
+		if path.Legacy {
+			if len(matches) == 0 {
+				result = jsonPathNotExistReply(path)
+				return
+			}
+			if !isNumber[0] {
+				result = reply.GetStandardErrorReply("ERR wrong type of path value - expected a number but found " +
+					jsondoc.TypeName(matches[0].Value))
+				return
+			}
+		}
+
+		for i, m := range matches {
+			if !isNumber[i] {
+				continue
+			}
+			doc.Replace(m, sums[i])
+			// 记录结果而不是增量, 浮点数重放后不会有偏差
+			db.addAof(utils.ToCmdLineWithName("JSON.SET", args[0], []byte(m.Path), jsondoc.Marshal(sums[i])))
+		}
+		if path.Legacy {
+			result = reply.GetBulkReply(jsondoc.Marshal(sums[0]))
+			return
+		}
+		result = reply.GetBulkReply(jsondoc.Marshal(&jsondoc.Array{Elems: sums}))
+	})
+	return result
+}
+
+// execJSONStrAppend appends the JSON string value to the strings path matches and returns their new lengths
+// JSON.STRAPPEND key [path] value
+func execJSONStrAppend(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	pathArg, valueArg := []byte("."), args[1]
+	if len(args) == 3 {
+		pathArg, valueArg = args[1], args[2]
+	}
+	if len(args) > 3 {
+		return reply.GetArgNumErrReply("json.strappend")
+	}
+	path, errReply := parseJSONPath(pathArg)
+	if errReply != nil {
+		return errReply
+	}
+	value, errReply := parseJSONValue(valueArg)
+	if errReply != nil {
+		return errReply
+	}
+	suffix, ok := value.(string)
+	if !ok {
+		return reply.GetStandardErrorReply("ERR expected a string but found " + jsondoc.TypeName(value))
+	}
+
+	var result resp.Reply
+	db.WithKeyLock(key, func() {
+		doc, exists, errReply := db.getAsJSON(key)
+		if errReply != nil {
+			result = errReply
+			return
+		}
+		if !exists {
+			result = jsonNoSuchKeyReply()
+			return
+		}
+
+		matches := findJSON(doc, path)
+		results := make([]resp.Reply, len(matches))
+		appended := false
+		for i, m := range matches {
+			str, ok := m.Value.(string)
+			if !ok {
+				continue
+			}
+			str += suffix
+			doc.Replace(m, str)
+			results[i] = reply.GetIntReply(int64(len(str)))
+			appended = true
+		}
+		if appended {
+			db.addAof(utils.ToCmdLineWithName("JSON.STRAPPEND", args[0], pathArg, jsondoc.Marshal(suffix)))
+		}
+		result = jsonResultsReply(path, matches, results, "string")
+	})
+	return result
+}
+
+// execJSONMGet returns for each key the JSON of the values path matches, or nil
+// JSON.MGET key [key ...] path
+func execJSONMGet(db *DB, args [][]byte) resp.Reply {
+	path, errReply := parseJSONPath(args[len(args)-1])
+	if errReply != nil {
+		return errReply
+	}
+	keys := make([]string, len(args)-1)
+	for i, arg := range args[:len(args)-1] {
+		keys[i] = string(arg)
+	}
+
+	results := make([][]byte, len(keys))
+	db.withRKeyLocks(keys, func() {
+		for i, key := range keys {
+			// 不存在或不是 JSON 的键返回 nil
+			doc, exists, errReply := db.getAsJSON(key)
+			if errReply != nil || !exists {
+				continue
+			}
+			matches := path.Find(doc.Root)
+			if path.Legacy {
+				if len(matches) > 0 {
+					results[i] = jsondoc.Marshal(matches[0].Value)
+				}
+				continue
+			}
+			arr := &jsondoc.Array{Elems: make([]any, len(matches))}
+			for j, m := range matches {
+				arr.Elems[j] = m.Value
+			}
+			results[i] = jsondoc.Marshal(arr)
+		}
+	})
+	return reply.GetMultiBulkReply(results)
+}
+
+func init() {
+	RegisterCommand("JSON.SET", execJSONSet, -4)             // key path value [NX|XX]
+	RegisterCommand("JSON.GET", execJSONGet, -2)             // key [INDENT indent] [NEWLINE newline] [SPACE space] [path ...]
+	RegisterCommand("JSON.DEL", execJSONDel, -2)             // key [path]
+	RegisterCommand("JSON.TYPE", execJSONType, -2)           // key [path]
+	RegisterCommand("JSON.ARRAPPEND", execJSONArrAppend, -4) // key path value [value ...]
+	RegisterCommand("JSON.ARRLEN", execJSONArrLen, -2)       // key [path]
+	RegisterCommand("JSON.OBJKEYS", execJSONObjKeys, -2)     // key [path]
+	RegisterCommand("JSON.NUMINCRBY", execJSONNumIncrBy, 4)  // key path number
+	RegisterCommand("JSON.STRAPPEND", execJSONStrAppend, -3) // key [path] value
+	RegisterCommand("JSON.MGET", execJSONMGet, -3)           // key [key ...] path
+}
@@ -0,0 +1,72 @@
+package database
+
+import "testing"
+
+func TestJSONNestedArrays(t *testing.T) {
+	doc := []string{"JSON.SET", "j", "$", `{"a":[[1,2,3],[4,[5,6]],{"b":[7,8]}],"c":{"a":[9]}}`}
+	nested := [][]string{doc}
+	with := func(lines ...[]string) [][]string {
+		return append([][]string{doc}, lines...)
+	}
+	get := func(path ...string) []string {
+		return append([]string{"JSON.GET", "j"}, path...)
+	}
+	runCmdCases(t, []cmdCase{
+		// JSON.GET
+		{"index of an index", nested, get("$.a[1][1][0]"), "$3 [5]"},
+		{"negative indexes", nested, get("$.a[-1].b[-1]"), "$3 [8]"},
+		{"slice", nested, get("$.a[0][0:2]"), "$5 [1,2]"},
+		{"slice with step", nested, get("$.a[0][::2]"), "$5 [1,3]"},
+		{"wildcard then index", nested, get("$.a[*][0]"), "$5 [1,4]"},
+		{"recursive descent then index", nested, get("$..a[0]"), "$11 [[1,2,3],9]"},
+		{"index out of range", nested, get("$.a[9]"), "$2 []"},
+		{"legacy path", nested, get(".a[1][1]"), "$5 [5,6]"},
+		{"legacy path without a match", nested, get(".a[9]"),
+			"-ERR Path '.a[9]' does not exist"},
+		{"several paths", nested, get("$.a[0]", "$.a[1][1]"), `$40 {"$.a[0]":[[1,2,3]],"$.a[1][1]":[[5,6]]}`},
+
+		// JSON.SET
+		{"set nested element", with([]string{"JSON.SET", "j", "$.a[1][1][0]", "50"}), get("$.a[1]"), "$12 [[4,[50,6]]]"},
+		{"set every first element", with([]string{"JSON.SET", "j", "$.a[*][0]", `"x"`}), get("$.a"),
+			`$37 [[["x",2,3],["x",[5,6]],{"b":[7,8]}]]`},
+		{"set negative index", with([]string{"JSON.SET", "j", "$.a[0][-1]", "[]"}), get("$.a[0]"), "$10 [[1,2,[]]]"},
+		{"set new key in an array element", with([]string{"JSON.SET", "j", "$.a[2].n", "[1]"}), get("$.a[2]"),
+			`$21 [{"b":[7,8],"n":[1]}]`},
+		// 数组下标超出范围时不会扩展数组
+		{"set index out of range", nested, []string{"JSON.SET", "j", "$.a[9]", "1"}, "$-1"},
+		{"set index out of range leaves the array", with([]string{"JSON.SET", "j", "$.a[0][3]", "1"}), get("$.a[0]"),
+			"$9 [[1,2,3]]"},
+		{"set below a missing element", nested, []string{"JSON.SET", "j", "$.a[0][5].x", "1"}, "$-1"},
+		{"set whole nested array", with([]string{"JSON.SET", "j", "$.a[1]", "[[0]]"}), get("$.a"),
+			`$29 [[[1,2,3],[[0]],{"b":[7,8]}]]`},
+
+		// JSON.DEL
+		{"del nested element", with([]string{"JSON.DEL", "j", "$.a[1][1][0]"}), get("$.a[1]"), "$9 [[4,[6]]]"},
+		{"del count", nested, []string{"JSON.DEL", "j", "$.a[*][0]"}, ":2"},
+		{"del from several arrays", with([]string{"JSON.DEL", "j", "$.a[*][0]"}), get("$.a"),
+			`$29 [[[2,3],[[5,6]],{"b":[7,8]}]]`},
+		{"del negative index", with([]string{"JSON.DEL", "j", "$.a[0][-1]"}), get("$.a[0]"), "$7 [[1,2]]"},
+		{"del missing index", nested, []string{"JSON.DEL", "j", "$.a[0][7]"}, ":0"},
+		{"del whole nested array", with([]string{"JSON.DEL", "j", "$.a[1]"}), get("$.a"), `$23 [[[1,2,3],{"b":[7,8]}]]`},
+		{"del root", nested, []string{"JSON.DEL", "j", "$"}, ":1"},
+		{"key gone after deleting the root", with([]string{"JSON.DEL", "j", "$"}), []string{"EXISTS", "j"}, ":0"},
+
+		// 同一数组中的多个下标从后往前删除, 重复的下标只删除一次
+		{"del union with duplicates", [][]string{{"JSON.SET", "k", "$", "[0,1,2,3,4,5]"}},
+			[]string{"JSON.DEL", "k", "$[0,0,-1,2]"}, ":3"},
+		{"del union leaves the rest", [][]string{{"JSON.SET", "k", "$", "[0,1,2,3,4,5]"}, {"JSON.DEL", "k", "$[0,0,-1,2]"}},
+			[]string{"JSON.GET", "k"}, "$7 [1,3,4]"},
+		{"del slice", [][]string{{"JSON.SET", "k", "$", "[0,1,2,3,4,5]"}, {"JSON.DEL", "k", "$[1:5:2]"}},
+			[]string{"JSON.GET", "k"}, "$9 [0,2,4,5]"},
+		// 外层元素与它里面的元素同时匹配时都会删除
+		{"del recursive", [][]string{{"JSON.SET", "k", "$", "[[1,2],[3,4],[5,[6,7]]]"}},
+			[]string{"JSON.DEL", "k", "$..[0]"}, ":5"},
+		{"del recursive leaves the rest", [][]string{{"JSON.SET", "k", "$", "[[1,2],[3,4],[5,[6,7]]]"}, {"JSON.DEL", "k", "$..[0]"}},
+			[]string{"JSON.GET", "k"}, "$11 [[4],[[7]]]"},
+
+		// 其他命令同样作用于嵌套数组
+		{"arrappend nested", with([]string{"JSON.ARRAPPEND", "j", "$.a[1][1]", "7"}), get("$.a[1][1]"), "$9 [[5,6,7]]"},
+		{"arrlen of each element", nested, []string{"JSON.ARRLEN", "j", "$.a[*]"}, "*3 :3 :2 $-1"},
+		{"type of each element", nested, []string{"JSON.TYPE", "j", "$.a[*]"}, "*3 $5 array $5 array $6 object"},
+	})
+}
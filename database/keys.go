@@ -1,10 +1,21 @@
 package database
 
 import (
+	"Redis_Go/datastruct/bloom"
+	"Redis_Go/datastruct/cms"
+	"Redis_Go/datastruct/hash"
+	"Redis_Go/datastruct/jsondoc"
+	"Redis_Go/datastruct/list"
+	"Redis_Go/datastruct/set"
+	"Redis_Go/datastruct/stream"
+	"Redis_Go/datastruct/zset"
+	"Redis_Go/interface/database"
 	"Redis_Go/interface/resp"
 	"Redis_Go/lib/utils"
 	"Redis_Go/lib/wildcard"
 	"Redis_Go/resp/reply"
+	"strconv"
+	"strings"
 )
 
 func execDel(db *DB, args [][]byte) resp.Reply {
@@ -30,10 +41,107 @@ func execExists(db *DB, args [][]byte) resp.Reply {
 	return reply.GetIntReply(result)
 }
 
+// Handle the UNLINK command.
+// It removes the keys like DEL. Like DEL, it only drops the references to the values and leaves them to the
+// garbage collector, which reclaims them concurrently; the values are never cleared in place, since a reader
+// such as MGET or SORT BY may still hold one.
+// UNLINK key [key ...]
+func execUnlink(db *DB, args [][]byte) resp.Reply {
+	keys := make([]string, len(args))
+	for i, v := range args {
+		keys[i] = string(v)
+	}
+	handle := db.lockMgr.LockKeys(keys)
+	defer db.lockMgr.UnlockKeys(handle)
+
+	deleted := 0
+	for _, key := range utils.DedupSortedKeys(keys) {
+		if _, ok := db.GetEntity(key); !ok {
+			continue
+		}
+		db.Remove(key)
+		deleted++
+	}
+	if deleted > 0 {
+		db.addAof(utils.ToCmdLineWithName("UNLINK", args...))
+	}
+	return reply.GetIntReply(int64(deleted))
+}
+
+// Handle the TOUCH command.
+// It updates the last access time of the keys and returns how many of them exist.
+// TOUCH key [key ...]
+func execTouch(db *DB, args [][]byte) resp.Reply {
+	keys := make([]string, len(args))
+	for i, v := range args {
+		keys[i] = string(v)
+	}
+	result := int64(0)
+	db.withRKeyLocks(keys, func() {
+		for _, key := range keys {
+			// GetEntity 会记录访问
+			if _, ok := db.GetEntity(key); ok {
+				result++
+			}
+		}
+	})
+	return reply.GetIntReply(result)
+}
+
+// Handle the DBSIZE command.
+// It returns the number of keys in the database, including expired keys not reclaimed yet.
+func execDBSize(db *DB, args [][]byte) resp.Reply {
+	return reply.GetIntReply(int64(db.dicts.Load().data.Len()))
+}
+
+// Handle the RANDOMKEY command.
+// It returns a random key of the database, reclaiming the expired keys it comes across.
+func execRandomKey(db *DB, args [][]byte) resp.Reply {
+	for {
+		keys := db.dicts.Load().data.RandomKeys(1)
+		if len(keys) == 0 {
+			return reply.GetNullBulkReply()
+		}
+		key := keys[0]
+		if !db.IsExpired(key) {
+			return reply.GetBulkReply([]byte(key))
+		}
+		db.WithKeyLock(key, func() {
+			// GetEntity 删除过期的 key
+			db.GetEntity(key)
+		})
+	}
+}
+
+// parseFlushMode parses the [ASYNC|SYNC] option of FLUSHDB and FLUSHALL
+func parseFlushMode(args [][]byte) (async bool, errReply resp.Reply) {
+	if len(args) == 0 {
+		return false, nil
+	}
+	if len(args) == 1 {
+		switch strings.ToUpper(string(args[0])) {
+		case "ASYNC":
+			return true, nil
+		case "SYNC":
+			return false, nil
+		}
+	}
+	return false, reply.GetSyntaxErrReply()
+}
+
 // Handle the FLUSHDB command.
-// It clears all keys from the database
+// It clears all keys from the database, with ASYNC the old keys are released in the background
+// FLUSHDB [ASYNC|SYNC]
 func execFlushDB(db *DB, args [][]byte) resp.Reply {
-	db.Flush()
+	async, errReply := parseFlushMode(args)
+	if errReply != nil {
+		return errReply
+	}
+	if async {
+		db.FlushAsync()
+	} else {
+		db.Flush()
+	}
 	db.addAof(utils.ToCmdLineWithName("FLUSHDB", args...))
 	return reply.GetOKReply()
 }
@@ -43,16 +151,9 @@ func execFlushDB(db *DB, args [][]byte) resp.Reply {
 func execType(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
 	if entity, ok := db.GetEntity(key); ok {
-		switch entity.Data.(type) {
-		// If the entity is []byte, return the type as "string"
-		case []byte:
-			return reply.GetBulkReply([]byte("string"))
-		}
-		// TODO: Add more types as needed
-	} else {
-		return reply.GetStatusReply("none")
+		return reply.GetStatusReply(typeName(entity))
 	}
-	return reply.GetUnknownReply()
+	return reply.GetStatusReply("none")
 }
 
 // Handle the RENAME command.
@@ -65,8 +166,14 @@ func execRename(db *DB, args [][]byte) resp.Reply {
 	if !ok {
 		return reply.GetStandardErrorReply("ERR no such key")
 	}
+	expireTime, hasTTL := db.ExpireTime(src)
 	db.PutEntity(dst, entity)
 	db.Remove(src)
+	if hasTTL {
+		db.Expire(dst, expireTime)
+	} else {
+		db.Persist(dst)
+	}
 	db.addAof(utils.ToCmdLineWithName("RENAME", args...))
 	return reply.GetOKReply()
 }
@@ -84,8 +191,12 @@ func execRenameNX(db *DB, args [][]byte) resp.Reply {
 	if _, ok := db.GetEntity(dst); ok {
 		return reply.GetIntReply(0)
 	}
+	expireTime, hasTTL := db.ExpireTime(src)
 	db.PutEntity(dst, entity)
 	db.Remove(src)
+	if hasTTL {
+		db.Expire(dst, expireTime)
+	}
 	db.addAof(utils.ToCmdLineWithName("RENAMENX", args...))
 	return reply.GetIntReply(1)
 }
@@ -95,8 +206,8 @@ func execRenameNX(db *DB, args [][]byte) resp.Reply {
 func execKeys(db *DB, args [][]byte) resp.Reply {
 	pattern := wildcard.CompilePattern(string(args[0]))
 	result := make([][]byte, 0) // Store all matching keys
-	db.data.ForEach(func(key string, val interface{}) bool {
-		if pattern.IsMatch(key) {
+	db.dicts.Load().data.ForEach(func(key string, val interface{}) bool {
+		if pattern.IsMatch(key) && !db.IsExpired(key) {
 			result = append(result, []byte(key))
 		}
 		return true
@@ -104,12 +215,145 @@ func execKeys(db *DB, args [][]byte) resp.Reply {
 	return reply.GetMultiBulkReply(result)
 }
 
+// typeName returns the name of the type of the value held by entity
+func typeName(entity *database.DataEntity) string {
+	if _, isString := stringEncoding(entity); isString {
+		return "string"
+	}
+	switch entity.Data.(type) {
+	case *hash.Hash:
+		return "hash"
+	case *list.List:
+		return "list"
+	case *set.Set:
+		return "set"
+	case zset.ZSet:
+		return "zset"
+	case *stream.Stream:
+		return "stream"
+	case *jsondoc.Document:
+		return "ReJSON-RL"
+	case *bloom.Filter:
+		return "MBbloom--"
+	case *cms.Sketch:
+		return "CMSk-TYPE"
+	}
+	return "unknown"
+}
+
+// parseElementScanArgs parses the "cursor [MATCH pattern] [COUNT count]" arguments of SSCAN, HSCAN and ZSCAN.
+// flag is an extra option without a value that the command accepts, if not empty
+func parseElementScanArgs(args [][]byte, flag string) (cursor uint64, pattern string, count int, flagSet bool, errReply resp.Reply) {
+	cursor, err := strconv.ParseUint(string(args[0]), 10, 64)
+	if err != nil {
+		return 0, "", 0, false, reply.GetStandardErrorReply("ERR invalid cursor")
+	}
+
+	pattern = "*"
+	count = 10
+	for i := 1; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		if flag != "" && option == flag {
+			flagSet = true
+			continue
+		}
+		if i+1 >= len(args) {
+			return 0, "", 0, false, reply.GetSyntaxErrReply()
+		}
+		switch option {
+		case "MATCH":
+			pattern = string(args[i+1])
+		case "COUNT":
+			c, err := strconv.Atoi(string(args[i+1]))
+			if err != nil {
+				return 0, "", 0, false, reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+			}
+			if c < 1 {
+				return 0, "", 0, false, reply.GetSyntaxErrReply()
+			}
+			count = c
+		default:
+			return 0, "", 0, false, reply.GetSyntaxErrReply()
+		}
+		i++
+	}
+	return cursor, pattern, count, flagSet, nil
+}
+
+// Handle the SCAN command.
+// It incrementally iterates the keys of the database; see dict.Dict.Scan for the guarantees of the cursor.
+// SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+func execScan(db *DB, args [][]byte) resp.Reply {
+	cursor, err := strconv.ParseUint(string(args[0]), 10, 64)
+	if err != nil {
+		return reply.GetStandardErrorReply("ERR invalid cursor")
+	}
+
+	pattern := "*"
+	count := 10
+	typeFilter := ""
+	for i := 1; i < len(args); i++ {
+		if i+1 >= len(args) {
+			return reply.GetSyntaxErrReply()
+		}
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			pattern = string(args[i+1])
+		case "COUNT":
+			c, err := strconv.Atoi(string(args[i+1]))
+			if err != nil {
+				return reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+			}
+			if c < 1 {
+				return reply.GetSyntaxErrReply()
+			}
+			count = c
+		case "TYPE":
+			typeFilter = string(args[i+1])
+		default:
+			return reply.GetSyntaxErrReply()
+		}
+		i++
+	}
+
+	// The dict is locked while it is scanned, so keys are only collected here and filtered afterwards
+	keys := make([]string, 0, count)
+	next := db.dicts.Load().data.Scan(cursor, count, func(key string, val interface{}) bool {
+		keys = append(keys, key)
+		return true
+	})
+
+	matcher := wildcard.CompilePattern(pattern)
+	result := make([][]byte, 0, len(keys))
+	for _, key := range keys {
+		if !matcher.IsMatch(key) {
+			continue
+		}
+		// SCAN 不算作对 key 的访问, 和 OBJECT 一样不更新 LFU/LRU 信息
+		entity, exists := db.peekEntity(key)
+		if !exists {
+			continue
+		}
+		// TYPE 的名字不区分大小写, 模块类型的名字本身就有大写字母
+		if typeFilter != "" && !strings.EqualFold(typeName(entity), typeFilter) {
+			continue
+		}
+		result = append(result, []byte(key))
+	}
+	return reply.GetScanReply(int64(next), result)
+}
+
 func init() {
 	RegisterCommand("DEL", execDel, -2)
 	RegisterCommand("EXISTS", execExists, -2)
-	RegisterCommand("FLUSHDB", execFlushDB, -1)
+	RegisterCommand("FLUSHDB", execFlushDB, -1) // [ASYNC|SYNC]
 	RegisterCommand("TYPE", execType, 2)
 	RegisterCommand("RENAME", execRename, 3)
 	RegisterCommand("RENAMENX", execRenameNX, 3)
 	RegisterCommand("KEYS", execKeys, 2)
+	RegisterCommand("SCAN", execScan, -2)
+	RegisterCommand("UNLINK", execUnlink, -2)
+	RegisterCommand("TOUCH", execTouch, -2)
+	RegisterCommand("DBSIZE", execDBSize, 1)
+	RegisterCommand("RANDOMKEY", execRandomKey, 1)
 }
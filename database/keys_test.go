@@ -0,0 +1,24 @@
+package database
+
+import "testing"
+
+func TestScanType(t *testing.T) {
+	keys := [][]string{
+		{"SET", "k", "v"},
+		{"JSON.SET", "j", "$", `{"a":1}`},
+		{"BF.ADD", "b", "x"},
+		{"CMS.INITBYDIM", "c", "10", "5"},
+	}
+	runCmdCases(t, []cmdCase{
+		// 模块类型的名字带大写字母, TYPE 按不区分大小写的方式比较
+		{"json", keys, []string{"SCAN", "0", "TYPE", "ReJSON-RL"}, "*2 :0 *1 $1 j"},
+		{"json lower case", keys, []string{"SCAN", "0", "TYPE", "rejson-rl"}, "*2 :0 *1 $1 j"},
+		{"bloom", keys, []string{"SCAN", "0", "TYPE", "MBbloom--"}, "*2 :0 *1 $1 b"},
+		{"cms", keys, []string{"SCAN", "0", "TYPE", "cmsk-type"}, "*2 :0 *1 $1 c"},
+		{"string upper case", keys, []string{"SCAN", "0", "TYPE", "STRING"}, "*2 :0 *1 $1 k"},
+		{"no such type", keys, []string{"SCAN", "0", "TYPE", "list"}, "*2 :0 *0"},
+		// SCAN 不算作访问, 新 key 的 LFU 计数保持初始值
+		{"scan keeps the access stats", [][]string{keys[0], {"SCAN", "0", "COUNT", "100"}, {"SCAN", "0", "TYPE", "string"}},
+			[]string{"OBJECT", "FREQ", "k"}, ":5"},
+	})
+}
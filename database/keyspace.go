@@ -0,0 +1,297 @@
+package database
+
+import (
+	"Redis_Go/datastruct/bloom"
+	"Redis_Go/datastruct/cms"
+	"Redis_Go/datastruct/hash"
+	"Redis_Go/datastruct/jsondoc"
+	"Redis_Go/datastruct/list"
+	"Redis_Go/datastruct/set"
+	"Redis_Go/datastruct/stream"
+	"Redis_Go/datastruct/zset"
+	"Redis_Go/interface/database"
+	"Redis_Go/interface/resp"
+	"Redis_Go/lib/utils"
+	"Redis_Go/resp/reply"
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// Commands that work across the DBs of a Database, like SELECT they are executed by Database rather than by a DB.
+// A DB's index changes when SWAPDB swaps it with another, so they log their AOF lines through addAofLine,
+// which builds the line from the indexes the DBs have at that time
+type multiDBExecFunc func(c resp.Connection, d *Database, args [][]byte) resp.Reply
+
+type multiDBCommand struct {
+	exec   multiDBExecFunc
+	argCnt int
+}
+
+var multiDBCmdTable = make(map[string]*multiDBCommand)
+
+func registerMultiDBCommand(name string, exec multiDBExecFunc, argCnt int) {
+	multiDBCmdTable[strings.ToLower(name)] = &multiDBCommand{exec: exec, argCnt: argCnt}
+}
+
+// getDB returns the DB at index, which SWAPDB may change at any time
+func (d *Database) getDB(index int) database.Database {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.dbSet[index]
+}
+
+// getDBs returns the DBs at the given indexes, ok is false if one of them isn't a *DB
+func (d *Database) getDBs(indexes ...int) (dbs []*DB, ok bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	dbs = make([]*DB, len(indexes))
+	for i, index := range indexes {
+		if dbs[i], ok = d.dbSet[index].(*DB); !ok {
+			return nil, false
+		}
+	}
+	return dbs, true
+}
+
+// addAofLine appends the line built by build to the AOF. SWAPDB can't change the indexes of the DBs meanwhile
+func (d *Database) addAofLine(build func() (dbIndex int, line CmdLine)) {
+	if d.aofHandler == nil {
+		return
+	}
+	d.aofMu.Lock()
+	defer d.aofMu.Unlock()
+	dbIndex, line := build()
+	d.aofHandler.AddAof(dbIndex, line)
+}
+
+// parseDBIndex parses a DB index argument of a command
+func (d *Database) parseDBIndex(arg []byte) (int, resp.Reply) {
+	index, err := strconv.Atoi(string(arg))
+	if err != nil {
+		return 0, reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+	}
+	if index < 0 || index >= len(d.dbSet) {
+		return 0, reply.GetStandardErrorReply("ERR DB index is out of range")
+	}
+	return index, nil
+}
+
+// lockKeyInDBs takes the write locks of srcKey in src and of dstKey in dst, in the lock order of the DBs
+// so that two commands moving keys in opposite directions can't deadlock, and returns the function releasing them
+func lockKeyInDBs(src *DB, srcKey string, dst *DB, dstKey string) (unlock func()) {
+	if src == dst {
+		handle := src.lockMgr.LockKeys([]string{srcKey, dstKey})
+		return func() { src.lockMgr.UnlockKeys(handle) }
+	}
+	first, firstKey, second, secondKey := src, srcKey, dst, dstKey
+	if dst.lockOrder < src.lockOrder {
+		first, firstKey, second, secondKey = dst, dstKey, src, srcKey
+	}
+	firstLock := first.lockMgr.Lock(firstKey)
+	secondLock := second.lockMgr.Lock(secondKey)
+	return func() {
+		second.lockMgr.Unlock(secondLock)
+		first.lockMgr.Unlock(firstLock)
+	}
+}
+
+// cloneEntity returns a deep copy of the value held by entity
+func cloneEntity(entity *database.DataEntity) *database.DataEntity {
+	if str, ok := stringBytes(entity); ok {
+		return newStringEntity(bytes.Clone(str))
+	}
+	var data interface{}
+	switch val := entity.Data.(type) {
+	case *hash.Hash:
+		data = val.Clone()
+	case *list.List:
+		data = val.Clone()
+	case *set.Set:
+		data = val.Clone()
+	case zset.ZSet:
+		data = val.Clone()
+	case *stream.Stream:
+		data = val.Clone()
+	case *jsondoc.Document:
+		data = &jsondoc.Document{Root: jsondoc.Clone(val.Root)}
+	case *bloom.Filter:
+		data = val.Clone()
+	case *cms.Sketch:
+		data = val.Clone()
+	default:
+		data = entity.Data
+	}
+	return &database.DataEntity{Data: data}
+}
+
+// execCopy copies the value of source to destination, in the DB given by DB or the current one.
+// It returns 1 if the value was copied, 0 if source doesn't exist or destination does and REPLACE isn't given
+// COPY source destination [DB destination-db] [REPLACE]
+func execCopy(c resp.Connection, d *Database, args [][]byte) resp.Reply {
+	srcKey, dstKey := string(args[0]), string(args[1])
+	srcIndex := c.GetDBIndex()
+	dstIndex, replace := srcIndex, false
+	for i := 2; i < len(args); i++ {
+		switch option := strings.ToUpper(string(args[i])); {
+		case option == "REPLACE":
+			replace = true
+		case option == "DB" && i+1 < len(args):
+			var errReply resp.Reply
+			if dstIndex, errReply = d.parseDBIndex(args[i+1]); errReply != nil {
+				return errReply
+			}
+			i++
+		default:
+			return reply.GetSyntaxErrReply()
+		}
+	}
+	if srcIndex == dstIndex && srcKey == dstKey {
+		return reply.GetStandardErrorReply("ERR source and destination objects are the same")
+	}
+	dbs, ok := d.getDBs(srcIndex, dstIndex)
+	if !ok {
+		return reply.GetStandardErrorReply("ERR COPY is not supported by this database")
+	}
+	src, dst := dbs[0], dbs[1]
+
+	unlock := lockKeyInDBs(src, srcKey, dst, dstKey)
+	defer unlock()
+
+	entity, exists := src.GetEntity(srcKey)
+	if !exists {
+		return reply.GetIntReply(0)
+	}
+	if _, exists := dst.GetEntity(dstKey); exists {
+		if !replace {
+			return reply.GetIntReply(0)
+		}
+		dst.Remove(dstKey)
+	}
+	dst.PutEntity(dstKey, cloneEntity(entity))
+	if expireTime, hasTTL := src.ExpireTime(srcKey); hasTTL {
+		dst.Expire(dstKey, expireTime)
+	}
+	dst.signalKey(dstKey)
+
+	d.addAofLine(func() (int, CmdLine) {
+		line := utils.String2Cmdline("COPY", srcKey, dstKey, "DB", strconv.Itoa(dst.index))
+		if replace {
+			line = append(line, []byte("REPLACE"))
+		}
+		return src.index, line
+	})
+	return reply.GetIntReply(1)
+}
+
+// execMove moves key from the current DB to the given one.
+// It returns 1 if the key was moved, 0 if it doesn't exist in the current DB or already exists in the other
+// MOVE key db
+func execMove(c resp.Connection, d *Database, args [][]byte) resp.Reply {
+	key := string(args[0])
+	srcIndex := c.GetDBIndex()
+	dstIndex, errReply := d.parseDBIndex(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	if srcIndex == dstIndex {
+		return reply.GetStandardErrorReply("ERR source and destination objects are the same")
+	}
+	dbs, ok := d.getDBs(srcIndex, dstIndex)
+	if !ok {
+		return reply.GetStandardErrorReply("ERR MOVE is not supported by this database")
+	}
+	src, dst := dbs[0], dbs[1]
+
+	unlock := lockKeyInDBs(src, key, dst, key)
+	defer unlock()
+
+	entity, exists := src.GetEntity(key)
+	if !exists {
+		return reply.GetIntReply(0)
+	}
+	if _, exists := dst.GetEntity(key); exists {
+		return reply.GetIntReply(0)
+	}
+	dst.PutEntity(key, entity)
+	if expireTime, hasTTL := src.ExpireTime(key); hasTTL {
+		dst.Expire(key, expireTime)
+	}
+	src.Remove(key)
+	dst.signalKey(key)
+
+	d.addAofLine(func() (int, CmdLine) {
+		return src.index, utils.String2Cmdline("MOVE", key, strconv.Itoa(dst.index))
+	})
+	return reply.GetIntReply(1)
+}
+
+// execSwapDB swaps two DBs, so that clients connected to one see the data of the other right away.
+// Clients blocked on a key keep waiting on the DB they blocked in
+// SWAPDB index1 index2
+func execSwapDB(c resp.Connection, d *Database, args [][]byte) resp.Reply {
+	first, err := strconv.Atoi(string(args[0]))
+	if err != nil {
+		return reply.GetStandardErrorReply("ERR invalid first DB index")
+	}
+	second, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return reply.GetStandardErrorReply("ERR invalid second DB index")
+	}
+	if first < 0 || first >= len(d.dbSet) || second < 0 || second >= len(d.dbSet) {
+		return reply.GetStandardErrorReply("ERR DB index is out of range")
+	}
+
+	// 持有 aofMu, 交换期间其他命令不会用旧的下标写 AOF
+	d.aofMu.Lock()
+	defer d.aofMu.Unlock()
+	d.mu.Lock()
+	d.dbSet[first], d.dbSet[second] = d.dbSet[second], d.dbSet[first]
+	if firstDB, ok := d.dbSet[first].(*DB); ok {
+		firstDB.index = first
+	}
+	if secondDB, ok := d.dbSet[second].(*DB); ok {
+		secondDB.index = second
+	}
+	d.mu.Unlock()
+
+	if d.aofHandler != nil {
+		d.aofHandler.AddAof(c.GetDBIndex(), utils.String2Cmdline("SWAPDB", string(args[0]), string(args[1])))
+	}
+	return reply.GetOKReply()
+}
+
+// execFlushAll clears all the DBs, with ASYNC the old keys are released in the background
+// FLUSHALL [ASYNC|SYNC]
+func execFlushAll(c resp.Connection, d *Database, args [][]byte) resp.Reply {
+	async, errReply := parseFlushMode(args)
+	if errReply != nil {
+		return errReply
+	}
+	d.mu.RLock()
+	dbSet := append([]database.Database(nil), d.dbSet...)
+	d.mu.RUnlock()
+	for _, db := range dbSet {
+		db, ok := db.(*DB)
+		if !ok {
+			continue
+		}
+		if async {
+			db.FlushAsync()
+		} else {
+			db.Flush()
+		}
+	}
+
+	d.addAofLine(func() (int, CmdLine) {
+		return c.GetDBIndex(), utils.ToCmdLineWithName("FLUSHALL", args...)
+	})
+	return reply.GetOKReply()
+}
+
+func init() {
+	registerMultiDBCommand("COPY", execCopy, -3)         // source destination [DB destination-db] [REPLACE]
+	registerMultiDBCommand("MOVE", execMove, 3)          // key db
+	registerMultiDBCommand("SWAPDB", execSwapDB, 3)      // index1 index2
+	registerMultiDBCommand("FLUSHALL", execFlushAll, -1) // [ASYNC|SYNC]
+}
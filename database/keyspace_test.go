@@ -0,0 +1,148 @@
+package database
+
+import (
+	DatabaseInterface "Redis_Go/interface/database"
+	"strings"
+	"testing"
+)
+
+// testConn is a connection that only remembers the DB it selected
+type testConn struct{ dbIndex int }
+
+func (c *testConn) Write([]byte) error { return nil }
+func (c *testConn) GetDBIndex() int    { return c.dbIndex }
+func (c *testConn) SelectDB(index int) { c.dbIndex = index }
+
+// dbStep runs cmd on DB db and expects the reply, with CRLF replaced by spaces as in cmdCase
+type dbStep struct {
+	db   int
+	cmd  []string
+	want string
+}
+
+// newTestDatabase creates 16 empty DBs without an AOF
+func newTestDatabase() *Database {
+	d := &Database{}
+	for i := 0; i < 16; i++ {
+		d.dbSet = append(d.dbSet, DatabaseInterface.Database(NewDB(i)))
+	}
+	return d
+}
+
+// runDBSteps runs steps in order on d, for the commands that work across DBs
+func runDBSteps(t *testing.T, d *Database, steps []dbStep) {
+	t.Helper()
+	for i, step := range steps {
+		args := make([][]byte, len(step.cmd))
+		for j, arg := range step.cmd {
+			args[j] = []byte(arg)
+		}
+		got := strings.TrimSpace(strings.ReplaceAll(string(d.Exec(&testConn{step.db}, args).ToBytes()), "\r\n", " "))
+		if step.want != "" && got != step.want {
+			t.Fatalf("step %d: %s on DB %d replied %q, want %q", i, strings.Join(step.cmd, " "), step.db, got, step.want)
+		}
+	}
+}
+
+func TestSwapDB(t *testing.T) {
+	d := newTestDatabase()
+	runDBSteps(t, d, []dbStep{
+		{0, []string{"SETEX", "a", "100", "1"}, "+OK"},
+		{0, []string{"HSET", "h", "f", "v", "g", "w"}, ":2"},
+		{0, []string{"HEXPIRE", "h", "100", "FIELDS", "1", "f"}, "*1 :1"},
+		{1, []string{"SET", "b", "2"}, "+OK"},
+		{0, []string{"SWAPDB", "0", "1"}, "+OK"},
+
+		{0, []string{"GET", "a"}, "$-1"},
+		{0, []string{"GET", "b"}, "$1 2"},
+		{0, []string{"DBSIZE"}, ":1"},
+		// 过期时间和字段过期时间都随 DB 一起交换
+		{1, []string{"GET", "a"}, "$1 1"},
+		{1, []string{"HTTL", "h", "FIELDS", "2", "f", "g"}, "*2 :100 :-1"},
+		{1, []string{"DBSIZE"}, ":2"},
+		// 交换后写入的是连接所选下标上的 DB
+		{1, []string{"SET", "c", "3"}, "+OK"},
+		{0, []string{"SWAPDB", "1", "0"}, "+OK"},
+		{0, []string{"GET", "c"}, "$1 3"},
+
+		{0, []string{"SWAPDB", "0", "0"}, "+OK"},
+		{0, []string{"DBSIZE"}, ":3"},
+		{0, []string{"SWAPDB", "0", "16"}, "-ERR DB index is out of range"},
+		{0, []string{"SWAPDB", "-1", "0"}, "-ERR DB index is out of range"},
+		{0, []string{"SWAPDB", "x", "0"}, "-ERR invalid first DB index"},
+		{0, []string{"SWAPDB", "0", "y"}, "-ERR invalid second DB index"},
+		{0, []string{"SWAPDB", "0"}, "-ERR wrong number of arguments for 'swapdb' command"},
+	})
+	// a 交换到 DB 1 又换回了 DB 0, 过期时间一直跟着它
+	if _, ok := d.getDB(0).(*DB).ExpireTime("a"); !ok {
+		t.Fatal("a lost its expiration time in the swaps")
+	}
+	if _, ok := d.getDB(1).(*DB).ExpireTime("a"); ok {
+		t.Fatal("DB 1 still has an expiration time for a")
+	}
+}
+
+// TestFlushAsync checks that FLUSHDB ASYNC and FLUSHALL ASYNC drop the expiration times of keys and
+// of hash fields along with the keys, so that keys created afterwards don't inherit them
+func TestFlushAsync(t *testing.T) {
+	fill := []dbStep{
+		{0, []string{"SETEX", "a", "100", "1"}, "+OK"},
+		{0, []string{"HSET", "h", "f", "v"}, ":1"},
+		{0, []string{"HEXPIRE", "h", "100", "FIELDS", "1", "f"}, "*1 :1"},
+		{1, []string{"SETEX", "b", "100", "2"}, "+OK"},
+		{1, []string{"HSET", "h", "f", "v"}, ":1"},
+		{1, []string{"HEXPIRE", "h", "100", "FIELDS", "1", "f"}, "*1 :1"},
+	}
+	// emptied checks that DB index holds no key, expiration time or hash with expiring fields
+	emptied := func(d *Database, index int) {
+		t.Helper()
+		dicts := d.getDB(index).(*DB).dicts.Load()
+		if dicts.data.Len() != 0 || dicts.ttlMap.Len() != 0 || dicts.hashTTLKeys.Len() != 0 {
+			t.Fatalf("DB %d kept %d keys, %d expiration times and %d hashes with expiring fields",
+				index, dicts.data.Len(), dicts.ttlMap.Len(), dicts.hashTTLKeys.Len())
+		}
+	}
+	recreated := []dbStep{
+		{0, []string{"SET", "a", "x"}, "+OK"},
+		{0, []string{"HSET", "h", "f", "v"}, ":1"},
+		{0, []string{"HTTL", "h", "FIELDS", "1", "f"}, "*1 :-1"},
+	}
+
+	d := newTestDatabase()
+	runDBSteps(t, d, fill)
+	runDBSteps(t, d, []dbStep{
+		{0, []string{"FLUSHDB", "ASYNC"}, "+OK"},
+		{0, []string{"DBSIZE"}, ":0"},
+		{1, []string{"DBSIZE"}, ":2"},
+	})
+	emptied(d, 0)
+	runDBSteps(t, d, recreated)
+	if _, ok := d.getDB(0).(*DB).ExpireTime("a"); ok {
+		t.Fatal("a got the expiration time it had before FLUSHDB ASYNC")
+	}
+	if _, ok := d.getDB(1).(*DB).ExpireTime("b"); !ok {
+		t.Fatal("FLUSHDB ASYNC on DB 0 dropped the expiration time of b in DB 1")
+	}
+
+	d = newTestDatabase()
+	runDBSteps(t, d, fill)
+	runDBSteps(t, d, []dbStep{
+		{0, []string{"FLUSHALL", "ASYNC"}, "+OK"},
+		{0, []string{"DBSIZE"}, ":0"},
+		{1, []string{"DBSIZE"}, ":0"},
+	})
+	emptied(d, 0)
+	emptied(d, 1)
+	runDBSteps(t, d, recreated)
+	if _, ok := d.getDB(0).(*DB).ExpireTime("a"); ok {
+		t.Fatal("a got the expiration time it had before FLUSHALL ASYNC")
+	}
+
+	runDBSteps(t, d, []dbStep{
+		{0, []string{"FLUSHDB", "SYNC"}, "+OK"},
+		{0, []string{"DBSIZE"}, ":0"},
+		{0, []string{"FLUSHDB", "LATER"}, "-ERR syntax error"},
+		{0, []string{"FLUSHALL", "ASYNC", "SYNC"}, "-ERR syntax error"},
+	})
+	emptied(d, 0)
+}
@@ -0,0 +1,29 @@
+package database
+
+import "sync"
+
+const lazyFreeQueueSize = 1024
+
+var (
+	lazyFreeQueue chan func()
+	lazyFreeOnce  sync.Once
+)
+
+// lazyFree runs release on the lazy free goroutine, so that the command doesn't wait for it.
+// If the goroutine has fallen so far behind that its queue is full, release runs right away instead,
+// rather than blocking the command until there is room
+func lazyFree(release func()) {
+	lazyFreeOnce.Do(func() {
+		lazyFreeQueue = make(chan func(), lazyFreeQueueSize)
+		go func() {
+			for release := range lazyFreeQueue {
+				release()
+			}
+		}()
+	})
+	select {
+	case lazyFreeQueue <- release:
+	default:
+		release()
+	}
+}
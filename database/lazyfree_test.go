@@ -0,0 +1,42 @@
+package database
+
+import (
+	"Redis_Go/datastruct/set"
+	"strconv"
+	"testing"
+)
+
+func TestLazyFreeRunsInPlaceWhenFull(t *testing.T) {
+	block, started := make(chan struct{}), make(chan struct{})
+	lazyFree(func() {
+		close(started)
+		<-block
+	})
+	<-started
+	for i := 0; i < lazyFreeQueueSize; i++ {
+		lazyFree(func() {})
+	}
+	ran := false
+	lazyFree(func() { ran = true })
+	close(block)
+	if !ran {
+		t.Fatal("lazyFree with a full queue didn't run the release right away")
+	}
+}
+
+// TestUnlinkLeavesValuesIntact checks that UNLINK doesn't clear a large value that a reader still holds
+func TestUnlinkLeavesValuesIntact(t *testing.T) {
+	db := NewDB()
+	args := []string{"SADD", "s"}
+	for i := 0; i < 1000; i++ {
+		args = append(args, strconv.Itoa(i))
+	}
+	execLine(db, args...)
+	entity, _ := db.GetEntity("s")
+	if got := execLine(db, "UNLINK", "s"); got != ":1" {
+		t.Fatalf("UNLINK replied %q", got)
+	}
+	if n := entity.Data.(*set.Set).Len(); n != 1000 {
+		t.Fatalf("the unlinked set has %d members, want 1000", n)
+	}
+}
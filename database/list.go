@@ -0,0 +1,124 @@
+package database
+
+import (
+	"Redis_Go/datastruct/list"
+	"Redis_Go/interface/resp"
+	"Redis_Go/resp/reply"
+	"strconv"
+)
+
+// getAsList returns the list stored at key, errReply is a WRONGTYPE error if the key holds another type
+func (db *DB) getAsList(key string) (l *list.List, exists bool, errReply resp.Reply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, false, nil
+	}
+	l, ok := entity.Data.(*list.List)
+	if !ok {
+		return nil, true, reply.GetWrongTypeErrReply()
+	}
+	return l, true, nil
+}
+
+// execLLen returns the length of the list stored at key
+// LLEN key
+func execLLen(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+
+	var result resp.Reply
+	db.WithRKeyLock(key, func() {
+		l, exists, errReply := db.getAsList(key)
+		switch {
+		case errReply != nil:
+			result = errReply
+		case !exists:
+			result = reply.GetIntReply(0)
+		default:
+			result = reply.GetIntReply(int64(l.Len()))
+		}
+	})
+	return result
+}
+
+// execLIndex returns the element at index of the list stored at key, negative indexes count from the end
+// LINDEX key index
+func execLIndex(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	index, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+	}
+
+	var result resp.Reply
+	db.WithRKeyLock(key, func() {
+		l, exists, errReply := db.getAsList(key)
+		if errReply != nil {
+			result = errReply
+			return
+		}
+		if !exists {
+			result = reply.GetNullBulkReply()
+			return
+		}
+		size := int64(l.Len())
+		if index < 0 {
+			index += size
+		}
+		if index < 0 || index >= size {
+			result = reply.GetNullBulkReply()
+			return
+		}
+		result = reply.GetBulkReply([]byte(l.Elements()[index]))
+	})
+	return result
+}
+
+// execLRange returns the elements of the list stored at key between start and stop (inclusive),
+// negative indexes count from the end
+// LRANGE key start stop
+func execLRange(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	start, err1 := strconv.ParseInt(string(args[1]), 10, 64)
+	stop, err2 := strconv.ParseInt(string(args[2]), 10, 64)
+	if err1 != nil || err2 != nil {
+		return reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+	}
+
+	var result resp.Reply
+	db.WithRKeyLock(key, func() {
+		l, exists, errReply := db.getAsList(key)
+		if errReply != nil {
+			result = errReply
+			return
+		}
+		if !exists {
+			result = reply.GetMultiRawReply(nil)
+			return
+		}
+		size := int64(l.Len())
+		if start < 0 {
+			start = max(start+size, 0)
+		}
+		if stop < 0 {
+			stop += size
+		}
+		stop = min(stop, size-1)
+		if start > stop {
+			result = reply.GetMultiRawReply(nil)
+			return
+		}
+		elements := l.Elements()[start : stop+1]
+		values := make([][]byte, len(elements))
+		for i, elem := range elements {
+			values[i] = []byte(elem)
+		}
+		result = reply.GetMultiBulkReply(values)
+	})
+	return result
+}
+
+func init() {
+	RegisterCommand("LLEN", execLLen, 2)     // LLEN key
+	RegisterCommand("LINDEX", execLIndex, 3) // LINDEX key index
+	RegisterCommand("LRANGE", execLRange, 4) // LRANGE key start stop
+}
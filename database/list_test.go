@@ -0,0 +1,24 @@
+package database
+
+import "testing"
+
+func TestListReads(t *testing.T) {
+	// SORT ... STORE 是目前唯一创建列表的命令
+	stored := [][]string{{"SADD", "s", "3", "1", "2", "5", "4"}, {"SORT", "s", "STORE", "l"}}
+	runCmdCases(t, []cmdCase{
+		{"llen", stored, []string{"LLEN", "l"}, ":5"},
+		{"llen missing key", nil, []string{"LLEN", "l"}, ":0"},
+		{"lrange all", stored, []string{"LRANGE", "l", "0", "-1"}, "*5 $1 1 $1 2 $1 3 $1 4 $1 5"},
+		{"lrange negative", stored, []string{"LRANGE", "l", "-2", "-1"}, "*2 $1 4 $1 5"},
+		{"lrange start before the head", stored, []string{"LRANGE", "l", "-100", "1"}, "*2 $1 1 $1 2"},
+		{"lrange stop past the end", stored, []string{"LRANGE", "l", "3", "100"}, "*2 $1 4 $1 5"},
+		{"lrange start past the end", stored, []string{"LRANGE", "l", "5", "10"}, "*0"},
+		{"lrange start after stop", stored, []string{"LRANGE", "l", "3", "1"}, "*0"},
+		{"lrange missing key", nil, []string{"LRANGE", "l", "0", "-1"}, "*0"},
+		{"lindex", stored, []string{"LINDEX", "l", "1"}, "$1 2"},
+		{"lindex negative", stored, []string{"LINDEX", "l", "-1"}, "$1 5"},
+		{"lindex out of range", stored, []string{"LINDEX", "l", "5"}, "$-1"},
+		{"wrong type", [][]string{{"SET", "l", "v"}}, []string{"LRANGE", "l", "0", "-1"},
+			"-WRONGTYPE Operation against a key holding the wrong kind of value"},
+	})
+}
@@ -0,0 +1,201 @@
+package database
+
+import (
+	"Redis_Go/datastruct/bloom"
+	"Redis_Go/datastruct/cms"
+	"Redis_Go/datastruct/hash"
+	"Redis_Go/datastruct/jsondoc"
+	"Redis_Go/datastruct/list"
+	"Redis_Go/datastruct/set"
+	"Redis_Go/datastruct/stream"
+	"Redis_Go/datastruct/zset"
+	"Redis_Go/interface/database"
+	"Redis_Go/interface/resp"
+	"Redis_Go/resp/reply"
+	"strconv"
+	"strings"
+)
+
+// Approximate sizes of the Go structures values are made of, MEMORY USAGE adds them up
+const (
+	// entityOverhead is the keyspace dict entry of a key, the header of the key string and the DataEntity
+	entityOverhead = 80
+	stringHeader   = 16
+	sliceHeader    = 24
+	// mapEntryOverhead is the bucket slot and tophash of a Go map entry, amortized over the load factor
+	mapEntryOverhead = 24
+	// skiplistNodeOverhead is a skiplist node with the average 1.33 levels
+	skiplistNodeOverhead = 64
+	// pendingEntrySize is a stream PEL entry, referenced by both its group and its consumer
+	pendingEntrySize = 64
+	// memoryDefaultSamples is the number of elements MEMORY USAGE samples in collections by default
+	memoryDefaultSamples = 5
+)
+
+// entityMemoryUsage estimates the bytes taken by key and its value. The size of the elements of a collection
+// is averaged over samples of them, all of them if samples is 0
+func entityMemoryUsage(key string, entity *database.DataEntity, samples int) int64 {
+	size := int64(entityOverhead + len(key))
+	switch val := entity.Data.(type) {
+	case []byte:
+		size += sliceHeader + int64(cap(val))
+	case *embstr:
+		// embstr 与 DataEntity 共用一次分配
+		size += embstrMaxLen + 1
+	case *int64:
+		if !isSharedEntity(entity) {
+			size += 8
+		}
+	case *hash.Hash:
+		perEntry := int64(2 * stringHeader)
+		if val.Encoding() != 0 {
+			perEntry += mapEntryOverhead
+		}
+		fields := val.RandomFields(sampleCount(val.Len(), samples), true)
+		size += sampledSize(val.Len(), len(fields), func(i int) int64 {
+			value, _ := val.Get(fields[i])
+			return perEntry + int64(len(fields[i])+len(value))
+		})
+	case *list.List:
+		elements := val.Elements()
+		size += sliceHeader + sampledSize(len(elements), sampleCount(len(elements), samples), func(i int) int64 {
+			return stringHeader + int64(len(elements[i]))
+		})
+	case *set.Set:
+		members := val.RandomDistinctMembers(sampleCount(val.Len(), samples))
+		size += sampledSize(val.Len(), len(members), func(i int) int64 {
+			switch val.Encoding() {
+			case 2:
+				return 8
+			case 0:
+				return stringHeader + int64(len(members[i]))
+			}
+			return stringHeader + mapEntryOverhead + int64(len(members[i]))
+		})
+	case zset.ZSet:
+		elements := val.RandomElements(sampleCount(val.Len(), samples), true)
+		size += sampledSize(val.Len(), len(elements), func(i int) int64 {
+			if val.Encoding() == 0 {
+				return stringHeader + 8 + int64(len(elements[i].Member))
+			}
+			// 跳表节点和字典各存一份成员
+			return stringHeader + 8 + mapEntryOverhead + skiplistNodeOverhead + int64(len(elements[i].Member))
+		})
+	case *stream.Stream:
+		entries := val.Range(stream.MinID, stream.MaxID, sampleCount(val.Len(), samples), false)
+		size += sampledSize(val.Len(), len(entries), func(i int) int64 {
+			entrySize := int64(16 + sliceHeader)
+			for _, field := range entries[i].Fields {
+				entrySize += stringHeader + int64(len(field))
+			}
+			return entrySize
+		})
+		for _, g := range val.Groups() {
+			size += int64(64+len(g.Name)) + int64(g.PendingLen())*pendingEntrySize
+			for _, c := range g.Consumers() {
+				size += int64(64 + len(c.Name))
+			}
+		}
+	case *jsondoc.Document:
+		size += jsonMemoryUsage(val.Root)
+	case *bloom.Filter:
+		size += int64(48 + val.SubFilters()*64 + val.Size())
+	case *cms.Sketch:
+		size += int64(48 + val.Size())
+	}
+	return size
+}
+
+// sampleCount returns how many of n elements are sampled, all of them if samples is 0
+func sampleCount(n, samples int) int {
+	if samples == 0 {
+		return n
+	}
+	return min(n, samples)
+}
+
+// sampledSize extrapolates the total size of n elements from the sizes of a sample of them
+func sampledSize(n, sampled int, elementSize func(i int) int64) int64 {
+	if sampled == 0 {
+		return 0
+	}
+	var sum int64
+	for i := 0; i < sampled; i++ {
+		sum += elementSize(i)
+	}
+	return sum * int64(n) / int64(sampled)
+}
+
+// jsonMemoryUsage estimates the bytes taken by a JSON value, boxed in an interface
+func jsonMemoryUsage(v any) int64 {
+	size := int64(16)
+	switch val := v.(type) {
+	case string:
+		size += stringHeader + int64(len(val))
+	case int64, float64:
+		size += 8
+	case *jsondoc.Array:
+		size += sliceHeader
+		for _, elem := range val.Elems {
+			size += jsonMemoryUsage(elem)
+		}
+	case *jsondoc.Object:
+		size += 48
+		for _, key := range val.Keys() {
+			elem, _ := val.Get(key)
+			// 键在有序键列表和 map 中各有一份字符串头
+			size += 2*stringHeader + mapEntryOverhead + int64(len(key)) + jsonMemoryUsage(elem)
+		}
+	}
+	return size
+}
+
+// execMemory implements the MEMORY command
+// MEMORY USAGE key [SAMPLES count]
+// MEMORY HELP
+func execMemory(db *DB, args [][]byte) resp.Reply {
+	subCmd := strings.ToUpper(string(args[0]))
+	switch subCmd {
+	case "HELP":
+		return helpReply("MEMORY",
+			"USAGE <key> [SAMPLES <count>]",
+			"    Return memory in bytes used by <key> and its value. Nested values are",
+			"    sampled up to <count> times (default: 5, 0 means sample all).")
+	case "USAGE":
+	default:
+		return reply.GetStandardErrorReply("ERR unknown subcommand '" + string(args[0]) + "'. Try MEMORY HELP.")
+	}
+	if len(args) != 2 && len(args) != 4 {
+		return reply.GetArgNumErrReply("memory|usage")
+	}
+	key := string(args[1])
+	samples := memoryDefaultSamples
+	if len(args) == 4 {
+		if strings.ToUpper(string(args[2])) != "SAMPLES" {
+			return reply.GetSyntaxErrReply()
+		}
+		n, err := strconv.Atoi(string(args[3]))
+		if err != nil {
+			return reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+		}
+		if n < 0 {
+			return reply.GetSyntaxErrReply()
+		}
+		samples = n
+	}
+
+	var result resp.Reply
+	db.WithRKeyLock(key, func() {
+		entity, exists := db.peekEntity(key)
+		if !exists {
+			result = reply.GetNullBulkReply()
+			return
+		}
+		result = reply.GetIntReply(entityMemoryUsage(key, entity, samples))
+	})
+	return result
+}
+
+func init() {
+	RegisterCommand("MEMORY", execMemory, -2) // MEMORY USAGE key [SAMPLES count], MEMORY HELP
+}
@@ -0,0 +1,201 @@
+package database
+
+import (
+	"Redis_Go/datastruct/bloom"
+	"Redis_Go/datastruct/cms"
+	"Redis_Go/datastruct/hash"
+	"Redis_Go/datastruct/jsondoc"
+	"Redis_Go/datastruct/list"
+	"Redis_Go/datastruct/set"
+	"Redis_Go/datastruct/stream"
+	"Redis_Go/datastruct/zset"
+	"Redis_Go/interface/database"
+	"Redis_Go/interface/resp"
+	"Redis_Go/resp/reply"
+	"math"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// The access frequency is a logarithmic counter as in Redis's LFU: each access increments it with probability
+// 1/((counter-lfuInitVal)*lfuLogFactor+1), and it decays by one for every lfuDecayTime minutes without access
+const (
+	lfuInitVal   = 5
+	lfuLogFactor = 10
+	lfuDecayTime = 1
+	lfuMaxVal    = 255
+)
+
+// initEntityAccess sets the access stats of an entity that is stored for the first time.
+// Entities moved between keys, by RENAME for instance, keep their stats
+func initEntityAccess(entity *database.DataEntity) {
+	if isSharedEntity(entity) || atomic.LoadUint32(&entity.LastAccess) != 0 {
+		return
+	}
+	atomic.StoreUint32(&entity.Freq, lfuInitVal)
+	atomic.StoreUint32(&entity.LastAccess, uint32(time.Now().Unix()))
+}
+
+// touchEntity records an access to entity. Concurrent readers may lose an increment of the counter,
+// which is fine for an estimate. The shared integers aren't tracked, as their accesses come from every
+// key holding the same value
+func touchEntity(entity *database.DataEntity) {
+	if isSharedEntity(entity) {
+		return
+	}
+	now := uint32(time.Now().Unix())
+	counter := entityFreq(entity, now)
+	if counter < lfuMaxVal {
+		baseVal := max(int(counter)-lfuInitVal, 0)
+		if rand.Float64() < 1/float64(baseVal*lfuLogFactor+1) {
+			counter++
+		}
+	}
+	atomic.StoreUint32(&entity.Freq, counter)
+	atomic.StoreUint32(&entity.LastAccess, now)
+}
+
+// entityFreq returns the access counter of entity, decayed by the time since its last access
+func entityFreq(entity *database.DataEntity, now uint32) uint32 {
+	counter := atomic.LoadUint32(&entity.Freq)
+	if last := atomic.LoadUint32(&entity.LastAccess); last != 0 && now > last {
+		periods := (now - last) / 60 / lfuDecayTime
+		if periods >= counter {
+			return 0
+		}
+		counter -= periods
+	}
+	return counter
+}
+
+// entityIdleTime returns the seconds since the last access to entity
+func entityIdleTime(entity *database.DataEntity, now uint32) uint32 {
+	last := atomic.LoadUint32(&entity.LastAccess)
+	if last == 0 || now < last {
+		return 0
+	}
+	return now - last
+}
+
+// isSharedEntity reports whether entity is one of the preallocated integers shared by several keys
+func isSharedEntity(entity *database.DataEntity) bool {
+	val, ok := entity.Data.(*int64)
+	return ok && *val >= 0 && *val < sharedIntegers && entity == &sharedIntObjects[*val].entity
+}
+
+// objectEncoding returns the name OBJECT ENCODING reports for the value held by entity
+func objectEncoding(entity *database.DataEntity) string {
+	if encoding, ok := stringEncoding(entity); ok {
+		return encoding
+	}
+	switch val := entity.Data.(type) {
+	case *hash.Hash:
+		if val.Encoding() == 0 {
+			return "listpack"
+		}
+		return "hashtable"
+	case *list.List:
+		if val.Encoding() == 0 {
+			return "listpack"
+		}
+		return "quicklist"
+	case *set.Set:
+		switch val.Encoding() {
+		case 0:
+			return "listpack"
+		case 2:
+			return "intset"
+		}
+		return "hashtable"
+	case zset.ZSet:
+		if val.Encoding() == 0 {
+			return "listpack"
+		}
+		return "skiplist"
+	case *stream.Stream:
+		return "stream"
+	case *jsondoc.Document, *bloom.Filter, *cms.Sketch:
+		// Redis 中模块类型的编码都是 raw
+		return "raw"
+	}
+	return "unknown"
+}
+
+// objectEncodingReply returns the OBJECT ENCODING reply for key, a null bulk if the key doesn't exist.
+// HENCODING, SENCODING and ZTYPE reply with it too
+func objectEncodingReply(db *DB, key string) resp.Reply {
+	var result resp.Reply
+	db.WithRKeyLock(key, func() {
+		entity, exists := db.peekEntity(key)
+		if !exists {
+			result = reply.GetNullBulkReply()
+			return
+		}
+		result = reply.GetBulkReply([]byte(objectEncoding(entity)))
+	})
+	return result
+}
+
+// execObject implements the OBJECT command
+// OBJECT ENCODING|REFCOUNT|IDLETIME|FREQ key
+// OBJECT HELP
+func execObject(db *DB, args [][]byte) resp.Reply {
+	subCmd := strings.ToUpper(string(args[0]))
+	switch subCmd {
+	case "HELP":
+		return helpReply("OBJECT",
+			"ENCODING <key>",
+			"    Return the kind of internal representation used in order to store the value",
+			"    associated with a <key>.",
+			"FREQ <key>",
+			"    Return the access frequency index of the <key>. The returned integer is",
+			"    proportional to the logarithm of the recent access frequency of the key.",
+			"IDLETIME <key>",
+			"    Return the idle time of the <key>, that is the approximated number of",
+			"    seconds elapsed since the last access to the key.",
+			"REFCOUNT <key>",
+			"    Return the number of references of the value associated with the specified",
+			"    <key>.")
+	case "ENCODING", "REFCOUNT", "IDLETIME", "FREQ":
+	default:
+		return reply.GetStandardErrorReply("ERR unknown subcommand '" + string(args[0]) + "'. Try OBJECT HELP.")
+	}
+	if len(args) != 2 {
+		return reply.GetArgNumErrReply("object|" + strings.ToLower(subCmd))
+	}
+	key := string(args[1])
+	if subCmd == "ENCODING" {
+		return objectEncodingReply(db, key)
+	}
+
+	var result resp.Reply
+	db.WithRKeyLock(key, func() {
+		// OBJECT 不算作对 key 的访问
+		entity, exists := db.peekEntity(key)
+		if !exists {
+			result = reply.GetNullBulkReply()
+			return
+		}
+		now := uint32(time.Now().Unix())
+		switch subCmd {
+		case "REFCOUNT":
+			if isSharedEntity(entity) {
+				result = reply.GetIntReply(math.MaxInt32)
+			} else {
+				result = reply.GetIntReply(1)
+			}
+		// 共享整数不记录访问, IDLETIME 和 FREQ 都报告 0
+		case "IDLETIME":
+			result = reply.GetIntReply(int64(entityIdleTime(entity, now)))
+		case "FREQ":
+			result = reply.GetIntReply(int64(entityFreq(entity, now)))
+		}
+	})
+	return result
+}
+
+func init() {
+	RegisterCommand("OBJECT", execObject, -2) // OBJECT ENCODING|REFCOUNT|IDLETIME|FREQ key, OBJECT HELP
+}
@@ -5,9 +5,10 @@ import (
 	"Redis_Go/interface/database"
 	"Redis_Go/interface/resp"
 	"Redis_Go/lib/utils"
-	"Redis_Go/lib/wildcard"
 	"Redis_Go/resp/reply"
+	"sort"
 	"strconv"
+	"strings"
 )
 
 // SADD key member [member ...]
@@ -114,6 +115,40 @@ func execSIsMember(db *DB, args [][]byte) resp.Reply {
 	return reply.GetIntReply(0)
 }
 
+// SMISMEMBER key member [member ...]
+func execSMIsMember(db *DB, args [][]byte) resp.Reply {
+	if len(args) < 2 {
+		return reply.GetArgNumErrReply("SMISMEMBER")
+	}
+
+	key := string(args[0])
+	var (
+		result   []resp.Reply
+		errReply resp.Reply
+	)
+
+	db.WithRKeyLock(key, func() {
+		setObj, ok := db.getAsSet(key)
+		if isWrongTypeSet(setObj, ok) {
+			errReply = reply.GetWrongTypeErrReply()
+			return
+		}
+		result = make([]resp.Reply, len(args)-1)
+		for i, member := range args[1:] {
+			if ok && setObj.Contains(string(member)) {
+				result[i] = reply.GetIntReply(1)
+			} else {
+				result[i] = reply.GetIntReply(0)
+			}
+		}
+	})
+
+	if errReply != nil {
+		return errReply
+	}
+	return reply.GetMultiRawReply(result)
+}
+
 // SMEMBERS key
 func execSMembers(db *DB, args [][]byte) resp.Reply {
 	if len(args) != 1 {
@@ -470,6 +505,81 @@ func execSInter(db *DB, args [][]byte) resp.Reply {
 	return reply.GetMultiBulkReply(resultBytes)
 }
 
+// SINTERCARD numkeys key [key ...] [LIMIT limit]
+// limit 不为 0 时, 交集大小达到 limit 即停止计算
+func execSInterCard(db *DB, args [][]byte) resp.Reply {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil || numKeys <= 0 {
+		return reply.GetStandardErrorReply("ERR numkeys should be greater than 0")
+	}
+	if numKeys > len(args)-1 {
+		return reply.GetStandardErrorReply("ERR Number of keys can't be greater than number of args")
+	}
+	keys := make([]string, numKeys)
+	for i := range keys {
+		keys[i] = string(args[1+i])
+	}
+
+	limit := 0
+	options := args[1+numKeys:]
+	if len(options) > 0 {
+		if len(options) != 2 || strings.ToUpper(string(options[0])) != "LIMIT" {
+			return reply.GetSyntaxErrReply()
+		}
+		limit, err = strconv.Atoi(string(options[1]))
+		if err != nil {
+			return reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+		}
+		if limit < 0 {
+			return reply.GetStandardErrorReply("ERR LIMIT can't be negative")
+		}
+	}
+
+	sortedKeys := utils.DedupSortedKeys(keys)
+	locks := make([]*KeyLockHandle, len(sortedKeys))
+	for i, key := range sortedKeys {
+		locks[i] = db.lockMgr.RLock(key)
+	}
+	defer func() {
+		for _, lock := range locks {
+			db.lockMgr.RUnlock(lock)
+		}
+	}()
+
+	sets := make([]*set.Set, 0, len(keys))
+	missing := false
+	for _, key := range keys {
+		setObj, exists := db.getAsSet(key)
+		if isWrongTypeSet(setObj, exists) {
+			return reply.GetWrongTypeErrReply()
+		}
+		if !exists {
+			missing = true
+			continue
+		}
+		sets = append(sets, setObj)
+	}
+	if missing {
+		return reply.GetIntReply(0)
+	}
+
+	// 遍历最小的集合, 在其余集合中查找
+	sort.Slice(sets, func(i, j int) bool {
+		return sets[i].Len() < sets[j].Len()
+	})
+	count := 0
+	sets[0].ForEach(func(member string) bool {
+		for _, other := range sets[1:] {
+			if !other.Contains(member) {
+				return true
+			}
+		}
+		count++
+		return count != limit
+	})
+	return reply.GetIntReply(int64(count))
+}
+
 // SDIFF key [key ...]
 func execSDiff(db *DB, args [][]byte) resp.Reply {
 	if len(args) < 1 {
@@ -705,98 +815,42 @@ func execSDiffStore(db *DB, args [][]byte) resp.Reply {
 	return reply.GetIntReply(int64(destSet.Len()))
 }
 
-// SSCAN key cursor [MATCH pattern] [COUNT]
+// SSCAN key cursor [MATCH pattern] [COUNT count]
+// 游标在元素增删和编码转换后依然有效, 见 set.Set.Scan
 func execSScan(db *DB, args [][]byte) resp.Reply {
-	if len(args) < 2 {
-		return reply.GetArgNumErrReply("SSCAN")
-	}
-
 	key := string(args[0])
-	cursor, err := strconv.Atoi(string(args[1]))
-	if err != nil || cursor < 0 {
-		return reply.GetStandardErrorReply("ERR invalid cursor")
-	}
-
-	matchPattern := "*"
-	count := 10
-	for i := 2; i < len(args); i++ {
-		arg := string(args[i])
-		if arg == "MATCH" && i+1 < len(args) {
-			matchPattern = string(args[i+1])
-			i++
-		} else if arg == "COUNT" && i+1 < len(args) {
-			c, _ := strconv.ParseInt(string(args[i+1]), 10, 64)
-			count = int(c)
-			i++
-		}
-	}
-
-	var (
-		members    []string
-		nextCursor int
-		errReply   resp.Reply
-	)
-
-	db.WithRKeyLock(key, func() {
-		setObj, exists := db.getAsSet(key)
-		if isWrongTypeSet(setObj, exists) {
-			errReply = reply.GetWrongTypeErrReply()
-			return
-		}
-		if !exists {
-			return
-		}
-		members, nextCursor = scanSet(setObj, cursor, matchPattern, count)
-	})
-
+	cursor, pattern, count, _, errReply := parseElementScanArgs(args[1:], "")
 	if errReply != nil {
 		return errReply
 	}
 
-	// 构建返回结果: [cursor, [member1, member2, ...]]
-	membersBytes := make([][]byte, len(members))
-	for i, m := range members {
-		membersBytes[i] = []byte(m)
-	}
-	return reply.GetScanReply(int64(nextCursor), membersBytes)
-}
-
-// SENCODING key
-func execSEncoding(db *DB, args [][]byte) resp.Reply {
-	if len(args) != 1 {
-		return reply.GetArgNumErrReply("SENCODING")
-	}
-
-	key := string(args[0])
-	var (
-		encoding string
-		errReply resp.Reply
-	)
-
+	var result resp.Reply
 	db.WithRKeyLock(key, func() {
 		setObj, exists := db.getAsSet(key)
 		if isWrongTypeSet(setObj, exists) {
-			errReply = reply.GetWrongTypeErrReply()
+			result = reply.GetWrongTypeErrReply()
 			return
 		}
 		if !exists {
+			result = reply.GetScanReply(0, [][]byte{})
 			return
 		}
-		switch setObj.Encoding() {
-		case 0:
-			encoding = "listpack"
-		case 1:
-			encoding = "dict"
+
+		members, next := setObj.Scan(cursor, count, pattern)
+		// 构建返回结果: [cursor, [member1, member2, ...]]
+		membersBytes := make([][]byte, len(members))
+		for i, m := range members {
+			membersBytes[i] = []byte(m)
 		}
+		result = reply.GetScanReply(int64(next), membersBytes)
 	})
+	return result
+}
 
-	if errReply != nil {
-		return errReply
-	}
-	if encoding == "" {
-		return reply.GetNullBulkReply()
-	}
-	return reply.GetBulkReply([]byte(encoding))
+// execSEncoding is an alias of OBJECT ENCODING, kept for compatibility
+// SENCODING key
+func execSEncoding(db *DB, args [][]byte) resp.Reply {
+	return objectEncodingReply(db, string(args[0]))
 }
 
 // getAsSet
@@ -829,38 +883,12 @@ func (db *DB) getOrCreateSet(key string) (*set.Set, bool) {
 	return setObj, false
 }
 
-// scanSet
-func scanSet(s *set.Set, cursor int, pattern string, count int) ([]string, int) {
-	members := s.Members()
-	if cursor >= len(members) {
-		return []string{}, 0
-	}
-
-	p := wildcard.CompilePattern(pattern)
-
-	result := make([]string, 0)
-	matched := 0
-	i := cursor
-
-	for i < len(members) && matched < count {
-		if p.IsMatch(members[i]) {
-			result = append(result, members[i])
-			matched++
-		}
-		i++
-	}
-
-	if i >= len(members) {
-		return result, 0
-	}
-	return result, i
-}
-
 // init
 func init() {
 	RegisterCommand("SADD", execSAdd, -3)
 	RegisterCommand("SREM", execSRem, -3)
 	RegisterCommand("SISMEMBER", execSIsMember, 3)
+	RegisterCommand("SMISMEMBER", execSMIsMember, -3)
 	RegisterCommand("SMEMBERS", execSMembers, 2)
 	RegisterCommand("SCARD", execSCard, 2)
 	RegisterCommand("SPOP", execSPop, -2)
@@ -868,6 +896,7 @@ func init() {
 	RegisterCommand("SMOVE", execSMove, 4)
 	RegisterCommand("SUNION", execSUnion, -2)
 	RegisterCommand("SINTER", execSInter, -2)
+	RegisterCommand("SINTERCARD", execSInterCard, -3)
 	RegisterCommand("SDIFF", execSDiff, -2)
 	RegisterCommand("SUNIONSTORE", execSUnionStore, -3)
 	RegisterCommand("SINTERSTORE", execSInterStore, -3)
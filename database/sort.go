@@ -0,0 +1,379 @@
+package database
+
+import (
+	"Redis_Go/datastruct/hash"
+	"Redis_Go/datastruct/list"
+	"Redis_Go/datastruct/set"
+	"Redis_Go/datastruct/zset"
+	"Redis_Go/interface/database"
+	"Redis_Go/interface/resp"
+	"Redis_Go/lib/utils"
+	"Redis_Go/resp/reply"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sortSpec holds the parsed options of SORT and SORT_RO
+type sortSpec struct {
+	byPattern   string
+	dontSort    bool // BY a pattern without '*', the elements keep the order of the source
+	getPatterns []string
+	offset      int
+	count       int // -1 for no LIMIT
+	desc        bool
+	alpha       bool
+	storeKey    string
+	store       bool
+}
+
+// sortItem is an element being sorted with the value it is sorted by
+type sortItem struct {
+	elem  string
+	by    string
+	byNil bool // BY found no value for the element
+	score float64
+}
+
+// parseSortSpec parses the options following the key of SORT. STORE is rejected if readOnly is set
+func parseSortSpec(args [][]byte, readOnly bool) (*sortSpec, resp.Reply) {
+	spec := &sortSpec{count: -1}
+	for i := 0; i < len(args); i++ {
+		remaining := len(args) - i - 1
+		switch strings.ToUpper(string(args[i])) {
+		case "ASC":
+			spec.desc = false
+		case "DESC":
+			spec.desc = true
+		case "ALPHA":
+			spec.alpha = true
+		case "LIMIT":
+			if remaining < 2 {
+				return nil, reply.GetSyntaxErrReply()
+			}
+			offset, err1 := strconv.Atoi(string(args[i+1]))
+			count, err2 := strconv.Atoi(string(args[i+2]))
+			if err1 != nil || err2 != nil {
+				return nil, reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+			}
+			spec.offset, spec.count = offset, count
+			i += 2
+		case "STORE":
+			if readOnly || remaining < 1 {
+				return nil, reply.GetSyntaxErrReply()
+			}
+			spec.storeKey, spec.store = string(args[i+1]), true
+			i++
+		case "BY":
+			if remaining < 1 {
+				return nil, reply.GetSyntaxErrReply()
+			}
+			spec.byPattern = string(args[i+1])
+			// 和 Redis 一样, 不含 '*' 的 BY 模式表示不排序
+			spec.dontSort = !strings.Contains(spec.byPattern, "*")
+			i++
+		case "GET":
+			if remaining < 1 {
+				return nil, reply.GetSyntaxErrReply()
+			}
+			spec.getPatterns = append(spec.getPatterns, string(args[i+1]))
+			i++
+		default:
+			return nil, reply.GetSyntaxErrReply()
+		}
+	}
+	return spec, nil
+}
+
+// sortPatternKey substitutes elem for the first '*' of pattern and returns the key it names,
+// and the hash field if the pattern ends with "->field". ok is false if the pattern has no '*'
+func sortPatternKey(pattern, elem string) (key, field string, ok bool) {
+	star := strings.IndexByte(pattern, '*')
+	if star < 0 {
+		return "", "", false
+	}
+	rest := pattern[star+1:]
+	if arrow := strings.Index(rest, "->"); arrow >= 0 && arrow+2 < len(rest) {
+		rest, field = rest[:arrow], rest[arrow+2:]
+	}
+	return pattern[:star] + elem + rest, field, true
+}
+
+// lookupSortPattern returns the value pattern refers to for elem: the element itself for "#",
+// otherwise the string at the substituted key or the field of the hash there. ok is false if there is none
+func lookupSortPattern(db *DB, pattern, elem string) (value string, ok bool) {
+	if pattern == "#" {
+		return elem, true
+	}
+	key, field, ok := sortPatternKey(pattern, elem)
+	if !ok {
+		return "", false
+	}
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return "", false
+	}
+	if field == "" {
+		str, isString := stringBytes(entity)
+		return string(str), isString
+	}
+	hashObj, isHash := entity.Data.(*hash.Hash)
+	if !isHash {
+		return "", false
+	}
+	return hashObj.Get(field)
+}
+
+// patternKeys returns the keys the BY and GET patterns refer to for elements, in no particular order
+func (spec *sortSpec) patternKeys(elements []string) []string {
+	patterns := spec.getPatterns
+	if spec.byPattern != "" && !spec.dontSort {
+		patterns = append([]string{spec.byPattern}, patterns...)
+	}
+	var keys []string
+	for _, pattern := range patterns {
+		for _, elem := range elements {
+			if key, _, ok := sortPatternKey(pattern, elem); ok {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// sortSourceElements returns the elements of the list, set or zset at key, in the order of a list or zset,
+// and the value they were read from, nil if the key doesn't exist
+func sortSourceElements(db *DB, key string) ([]string, interface{}, resp.Reply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil, nil
+	}
+	switch val := entity.Data.(type) {
+	case *list.List:
+		return append([]string(nil), val.Elements()...), val, nil
+	case *set.Set:
+		return val.Members(), val, nil
+	case zset.ZSet:
+		elements := val.RangeByRankElements(0, -1, false)
+		members := make([]string, len(elements))
+		for i, element := range elements {
+			members[i] = element.Member
+		}
+		return members, val, nil
+	}
+	return nil, nil, reply.GetWrongTypeErrReply()
+}
+
+// sortElements orders elements, read from source, as spec asks, reading the values of the BY pattern from db
+func (spec *sortSpec) sortElements(db *DB, source interface{}, elements []string) resp.Reply {
+	if spec.dontSort {
+		switch source.(type) {
+		case *set.Set:
+			// 集合的遍历顺序不固定, STORE 的结果要在 AOF 重放时保持一致, 所以按字典序输出
+			if spec.store {
+				sort.Strings(elements)
+			}
+		case zset.ZSet:
+			if spec.desc {
+				for i, j := 0, len(elements)-1; i < j; i, j = i+1, j-1 {
+					elements[i], elements[j] = elements[j], elements[i]
+				}
+			}
+		}
+		return nil
+	}
+
+	items := make([]sortItem, len(elements))
+	for i, elem := range elements {
+		items[i].elem = elem
+		value, found := elem, true
+		if spec.byPattern != "" {
+			value, found = lookupSortPattern(db, spec.byPattern, elem)
+		}
+		if spec.alpha {
+			items[i].by, items[i].byNil = value, !found
+			continue
+		}
+		if found {
+			score, err := strconv.ParseFloat(value, 64)
+			if err != nil || math.IsNaN(score) {
+				return reply.GetStandardErrorReply("ERR One or more scores can't be converted into double")
+			}
+			items[i].score = score
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		a, b := &items[i], &items[j]
+		cmp := 0
+		switch {
+		case !spec.alpha:
+			if a.score < b.score {
+				cmp = -1
+			} else if a.score > b.score {
+				cmp = 1
+			}
+		case a.byNil || b.byNil:
+			// 没有取到值的元素排在前面
+			if !b.byNil {
+				cmp = -1
+			} else if !a.byNil {
+				cmp = 1
+			}
+		default:
+			cmp = strings.Compare(a.by, b.by)
+		}
+		// 值相同时按元素本身比较, 保证结果是确定的
+		if cmp == 0 {
+			cmp = strings.Compare(a.elem, b.elem)
+		}
+		if spec.desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+	for i := range items {
+		elements[i] = items[i].elem
+	}
+	return nil
+}
+
+// limit returns the window of elements selected by LIMIT
+func (spec *sortSpec) limit(elements []string) []string {
+	start := max(spec.offset, 0)
+	if start >= len(elements) {
+		return nil
+	}
+	end := len(elements)
+	if spec.count >= 0 {
+		// 先限制 count, start+count 可能溢出
+		end = start + min(spec.count, len(elements)-start)
+	}
+	return elements[start:end]
+}
+
+// results returns the values of the GET patterns for elements, or the elements themselves without GET.
+// Values that don't exist are nil
+func (spec *sortSpec) results(db *DB, elements []string) [][]byte {
+	if len(spec.getPatterns) == 0 {
+		results := make([][]byte, len(elements))
+		for i, elem := range elements {
+			results[i] = []byte(elem)
+		}
+		return results
+	}
+	results := make([][]byte, 0, len(elements)*len(spec.getPatterns))
+	for _, elem := range elements {
+		for _, pattern := range spec.getPatterns {
+			if value, ok := lookupSortPattern(db, pattern, elem); ok {
+				results = append(results, []byte(value))
+			} else {
+				results = append(results, nil)
+			}
+		}
+	}
+	return results
+}
+
+// sortGeneric implements SORT and SORT_RO.
+// The keys the patterns refer to depend on the elements of the source, so they are found under the lock of
+// the source first. All of them are then locked together in order, and the elements are read again: if they
+// have changed meanwhile and refer to more keys, those are added and the keys are locked once more
+func sortGeneric(db *DB, cmdName string, args [][]byte, readOnly bool) resp.Reply {
+	key := string(args[0])
+	spec, errReply := parseSortSpec(args[1:], readOnly)
+	if errReply != nil {
+		return errReply
+	}
+
+	lockedKeys := []string{key}
+	if spec.store {
+		lockedKeys = append(lockedKeys, spec.storeKey)
+	}
+	for {
+		var (
+			result   resp.Reply
+			unlocked []string
+		)
+		withSortLocks(db, lockedKeys, spec.store, func() {
+			elements, source, errReply := sortSourceElements(db, key)
+			if errReply != nil {
+				result = errReply
+				return
+			}
+			locked := make(map[string]struct{}, len(lockedKeys))
+			for _, k := range lockedKeys {
+				locked[k] = struct{}{}
+			}
+			for _, k := range spec.patternKeys(elements) {
+				if _, ok := locked[k]; !ok {
+					locked[k] = struct{}{}
+					unlocked = append(unlocked, k)
+				}
+			}
+			if len(unlocked) > 0 {
+				return
+			}
+			result = spec.run(db, cmdName, args, source, elements)
+		})
+		if len(unlocked) == 0 {
+			return result
+		}
+		lockedKeys = append(lockedKeys, unlocked...)
+	}
+}
+
+// withSortLocks runs fn holding the locks of keys, write locks if exclusive is set
+func withSortLocks(db *DB, keys []string, exclusive bool, fn func()) {
+	if !exclusive {
+		db.withRKeyLocks(keys, fn)
+		return
+	}
+	handle := db.lockMgr.LockKeys(keys)
+	defer db.lockMgr.UnlockKeys(handle)
+	fn()
+}
+
+// run sorts elements, read from source, and replies with the results or stores them.
+// The caller holds the locks of all the keys involved
+func (spec *sortSpec) run(db *DB, cmdName string, args [][]byte, source interface{}, elements []string) resp.Reply {
+	if errReply := spec.sortElements(db, source, elements); errReply != nil {
+		return errReply
+	}
+	results := spec.results(db, spec.limit(elements))
+	if !spec.store {
+		return reply.GetMultiBulkReply(results)
+	}
+
+	if len(results) == 0 {
+		db.Remove(spec.storeKey)
+	} else {
+		values := make([]string, len(results))
+		for i, result := range results {
+			values[i] = string(result)
+		}
+		db.PutEntity(spec.storeKey, &database.DataEntity{Data: list.New(values)})
+		db.Persist(spec.storeKey)
+	}
+	db.addAof(utils.ToCmdLineWithName(cmdName, args...))
+	return reply.GetIntReply(int64(len(results)))
+}
+
+// execSort sorts the elements of a list, set or zset, by their values or by those of other keys.
+// With STORE the results are stored as a list and their number is returned
+// SORT key [BY pattern] [LIMIT offset count] [GET pattern [GET pattern ...]] [ASC|DESC] [ALPHA] [STORE destination]
+func execSort(db *DB, args [][]byte) resp.Reply {
+	return sortGeneric(db, "SORT", args, false)
+}
+
+// execSortRO is the read-only variant of SORT, which doesn't accept STORE
+// SORT_RO key [BY pattern] [LIMIT offset count] [GET pattern [GET pattern ...]] [ASC|DESC] [ALPHA]
+func execSortRO(db *DB, args [][]byte) resp.Reply {
+	return sortGeneric(db, "SORT_RO", args, true)
+}
+
+func init() {
+	RegisterCommand("SORT", execSort, -2)      // SORT key [BY pattern] [LIMIT offset count] [GET pattern ...] [ASC|DESC] [ALPHA] [STORE destination]
+	RegisterCommand("SORT_RO", execSortRO, -2) // SORT_RO key [BY pattern] [LIMIT offset count] [GET pattern ...] [ASC|DESC] [ALPHA]
+}
@@ -0,0 +1,29 @@
+package database
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestSortLimit(t *testing.T) {
+	elements := []string{"1", "2", "3"}
+	tests := []struct {
+		offset, count int
+		want          []string
+	}{
+		{0, -1, []string{"1", "2", "3"}},
+		{1, 1, []string{"2"}},
+		{-5, 2, []string{"1", "2"}},
+		{1, math.MaxInt, []string{"2", "3"}},
+		{math.MaxInt, math.MaxInt, nil},
+		{3, 1, nil},
+		{0, 0, []string{}},
+	}
+	for _, tt := range tests {
+		spec := &sortSpec{offset: tt.offset, count: tt.count}
+		if got := spec.limit(elements); !slices.Equal(got, tt.want) {
+			t.Errorf("LIMIT %d %d selected %q, want %q", tt.offset, tt.count, got, tt.want)
+		}
+	}
+}
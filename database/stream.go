@@ -0,0 +1,576 @@
+package database
+
+import (
+	"Redis_Go/datastruct/stream"
+	"Redis_Go/interface/database"
+	"Redis_Go/interface/resp"
+	"Redis_Go/lib/utils"
+	"Redis_Go/resp/reply"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// getAsStream returns the stream stored at key, errReply is a WRONGTYPE error if the key holds another type
+func (db *DB) getAsStream(key string) (s *stream.Stream, exists bool, errReply resp.Reply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, false, nil
+	}
+	s, ok := entity.Data.(*stream.Stream)
+	if !ok {
+		return nil, true, reply.GetWrongTypeErrReply()
+	}
+	return s, true, nil
+}
+
+func streamIDReply(id stream.ID) resp.Reply {
+	return reply.GetBulkReply([]byte(id.String()))
+}
+
+// streamEntryReply formats an entry as [id, [field, value, ...]]
+func streamEntryReply(entry stream.Entry) resp.Reply {
+	fields := make([][]byte, len(entry.Fields))
+	for i, field := range entry.Fields {
+		fields[i] = []byte(field)
+	}
+	return reply.GetMultiRawReply([]resp.Reply{streamIDReply(entry.ID), reply.GetMultiBulkReply(fields)})
+}
+
+func streamEntriesReply(entries []stream.Entry) resp.Reply {
+	replies := make([]resp.Reply, len(entries))
+	for i, entry := range entries {
+		replies[i] = streamEntryReply(entry)
+	}
+	return reply.GetMultiRawReply(replies)
+}
+
+func streamIDErrReply(err error) resp.Reply {
+	return reply.GetStandardErrorReply(err.Error())
+}
+
+// streamTrim is the trimming option of XADD and XTRIM
+type streamTrim struct {
+	byMinID bool
+	maxLen  int
+	minID   stream.ID
+	approx  bool
+	limit   int // 0 means no limit
+}
+
+// parseStreamTrim parses "MAXLEN|MINID [=|~] threshold [LIMIT count]" starting at args[i],
+// and returns the position of the argument following it
+func parseStreamTrim(args [][]byte, i int) (*streamTrim, int, resp.Reply) {
+	trim := &streamTrim{byMinID: strings.ToUpper(string(args[i])) == "MINID"}
+	i++
+	if i < len(args) {
+		switch string(args[i]) {
+		case "~":
+			trim.approx = true
+			i++
+		case "=":
+			i++
+		}
+	}
+	if i >= len(args) {
+		return nil, 0, reply.GetSyntaxErrReply()
+	}
+	if trim.byMinID {
+		id, err := stream.ParseID(string(args[i]), 0)
+		if err != nil {
+			return nil, 0, streamIDErrReply(err)
+		}
+		trim.minID = id
+	} else {
+		maxLen, err := strconv.Atoi(string(args[i]))
+		if err != nil {
+			return nil, 0, reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+		}
+		if maxLen < 0 {
+			return nil, 0, reply.GetStandardErrorReply("ERR The MAXLEN argument must be >= 0.")
+		}
+		trim.maxLen = maxLen
+	}
+	i++
+
+	if i+1 < len(args) && strings.ToUpper(string(args[i])) == "LIMIT" {
+		limit, err := strconv.Atoi(string(args[i+1]))
+		if err != nil {
+			return nil, 0, reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+		}
+		if limit < 0 {
+			return nil, 0, reply.GetStandardErrorReply("ERR The LIMIT argument must be >= 0.")
+		}
+		if !trim.approx {
+			return nil, 0, reply.GetStandardErrorReply("ERR syntax error, LIMIT cannot be used without the special ~ option")
+		}
+		trim.limit = limit
+		i += 2
+	} else if trim.approx {
+		// 与 Redis 相同, 默认最多删除 100 个块的条目
+		trim.limit = 100 * stream.ChunkMaxEntries
+	}
+	return trim, i, nil
+}
+
+// apply trims s and returns how many entries were removed
+func (trim *streamTrim) apply(s *stream.Stream) int {
+	if trim.byMinID {
+		return s.TrimByMinID(trim.minID, trim.approx, trim.limit)
+	}
+	return s.TrimByLen(trim.maxLen, trim.approx, trim.limit)
+}
+
+// addStreamTrimAof logs a trimming of the stream at key.
+// Approximate trimming depends on the chunk layout, so it is logged as the exact trimming leaving the same entries
+func (db *DB) addStreamTrimAof(key string, s *stream.Stream) {
+	if first, ok := s.First(); ok {
+		db.addAof(utils.String2Cmdline("XTRIM", key, "MINID", first.ID.String()))
+	} else {
+		db.addAof(utils.String2Cmdline("XTRIM", key, "MAXLEN", "0"))
+	}
+}
+
+// execXAdd appends an entry to the stream stored at key, creating it unless NOMKSTREAM is given,
+// and returns the ID of the entry
+// XADD key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold [LIMIT count]] *|id field value [field value ...]
+func execXAdd(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	noMkStream := false
+	var trim *streamTrim
+	i := 1
+options:
+	for i < len(args) {
+		switch strings.ToUpper(string(args[i])) {
+		case "NOMKSTREAM":
+			noMkStream = true
+			i++
+		case "MAXLEN", "MINID":
+			var errReply resp.Reply
+			trim, i, errReply = parseStreamTrim(args, i)
+			if errReply != nil {
+				return errReply
+			}
+		default:
+			break options
+		}
+	}
+	if i >= len(args) || (len(args)-i-1) < 2 || (len(args)-i-1)%2 != 0 {
+		return reply.GetArgNumErrReply("xadd")
+	}
+
+	// id 为 * 时自动生成, 为 ms-* 时只自动生成序号
+	idArg := string(args[i])
+	autoMs, autoSeq := idArg == "*", false
+	var id stream.ID
+	if !autoMs {
+		if msPart, ok := strings.CutSuffix(idArg, "-*"); ok {
+			ms, err := strconv.ParseUint(msPart, 10, 64)
+			if err != nil {
+				return streamIDErrReply(stream.ErrInvalidID)
+			}
+			id, autoSeq = stream.ID{Ms: ms}, true
+		} else {
+			var err error
+			if id, err = stream.ParseID(idArg, 0); err != nil {
+				return streamIDErrReply(err)
+			}
+			if id.IsZero() {
+				return reply.GetStandardErrorReply("ERR The ID specified in XADD must be greater than 0-0")
+			}
+		}
+	}
+	fields := make([]string, len(args)-i-1)
+	for j, arg := range args[i+1:] {
+		fields[j] = string(arg)
+	}
+
+	var result resp.Reply
+	db.WithKeyLock(key, func() {
+		s, exists, errReply := db.getAsStream(key)
+		if errReply != nil {
+			result = errReply
+			return
+		}
+		if !exists {
+			if noMkStream {
+				result = reply.GetNullBulkReply()
+				return
+			}
+			s = stream.New()
+		}
+
+		ok := true
+		switch {
+		case autoMs:
+			if id, ok = s.NextID(uint64(time.Now().UnixMilli())); !ok {
+				result = reply.GetStandardErrorReply("ERR The stream has exhausted the last possible ID, unable to add more items")
+				return
+			}
+		case autoSeq:
+			id, ok = s.NextSeqID(id.Ms)
+		default:
+			ok = s.LastID().Less(id)
+		}
+		if !ok {
+			result = reply.GetStandardErrorReply("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+			return
+		}
+
+		s.Add(id, fields)
+		removed := 0
+		if trim != nil {
+			removed = trim.apply(s)
+		}
+		if !exists {
+			db.PutEntity(key, &database.DataEntity{Data: s})
+		}
+
+		// 记录生成的 ID, 重放时得到相同的条目
+		aofLine := utils.ToCmdLineWithName("XADD", args[0], []byte(id.String()))
+		db.addAof(append(aofLine, args[i+1:]...))
+		if removed > 0 {
+			db.addStreamTrimAof(key, s)
+		}
+		db.signalKey(key)
+		result = streamIDReply(id)
+	})
+	return result
+}
+
+// parseStreamRange parses the start and end bounds of XRANGE and XREVRANGE, making exclusive bounds inclusive
+func parseStreamRange(startArg, endArg []byte) (start, end stream.ID, errReply resp.Reply) {
+	start, exclusive, err := stream.ParseRangeID(string(startArg), 0)
+	if err != nil {
+		return start, end, streamIDErrReply(err)
+	}
+	if exclusive {
+		var ok bool
+		if start, ok = start.Next(); !ok {
+			return start, end, reply.GetStandardErrorReply("ERR invalid start ID for the interval")
+		}
+	}
+	end, exclusive, err = stream.ParseRangeID(string(endArg), stream.MaxID.Seq)
+	if err != nil {
+		return start, end, streamIDErrReply(err)
+	}
+	if exclusive {
+		var ok bool
+		if end, ok = end.Prev(); !ok {
+			return start, end, reply.GetStandardErrorReply("ERR invalid end ID for the interval")
+		}
+	}
+	return start, end, nil
+}
+
+// xrangeGeneric implements XRANGE and XREVRANGE, whose bounds come in reverse order
+func xrangeGeneric(db *DB, args [][]byte, reverse bool) resp.Reply {
+	key := string(args[0])
+	startArg, endArg := args[1], args[2]
+	if reverse {
+		startArg, endArg = endArg, startArg
+	}
+	start, end, errReply := parseStreamRange(startArg, endArg)
+	if errReply != nil {
+		return errReply
+	}
+
+	count := -1
+	if len(args) > 3 {
+		if len(args) != 5 || strings.ToUpper(string(args[3])) != "COUNT" {
+			return reply.GetSyntaxErrReply()
+		}
+		n, err := strconv.Atoi(string(args[4]))
+		if err != nil {
+			return reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+		}
+		count = max(n, 0)
+	}
+	if count == 0 {
+		return reply.GetNullMultiBulkReply()
+	}
+
+	var result resp.Reply
+	db.WithRKeyLock(key, func() {
+		s, exists, errReply := db.getAsStream(key)
+		if errReply != nil {
+			result = errReply
+			return
+		}
+		if !exists {
+			result = reply.GetMultiRawReply(nil)
+			return
+		}
+		result = streamEntriesReply(s.Range(start, end, max(count, 0), reverse))
+	})
+	return result
+}
+
+// execXRange returns the entries with IDs between start and end
+// XRANGE key start end [COUNT count]
+func execXRange(db *DB, args [][]byte) resp.Reply {
+	return xrangeGeneric(db, args, false)
+}
+
+// execXRevRange returns the entries with IDs between end and start, from the greatest ID down
+// XREVRANGE key end start [COUNT count]
+func execXRevRange(db *DB, args [][]byte) resp.Reply {
+	return xrangeGeneric(db, args, true)
+}
+
+// execXLen returns the number of entries of the stream stored at key
+// XLEN key
+func execXLen(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+
+	var result resp.Reply
+	db.WithRKeyLock(key, func() {
+		s, exists, errReply := db.getAsStream(key)
+		switch {
+		case errReply != nil:
+			result = errReply
+		case !exists:
+			result = reply.GetIntReply(0)
+		default:
+			result = reply.GetIntReply(int64(s.Len()))
+		}
+	})
+	return result
+}
+
+// execXDel removes the entries with the given IDs and returns how many existed
+// XDEL key id [id ...]
+func execXDel(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	ids := make([]stream.ID, len(args)-1)
+	for i, arg := range args[1:] {
+		id, err := stream.ParseID(string(arg), 0)
+		if err != nil {
+			return streamIDErrReply(err)
+		}
+		ids[i] = id
+	}
+
+	var result resp.Reply
+	db.WithKeyLock(key, func() {
+		s, exists, errReply := db.getAsStream(key)
+		if errReply != nil {
+			result = errReply
+			return
+		}
+		deleted := 0
+		if exists {
+			for _, id := range ids {
+				if s.Delete(id) {
+					deleted++
+				}
+			}
+		}
+		if deleted > 0 {
+			db.addAof(utils.ToCmdLineWithName("XDEL", args...))
+		}
+		result = reply.GetIntReply(int64(deleted))
+	})
+	return result
+}
+
+// execXTrim trims the stream stored at key and returns how many entries were removed
+// XTRIM key MAXLEN|MINID [=|~] threshold [LIMIT count]
+func execXTrim(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	option := strings.ToUpper(string(args[1]))
+	if option != "MAXLEN" && option != "MINID" {
+		return reply.GetSyntaxErrReply()
+	}
+	trim, next, errReply := parseStreamTrim(args, 1)
+	if errReply != nil {
+		return errReply
+	}
+	if next != len(args) {
+		return reply.GetSyntaxErrReply()
+	}
+
+	var result resp.Reply
+	db.WithKeyLock(key, func() {
+		s, exists, errReply := db.getAsStream(key)
+		if errReply != nil {
+			result = errReply
+			return
+		}
+		removed := 0
+		if exists {
+			removed = trim.apply(s)
+		}
+		if removed > 0 {
+			db.addStreamTrimAof(key, s)
+		}
+		result = reply.GetIntReply(int64(removed))
+	})
+	return result
+}
+
+// streamReadArgs holds the arguments of XREAD and XREADGROUP
+type streamReadArgs struct {
+	count    int // 0 means no limit
+	block    bool
+	timeout  time.Duration
+	noAck    bool
+	group    string
+	consumer string
+	keys     []string
+	ids      []string
+}
+
+// parseStreamReadArgs parses the arguments of XREAD, or of XREADGROUP if group is true
+func parseStreamReadArgs(args [][]byte, group bool) (*streamReadArgs, resp.Reply) {
+	cmdName := "xread"
+	if group {
+		cmdName = "xreadgroup"
+	}
+	readArgs := &streamReadArgs{}
+	for i := 0; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		remaining := len(args) - i - 1
+		switch {
+		case option == "COUNT" && remaining >= 1:
+			count, err := strconv.Atoi(string(args[i+1]))
+			if err != nil {
+				return nil, reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+			}
+			readArgs.count = max(count, 0)
+			i++
+		case option == "BLOCK" && remaining >= 1:
+			ms, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return nil, reply.GetStandardErrorReply("ERR timeout is not an integer or out of range")
+			}
+			if ms < 0 {
+				return nil, reply.GetStandardErrorReply("ERR timeout is negative")
+			}
+			readArgs.block, readArgs.timeout = true, time.Duration(ms)*time.Millisecond
+			i++
+		case option == "NOACK" && group:
+			readArgs.noAck = true
+		case option == "GROUP" && group && remaining >= 2:
+			readArgs.group, readArgs.consumer = string(args[i+1]), string(args[i+2])
+			i += 2
+		case option == "STREAMS":
+			streams := args[i+1:]
+			if len(streams) == 0 || len(streams)%2 != 0 {
+				return nil, reply.GetStandardErrorReply("ERR Unbalanced '" + cmdName + "' list of streams: for each stream key an ID or '$' must be specified.")
+			}
+			half := len(streams) / 2
+			readArgs.keys = make([]string, half)
+			readArgs.ids = make([]string, half)
+			for j := 0; j < half; j++ {
+				readArgs.keys[j] = string(streams[j])
+				readArgs.ids[j] = string(streams[half+j])
+			}
+			if group && readArgs.group == "" {
+				return nil, reply.GetStandardErrorReply("ERR Missing GROUP option for XREADGROUP")
+			}
+			return readArgs, nil
+		default:
+			return nil, reply.GetSyntaxErrReply()
+		}
+	}
+	return nil, reply.GetSyntaxErrReply()
+}
+
+// execXRead returns the entries with IDs greater than the given ones from each stream,
+// waiting up to BLOCK milliseconds for one to be added if there is none
+// XREAD [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+func execXRead(db *DB, args [][]byte) resp.Reply {
+	readArgs, errReply := parseStreamReadArgs(args, false)
+	if errReply != nil {
+		return errReply
+	}
+
+	ids := make([]stream.ID, len(readArgs.ids))
+	var lastKeys []int
+	for i, arg := range readArgs.ids {
+		switch arg {
+		case "$":
+			lastKeys = append(lastKeys, i)
+		case ">":
+			return reply.GetStandardErrorReply("ERR The > ID can be specified only when calling XREADGROUP using the GROUP <group> <consumer> option.")
+		default:
+			id, err := stream.ParseID(arg, 0)
+			if err != nil {
+				return streamIDErrReply(err)
+			}
+			ids[i] = id
+		}
+	}
+	// $ 只在命令开始时解析一次, 阻塞期间等待的是之后加入的条目
+	if len(lastKeys) > 0 {
+		db.withRKeyLocks(readArgs.keys, func() {
+			for _, i := range lastKeys {
+				s, exists, err := db.getAsStream(readArgs.keys[i])
+				if err != nil {
+					errReply = err
+					return
+				}
+				if exists {
+					ids[i] = s.LastID()
+				}
+			}
+		})
+		if errReply != nil {
+			return errReply
+		}
+	}
+
+	// read returns nil if no stream has entries to serve
+	read := func() resp.Reply {
+		var result resp.Reply
+		var replies []resp.Reply
+		db.withRKeyLocks(readArgs.keys, func() {
+			for i, key := range readArgs.keys {
+				s, exists, errReply := db.getAsStream(key)
+				if errReply != nil {
+					result = errReply
+					return
+				}
+				start, ok := ids[i].Next()
+				if !exists || !ok {
+					continue
+				}
+				entries := s.Range(start, stream.MaxID, readArgs.count, false)
+				if len(entries) > 0 {
+					replies = append(replies, reply.GetMultiRawReply([]resp.Reply{
+						reply.GetBulkReply([]byte(key)),
+						streamEntriesReply(entries),
+					}))
+				}
+			}
+		})
+		if result == nil && len(replies) > 0 {
+			result = reply.GetMultiRawReply(replies)
+		}
+		return result
+	}
+
+	if result := read(); result != nil {
+		return result
+	}
+	if !readArgs.block {
+		return reply.GetNullMultiBulkReply()
+	}
+	return &blockingReply{
+		keys:     readArgs.keys,
+		timeout:  readArgs.timeout,
+		retry:    read,
+		timedOut: reply.GetNullMultiBulkReply(),
+	}
+}
+
+func init() {
+	RegisterCommand("XADD", execXAdd, -5)           // key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold [LIMIT count]] *|id field value [field value ...]
+	RegisterCommand("XRANGE", execXRange, -4)       // key start end [COUNT count]
+	RegisterCommand("XREVRANGE", execXRevRange, -4) // key end start [COUNT count]
+	RegisterCommand("XLEN", execXLen, 2)            // key
+	RegisterCommand("XDEL", execXDel, -3)           // key id [id ...]
+	RegisterCommand("XTRIM", execXTrim, -4)         // key MAXLEN|MINID [=|~] threshold [LIMIT count]
+	RegisterCommand("XREAD", execXRead, -4)         // [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+}
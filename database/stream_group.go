@@ -0,0 +1,957 @@
+package database
+
+import (
+	"Redis_Go/datastruct/stream"
+	"Redis_Go/interface/database"
+	"Redis_Go/interface/resp"
+	"Redis_Go/lib/utils"
+	"Redis_Go/resp/reply"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// getStreamGroup returns the stream stored at key and its consumer group,
+// errReply is a NOGROUP error with the given message if either doesn't exist
+func (db *DB) getStreamGroup(key, group, noGroupMsg string) (*stream.Stream, *stream.Group, resp.Reply) {
+	s, exists, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return nil, nil, errReply
+	}
+	if exists {
+		if g, ok := s.Group(group); ok {
+			return s, g, nil
+		}
+	}
+	return nil, nil, reply.GetStandardErrorReply(noGroupMsg)
+}
+
+func noSuchKeyOrGroupMsg(key, group string) string {
+	return "NOGROUP No such key '" + key + "' or consumer group '" + group + "'"
+}
+
+func noSuchGroupMsg(key, group string) string {
+	return "NOGROUP No such consumer group '" + group + "' for key name '" + key + "'"
+}
+
+// helpReply formats the lines of a HELP subcommand
+func helpReply(cmdName string, lines ...string) resp.Reply {
+	replies := make([]resp.Reply, 0, len(lines)+3)
+	replies = append(replies, reply.GetStatusReply(cmdName+" <subcommand> [<arg> [value] [opt] ...]. Subcommands are:"))
+	for _, line := range lines {
+		replies = append(replies, reply.GetStatusReply(line))
+	}
+	replies = append(replies, reply.GetStatusReply("HELP"), reply.GetStatusReply("    Print this help."))
+	return reply.GetMultiRawReply(replies)
+}
+
+func parseEntriesRead(arg []byte) (int64, resp.Reply) {
+	n, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return 0, reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+	}
+	if n < 0 && n != stream.InvalidEntriesRead {
+		return 0, reply.GetStandardErrorReply("ERR value for ENTRIESREAD must be positive or -1")
+	}
+	return n, nil
+}
+
+// resolveGroupID parses the ID argument of XGROUP CREATE and SETID, where "$" stands for the last ID of s
+func resolveGroupID(arg []byte, s *stream.Stream) (stream.ID, resp.Reply) {
+	if string(arg) == "$" {
+		if s == nil {
+			return stream.MinID, nil
+		}
+		return s.LastID(), nil
+	}
+	id, err := stream.ParseID(string(arg), 0)
+	if err != nil {
+		return id, streamIDErrReply(err)
+	}
+	return id, nil
+}
+
+// execXGroup manages the consumer groups of a stream
+// XGROUP CREATE key group id|$ [MKSTREAM] [ENTRIESREAD entries-read]
+// XGROUP SETID key group id|$ [ENTRIESREAD entries-read]
+// XGROUP DESTROY key group
+// XGROUP CREATECONSUMER key group consumer
+// XGROUP DELCONSUMER key group consumer
+func execXGroup(db *DB, args [][]byte) resp.Reply {
+	subCmd := strings.ToUpper(string(args[0]))
+	var minArgs, maxArgs int
+	switch subCmd {
+	case "HELP":
+		return helpReply("XGROUP",
+			"CREATE <key> <groupname> <id|$> [option]",
+			"    Create a new consumer group. Options are:",
+			"    * MKSTREAM",
+			"      Create the empty stream if it does not exist.",
+			"    * ENTRIESREAD entries_read",
+			"      Set the group's entries_read counter (internal use).",
+			"CREATECONSUMER <key> <groupname> <consumer>",
+			"    Create a new consumer in the specified group.",
+			"DELCONSUMER <key> <groupname> <consumer>",
+			"    Remove the specified consumer.",
+			"DESTROY <key> <groupname>",
+			"    Remove the specified group.",
+			"SETID <key> <groupname> <id|$> [ENTRIESREAD entries_read]",
+			"    Set the current group ID and entries_read counter.")
+	case "CREATE":
+		minArgs, maxArgs = 4, 7
+	case "SETID":
+		minArgs, maxArgs = 4, 6
+	case "DESTROY":
+		minArgs, maxArgs = 3, 3
+	case "CREATECONSUMER", "DELCONSUMER":
+		minArgs, maxArgs = 4, 4
+	default:
+		return reply.GetStandardErrorReply("ERR unknown subcommand '" + string(args[0]) + "'. Try XGROUP HELP.")
+	}
+	if len(args) < minArgs || len(args) > maxArgs {
+		return reply.GetArgNumErrReply("xgroup|" + strings.ToLower(subCmd))
+	}
+
+	key, group := string(args[1]), string(args[2])
+	mkStream := false
+	entriesRead, entriesReadGiven := int64(stream.InvalidEntriesRead), false
+	if subCmd == "CREATE" || subCmd == "SETID" {
+		for i := 4; i < len(args); i++ {
+			option := strings.ToUpper(string(args[i]))
+			switch {
+			case option == "MKSTREAM" && subCmd == "CREATE":
+				mkStream = true
+			case option == "ENTRIESREAD" && i+1 < len(args):
+				var errReply resp.Reply
+				if entriesRead, errReply = parseEntriesRead(args[i+1]); errReply != nil {
+					return errReply
+				}
+				entriesReadGiven = true
+				i++
+			default:
+				return reply.GetSyntaxErrReply()
+			}
+		}
+	}
+
+	var result resp.Reply
+	db.WithKeyLock(key, func() {
+		s, exists, errReply := db.getAsStream(key)
+		if errReply != nil {
+			result = errReply
+			return
+		}
+		if !exists && !mkStream {
+			result = reply.GetStandardErrorReply("ERR The XGROUP subcommand requires the key to exist. " +
+				"Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+			return
+		}
+
+		if subCmd == "CREATE" {
+			id, errReply := resolveGroupID(args[3], s)
+			if errReply != nil {
+				result = errReply
+				return
+			}
+			if !exists {
+				s = stream.New()
+			}
+			if _, ok := s.CreateGroup(group, id, entriesRead); !ok {
+				result = reply.GetStandardErrorReply("BUSYGROUP Consumer Group name already exists")
+				return
+			}
+			if !exists {
+				db.PutEntity(key, &database.DataEntity{Data: s})
+			}
+
+			// $ 记录为解析后的 ID
+			aofLine := utils.String2Cmdline("XGROUP", "CREATE", key, group, id.String())
+			if mkStream {
+				aofLine = append(aofLine, []byte("MKSTREAM"))
+			}
+			if entriesReadGiven {
+				aofLine = append(aofLine, []byte("ENTRIESREAD"), []byte(strconv.FormatInt(entriesRead, 10)))
+			}
+			db.addAof(aofLine)
+			result = reply.GetOKReply()
+			return
+		}
+
+		g, ok := s.Group(group)
+		if !ok {
+			result = reply.GetStandardErrorReply(noSuchGroupMsg(key, group))
+			return
+		}
+		switch subCmd {
+		case "SETID":
+			id, errReply := resolveGroupID(args[3], s)
+			if errReply != nil {
+				result = errReply
+				return
+			}
+			g.LastID, g.EntriesRead = id, entriesRead
+			db.addAof(utils.String2Cmdline("XGROUP", "SETID", key, group, id.String(),
+				"ENTRIESREAD", strconv.FormatInt(entriesRead, 10)))
+			result = reply.GetOKReply()
+		case "DESTROY":
+			s.DestroyGroup(group)
+			db.addAof(utils.ToCmdLineWithName("XGROUP", args...))
+			// 唤醒阻塞在该组上的 XREADGROUP, 让它们返回 NOGROUP 错误
+			db.signalKey(key)
+			result = reply.GetIntReply(1)
+		case "CREATECONSUMER":
+			_, created := g.CreateConsumer(string(args[3]), time.Now().UnixMilli())
+			if !created {
+				result = reply.GetIntReply(0)
+				return
+			}
+			db.addAof(utils.ToCmdLineWithName("XGROUP", args...))
+			result = reply.GetIntReply(1)
+		case "DELCONSUMER":
+			pending, deleted := g.DeleteConsumer(string(args[3]))
+			if deleted {
+				db.addAof(utils.ToCmdLineWithName("XGROUP", args...))
+			}
+			result = reply.GetIntReply(int64(pending))
+		}
+	})
+	return result
+}
+
+// xclaimAofLine is how a delivery or a claim is logged: an XCLAIM setting the pending entry exactly as it is now
+func xclaimAofLine(key, group string, pe *stream.PendingEntry) [][]byte {
+	return utils.String2Cmdline("XCLAIM", key, group, pe.Consumer.Name, "0", pe.ID.String(),
+		"TIME", strconv.FormatInt(pe.DeliveryTime, 10),
+		"RETRYCOUNT", strconv.FormatInt(pe.DeliveryCount, 10), "FORCE", "JUSTID")
+}
+
+// xsetIDAofLine logs the last delivered ID and entries read counter of a group
+func xsetIDAofLine(key string, g *stream.Group) [][]byte {
+	return utils.String2Cmdline("XGROUP", "SETID", key, g.Name, g.LastID.String(),
+		"ENTRIESREAD", strconv.FormatInt(g.EntriesRead, 10))
+}
+
+// execXReadGroup reads from the streams on behalf of a consumer of a group.
+// The ID > delivers entries never delivered to the group and adds them to the consumer's pending entries,
+// waiting up to BLOCK milliseconds for one to be added if there is none.
+// Any other ID returns the consumer's pending entries after it, the ones deleted since being given as nil
+// XREADGROUP GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+func execXReadGroup(db *DB, args [][]byte) resp.Reply {
+	readArgs, errReply := parseStreamReadArgs(args, true)
+	if errReply != nil {
+		return errReply
+	}
+
+	ids := make([]stream.ID, len(readArgs.ids))
+	readNew := make([]bool, len(readArgs.ids))
+	onlyNew := true
+	for i, arg := range readArgs.ids {
+		switch arg {
+		case ">":
+			readNew[i] = true
+		case "$":
+			return reply.GetStandardErrorReply("ERR The $ ID is meaningless in the context of XREADGROUP: " +
+				"you want to read the history of this consumer by specifying a proper ID, " +
+				"or use the > ID to get new messages. The $ ID would just return an empty result set.")
+		default:
+			id, err := stream.ParseID(arg, 0)
+			if err != nil {
+				return streamIDErrReply(err)
+			}
+			ids[i] = id
+			onlyNew = false
+		}
+	}
+
+	// read returns nil if no stream has entries to serve
+	read := func() resp.Reply {
+		handle := db.lockMgr.LockKeys(readArgs.keys)
+		defer db.lockMgr.UnlockKeys(handle)
+
+		// 先检查所有的键, 出错时不做任何修改
+		streams := make([]*stream.Stream, len(readArgs.keys))
+		groups := make([]*stream.Group, len(readArgs.keys))
+		for i, key := range readArgs.keys {
+			var errReply resp.Reply
+			streams[i], groups[i], errReply = db.getStreamGroup(key, readArgs.group,
+				"NOGROUP No such key '"+key+"' or consumer group '"+readArgs.group+"' in XREADGROUP with GROUP option")
+			if errReply != nil {
+				return errReply
+			}
+		}
+
+		now := time.Now().UnixMilli()
+		var replies []resp.Reply
+		for i, key := range readArgs.keys {
+			s, g := streams[i], groups[i]
+			c, created := g.CreateConsumer(readArgs.consumer, now)
+			c.SeenTime = now
+			if created {
+				db.addAof(utils.String2Cmdline("XGROUP", "CREATECONSUMER", key, g.Name, c.Name))
+			}
+
+			var entries []resp.Reply
+			if readNew[i] {
+				start, ok := g.LastID.Next()
+				if !ok {
+					continue
+				}
+				delivered := s.Range(start, stream.MaxID, readArgs.count, false)
+				if len(delivered) == 0 {
+					continue
+				}
+				c.ActiveTime = now
+				for _, entry := range delivered {
+					g.LastID = entry.ID
+					s.MarkRead(g, entry.ID)
+					entries = append(entries, streamEntryReply(entry))
+					if !readArgs.noAck {
+						db.addAof(xclaimAofLine(key, g.Name, g.Deliver(entry.ID, c, now)))
+					}
+				}
+				db.addAof(xsetIDAofLine(key, g))
+			} else if start, ok := ids[i].Next(); ok {
+				for _, pe := range c.PendingFrom(start, readArgs.count) {
+					entry, exists := s.Get(pe.ID)
+					if !exists {
+						entries = append(entries, reply.GetMultiRawReply([]resp.Reply{
+							streamIDReply(pe.ID),
+							reply.GetNullMultiBulkReply(),
+						}))
+						continue
+					}
+					pe.DeliveryTime = now
+					pe.DeliveryCount++
+					db.addAof(xclaimAofLine(key, g.Name, pe))
+					entries = append(entries, streamEntryReply(entry))
+				}
+			}
+			replies = append(replies, reply.GetMultiRawReply([]resp.Reply{
+				reply.GetBulkReply([]byte(key)),
+				reply.GetMultiRawReply(entries),
+			}))
+		}
+		if len(replies) == 0 {
+			return nil
+		}
+		return reply.GetMultiRawReply(replies)
+	}
+
+	if result := read(); result != nil {
+		return result
+	}
+	if !readArgs.block || !onlyNew {
+		return reply.GetNullMultiBulkReply()
+	}
+	return &blockingReply{
+		keys:     readArgs.keys,
+		timeout:  readArgs.timeout,
+		retry:    read,
+		timedOut: reply.GetNullMultiBulkReply(),
+	}
+}
+
+// execXAck removes the entries from the pending entries of the group and returns how many were pending
+// XACK key group id [id ...]
+func execXAck(db *DB, args [][]byte) resp.Reply {
+	key, group := string(args[0]), string(args[1])
+	ids := make([]stream.ID, len(args)-2)
+	for i, arg := range args[2:] {
+		id, err := stream.ParseID(string(arg), 0)
+		if err != nil {
+			return streamIDErrReply(err)
+		}
+		ids[i] = id
+	}
+
+	var result resp.Reply
+	db.WithKeyLock(key, func() {
+		s, exists, errReply := db.getAsStream(key)
+		if errReply != nil {
+			result = errReply
+			return
+		}
+		acked := 0
+		if exists {
+			if g, ok := s.Group(group); ok {
+				for _, id := range ids {
+					if g.Ack(id) {
+						acked++
+					}
+				}
+			}
+		}
+		if acked > 0 {
+			db.addAof(utils.ToCmdLineWithName("XACK", args...))
+		}
+		result = reply.GetIntReply(int64(acked))
+	})
+	return result
+}
+
+// execXPending returns a summary of the pending entries of a group, or the pending entries themselves
+// between start and end, idle for at least min-idle-time milliseconds and optionally of a single consumer
+// XPENDING key group [[IDLE min-idle-time] start end count [consumer]]
+func execXPending(db *DB, args [][]byte) resp.Reply {
+	key, group := string(args[0]), string(args[1])
+	extended := len(args) > 2
+	var (
+		minIdle    int64
+		start, end stream.ID
+		count      int
+		consumer   string
+	)
+	if extended {
+		i := 2
+		if strings.ToUpper(string(args[i])) == "IDLE" && len(args) > 3 {
+			var err error
+			if minIdle, err = strconv.ParseInt(string(args[i+1]), 10, 64); err != nil {
+				return reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+			}
+			i += 2
+		}
+		if rest := len(args) - i; rest != 3 && rest != 4 {
+			return reply.GetSyntaxErrReply()
+		}
+		var errReply resp.Reply
+		if start, end, errReply = parseStreamRange(args[i], args[i+1]); errReply != nil {
+			return errReply
+		}
+		n, err := strconv.Atoi(string(args[i+2]))
+		if err != nil {
+			return reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+		}
+		count = max(n, 0)
+		if i+3 < len(args) {
+			consumer = string(args[i+3])
+		}
+	}
+
+	var result resp.Reply
+	db.WithRKeyLock(key, func() {
+		_, g, errReply := db.getStreamGroup(key, group, noSuchKeyOrGroupMsg(key, group))
+		if errReply != nil {
+			result = errReply
+			return
+		}
+
+		if !extended {
+			pending := g.PendingFrom(stream.MinID, 0)
+			if len(pending) == 0 {
+				result = reply.GetMultiRawReply([]resp.Reply{
+					reply.GetIntReply(0),
+					reply.GetNullBulkReply(),
+					reply.GetNullBulkReply(),
+					reply.GetNullMultiBulkReply(),
+				})
+				return
+			}
+			var consumers []resp.Reply
+			for _, c := range g.Consumers() {
+				if c.PendingLen() == 0 {
+					continue
+				}
+				consumers = append(consumers, reply.GetMultiBulkReply([][]byte{
+					[]byte(c.Name),
+					[]byte(strconv.Itoa(c.PendingLen())),
+				}))
+			}
+			result = reply.GetMultiRawReply([]resp.Reply{
+				reply.GetIntReply(int64(len(pending))),
+				streamIDReply(pending[0].ID),
+				streamIDReply(pending[len(pending)-1].ID),
+				reply.GetMultiRawReply(consumers),
+			})
+			return
+		}
+
+		var pending []*stream.PendingEntry
+		if consumer == "" {
+			pending = g.PendingFrom(start, 0)
+		} else if c, ok := g.Consumer(consumer); ok {
+			pending = c.PendingFrom(start, 0)
+		}
+		now := time.Now().UnixMilli()
+		replies := make([]resp.Reply, 0)
+		for _, pe := range pending {
+			if len(replies) >= count || end.Less(pe.ID) {
+				break
+			}
+			idle := now - pe.DeliveryTime
+			if idle < minIdle {
+				continue
+			}
+			replies = append(replies, reply.GetMultiRawReply([]resp.Reply{
+				streamIDReply(pe.ID),
+				reply.GetBulkReply([]byte(pe.Consumer.Name)),
+				reply.GetIntReply(max(idle, 0)),
+				reply.GetIntReply(pe.DeliveryCount),
+			}))
+		}
+		result = reply.GetMultiRawReply(replies)
+	})
+	return result
+}
+
+// execXClaim moves the pending entries idle for at least min-idle-time milliseconds to the consumer,
+// and returns them. Pending entries whose entry was deleted are removed from the group
+// XCLAIM key group consumer min-idle-time id [id ...] [IDLE ms] [TIME unix-time-milliseconds] [RETRYCOUNT count] [FORCE] [JUSTID] [LASTID lastid]
+func execXClaim(db *DB, args [][]byte) resp.Reply {
+	key, group, consumer := string(args[0]), string(args[1]), string(args[2])
+	minIdle, err := strconv.ParseInt(string(args[3]), 10, 64)
+	if err != nil {
+		return reply.GetStandardErrorReply("ERR Invalid min-idle-time argument for XCLAIM")
+	}
+
+	// 参数中第一个不是 ID 的位置开始为选项
+	var ids []stream.ID
+	i := 4
+	for ; i < len(args); i++ {
+		id, err := stream.ParseID(string(args[i]), 0)
+		if err != nil {
+			break
+		}
+		ids = append(ids, id)
+	}
+
+	now := time.Now().UnixMilli()
+	deliveryTime, retryCount := now, int64(-1)
+	force, justID := false, false
+	var lastID *stream.ID
+	for ; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		remaining := len(args) - i - 1
+		switch {
+		case option == "FORCE":
+			force = true
+		case option == "JUSTID":
+			justID = true
+		case option == "IDLE" && remaining >= 1:
+			idle, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return reply.GetStandardErrorReply("ERR Invalid IDLE option argument for XCLAIM")
+			}
+			deliveryTime = now - idle
+			i++
+		case option == "TIME" && remaining >= 1:
+			if deliveryTime, err = strconv.ParseInt(string(args[i+1]), 10, 64); err != nil {
+				return reply.GetStandardErrorReply("ERR Invalid TIME option argument for XCLAIM")
+			}
+			i++
+		case option == "RETRYCOUNT" && remaining >= 1:
+			if retryCount, err = strconv.ParseInt(string(args[i+1]), 10, 64); err != nil {
+				return reply.GetStandardErrorReply("ERR Invalid RETRYCOUNT option argument for XCLAIM")
+			}
+			i++
+		case option == "LASTID" && remaining >= 1:
+			id, err := stream.ParseID(string(args[i+1]), 0)
+			if err != nil {
+				return streamIDErrReply(err)
+			}
+			lastID = &id
+			i++
+		default:
+			return reply.GetStandardErrorReply("ERR Unrecognized XCLAIM option '" + string(args[i]) + "'")
+		}
+	}
+	// 不能把投递时间设在未来
+	if deliveryTime < 0 || deliveryTime > now {
+		deliveryTime = now
+	}
+
+	var result resp.Reply
+	db.WithKeyLock(key, func() {
+		s, g, errReply := db.getStreamGroup(key, group, noSuchKeyOrGroupMsg(key, group))
+		if errReply != nil {
+			result = errReply
+			return
+		}
+		if lastID != nil && g.LastID.Less(*lastID) {
+			g.LastID = *lastID
+			db.addAof(xsetIDAofLine(key, g))
+		}
+
+		replies := make([]resp.Reply, 0, len(ids))
+		var c *stream.Consumer
+		for _, id := range ids {
+			entry, exists := s.Get(id)
+			pe, pending := g.Pending(id)
+			if !pending && !(force && exists) {
+				continue
+			}
+			if pending && !exists {
+				g.Ack(id)
+				db.addAof(utils.String2Cmdline("XACK", key, group, id.String()))
+				continue
+			}
+			if pending && minIdle > 0 && now-pe.DeliveryTime < minIdle {
+				continue
+			}
+
+			// 消费者在第一次认领时才创建
+			if c == nil {
+				c, _ = g.CreateConsumer(consumer, now)
+				c.SeenTime, c.ActiveTime = now, now
+			}
+			if pending {
+				g.Claim(pe, c)
+			} else {
+				pe = g.Deliver(id, c, now)
+			}
+			pe.DeliveryTime = deliveryTime
+			if retryCount >= 0 {
+				pe.DeliveryCount = retryCount
+			} else if !justID {
+				pe.DeliveryCount++
+			}
+			db.addAof(xclaimAofLine(key, group, pe))
+
+			if justID {
+				replies = append(replies, streamIDReply(id))
+			} else {
+				replies = append(replies, streamEntryReply(entry))
+			}
+		}
+		result = reply.GetMultiRawReply(replies)
+	})
+	return result
+}
+
+// execXAutoClaim scans the pending entries of the group from start and claims up to count of those idle for
+// at least min-idle-time milliseconds, as XCLAIM does. It replies with the ID to continue the scan from,
+// 0-0 once it is complete, the claimed entries and the IDs of the deleted entries removed from the group
+// XAUTOCLAIM key group consumer min-idle-time start [COUNT count] [JUSTID]
+func execXAutoClaim(db *DB, args [][]byte) resp.Reply {
+	key, group, consumer := string(args[0]), string(args[1]), string(args[2])
+	minIdle, err := strconv.ParseInt(string(args[3]), 10, 64)
+	if err != nil {
+		return reply.GetStandardErrorReply("ERR Invalid min-idle-time argument for XAUTOCLAIM")
+	}
+	start, exclusive, err := stream.ParseRangeID(string(args[4]), 0)
+	if err != nil {
+		return streamIDErrReply(err)
+	}
+	if exclusive {
+		var ok bool
+		if start, ok = start.Next(); !ok {
+			return reply.GetStandardErrorReply("ERR invalid start ID for the interval")
+		}
+	}
+
+	count, justID := 100, false
+	for i := 5; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		switch {
+		case option == "JUSTID":
+			justID = true
+		case option == "COUNT" && i+1 < len(args):
+			n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+			}
+			// 每次最多检查 count 的 10 倍个条目
+			if n < 1 || n > math.MaxInt64/10 {
+				return reply.GetStandardErrorReply("ERR COUNT must be > 0")
+			}
+			count = int(n)
+			i++
+		default:
+			return reply.GetSyntaxErrReply()
+		}
+	}
+
+	var result resp.Reply
+	db.WithKeyLock(key, func() {
+		s, g, errReply := db.getStreamGroup(key, group, noSuchKeyOrGroupMsg(key, group))
+		if errReply != nil {
+			result = errReply
+			return
+		}
+
+		now := time.Now().UnixMilli()
+		attempts := count * 10
+		next := stream.MinID
+		claimed := make([]resp.Reply, 0)
+		var deleted [][]byte
+		var c *stream.Consumer
+		for _, pe := range g.PendingFrom(start, 0) {
+			if attempts == 0 || len(claimed) == count {
+				next = pe.ID
+				break
+			}
+			attempts--
+
+			entry, exists := s.Get(pe.ID)
+			if !exists {
+				g.Ack(pe.ID)
+				deleted = append(deleted, []byte(pe.ID.String()))
+				continue
+			}
+			if minIdle > 0 && now-pe.DeliveryTime < minIdle {
+				continue
+			}
+
+			if c == nil {
+				c, _ = g.CreateConsumer(consumer, now)
+				c.SeenTime, c.ActiveTime = now, now
+			}
+			g.Claim(pe, c)
+			pe.DeliveryTime = now
+			if !justID {
+				pe.DeliveryCount++
+			}
+			db.addAof(xclaimAofLine(key, group, pe))
+
+			if justID {
+				claimed = append(claimed, streamIDReply(pe.ID))
+			} else {
+				claimed = append(claimed, streamEntryReply(entry))
+			}
+		}
+		if len(deleted) > 0 {
+			db.addAof(append(utils.String2Cmdline("XACK", key, group), deleted...))
+		}
+
+		result = reply.GetMultiRawReply([]resp.Reply{
+			streamIDReply(next),
+			reply.GetMultiRawReply(claimed),
+			reply.GetMultiBulkReply(deleted),
+		})
+	})
+	return result
+}
+
+// streamInfo is the flat list of field names and values XINFO replies with
+type streamInfo []resp.Reply
+
+func (info *streamInfo) add(name string, value resp.Reply) {
+	*info = append(*info, reply.GetBulkReply([]byte(name)), value)
+}
+
+func (info *streamInfo) addInt(name string, value int64) {
+	info.add(name, reply.GetIntReply(value))
+}
+
+func (info streamInfo) reply() resp.Reply {
+	return reply.GetMultiRawReply(info)
+}
+
+// addEntriesRead adds the entries-read and lag fields of a group, nil when unknown
+func (info *streamInfo) addEntriesRead(s *stream.Stream, g *stream.Group) {
+	if g.EntriesRead != stream.InvalidEntriesRead {
+		info.addInt("entries-read", g.EntriesRead)
+	} else {
+		info.add("entries-read", reply.GetNullBulkReply())
+	}
+	if lag, ok := s.Lag(g); ok {
+		info.addInt("lag", lag)
+	} else {
+		info.add("lag", reply.GetNullBulkReply())
+	}
+}
+
+// addStreamHeader adds the fields XINFO STREAM replies with in both forms
+func (info *streamInfo) addStreamHeader(s *stream.Stream) {
+	info.addInt("length", int64(s.Len()))
+	// 用块数代替 Redis 中基数树的键数和节点数
+	info.addInt("radix-tree-keys", int64(s.ChunkCount()))
+	info.addInt("radix-tree-nodes", int64(s.ChunkCount()))
+	info.add("last-generated-id", streamIDReply(s.LastID()))
+	info.add("max-deleted-entry-id", streamIDReply(s.MaxDeletedID()))
+	info.addInt("entries-added", int64(s.EntriesAdded()))
+	first, _ := s.First()
+	info.add("recorded-first-entry-id", streamIDReply(first.ID))
+}
+
+func streamInfoReply(s *stream.Stream) resp.Reply {
+	var info streamInfo
+	info.addStreamHeader(s)
+	info.addInt("groups", int64(len(s.Groups())))
+	for _, field := range []string{"first-entry", "last-entry"} {
+		entry, ok := s.First()
+		if field == "last-entry" {
+			entry, ok = s.Last()
+		}
+		if ok {
+			info.add(field, streamEntryReply(entry))
+		} else {
+			info.add(field, reply.GetNullBulkReply())
+		}
+	}
+	return info.reply()
+}
+
+// streamInfoFullReply describes the stream with up to count of its entries and of the pending entries
+// of each group and consumer, all of them if count is 0
+func streamInfoFullReply(s *stream.Stream, count int) resp.Reply {
+	var info streamInfo
+	info.addStreamHeader(s)
+	info.add("entries", streamEntriesReply(s.Range(stream.MinID, stream.MaxID, count, false)))
+
+	groups := make([]resp.Reply, 0)
+	for _, g := range s.Groups() {
+		var groupInfo streamInfo
+		groupInfo.add("name", reply.GetBulkReply([]byte(g.Name)))
+		groupInfo.add("last-delivered-id", streamIDReply(g.LastID))
+		groupInfo.addEntriesRead(s, g)
+		groupInfo.addInt("pel-count", int64(g.PendingLen()))
+		pending := make([]resp.Reply, 0)
+		for _, pe := range g.PendingFrom(stream.MinID, count) {
+			pending = append(pending, reply.GetMultiRawReply([]resp.Reply{
+				streamIDReply(pe.ID),
+				reply.GetBulkReply([]byte(pe.Consumer.Name)),
+				reply.GetIntReply(pe.DeliveryTime),
+				reply.GetIntReply(pe.DeliveryCount),
+			}))
+		}
+		groupInfo.add("pending", reply.GetMultiRawReply(pending))
+
+		consumers := make([]resp.Reply, 0)
+		for _, c := range g.Consumers() {
+			var consumerInfo streamInfo
+			consumerInfo.add("name", reply.GetBulkReply([]byte(c.Name)))
+			consumerInfo.addInt("seen-time", c.SeenTime)
+			consumerInfo.addInt("active-time", c.ActiveTime)
+			consumerInfo.addInt("pel-count", int64(c.PendingLen()))
+			consumerPending := make([]resp.Reply, 0)
+			for _, pe := range c.PendingFrom(stream.MinID, count) {
+				consumerPending = append(consumerPending, reply.GetMultiRawReply([]resp.Reply{
+					streamIDReply(pe.ID),
+					reply.GetIntReply(pe.DeliveryTime),
+					reply.GetIntReply(pe.DeliveryCount),
+				}))
+			}
+			consumerInfo.add("pending", reply.GetMultiRawReply(consumerPending))
+			consumers = append(consumers, consumerInfo.reply())
+		}
+		groupInfo.add("consumers", reply.GetMultiRawReply(consumers))
+		groups = append(groups, groupInfo.reply())
+	}
+	info.add("groups", reply.GetMultiRawReply(groups))
+	return info.reply()
+}
+
+func streamGroupsInfoReply(s *stream.Stream) resp.Reply {
+	groups := make([]resp.Reply, 0)
+	for _, g := range s.Groups() {
+		var info streamInfo
+		info.add("name", reply.GetBulkReply([]byte(g.Name)))
+		info.addInt("consumers", int64(len(g.Consumers())))
+		info.addInt("pending", int64(g.PendingLen()))
+		info.add("last-delivered-id", streamIDReply(g.LastID))
+		info.addEntriesRead(s, g)
+		groups = append(groups, info.reply())
+	}
+	return reply.GetMultiRawReply(groups)
+}
+
+func streamConsumersInfoReply(g *stream.Group) resp.Reply {
+	now := time.Now().UnixMilli()
+	consumers := make([]resp.Reply, 0)
+	for _, c := range g.Consumers() {
+		var info streamInfo
+		info.add("name", reply.GetBulkReply([]byte(c.Name)))
+		info.addInt("pending", int64(c.PendingLen()))
+		info.addInt("idle", max(now-c.SeenTime, 0))
+		inactive := int64(-1)
+		if c.ActiveTime != -1 {
+			inactive = max(now-c.ActiveTime, 0)
+		}
+		info.addInt("inactive", inactive)
+		consumers = append(consumers, info.reply())
+	}
+	return reply.GetMultiRawReply(consumers)
+}
+
+// execXInfo describes a stream, its consumer groups or the consumers of a group
+// XINFO STREAM key [FULL [COUNT count]]
+// XINFO GROUPS key
+// XINFO CONSUMERS key group
+func execXInfo(db *DB, args [][]byte) resp.Reply {
+	subCmd := strings.ToUpper(string(args[0]))
+	full, count := false, 10
+	switch subCmd {
+	case "HELP":
+		return helpReply("XINFO",
+			"CONSUMERS <key> <groupname>",
+			"    Show consumers of <groupname>.",
+			"GROUPS <key>",
+			"    Show the stream consumer groups.",
+			"STREAM <key> [FULL [COUNT <count>]",
+			"    Show information about the stream.")
+	case "STREAM":
+		if len(args) < 2 {
+			return reply.GetArgNumErrReply("xinfo|stream")
+		}
+		if len(args) > 2 {
+			if strings.ToUpper(string(args[2])) != "FULL" {
+				return reply.GetSyntaxErrReply()
+			}
+			full = true
+			if len(args) > 3 {
+				if len(args) != 5 || strings.ToUpper(string(args[3])) != "COUNT" {
+					return reply.GetSyntaxErrReply()
+				}
+				n, err := strconv.Atoi(string(args[4]))
+				if err != nil {
+					return reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+				}
+				count = max(n, 0)
+			}
+		}
+	case "GROUPS":
+		if len(args) != 2 {
+			return reply.GetArgNumErrReply("xinfo|groups")
+		}
+	case "CONSUMERS":
+		if len(args) != 3 {
+			return reply.GetArgNumErrReply("xinfo|consumers")
+		}
+	default:
+		return reply.GetStandardErrorReply("ERR unknown subcommand '" + string(args[0]) + "'. Try XINFO HELP.")
+	}
+
+	key := string(args[1])
+	var result resp.Reply
+	db.WithRKeyLock(key, func() {
+		s, exists, errReply := db.getAsStream(key)
+		if errReply != nil {
+			result = errReply
+			return
+		}
+		if !exists {
+			result = reply.GetStandardErrorReply("ERR no such key")
+			return
+		}
+		switch subCmd {
+		case "STREAM":
+			if full {
+				result = streamInfoFullReply(s, count)
+			} else {
+				result = streamInfoReply(s)
+			}
+		case "GROUPS":
+			result = streamGroupsInfoReply(s)
+		case "CONSUMERS":
+			group := string(args[2])
+			g, ok := s.Group(group)
+			if !ok {
+				result = reply.GetStandardErrorReply(noSuchGroupMsg(key, group))
+				return
+			}
+			result = streamConsumersInfoReply(g)
+		}
+	})
+	return result
+}
+
+func init() {
+	RegisterCommand("XGROUP", execXGroup, -2)         // CREATE|SETID|DESTROY|CREATECONSUMER|DELCONSUMER|HELP key group ...
+	RegisterCommand("XREADGROUP", execXReadGroup, -7) // GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+	RegisterCommand("XACK", execXAck, -4)             // key group id [id ...]
+	RegisterCommand("XPENDING", execXPending, -3)     // key group [[IDLE min-idle-time] start end count [consumer]]
+	RegisterCommand("XCLAIM", execXClaim, -6)         // key group consumer min-idle-time id [id ...] [IDLE ms] [TIME ms] [RETRYCOUNT count] [FORCE] [JUSTID] [LASTID lastid]
+	RegisterCommand("XAUTOCLAIM", execXAutoClaim, -6) // key group consumer min-idle-time start [COUNT count] [JUSTID]
+	RegisterCommand("XINFO", execXInfo, -2)           // STREAM|GROUPS|CONSUMERS|HELP key ...
+}
@@ -0,0 +1,200 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// pendingEntries returns the pending entries of a group, or of one of its consumers, as "id owner deliveries"
+// lines, leaving out the idle times
+func pendingEntries(db *DB, key, group string, consumer ...string) []string {
+	line := append([]string{"XPENDING", key, group, "-", "+", "100"}, consumer...)
+	fields := strings.Fields(execLine(db, line...))
+	var entries []string
+	// 每一项是 *4 $n id $n owner :idle :count
+	for i := 1; i+6 < len(fields); i += 7 {
+		entries = append(entries, fields[i+2]+" "+fields[i+4]+" "+fields[i+6][1:])
+	}
+	return entries
+}
+
+func checkPending(t *testing.T, db *DB, want string, consumer ...string) {
+	t.Helper()
+	if got := strings.Join(pendingEntries(db, "s", "g", consumer...), ", "); got != want {
+		t.Fatalf("pending entries of %v: %q, want %q", consumer, got, want)
+	}
+}
+
+func TestXReadGroupPendingEntries(t *testing.T) {
+	db := NewDB()
+	for _, line := range [][]string{
+		{"XADD", "s", "1-1", "f", "a"},
+		{"XADD", "s", "2-1", "f", "b"},
+		{"XADD", "s", "3-1", "f", "c"},
+		{"XGROUP", "CREATE", "s", "g", "0"},
+	} {
+		execLine(db, line...)
+	}
+
+	steps := []struct {
+		cmd  []string
+		want string
+	}{
+		// > 只投递从未投递给该组的条目, 并加入消费者的 PEL
+		{[]string{"XREADGROUP", "GROUP", "g", "alice", "COUNT", "2", "STREAMS", "s", ">"},
+			"*1 *2 $1 s *2 *2 $3 1-1 *2 $1 f $1 a *2 $3 2-1 *2 $1 f $1 b"},
+		{[]string{"XREADGROUP", "GROUP", "g", "bob", "STREAMS", "s", ">"}, "*1 *2 $1 s *1 *2 $3 3-1 *2 $1 f $1 c"},
+		{[]string{"XREADGROUP", "GROUP", "g", "bob", "STREAMS", "s", ">"}, "*-1"},
+		{[]string{"XPENDING", "s", "g"}, "*4 :3 $3 1-1 $3 3-1 *2 *2 $5 alice $1 2 *2 $3 bob $1 1"},
+		// 重复的 ID 和不在 PEL 中的 ID 不计数
+		{[]string{"XACK", "s", "g", "1-1", "1-1", "9-9"}, ":1"},
+		{[]string{"XACK", "s", "g", "1-1"}, ":0"},
+		// min-idle-time 未到的条目不会被认领
+		{[]string{"XCLAIM", "s", "g", "bob", "3600000", "2-1"}, "*0"},
+		{[]string{"XCLAIM", "s", "g", "bob", "0", "2-1", "JUSTID"}, "*1 $3 2-1"},
+		// 历史 ID 只返回消费者自己的 PEL
+		{[]string{"XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", "0"}, "*1 *2 $1 s *0"},
+		{[]string{"XREADGROUP", "GROUP", "g", "bob", "STREAMS", "s", "0"},
+			"*1 *2 $1 s *2 *2 $3 2-1 *2 $1 f $1 b *2 $3 3-1 *2 $1 f $1 c"},
+		{[]string{"XREADGROUP", "GROUP", "g", "bob", "STREAMS", "s", "2-1"}, "*1 *2 $1 s *1 *2 $3 3-1 *2 $1 f $1 c"},
+		// 已删除的条目仍在 PEL 中, 以 nil 返回
+		{[]string{"XDEL", "s", "3-1"}, ":1"},
+		{[]string{"XREADGROUP", "GROUP", "g", "bob", "STREAMS", "s", "3"}, "*1 *2 $1 s *1 *2 $3 3-1 *-1"},
+		{[]string{"XREADGROUP", "GROUP", "nogroup", "bob", "STREAMS", "s", ">"},
+			"-NOGROUP No such key 's' or consumer group 'nogroup' in XREADGROUP with GROUP option"},
+	}
+	for _, step := range steps {
+		if got := execLine(db, step.cmd...); got != step.want {
+			t.Fatalf("%s replied %q, want %q", strings.Join(step.cmd, " "), got, step.want)
+		}
+	}
+
+	// 读取历史会增加投递次数, 已删除的条目和 JUSTID 的认领不会
+	checkPending(t, db, "2-1 bob 2, 3-1 bob 3")
+	checkPending(t, db, "", "alice")
+
+	// NOACK 读取的条目不进入 PEL
+	execLine(db, "XADD", "s", "4-1", "f", "d")
+	if got := execLine(db, "XREADGROUP", "GROUP", "g", "carol", "NOACK", "STREAMS", "s", ">"); got != "*1 *2 $1 s *1 *2 $3 4-1 *2 $1 f $1 d" {
+		t.Fatalf("XREADGROUP NOACK replied %q", got)
+	}
+	checkPending(t, db, "", "carol")
+
+	// 认领转移条目的所有权, 不带 JUSTID 时算一次投递
+	if got := execLine(db, "XCLAIM", "s", "g", "alice", "0", "2-1"); got != "*1 *2 $3 2-1 *2 $1 f $1 b" {
+		t.Fatalf("XCLAIM replied %q", got)
+	}
+	checkPending(t, db, "2-1 alice 3, 3-1 bob 3")
+	if got := execLine(db, "XACK", "s", "g", "2-1", "3-1"); got != ":2" {
+		t.Fatalf("XACK replied %q", got)
+	}
+	if got := execLine(db, "XPENDING", "s", "g"); got != "*4 :0 $-1 $-1 *-1" {
+		t.Fatalf("XPENDING replied %q after acknowledging everything", got)
+	}
+}
+
+// execBlocking runs a command that may block in its own goroutine and sends its reply on the returned channel
+func execBlocking(db *DB, line ...string) <-chan string {
+	ch := make(chan string, 1)
+	go func() {
+		ch <- execLine(db, line...)
+	}()
+	return ch
+}
+
+// waitBlocked waits until a client blocks on key
+func waitBlocked(t *testing.T, db *DB, key string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		db.waiters.mu.Lock()
+		n := len(db.waiters.waiters[key])
+		db.waiters.mu.Unlock()
+		if n > 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("no client blocked on %s", key)
+}
+
+func receive(t *testing.T, ch <-chan string) string {
+	t.Helper()
+	select {
+	case got := <-ch:
+		return got
+	case <-time.After(5 * time.Second):
+		t.Fatal("the blocked command didn't wake up")
+		return ""
+	}
+}
+
+func TestXReadBlockWakesUp(t *testing.T) {
+	db := NewDB()
+	execLine(db, "XADD", "s", "1-1", "f", "a")
+
+	// $ 等待命令开始之后加入的条目
+	ch := execBlocking(db, "XREAD", "BLOCK", "0", "STREAMS", "other", "s", "$", "$")
+	waitBlocked(t, db, "s")
+	// 写入其他键不会唤醒
+	execLine(db, "SET", "unrelated", "v")
+	select {
+	case got := <-ch:
+		t.Fatalf("XREAD woke up with %q before any entry was added", got)
+	case <-time.After(20 * time.Millisecond):
+	}
+	execLine(db, "XADD", "s", "2-1", "f", "b")
+	if got := receive(t, ch); got != "*1 *2 $1 s *1 *2 $3 2-1 *2 $1 f $1 b" {
+		t.Fatalf("XREAD BLOCK replied %q", got)
+	}
+
+	// 任一键有新条目都会唤醒, 包括阻塞时还不存在的键
+	ch = execBlocking(db, "XREAD", "BLOCK", "0", "STREAMS", "s", "other", "$", "0")
+	waitBlocked(t, db, "other")
+	execLine(db, "XADD", "other", "5-1", "g", "x")
+	if got := receive(t, ch); got != "*1 *2 $5 other *1 *2 $3 5-1 *2 $1 g $1 x" {
+		t.Fatalf("XREAD BLOCK replied %q", got)
+	}
+
+	// 已有条目时不阻塞
+	if got := execLine(db, "XREAD", "BLOCK", "0", "STREAMS", "s", "1-1"); got != "*1 *2 $1 s *1 *2 $3 2-1 *2 $1 f $1 b" {
+		t.Fatalf("XREAD BLOCK with entries to serve replied %q", got)
+	}
+
+	start := time.Now()
+	if got := execLine(db, "XREAD", "BLOCK", "50", "STREAMS", "s", "$"); got != "*-1" {
+		t.Fatalf("XREAD BLOCK replied %q on timeout", got)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("XREAD BLOCK 50 returned after %v", elapsed)
+	}
+}
+
+func TestXReadGroupBlockWakesUp(t *testing.T) {
+	db := NewDB()
+	execLine(db, "XGROUP", "CREATE", "s", "g", "$", "MKSTREAM")
+
+	ch := execBlocking(db, "XREADGROUP", "GROUP", "g", "alice", "BLOCK", "0", "STREAMS", "s", ">")
+	waitBlocked(t, db, "s")
+	execLine(db, "XADD", "s", "1-1", "f", "a")
+	if got := receive(t, ch); got != "*1 *2 $1 s *1 *2 $3 1-1 *2 $1 f $1 a" {
+		t.Fatalf("XREADGROUP BLOCK replied %q", got)
+	}
+	// 阻塞后投递的条目同样进入 PEL
+	checkPending(t, db, "1-1 alice 1")
+
+	// 删除组会唤醒阻塞的客户端, 让它返回错误
+	ch = execBlocking(db, "XREADGROUP", "GROUP", "g", "bob", "BLOCK", "0", "STREAMS", "s", ">")
+	waitBlocked(t, db, "s")
+	execLine(db, "XGROUP", "DESTROY", "s", "g")
+	if got := receive(t, ch); !strings.HasPrefix(got, "-NOGROUP") {
+		t.Fatalf("XREADGROUP BLOCK replied %q after its group was destroyed", got)
+	}
+
+	// 读取历史的 XREADGROUP 不阻塞
+	execLine(db, "XGROUP", "CREATE", "s", "g", "$")
+	if got := execLine(db, "XREADGROUP", "GROUP", "g", "alice", "BLOCK", "0", "STREAMS", "s", "0"); got != "*1 *2 $1 s *0" {
+		t.Fatalf("XREADGROUP BLOCK with a history ID replied %q", got)
+	}
+}
@@ -0,0 +1,117 @@
+package database
+
+import (
+	"Redis_Go/interface/database"
+	"strconv"
+)
+
+// String values are stored in one of three encodings, told apart by the type of DataEntity.Data:
+//
+//   - int:    *int64, for values that are the canonical form of an int64
+//   - embstr: *embstr, for short values; the entity and the bytes share one allocation
+//   - raw:    []byte, for everything else
+const (
+	// embstrMaxLen keeps an embstr (entity + length + bytes) inside a 64-byte allocation.
+	// Redis allows 44 bytes, but the DataEntity here is 24 bytes with its access stats, which leaves 39
+	embstrMaxLen = 39
+	// sharedIntegers is the number of preallocated integer objects, shared by every key holding 0..sharedIntegers-1
+	sharedIntegers = 10000
+	// maxIntStringLen is the length of the longest int64, "-9223372036854775808"
+	maxIntStringLen = 20
+)
+
+// intObject keeps a DataEntity and its integer value in a single allocation
+type intObject struct {
+	entity database.DataEntity
+	val    int64
+}
+
+// embstr keeps a DataEntity and a short string value in a single allocation
+type embstr struct {
+	entity database.DataEntity
+	len    uint8
+	buf    [embstrMaxLen]byte
+}
+
+func (e *embstr) bytes() []byte {
+	return e.buf[:e.len:e.len]
+}
+
+var sharedIntObjects [sharedIntegers]intObject
+
+func init() {
+	for i := range sharedIntObjects {
+		obj := &sharedIntObjects[i]
+		obj.val = int64(i)
+		obj.entity.Data = &obj.val
+	}
+}
+
+// newIntEntity returns an int encoded entity holding n.
+// Small non-negative values share a preallocated entity, so the result must not be modified
+func newIntEntity(n int64) *database.DataEntity {
+	if n >= 0 && n < sharedIntegers {
+		return &sharedIntObjects[n].entity
+	}
+	obj := &intObject{val: n}
+	obj.entity.Data = &obj.val
+	return &obj.entity
+}
+
+// newStringEntity returns an entity holding val in the most compact encoding available.
+// val must not be modified afterwards, as a raw encoded entity keeps a reference to it
+func newStringEntity(val []byte) *database.DataEntity {
+	if n, ok := parseCanonicalInt(val); ok {
+		return newIntEntity(n)
+	}
+	if len(val) <= embstrMaxLen {
+		e := &embstr{len: uint8(len(val))}
+		copy(e.buf[:], val)
+		e.entity.Data = e
+		return &e.entity
+	}
+	return &database.DataEntity{Data: val}
+}
+
+// parseCanonicalInt parses val as an int64 only if formatting the result gives back val,
+// so that "007" or "+1" keep their exact bytes
+func parseCanonicalInt(val []byte) (int64, bool) {
+	if len(val) == 0 || len(val) > maxIntStringLen {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(string(val), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	var buf [maxIntStringLen]byte
+	if string(strconv.AppendInt(buf[:0], n, 10)) != string(val) {
+		return 0, false
+	}
+	return n, true
+}
+
+// stringBytes returns the bytes of a string entity, whatever its encoding
+func stringBytes(entity *database.DataEntity) ([]byte, bool) {
+	switch val := entity.Data.(type) {
+	case []byte:
+		return val, true
+	case *embstr:
+		return val.bytes(), true
+	case *int64:
+		return strconv.AppendInt(nil, *val, 10), true
+	}
+	return nil, false
+}
+
+// stringEncoding returns the OBJECT ENCODING name of a string entity
+func stringEncoding(entity *database.DataEntity) (string, bool) {
+	switch entity.Data.(type) {
+	case []byte:
+		return "raw", true
+	case *embstr:
+		return "embstr", true
+	case *int64:
+		return "int", true
+	}
+	return "", false
+}
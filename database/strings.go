@@ -5,38 +5,89 @@ import (
 	"Redis_Go/interface/resp"
 	"Redis_Go/lib/utils"
 	"Redis_Go/resp/reply"
+	"math"
 	"strconv"
+	"strings"
+	"time"
 )
 
+// maxStringLength is the largest value SETRANGE and APPEND may produce (512MB, as in Redis)
+const maxStringLength = 512 * 1024 * 1024
+
+// getAsString returns the string value stored at key.
+// errReply is a WRONGTYPE error if the key holds another kind of value
+func (db *DB) getAsString(key string) (val []byte, exists bool, errReply resp.Reply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, false, nil
+	}
+	val, ok := stringBytes(entity)
+	if !ok {
+		return nil, true, reply.GetWrongTypeErrReply()
+	}
+	return val, true, nil
+}
+
 // execGet retrieves the value associated with the specified key from the database.
 func execGet(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
-	if entity, ok := db.GetEntity(key); ok {
-		// TODO: If we have multiple types, we need to check the conversion if it's not []byte
-		return reply.GetBulkReply(entity.Data.([]byte))
+	val, exists, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
 	}
-	return reply.GetNullBulkReply()
+	if !exists {
+		return reply.GetNullBulkReply()
+	}
+	return reply.GetBulkReply(val)
 }
 
 func execSet(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
 	value := args[1]
-	entity := &database.DataEntity{
-		Data: value,
-	}
-	db.PutEntity(key, entity)
-	db.addAof(utils.ToCmdLineWithName("SET", args...))
+	entity := newStringEntity(value)
+	db.WithKeyLock(key, func() {
+		db.PutEntity(key, entity)
+		db.Persist(key)
+		db.addAof(utils.ToCmdLineWithName("SET", args...))
+	})
 	return reply.GetStatusReply("OK")
 }
 
+// execSetEX sets the value and the expiration (in seconds) of a key
+// SETEX key seconds value
+func execSetEX(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	seconds, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+	}
+	if seconds <= 0 {
+		return reply.GetStandardErrorReply("ERR invalid expire time in 'setex' command")
+	}
+	value := args[2]
+	expireTime := time.Now().Add(time.Duration(seconds) * time.Second)
+
+	db.WithKeyLock(key, func() {
+		db.PutEntity(key, newStringEntity(value))
+		db.Expire(key, expireTime)
+		// Log the absolute expiration so that replaying the AOF later doesn't extend it
+		db.addAof(utils.ToCmdLineWithName("SET", args[0], value))
+		db.addAof(utils.String2Cmdline("GETEX", key, "PXAT", strconv.FormatInt(expireTime.UnixMilli(), 10)))
+	})
+	return reply.GetOKReply()
+}
+
 func execSetNX(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
 	value := args[1]
-	entity := &database.DataEntity{
-		Data: value,
-	}
-	result := db.PutIfAbsent(key, entity)
-	db.addAof(utils.ToCmdLineWithName("SETNX", args...))
+	entity := newStringEntity(value)
+	var result int
+	db.WithKeyLock(key, func() {
+		// Look the key up first so that an expired value is reclaimed before PutIfAbsent
+		db.GetEntity(key)
+		result = db.PutIfAbsent(key, entity)
+		db.addAof(utils.ToCmdLineWithName("SETNX", args...))
+	})
 	return reply.GetIntReply(int64(result))
 }
 
@@ -44,24 +95,289 @@ func execGetSet(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
 	value := args[1]
 
-	entity, ok := db.GetEntity(key)
-	db.PutEntity(key, &database.DataEntity{
-		Data: value,
+	var result resp.Reply
+	db.WithKeyLock(key, func() {
+		old, exists, errReply := db.getAsString(key)
+		if errReply != nil {
+			result = errReply
+			return
+		}
+		db.PutEntity(key, newStringEntity(value))
+		db.Persist(key)
+		db.addAof(utils.ToCmdLineWithName("GETSET", args...))
+		if !exists {
+			result = reply.GetNullBulkReply()
+			return
+		}
+		result = reply.GetBulkReply(old)
 	})
-	db.addAof(utils.ToCmdLineWithName("GETSET", args...))
-	if !ok {
-		return reply.GetNullBulkReply()
-	}
-	return reply.GetBulkReply(entity.Data.([]byte))
+	return result
 }
 
 func execStrLen(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
-	entity, ok := db.GetEntity(key)
-	if !ok {
-		return reply.GetNullBulkReply()
+	val, _, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
 	}
-	return reply.GetIntReply(int64(len(entity.Data.([]byte))))
+	return reply.GetIntReply(int64(len(val)))
+}
+
+// execAppend appends value to the string stored at key, creating it if needed
+// APPEND key value
+func execAppend(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	value := args[1]
+
+	var result resp.Reply
+	db.WithKeyLock(key, func() {
+		old, _, errReply := db.getAsString(key)
+		if errReply != nil {
+			result = errReply
+			return
+		}
+		if len(old)+len(value) > maxStringLength {
+			result = reply.GetStandardErrorReply("ERR string exceeds maximum allowed size (proto-max-bulk-len)")
+			return
+		}
+		// Always build a new slice: readers may still hold the old one
+		newVal := make([]byte, 0, len(old)+len(value))
+		newVal = append(newVal, old...)
+		newVal = append(newVal, value...)
+		db.PutEntity(key, &database.DataEntity{Data: newVal})
+		db.addAof(utils.ToCmdLineWithName("APPEND", args...))
+		result = reply.GetIntReply(int64(len(newVal)))
+	})
+	return result
+}
+
+// execGetRange returns the substring of the string stored at key between start and end (inclusive)
+// GETRANGE key start end
+func execGetRange(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	start, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+	}
+	end, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+	}
+
+	val, _, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	size := int64(len(val))
+	if start < 0 && end < 0 && start > end {
+		return reply.GetBulkReply([]byte{})
+	}
+	if start < 0 {
+		start = size + start
+	}
+	if end < 0 {
+		end = size + end
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= size {
+		end = size - 1
+	}
+	if start > end || size == 0 {
+		return reply.GetBulkReply([]byte{})
+	}
+	return reply.GetBulkReply(val[start : end+1])
+}
+
+// execSetRange overwrites part of the string stored at key, starting at offset.
+// The string is zero-padded if offset is past its current length.
+// SETRANGE key offset value
+func execSetRange(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	offset, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+	}
+	if offset < 0 {
+		return reply.GetStandardErrorReply("ERR offset is out of range")
+	}
+	value := args[2]
+
+	var result resp.Reply
+	db.WithKeyLock(key, func() {
+		old, exists, errReply := db.getAsString(key)
+		if errReply != nil {
+			result = errReply
+			return
+		}
+		// An empty value doesn't create the key nor pad the existing one, whatever the offset
+		if len(value) == 0 {
+			result = reply.GetIntReply(int64(len(old)))
+			return
+		}
+		// 先减后比较, offset 很大时 offset+len(value) 会溢出
+		if offset > maxStringLength-int64(len(value)) {
+			result = reply.GetStandardErrorReply("ERR string exceeds maximum allowed size (proto-max-bulk-len)")
+			return
+		}
+		if !exists {
+			old = nil
+		}
+
+		newLen := int64(len(old))
+		if end := offset + int64(len(value)); end > newLen {
+			newLen = end
+		}
+		newVal := make([]byte, newLen)
+		copy(newVal, old)
+		copy(newVal[offset:], value)
+
+		db.PutEntity(key, &database.DataEntity{Data: newVal})
+		db.addAof(utils.ToCmdLineWithName("SETRANGE", args...))
+		result = reply.GetIntReply(newLen)
+	})
+	return result
+}
+
+// execGetDel gets the value of key and deletes the key
+// GETDEL key
+func execGetDel(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+
+	var result resp.Reply
+	db.WithKeyLock(key, func() {
+		val, exists, errReply := db.getAsString(key)
+		if errReply != nil {
+			result = errReply
+			return
+		}
+		if !exists {
+			result = reply.GetNullBulkReply()
+			return
+		}
+		db.Remove(key)
+		db.addAof(utils.ToCmdLineWithName("DEL", args[0]))
+		result = reply.GetBulkReply(val)
+	})
+	return result
+}
+
+// execGetEX gets the value of key and optionally sets or removes its expiration
+// GETEX key [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | PERSIST]
+func execGetEX(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+
+	var (
+		expireTime time.Time
+		persist    bool
+		optSet     bool
+	)
+	for i := 1; i < len(args); i++ {
+		opt := strings.ToUpper(string(args[i]))
+		if optSet {
+			return reply.GetSyntaxErrReply()
+		}
+		optSet = true
+		if opt == "PERSIST" {
+			persist = true
+			continue
+		}
+		if i+1 >= len(args) {
+			return reply.GetSyntaxErrReply()
+		}
+		n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+		if err != nil {
+			return reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+		}
+		if n <= 0 {
+			return reply.GetStandardErrorReply("ERR invalid expire time in 'getex' command")
+		}
+		i++
+		switch opt {
+		case "EX":
+			expireTime = time.Now().Add(time.Duration(n) * time.Second)
+		case "PX":
+			expireTime = time.Now().Add(time.Duration(n) * time.Millisecond)
+		case "EXAT":
+			expireTime = time.Unix(n, 0)
+		case "PXAT":
+			expireTime = time.UnixMilli(n)
+		default:
+			return reply.GetSyntaxErrReply()
+		}
+	}
+
+	var result resp.Reply
+	db.WithKeyLock(key, func() {
+		val, exists, errReply := db.getAsString(key)
+		if errReply != nil {
+			result = errReply
+			return
+		}
+		if !exists {
+			result = reply.GetNullBulkReply()
+			return
+		}
+
+		if persist {
+			if _, hasTTL := db.ExpireTime(key); hasTTL {
+				db.Persist(key)
+				db.addAof(utils.String2Cmdline("GETEX", key, "PERSIST"))
+			}
+		} else if !expireTime.IsZero() {
+			if expireTime.After(time.Now()) {
+				db.Expire(key, expireTime)
+			} else {
+				db.Remove(key)
+			}
+			db.addAof(utils.String2Cmdline("GETEX", key, "PXAT", strconv.FormatInt(expireTime.UnixMilli(), 10)))
+		}
+		result = reply.GetBulkReply(val)
+	})
+	return result
+}
+
+// incrBy adds delta to the integer stored at key, treating a missing key as 0.
+// aofLine is logged under the key lock once the update succeeds
+func (db *DB) incrBy(key string, delta int64, aofLine CmdLine) (int64, resp.Reply) {
+	var (
+		newValue int64
+		errReply resp.Reply
+	)
+	db.WithKeyLock(key, func() {
+		var oldValue int64
+		if entity, exists := db.GetEntity(key); exists {
+			// Int encoded values are used as is, without formatting and parsing them again
+			if intVal, ok := entity.Data.(*int64); ok {
+				oldValue = *intVal
+			} else {
+				val, ok := stringBytes(entity)
+				if !ok {
+					errReply = reply.GetWrongTypeErrReply()
+					return
+				}
+				var err error
+				oldValue, err = strconv.ParseInt(string(val), 10, 64)
+				if err != nil {
+					errReply = reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+					return
+				}
+			}
+		}
+		if (delta > 0 && oldValue > math.MaxInt64-delta) || (delta < 0 && oldValue < math.MinInt64-delta) {
+			errReply = reply.GetStandardErrorReply("ERR increment or decrement would overflow")
+			return
+		}
+		newValue = oldValue + delta
+		db.PutEntity(key, newIntEntity(newValue))
+		db.addAof(aofLine)
+	})
+	return newValue, errReply
 }
 
 // execIncrBy increments the stored value by the specified amount
@@ -74,21 +390,10 @@ func execIncrBy(db *DB, args [][]byte) resp.Reply {
 		return reply.GetStandardErrorReply("ERR value is not an integer or out of range")
 	}
 
-	entity, ok := db.GetEntity(key)
-	var oldValue int64
-	if ok {
-		if oldStr, ok := entity.Data.([]byte); ok {
-			oldValue, err = strconv.ParseInt(string(oldStr), 10, 64)
-			if err != nil {
-				return reply.GetStandardErrorReply("ERR value is not an integer or out of range")
-			}
-		}
+	newValue, errReply := db.incrBy(key, delta, utils.ToCmdLineWithName("INCRBY", args...))
+	if errReply != nil {
+		return errReply
 	}
-
-	newValue := oldValue + delta
-	newValueStr := strconv.FormatInt(newValue, 10)
-	db.PutEntity(key, &database.DataEntity{Data: []byte(newValueStr)})
-	db.addAof(utils.ToCmdLineWithName("INCRBY", args...))
 	return reply.GetIntReply(newValue)
 }
 
@@ -97,13 +402,178 @@ func execIncr(db *DB, args [][]byte) resp.Reply {
 	return execIncrBy(db, [][]byte{args[0], []byte("1")})
 }
 
+// execDecrBy decrements the stored value by the specified amount
+// DECRBY key decrement
+func execDecrBy(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+
+	decrement, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+	}
+	if decrement == math.MinInt64 {
+		return reply.GetStandardErrorReply("ERR decrement would overflow")
+	}
+
+	newValue, errReply := db.incrBy(key, -decrement, utils.ToCmdLineWithName("DECRBY", args...))
+	if errReply != nil {
+		return errReply
+	}
+	return reply.GetIntReply(newValue)
+}
+
+// execDecr decrements the stored value by 1
+// DECR key
+func execDecr(db *DB, args [][]byte) resp.Reply {
+	return execDecrBy(db, [][]byte{args[0], []byte("1")})
+}
+
+// parseStrictFloat parses a float argument, rejecting NaN and infinities
+func parseStrictFloat(raw []byte) (float64, bool) {
+	f, err := strconv.ParseFloat(string(raw), 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
+
+// formatIncrFloat formats a float the way INCRBYFLOAT replies: plain decimal notation,
+// no exponent and no trailing zeros
+func formatIncrFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// execIncrByFloat increments the stored value by a floating point amount
+// INCRBYFLOAT key increment
+func execIncrByFloat(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+
+	delta, ok := parseStrictFloat(args[1])
+	if !ok {
+		return reply.GetStandardErrorReply("ERR value is not a valid float")
+	}
+
+	var result resp.Reply
+	db.WithKeyLock(key, func() {
+		val, exists, errReply := db.getAsString(key)
+		if errReply != nil {
+			result = errReply
+			return
+		}
+		var oldValue float64
+		if exists {
+			oldValue, ok = parseStrictFloat(val)
+			if !ok {
+				result = reply.GetStandardErrorReply("ERR value is not a valid float")
+				return
+			}
+		}
+		newValue := oldValue + delta
+		if math.IsNaN(newValue) || math.IsInf(newValue, 0) {
+			result = reply.GetStandardErrorReply("ERR increment would produce NaN or Infinity")
+			return
+		}
+
+		newValueBytes := []byte(formatIncrFloat(newValue))
+		db.PutEntity(key, newStringEntity(newValueBytes))
+
+		// Float arithmetic may differ across replays, so log the result instead of the increment.
+		// SET clears the expiration, so restore it right after if there is one
+		db.addAof(utils.ToCmdLineWithName("SET", args[0], newValueBytes))
+		if expireTime, hasTTL := db.ExpireTime(key); hasTTL {
+			db.addAof(utils.String2Cmdline("GETEX", key, "PXAT", strconv.FormatInt(expireTime.UnixMilli(), 10)))
+		}
+		result = reply.GetBulkReply(newValueBytes)
+	})
+	return result
+}
+
+// execMGet returns the values of all the given keys.
+// Keys that don't exist or don't hold a string get a nil entry
+// MGET key [key ...]
+func execMGet(db *DB, args [][]byte) resp.Reply {
+	result := make([][]byte, len(args))
+	for i, arg := range args {
+		val, exists, errReply := db.getAsString(string(arg))
+		if !exists || errReply != nil {
+			continue
+		}
+		result[i] = val
+	}
+	return reply.GetMultiBulkReply(result)
+}
+
+// execMSet sets all the given key-value pairs atomically
+// MSET key value [key value ...]
+func execMSet(db *DB, args [][]byte) resp.Reply {
+	if len(args)%2 != 0 {
+		return reply.GetArgNumErrReply("mset")
+	}
+
+	keys := make([]string, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		keys = append(keys, string(args[i]))
+	}
+
+	lock := db.lockMgr.LockKeys(keys)
+	defer db.lockMgr.UnlockKeys(lock)
+
+	for i, key := range keys {
+		db.PutEntity(key, newStringEntity(args[2*i+1]))
+		db.Persist(key)
+	}
+	db.addAof(utils.ToCmdLineWithName("MSET", args...))
+	return reply.GetOKReply()
+}
+
+// execMSetNX sets all the given key-value pairs, only if none of the keys exist.
+// Either every key is set or none is
+// MSETNX key value [key value ...]
+func execMSetNX(db *DB, args [][]byte) resp.Reply {
+	if len(args)%2 != 0 {
+		return reply.GetArgNumErrReply("msetnx")
+	}
+
+	keys := make([]string, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		keys = append(keys, string(args[i]))
+	}
+
+	lock := db.lockMgr.LockKeys(keys)
+	defer db.lockMgr.UnlockKeys(lock)
+
+	for _, key := range keys {
+		if _, exists := db.GetEntity(key); exists {
+			return reply.GetIntReply(0)
+		}
+	}
+	for i, key := range keys {
+		db.PutEntity(key, newStringEntity(args[2*i+1]))
+	}
+	// None of the keys existed, so replaying it as MSET gives the same result
+	db.addAof(utils.ToCmdLineWithName("MSET", args...))
+	return reply.GetIntReply(1)
+}
+
 func init() {
 	RegisterCommand("GET", execGet, 2)
 	RegisterCommand("SET", execSet, 3)
 	RegisterCommand("SETNX", execSetNX, 3)
 	RegisterCommand("GETSET", execGetSet, 3)
-	RegisterCommand("SETEX", execSet, 4)
+	RegisterCommand("SETEX", execSetEX, 4)
 	RegisterCommand("STRLEN", execStrLen, 2)
 	RegisterCommand("INCR", execIncr, 2)
 	RegisterCommand("INCRBY", execIncrBy, 3)
+	RegisterCommand("DECR", execDecr, 2)               // DECR key
+	RegisterCommand("DECRBY", execDecrBy, 3)           // DECRBY key decrement
+	RegisterCommand("INCRBYFLOAT", execIncrByFloat, 3) // INCRBYFLOAT key increment
+	RegisterCommand("APPEND", execAppend, 3)           // APPEND key value
+	RegisterCommand("GETRANGE", execGetRange, 4)       // GETRANGE key start end
+	RegisterCommand("SUBSTR", execGetRange, 4)         // SUBSTR key start end
+	RegisterCommand("SETRANGE", execSetRange, 4)       // SETRANGE key offset value
+	RegisterCommand("GETDEL", execGetDel, 2)           // GETDEL key
+	RegisterCommand("MGET", execMGet, -2)              // MGET key [key ...]
+	RegisterCommand("MSET", execMSet, -3)              // MSET key value [key value ...]
+	RegisterCommand("MSETNX", execMSetNX, -3)          // MSETNX key value [key value ...]
+	RegisterCommand("GETEX", execGetEX, -2)            // GETEX key [EX seconds|PX ms|EXAT ts|PXAT ts-ms|PERSIST]
 }
@@ -0,0 +1,25 @@
+package database
+
+import "testing"
+
+func TestSetRange(t *testing.T) {
+	hello := [][]string{{"SET", "k", "Hello World"}}
+	runCmdCases(t, []cmdCase{
+		{"overwrite", hello, []string{"SETRANGE", "k", "6", "Redis"}, ":11"},
+		{"pad missing key", nil, []string{"SETRANGE", "k", "3", "ab"}, ":5"},
+		{"padded value", [][]string{{"SETRANGE", "k", "2", "ab"}}, []string{"GET", "k"}, "$4 \x00\x00ab"},
+		{"extend", hello, []string{"SETRANGE", "k", "11", "!"}, ":12"},
+		// 空值既不创建键也不补齐, 即使 offset 超过最大长度也只返回当前长度
+		{"empty value", hello, []string{"SETRANGE", "k", "100", ""}, ":11"},
+		{"empty value huge offset", hello, []string{"SETRANGE", "k", "9223372036854775807", ""}, ":11"},
+		{"empty value missing key", nil, []string{"SETRANGE", "k", "9223372036854775807", ""}, ":0"},
+		{"empty value creates nothing", [][]string{{"SETRANGE", "k", "10", ""}}, []string{"EXISTS", "k"}, ":0"},
+		{"too long", nil, []string{"SETRANGE", "k", "536870911", "ab"},
+			"-ERR string exceeds maximum allowed size (proto-max-bulk-len)"},
+		{"offset overflows", nil, []string{"SETRANGE", "k", "9223372036854775807", "ab"},
+			"-ERR string exceeds maximum allowed size (proto-max-bulk-len)"},
+		{"negative offset", nil, []string{"SETRANGE", "k", "-1", "a"}, "-ERR offset is out of range"},
+		{"wrong type", [][]string{{"SADD", "k", "a"}}, []string{"SETRANGE", "k", "0", ""},
+			"-WRONGTYPE Operation against a key holding the wrong kind of value"},
+	})
+}
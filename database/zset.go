@@ -1,10 +1,12 @@
 package database
 
 import (
+	"Redis_Go/datastruct/zset"
 	"Redis_Go/interface/database"
 	"Redis_Go/interface/resp"
 	"Redis_Go/lib/utils"
 	"Redis_Go/resp/reply"
+	"math"
 	"strconv"
 	"strings"
 )
@@ -12,59 +14,152 @@ import (
 // parseFloat parses a string to float64, handling errors
 func parseFloat(val string) (float64, resp.Reply) {
 	score, err := strconv.ParseFloat(val, 64)
-	if err != nil {
-		return 0, reply.GetStandardErrorReply("value is not a valid float")
+	if err != nil || math.IsNaN(score) {
+		return 0, reply.GetStandardErrorReply("ERR value is not a valid float")
 	}
 	return score, nil
 }
 
-// execZAdd implements the ZADD command
-// ZADD key [NX|XX] [CH] [INCR] score member [score member ...]
-func execZAdd(db *DB, args [][]byte) resp.Reply {
-	if len(args) < 3 || len(args)%2 == 0 {
-		return reply.GetStandardErrorReply("wrong number of arguments for 'zadd' command")
-	}
+// zaddFlags holds the options of ZADD
+type zaddFlags struct {
+	nx, xx, gt, lt, ch, incr bool
+}
 
-	key := string(args[0])
+// set turns on the flag with the given name, returning false if name is not a ZADD flag
+func (flags *zaddFlags) set(name string) bool {
+	switch name {
+	case "NX":
+		flags.nx = true
+	case "XX":
+		flags.xx = true
+	case "GT":
+		flags.gt = true
+	case "LT":
+		flags.lt = true
+	case "CH":
+		flags.ch = true
+	case "INCR":
+		flags.incr = true
+	default:
+		return false
+	}
+	return true
+}
 
+// zaddGeneric adds or updates the given score/member pairs according to flags.
+// The AOF records the final score of every changed member, so replaying it doesn't depend on the old scores
+func zaddGeneric(db *DB, key string, flags zaddFlags, scores []float64, members []string) resp.Reply {
 	var result resp.Reply
 	db.WithKeyLock(key, func() {
-		// Get or create ZSet
 		zsetObj, exists := getAsZSet(db, key)
 		if exists && zsetObj == nil {
 			result = reply.GetWrongTypeErrReply()
 			return
 		}
 
-		added := 0
-		for i := 1; i < len(args); i += 2 {
-			scoreStr := string(args[i])
-			member := string(args[i+1])
-
-			// Parse score
-			score, err := parseFloat(scoreStr)
-			if err != nil {
-				result = err
-				return
+		added, updated := 0, 0
+		applied := false // INCR 模式下, 成员是否被更新
+		var incrScore float64
+		aofArgs := [][]byte{[]byte(key)}
+		for i, member := range members {
+			score := scores[i]
+			oldScore, has := zsetObj.Score(member)
+			if flags.incr && has {
+				score += oldScore
+				if math.IsNaN(score) {
+					result = reply.GetStandardErrorReply("ERR resulting score is not a number (NaN)")
+					return
+				}
+			}
+			if (has && flags.nx) || (!has && flags.xx) {
+				continue
+			}
+			if has && ((flags.gt && score <= oldScore) || (flags.lt && score >= oldScore)) {
+				continue
 			}
 
-			// Add member to ZSet
-			if zsetObj.Add(member, score) {
+			applied, incrScore = true, score
+			if has && score == oldScore {
+				continue
+			}
+			zsetObj.Add(member, score)
+			if has {
+				updated++
+			} else {
 				added++
 			}
+			aofArgs = append(aofArgs, formatZScore(score), []byte(member))
 		}
 
-		// Store ZSet in database
-		db.PutEntity(key, &database.DataEntity{Data: zsetObj})
-
-		// Add AOF record
-		db.addAof(utils.ToCmdLineWithName("ZADD", args...))
+		if added+updated > 0 {
+			if !exists {
+				db.PutEntity(key, &database.DataEntity{Data: zsetObj})
+			}
+			db.addAof(utils.ToCmdLineWithName("ZADD", aofArgs...))
+		}
 
-		result = reply.GetIntReply(int64(added))
+		switch {
+		case flags.incr && !applied:
+			result = reply.GetNullBulkReply()
+		case flags.incr:
+			result = reply.GetBulkReply(formatZScore(incrScore))
+		case flags.ch:
+			result = reply.GetIntReply(int64(added + updated))
+		default:
+			result = reply.GetIntReply(int64(added))
+		}
 	})
 	return result
 }
 
+// execZAdd implements the ZADD command
+// ZADD key [NX|XX] [GT|LT] [CH] [INCR] score member [score member ...]
+func execZAdd(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+
+	flags := zaddFlags{}
+	i := 1
+	for i < len(args) && flags.set(strings.ToUpper(string(args[i]))) {
+		i++
+	}
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return reply.GetSyntaxErrReply()
+	}
+	if flags.nx && flags.xx {
+		return reply.GetStandardErrorReply("ERR XX and NX options at the same time are not compatible")
+	}
+	if (flags.gt && flags.lt) || (flags.nx && (flags.gt || flags.lt)) {
+		return reply.GetStandardErrorReply("ERR GT, LT, and/or NX options at the same time are not compatible")
+	}
+	if flags.incr && len(pairs) != 2 {
+		return reply.GetStandardErrorReply("ERR INCR option supports a single increment-element pair")
+	}
+
+	// 先校验全部分数, 避免只执行了一部分
+	scores := make([]float64, 0, len(pairs)/2)
+	members := make([]string, 0, len(pairs)/2)
+	for j := 0; j < len(pairs); j += 2 {
+		score, errReply := parseFloat(string(pairs[j]))
+		if errReply != nil {
+			return errReply
+		}
+		scores = append(scores, score)
+		members = append(members, string(pairs[j+1]))
+	}
+	return zaddGeneric(db, key, flags, scores, members)
+}
+
+// execZIncrBy implements the ZINCRBY command
+// ZINCRBY key increment member
+func execZIncrBy(db *DB, args [][]byte) resp.Reply {
+	delta, errReply := parseFloat(string(args[1]))
+	if errReply != nil {
+		return errReply
+	}
+	return zaddGeneric(db, string(args[0]), zaddFlags{incr: true}, []float64{delta}, []string{string(args[2])})
+}
+
 // execZScore implements the ZSCORE command
 // ZSCORE key member
 func execZScore(db *DB, args [][]byte) resp.Reply {
@@ -127,65 +222,320 @@ func execZCard(db *DB, args [][]byte) resp.Reply {
 	return result
 }
 
-// execZRange implements the ZRANGE command
-// ZRANGE key start stop [WITHSCORES]
-func execZRange(db *DB, args [][]byte) resp.Reply {
-	if len(args) < 3 {
-		return reply.GetStandardErrorReply("wrong number of arguments for 'zrange' command")
+// zrangeKind tells how the bounds of a range query are interpreted
+type zrangeKind int
+
+const (
+	zrangeByRank zrangeKind = iota
+	zrangeByScore
+	zrangeByLex
+)
+
+// zrangeSpec is a parsed range query, shared by ZRANGE, ZRANGESTORE and the older range commands
+type zrangeSpec struct {
+	kind       zrangeKind
+	reverse    bool
+	start      int // rank bounds
+	stop       int
+	minScore   zset.ScoreBorder
+	maxScore   zset.ScoreBorder
+	minLex     zset.LexBorder
+	maxLex     zset.LexBorder
+	offset     int
+	count      int // negative for no limit
+	withScores bool
+}
+
+// parseBounds parses the two bound arguments according to the kind of range.
+// With REV, score and lex ranges are given from max down to min
+func (spec *zrangeSpec) parseBounds(first, second []byte) resp.Reply {
+	switch spec.kind {
+	case zrangeByRank:
+		start, err1 := strconv.Atoi(string(first))
+		stop, err2 := strconv.Atoi(string(second))
+		if err1 != nil || err2 != nil {
+			return reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+		}
+		spec.start, spec.stop = start, stop
+	case zrangeByScore:
+		if spec.reverse {
+			first, second = second, first
+		}
+		min, err := zset.ParseScoreBorder(string(first))
+		if err != nil {
+			return reply.GetStandardErrorReply(err.Error())
+		}
+		max, err := zset.ParseScoreBorder(string(second))
+		if err != nil {
+			return reply.GetStandardErrorReply(err.Error())
+		}
+		spec.minScore, spec.maxScore = min, max
+	case zrangeByLex:
+		if spec.reverse {
+			first, second = second, first
+		}
+		min, err := zset.ParseLexBorder(string(first))
+		if err != nil {
+			return reply.GetStandardErrorReply(err.Error())
+		}
+		max, err := zset.ParseLexBorder(string(second))
+		if err != nil {
+			return reply.GetStandardErrorReply(err.Error())
+		}
+		spec.minLex, spec.maxLex = min, max
 	}
+	return nil
+}
 
-	withScores := false
-	if len(args) > 3 && strings.ToUpper(string(args[3])) == "WITHSCORES" {
-		withScores = true
+// parseLimit parses the "offset count" following LIMIT
+func (spec *zrangeSpec) parseLimit(offset, count []byte) resp.Reply {
+	o, err1 := strconv.Atoi(string(offset))
+	c, err2 := strconv.Atoi(string(count))
+	if err1 != nil || err2 != nil {
+		return reply.GetStandardErrorReply("ERR value is not an integer or out of range")
 	}
+	spec.offset, spec.count = o, c
+	return nil
+}
 
-	key := string(args[0])
+// parseZRangeSpec parses the unified range syntax
+// min max [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+func parseZRangeSpec(args [][]byte, allowWithScores bool) (*zrangeSpec, resp.Reply) {
+	spec := &zrangeSpec{kind: zrangeByRank, count: -1}
+	hasLimit := false
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "BYSCORE":
+			spec.kind = zrangeByScore
+		case "BYLEX":
+			spec.kind = zrangeByLex
+		case "REV":
+			spec.reverse = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return nil, reply.GetSyntaxErrReply()
+			}
+			if errReply := spec.parseLimit(args[i+1], args[i+2]); errReply != nil {
+				return nil, errReply
+			}
+			hasLimit = true
+			i += 2
+		case "WITHSCORES":
+			if !allowWithScores {
+				return nil, reply.GetSyntaxErrReply()
+			}
+			spec.withScores = true
+		default:
+			return nil, reply.GetSyntaxErrReply()
+		}
+	}
+	if hasLimit && spec.kind == zrangeByRank {
+		return nil, reply.GetStandardErrorReply("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	if spec.withScores && spec.kind == zrangeByLex {
+		return nil, reply.GetStandardErrorReply("ERR syntax error, WITHSCORES not supported in combination with BYLEX")
+	}
+	if errReply := spec.parseBounds(args[0], args[1]); errReply != nil {
+		return nil, errReply
+	}
+	return spec, nil
+}
 
-	// Parse start and stop indices
-	start, err := strconv.Atoi(string(args[1]))
-	if err != nil {
-		return reply.GetStandardErrorReply("value is not an integer or out of range")
+// parseScoreRangeOptions parses the options of ZRANGEBYSCORE and ZREVRANGEBYSCORE
+// [WITHSCORES] [LIMIT offset count]
+func (spec *zrangeSpec) parseScoreRangeOptions(args [][]byte, allowWithScores bool) resp.Reply {
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "WITHSCORES":
+			if !allowWithScores {
+				return reply.GetSyntaxErrReply()
+			}
+			spec.withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return reply.GetSyntaxErrReply()
+			}
+			if errReply := spec.parseLimit(args[i+1], args[i+2]); errReply != nil {
+				return errReply
+			}
+			i += 2
+		default:
+			return reply.GetSyntaxErrReply()
+		}
 	}
+	return nil
+}
 
-	stop, err := strconv.Atoi(string(args[2]))
-	if err != nil {
-		return reply.GetStandardErrorReply("value is not an integer or out of range")
+// run evaluates the range query against a sorted set
+func (spec *zrangeSpec) run(zsetObj zset.ZSet) []zset.Element {
+	switch spec.kind {
+	case zrangeByScore:
+		return zsetObj.RangeByScoreElements(spec.minScore, spec.maxScore, spec.offset, spec.count, spec.reverse)
+	case zrangeByLex:
+		return zsetObj.RangeByLexElements(spec.minLex, spec.maxLex, spec.offset, spec.count, spec.reverse)
 	}
+	return zsetObj.RangeByRankElements(spec.start, spec.stop, spec.reverse)
+}
 
+// formatZScore formats a score the way it is sent to clients
+func formatZScore(score float64) []byte {
+	switch {
+	case math.IsInf(score, 1):
+		return []byte("inf")
+	case math.IsInf(score, -1):
+		return []byte("-inf")
+	}
+	return []byte(strconv.FormatFloat(score, 'f', -1, 64))
+}
+
+// zsetElementsReply builds the reply of a range query, interleaving scores if withScores is set
+func zsetElementsReply(elements []zset.Element, withScores bool) resp.Reply {
+	size := len(elements)
+	if withScores {
+		size *= 2
+	}
+	arr := make([][]byte, 0, size)
+	for _, element := range elements {
+		arr = append(arr, []byte(element.Member))
+		if withScores {
+			arr = append(arr, formatZScore(element.Score))
+		}
+	}
+	return reply.GetMultiBulkReply(arr)
+}
+
+// zrangeGeneric runs a parsed range query against the sorted set stored at key
+func zrangeGeneric(db *DB, key string, spec *zrangeSpec) resp.Reply {
 	var result resp.Reply
 	db.WithRKeyLock(key, func() {
-		// Get ZSet
 		zsetObj, exists := getAsZSet(db, key)
 		if !exists {
-			result = reply.GetEmptyMultiBulkReply()
+			result = reply.GetMultiRawReply(nil)
 			return
 		}
 		if zsetObj == nil {
 			result = reply.GetWrongTypeErrReply()
 			return
 		}
+		result = zsetElementsReply(spec.run(zsetObj), spec.withScores)
+	})
+	return result
+}
 
-		// Get range
-		members := zsetObj.RangeByRank(start, stop)
+// execZRange implements the ZRANGE command
+// ZRANGE key start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+func execZRange(db *DB, args [][]byte) resp.Reply {
+	spec, errReply := parseZRangeSpec(args[1:], true)
+	if errReply != nil {
+		return errReply
+	}
+	return zrangeGeneric(db, string(args[0]), spec)
+}
 
-		// Prepare result
-		if !withScores {
-			arr := make([][]byte, len(members))
-			for i, member := range members {
-				arr[i] = []byte(member)
-			}
-			result = reply.GetMultiBulkReply(arr)
-		} else {
-			arr := make([][]byte, len(members)*2)
-			for i, member := range members {
-				arr[i*2] = []byte(member)
-				score, _ := zsetObj.Score(member)
-				arr[i*2+1] = []byte(strconv.FormatFloat(score, 'f', -1, 64))
-			}
-			result = reply.GetMultiBulkReply(arr)
+// execZRevRange implements the ZREVRANGE command
+// ZREVRANGE key start stop [WITHSCORES]
+func execZRevRange(db *DB, args [][]byte) resp.Reply {
+	spec := &zrangeSpec{kind: zrangeByRank, reverse: true, count: -1}
+	if len(args) == 4 {
+		if strings.ToUpper(string(args[3])) != "WITHSCORES" {
+			return reply.GetSyntaxErrReply()
 		}
-	})
-	return result
+		spec.withScores = true
+	} else if len(args) > 4 {
+		return reply.GetSyntaxErrReply()
+	}
+	if errReply := spec.parseBounds(args[1], args[2]); errReply != nil {
+		return errReply
+	}
+	return zrangeGeneric(db, string(args[0]), spec)
+}
+
+// execZRangeByScore implements the ZRANGEBYSCORE command
+// ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count]
+func execZRangeByScore(db *DB, args [][]byte) resp.Reply {
+	spec := &zrangeSpec{kind: zrangeByScore, count: -1}
+	if errReply := spec.parseScoreRangeOptions(args[3:], true); errReply != nil {
+		return errReply
+	}
+	if errReply := spec.parseBounds(args[1], args[2]); errReply != nil {
+		return errReply
+	}
+	return zrangeGeneric(db, string(args[0]), spec)
+}
+
+// execZRevRangeByScore implements the ZREVRANGEBYSCORE command
+// ZREVRANGEBYSCORE key max min [WITHSCORES] [LIMIT offset count]
+func execZRevRangeByScore(db *DB, args [][]byte) resp.Reply {
+	spec := &zrangeSpec{kind: zrangeByScore, reverse: true, count: -1}
+	if errReply := spec.parseScoreRangeOptions(args[3:], true); errReply != nil {
+		return errReply
+	}
+	if errReply := spec.parseBounds(args[1], args[2]); errReply != nil {
+		return errReply
+	}
+	return zrangeGeneric(db, string(args[0]), spec)
+}
+
+// execZRangeByLex implements the ZRANGEBYLEX command
+// ZRANGEBYLEX key min max [LIMIT offset count]
+func execZRangeByLex(db *DB, args [][]byte) resp.Reply {
+	spec := &zrangeSpec{kind: zrangeByLex, count: -1}
+	if errReply := spec.parseScoreRangeOptions(args[3:], false); errReply != nil {
+		return errReply
+	}
+	if errReply := spec.parseBounds(args[1], args[2]); errReply != nil {
+		return errReply
+	}
+	return zrangeGeneric(db, string(args[0]), spec)
+}
+
+// execZRevRangeByLex implements the ZREVRANGEBYLEX command
+// ZREVRANGEBYLEX key max min [LIMIT offset count]
+func execZRevRangeByLex(db *DB, args [][]byte) resp.Reply {
+	spec := &zrangeSpec{kind: zrangeByLex, reverse: true, count: -1}
+	if errReply := spec.parseScoreRangeOptions(args[3:], false); errReply != nil {
+		return errReply
+	}
+	if errReply := spec.parseBounds(args[1], args[2]); errReply != nil {
+		return errReply
+	}
+	return zrangeGeneric(db, string(args[0]), spec)
+}
+
+// execZRangeStore implements the ZRANGESTORE command, storing the result of a range query in dst
+// ZRANGESTORE dst src min max [BYSCORE|BYLEX] [REV] [LIMIT offset count]
+func execZRangeStore(db *DB, args [][]byte) resp.Reply {
+	dst := string(args[0])
+	src := string(args[1])
+	spec, errReply := parseZRangeSpec(args[2:], false)
+	if errReply != nil {
+		return errReply
+	}
+
+	handle := db.lockMgr.LockKeys([]string{dst, src})
+	defer db.lockMgr.UnlockKeys(handle)
+
+	zsetObj, exists := getAsZSet(db, src)
+	if exists && zsetObj == nil {
+		return reply.GetWrongTypeErrReply()
+	}
+	var elements []zset.Element
+	if exists {
+		elements = spec.run(zsetObj)
+	}
+
+	if len(elements) == 0 {
+		db.Remove(dst)
+	} else {
+		destZSet := zset.NewZSet()
+		for _, element := range elements {
+			destZSet.Add(element.Member, element.Score)
+		}
+		db.PutEntity(dst, &database.DataEntity{Data: destZSet})
+		db.Persist(dst)
+	}
+	db.addAof(utils.ToCmdLineWithName("ZRANGESTORE", args...))
+	return reply.GetIntReply(int64(len(elements)))
 }
 
 // execZRem implements the ZREM command
@@ -221,7 +571,9 @@ func execZRem(db *DB, args [][]byte) resp.Reply {
 
 		// Update database if we removed anything
 		if removed > 0 {
-			db.PutEntity(key, &database.DataEntity{Data: zsetObj})
+			if zsetObj.Len() == 0 {
+				db.Remove(key)
+			}
 
 			// Add AOF record
 			db.addAof(utils.ToCmdLineWithName("ZREM", args...))
@@ -232,6 +584,228 @@ func execZRem(db *DB, args [][]byte) resp.Reply {
 	return result
 }
 
+// zremRangeGeneric implements the ZREMRANGEBY* commands, where remove deletes the range from the zset.
+// The command is logged as is, since it removes the same members when replayed on the same data
+func zremRangeGeneric(db *DB, cmdName string, args [][]byte, remove func(zsetObj zset.ZSet) int) resp.Reply {
+	key := string(args[0])
+
+	var result resp.Reply
+	db.WithKeyLock(key, func() {
+		zsetObj, exists := getAsZSet(db, key)
+		if !exists {
+			result = reply.GetIntReply(0)
+			return
+		}
+		if zsetObj == nil {
+			result = reply.GetWrongTypeErrReply()
+			return
+		}
+
+		removed := remove(zsetObj)
+		if removed > 0 {
+			if zsetObj.Len() == 0 {
+				db.Remove(key)
+			}
+			db.addAof(utils.ToCmdLineWithName(cmdName, args...))
+		}
+		result = reply.GetIntReply(int64(removed))
+	})
+	return result
+}
+
+// execZRemRangeByRank implements the ZREMRANGEBYRANK command
+// ZREMRANGEBYRANK key start stop
+func execZRemRangeByRank(db *DB, args [][]byte) resp.Reply {
+	start, err1 := strconv.Atoi(string(args[1]))
+	stop, err2 := strconv.Atoi(string(args[2]))
+	if err1 != nil || err2 != nil {
+		return reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+	}
+	return zremRangeGeneric(db, "ZREMRANGEBYRANK", args, func(zsetObj zset.ZSet) int {
+		return zsetObj.RemoveRangeByRank(start, stop)
+	})
+}
+
+// execZRemRangeByScore implements the ZREMRANGEBYSCORE command
+// ZREMRANGEBYSCORE key min max
+func execZRemRangeByScore(db *DB, args [][]byte) resp.Reply {
+	min, err := zset.ParseScoreBorder(string(args[1]))
+	if err != nil {
+		return reply.GetStandardErrorReply(err.Error())
+	}
+	max, err := zset.ParseScoreBorder(string(args[2]))
+	if err != nil {
+		return reply.GetStandardErrorReply(err.Error())
+	}
+	return zremRangeGeneric(db, "ZREMRANGEBYSCORE", args, func(zsetObj zset.ZSet) int {
+		return zsetObj.RemoveRangeByScore(min, max)
+	})
+}
+
+// execZRemRangeByLex implements the ZREMRANGEBYLEX command
+// ZREMRANGEBYLEX key min max
+func execZRemRangeByLex(db *DB, args [][]byte) resp.Reply {
+	min, err := zset.ParseLexBorder(string(args[1]))
+	if err != nil {
+		return reply.GetStandardErrorReply(err.Error())
+	}
+	max, err := zset.ParseLexBorder(string(args[2]))
+	if err != nil {
+		return reply.GetStandardErrorReply(err.Error())
+	}
+	return zremRangeGeneric(db, "ZREMRANGEBYLEX", args, func(zsetObj zset.ZSet) int {
+		return zsetObj.RemoveRangeByLex(min, max)
+	})
+}
+
+// zpopGeneric implements ZPOPMIN and ZPOPMAX, popping from the highest score down if reverse is true.
+// The popped members are logged as a ZREM
+func zpopGeneric(db *DB, args [][]byte, reverse bool) resp.Reply {
+	if len(args) > 2 {
+		return reply.GetSyntaxErrReply()
+	}
+	key := string(args[0])
+	count := 1
+	if len(args) == 2 {
+		var err error
+		count, err = strconv.Atoi(string(args[1]))
+		if err != nil {
+			return reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+		}
+		if count < 0 {
+			return reply.GetStandardErrorReply("ERR value is out of range, must be positive")
+		}
+	}
+
+	var result resp.Reply
+	db.WithKeyLock(key, func() {
+		zsetObj, exists := getAsZSet(db, key)
+		if exists && zsetObj == nil {
+			result = reply.GetWrongTypeErrReply()
+			return
+		}
+		if !exists || count == 0 {
+			result = reply.GetMultiRawReply(nil)
+			return
+		}
+
+		elements := zsetObj.RangeByRankElements(0, count-1, reverse)
+		aofArgs := make([][]byte, 0, len(elements)+1)
+		aofArgs = append(aofArgs, []byte(key))
+		for _, element := range elements {
+			zsetObj.Remove(element.Member)
+			aofArgs = append(aofArgs, []byte(element.Member))
+		}
+		if zsetObj.Len() == 0 {
+			db.Remove(key)
+		}
+		db.addAof(utils.ToCmdLineWithName("ZREM", aofArgs...))
+		result = zsetElementsReply(elements, true)
+	})
+	return result
+}
+
+// execZPopMin implements the ZPOPMIN command, removing and returning the members with the lowest scores
+// ZPOPMIN key [count]
+func execZPopMin(db *DB, args [][]byte) resp.Reply {
+	return zpopGeneric(db, args, false)
+}
+
+// execZPopMax implements the ZPOPMAX command, removing and returning the members with the highest scores
+// ZPOPMAX key [count]
+func execZPopMax(db *DB, args [][]byte) resp.Reply {
+	return zpopGeneric(db, args, true)
+}
+
+// execZRandMember returns random members of the zset.
+// A positive count returns distinct members, a negative one may repeat them
+// ZRANDMEMBER key [count [WITHSCORES]]
+func execZRandMember(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	if len(args) > 3 {
+		return reply.GetSyntaxErrReply()
+	}
+
+	hasCount := len(args) >= 2
+	var count int64 = 1
+	if hasCount {
+		var err error
+		count, err = strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil {
+			return reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+		}
+	}
+	withScores := false
+	if len(args) == 3 {
+		if strings.ToUpper(string(args[2])) != "WITHSCORES" {
+			return reply.GetSyntaxErrReply()
+		}
+		withScores = true
+	}
+	if errReply := checkRandomCount(count, withScores); errReply != nil {
+		return errReply
+	}
+
+	var result resp.Reply
+	db.WithRKeyLock(key, func() {
+		zsetObj, exists := getAsZSet(db, key)
+		if exists && zsetObj == nil {
+			result = reply.GetWrongTypeErrReply()
+			return
+		}
+		if !exists {
+			if hasCount {
+				result = reply.GetMultiRawReply(nil)
+			} else {
+				result = reply.GetNullBulkReply()
+			}
+			return
+		}
+
+		if !hasCount {
+			elements := zsetObj.RandomElements(1, true)
+			result = reply.GetBulkReply([]byte(elements[0].Member))
+			return
+		}
+
+		var elements []zset.Element
+		if count >= 0 {
+			elements = zsetObj.RandomElements(int(count), true)
+		} else {
+			elements = zsetObj.RandomElements(int(-count), false)
+		}
+		result = zsetElementsReply(elements, withScores)
+	})
+	return result
+}
+
+// execZMScore returns the scores of the given members, with nil for missing ones
+// ZMSCORE key member [member ...]
+func execZMScore(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+
+	var result resp.Reply
+	db.WithRKeyLock(key, func() {
+		zsetObj, exists := getAsZSet(db, key)
+		if exists && zsetObj == nil {
+			result = reply.GetWrongTypeErrReply()
+			return
+		}
+
+		scores := make([][]byte, len(args)-1)
+		for i, member := range args[1:] {
+			if !exists {
+				continue
+			}
+			if score, ok := zsetObj.Score(string(member)); ok {
+				scores[i] = formatZScore(score)
+			}
+		}
+		result = reply.GetMultiBulkReply(scores)
+	})
+	return result
+}
+
 // execZCount implements the ZCOUNT command
 // ZCOUNT key min max
 func execZCount(db *DB, args [][]byte) resp.Reply {
@@ -241,15 +815,15 @@ func execZCount(db *DB, args [][]byte) resp.Reply {
 
 	key := string(args[0])
 
-	// Parse min and max scores
-	min, err := parseFloat(string(args[1]))
+	// Parse min and max scores, which may be exclusive or infinite
+	min, err := zset.ParseScoreBorder(string(args[1]))
 	if err != nil {
-		return err
+		return reply.GetStandardErrorReply(err.Error())
 	}
 
-	max, err := parseFloat(string(args[2]))
+	max, err := zset.ParseScoreBorder(string(args[2]))
 	if err != nil {
-		return err
+		return reply.GetStandardErrorReply(err.Error())
 	}
 
 	var result resp.Reply
@@ -266,20 +840,44 @@ func execZCount(db *DB, args [][]byte) resp.Reply {
 		}
 
 		// Count elements in range
-		count := zsetObj.Count(min, max)
+		count := zsetObj.CountByScore(min, max)
 
 		result = reply.GetIntReply(int64(count))
 	})
 	return result
 }
 
-// execZRank implements the ZRANK command
-// ZRANK key member
-func execZRank(db *DB, args [][]byte) resp.Reply {
-	if len(args) != 2 {
-		return reply.GetStandardErrorReply("wrong number of arguments for 'zrank' command")
+// execZLexCount implements the ZLEXCOUNT command
+// ZLEXCOUNT key min max
+func execZLexCount(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	min, err := zset.ParseLexBorder(string(args[1]))
+	if err != nil {
+		return reply.GetStandardErrorReply(err.Error())
+	}
+	max, err := zset.ParseLexBorder(string(args[2]))
+	if err != nil {
+		return reply.GetStandardErrorReply(err.Error())
 	}
 
+	var result resp.Reply
+	db.WithRKeyLock(key, func() {
+		zsetObj, exists := getAsZSet(db, key)
+		if !exists {
+			result = reply.GetIntReply(0)
+			return
+		}
+		if zsetObj == nil {
+			result = reply.GetWrongTypeErrReply()
+			return
+		}
+		result = reply.GetIntReply(int64(zsetObj.CountByLex(min, max)))
+	})
+	return result
+}
+
+// zrankGeneric implements ZRANK and ZREVRANK
+func zrankGeneric(db *DB, args [][]byte, reverse bool) resp.Reply {
 	key := string(args[0])
 	member := string(args[1])
 
@@ -296,54 +894,44 @@ func execZRank(db *DB, args [][]byte) resp.Reply {
 			return
 		}
 
-		// Get member's rank
-		score, exists := zsetObj.Score(member)
+		// Get member's 0-based rank
+		rank, exists := zsetObj.Rank(member, reverse)
 		if !exists {
 			result = reply.GetNullBulkReply()
 			return
 		}
-
-		// Using skiplist's GetRank method
-		rank := -1
-		if zsetObj.Encoding() == 1 { // Using skiplist encoding
-			// We need to access the skiplist from the ZSet implementation
-			skiplist := zsetObj.GetSkiplist()
-			rank = skiplist.GetRank(member, score)
-		} else {
-			// For listpack encoding, we need to compute rank by sorting
-			members := zsetObj.RangeByRank(0, -1)
-			for i, m := range members {
-				if m == member {
-					rank = i
-					break
-				}
-			}
-		}
-
-		if rank == -1 {
-			result = reply.GetNullBulkReply()
-		} else {
-			result = reply.GetIntReply(int64(rank))
-		}
+		result = reply.GetIntReply(int64(rank))
 	})
 	return result
 }
 
-// execZTYPE implements the ZTYPE command
-// ZTYPE key returns the type of the key, 0 for listpack, 1 for skiplist
-func execZType(db *DB, args [][]byte) resp.Reply {
-	if len(args) != 1 {
-		return reply.GetStandardErrorReply("wrong number of arguments for 'ztype' command")
-	}
+// execZRank implements the ZRANK command
+// ZRANK key member
+func execZRank(db *DB, args [][]byte) resp.Reply {
+	return zrankGeneric(db, args, false)
+}
 
+// execZRevRank implements the ZREVRANK command, ranking members from the highest score down
+// ZREVRANK key member
+func execZRevRank(db *DB, args [][]byte) resp.Reply {
+	return zrankGeneric(db, args, true)
+}
+
+// execZScan incrementally iterates the members of the zset with their scores.
+// The cursor stays valid across changes to the zset, see zset.ZSet.Scan
+// ZSCAN key cursor [MATCH pattern] [COUNT count]
+func execZScan(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
+	cursor, pattern, count, _, errReply := parseElementScanArgs(args[1:], "")
+	if errReply != nil {
+		return errReply
+	}
 
 	var result resp.Reply
 	db.WithRKeyLock(key, func() {
-		// Get ZSet
 		zsetObj, exists := getAsZSet(db, key)
 		if !exists {
-			result = reply.GetNullBulkReply()
+			result = reply.GetScanReply(0, [][]byte{})
 			return
 		}
 		if zsetObj == nil {
@@ -351,19 +939,47 @@ func execZType(db *DB, args [][]byte) resp.Reply {
 			return
 		}
 
-		result = reply.GetIntReply(int64(zsetObj.Encoding()))
+		elements, next := zsetObj.Scan(cursor, count, pattern)
+		arr := make([][]byte, 0, len(elements)*2)
+		for _, element := range elements {
+			arr = append(arr, []byte(element.Member), formatZScore(element.Score))
+		}
+		result = reply.GetScanReply(int64(next), arr)
 	})
 	return result
 }
 
+// execZType is an alias of OBJECT ENCODING, kept for compatibility
+// ZTYPE key
+func execZType(db *DB, args [][]byte) resp.Reply {
+	return objectEncodingReply(db, string(args[0]))
+}
+
 // Register ZSET commands
 func init() {
-	RegisterCommand("ZADD", execZAdd, -4)     // key score member [score member ...]
-	RegisterCommand("ZSCORE", execZScore, 3)  // key member
-	RegisterCommand("ZCARD", execZCard, 2)    // key
-	RegisterCommand("ZRANGE", execZRange, -4) // key start stop [WITHSCORES]
-	RegisterCommand("ZREM", execZRem, -3)     // key member [member ...]
-	RegisterCommand("ZCOUNT", execZCount, 4)  // key min max
-	RegisterCommand("ZRANK", execZRank, 3)    // key member
-	RegisterCommand("ZTYPE", execZType, 2)    // key
+	RegisterCommand("ZADD", execZAdd, -4)                         // key [NX|XX] [GT|LT] [CH] [INCR] score member [score member ...]
+	RegisterCommand("ZINCRBY", execZIncrBy, 4)                    // key increment member
+	RegisterCommand("ZSCORE", execZScore, 3)                      // key member
+	RegisterCommand("ZMSCORE", execZMScore, -3)                   // key member [member ...]
+	RegisterCommand("ZCARD", execZCard, 2)                        // key
+	RegisterCommand("ZRANGE", execZRange, -4)                     // key start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+	RegisterCommand("ZREVRANGE", execZRevRange, -4)               // key start stop [WITHSCORES]
+	RegisterCommand("ZRANGEBYSCORE", execZRangeByScore, -4)       // key min max [WITHSCORES] [LIMIT offset count]
+	RegisterCommand("ZREVRANGEBYSCORE", execZRevRangeByScore, -4) // key max min [WITHSCORES] [LIMIT offset count]
+	RegisterCommand("ZRANGEBYLEX", execZRangeByLex, -4)           // key min max [LIMIT offset count]
+	RegisterCommand("ZREVRANGEBYLEX", execZRevRangeByLex, -4)     // key max min [LIMIT offset count]
+	RegisterCommand("ZRANGESTORE", execZRangeStore, -5)           // dst src min max [BYSCORE|BYLEX] [REV] [LIMIT offset count]
+	RegisterCommand("ZREM", execZRem, -3)                         // key member [member ...]
+	RegisterCommand("ZREMRANGEBYRANK", execZRemRangeByRank, 4)    // key start stop
+	RegisterCommand("ZREMRANGEBYSCORE", execZRemRangeByScore, 4)  // key min max
+	RegisterCommand("ZREMRANGEBYLEX", execZRemRangeByLex, 4)      // key min max
+	RegisterCommand("ZPOPMIN", execZPopMin, -2)                   // key [count]
+	RegisterCommand("ZPOPMAX", execZPopMax, -2)                   // key [count]
+	RegisterCommand("ZRANDMEMBER", execZRandMember, -2)           // key [count [WITHSCORES]]
+	RegisterCommand("ZCOUNT", execZCount, 4)                      // key min max
+	RegisterCommand("ZLEXCOUNT", execZLexCount, 4)                // key min max
+	RegisterCommand("ZRANK", execZRank, 3)                        // key member
+	RegisterCommand("ZREVRANK", execZRevRank, 3)                  // key member
+	RegisterCommand("ZSCAN", execZScan, -3)                       // key cursor [MATCH pattern] [COUNT count]
+	RegisterCommand("ZTYPE", execZType, 2)                        // key
 }
@@ -0,0 +1,409 @@
+package database
+
+import (
+	"Redis_Go/datastruct/set"
+	"Redis_Go/datastruct/zset"
+	"Redis_Go/interface/database"
+	"Redis_Go/interface/resp"
+	"Redis_Go/lib/utils"
+	"Redis_Go/resp/reply"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	aggregateSum = iota
+	aggregateMin
+	aggregateMax
+)
+
+// zsetOpSpec holds the parsed arguments of ZUNION, ZINTER, ZDIFF and their STORE variants
+type zsetOpSpec struct {
+	keys       []string
+	weights    []float64
+	aggregate  int
+	withScores bool
+}
+
+// parseZSetOpSpec parses "numkeys key [key ...]" followed by the options of the command.
+// WEIGHTS and AGGREGATE are accepted if allowWeights is set, WITHSCORES if allowWithScores is set
+func parseZSetOpSpec(cmdName string, args [][]byte, allowWeights, allowWithScores bool) (*zsetOpSpec, resp.Reply) {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil {
+		return nil, reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+	}
+	if numKeys <= 0 {
+		return nil, reply.GetStandardErrorReply("ERR at least 1 input key is needed for '" + cmdName + "' command")
+	}
+	if numKeys > len(args)-1 {
+		return nil, reply.GetSyntaxErrReply()
+	}
+
+	spec := &zsetOpSpec{
+		keys:      make([]string, numKeys),
+		weights:   make([]float64, numKeys),
+		aggregate: aggregateSum,
+	}
+	for i := 0; i < numKeys; i++ {
+		spec.keys[i] = string(args[1+i])
+		spec.weights[i] = 1
+	}
+
+	options := args[1+numKeys:]
+	for i := 0; i < len(options); i++ {
+		switch strings.ToUpper(string(options[i])) {
+		case "WEIGHTS":
+			if !allowWeights || i+numKeys >= len(options) {
+				return nil, reply.GetSyntaxErrReply()
+			}
+			for j := 0; j < numKeys; j++ {
+				weight, err := strconv.ParseFloat(string(options[i+1+j]), 64)
+				if err != nil || math.IsNaN(weight) {
+					return nil, reply.GetStandardErrorReply("ERR weight value is not a float")
+				}
+				spec.weights[j] = weight
+			}
+			i += numKeys
+		case "AGGREGATE":
+			if !allowWeights || i+1 >= len(options) {
+				return nil, reply.GetSyntaxErrReply()
+			}
+			switch strings.ToUpper(string(options[i+1])) {
+			case "SUM":
+				spec.aggregate = aggregateSum
+			case "MIN":
+				spec.aggregate = aggregateMin
+			case "MAX":
+				spec.aggregate = aggregateMax
+			default:
+				return nil, reply.GetSyntaxErrReply()
+			}
+			i++
+		case "WITHSCORES":
+			if !allowWithScores {
+				return nil, reply.GetSyntaxErrReply()
+			}
+			spec.withScores = true
+		default:
+			return nil, reply.GetSyntaxErrReply()
+		}
+	}
+	return spec, nil
+}
+
+// getZSetOperand returns the members of key with their scores, for use as an input of ZUNION and friends.
+// Like in Redis, a set may be used as well, in which case every member has a score of 1
+func getZSetOperand(db *DB, key string) (map[string]float64, resp.Reply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	switch data := entity.Data.(type) {
+	case zset.ZSet:
+		elements := data.RangeByRankElements(0, -1, false)
+		members := make(map[string]float64, len(elements))
+		for _, element := range elements {
+			members[element.Member] = element.Score
+		}
+		return members, nil
+	case *set.Set:
+		members := make(map[string]float64, data.Len())
+		for _, member := range data.Members() {
+			members[member] = 1
+		}
+		return members, nil
+	}
+	return nil, reply.GetWrongTypeErrReply()
+}
+
+// getZSetOperands loads every key of keys, a missing key giving a nil map
+func getZSetOperands(db *DB, keys []string) ([]map[string]float64, resp.Reply) {
+	operands := make([]map[string]float64, len(keys))
+	for i, key := range keys {
+		members, errReply := getZSetOperand(db, key)
+		if errReply != nil {
+			return nil, errReply
+		}
+		operands[i] = members
+	}
+	return operands, nil
+}
+
+// weightScore multiplies score by weight, where 0 * inf gives 0 instead of NaN as in Redis
+func weightScore(score, weight float64) float64 {
+	result := score * weight
+	if math.IsNaN(result) {
+		return 0
+	}
+	return result
+}
+
+// aggregateScores combines the scores a member has in two inputs
+func aggregateScores(aggregate int, a, b float64) float64 {
+	switch aggregate {
+	case aggregateMin:
+		return math.Min(a, b)
+	case aggregateMax:
+		return math.Max(a, b)
+	}
+	sum := a + b
+	if math.IsNaN(sum) { // inf + -inf
+		return 0
+	}
+	return sum
+}
+
+// zunion computes the union of operands
+func (spec *zsetOpSpec) zunion(operands []map[string]float64) map[string]float64 {
+	result := make(map[string]float64)
+	for i, members := range operands {
+		for member, score := range members {
+			score = weightScore(score, spec.weights[i])
+			if old, ok := result[member]; ok {
+				score = aggregateScores(spec.aggregate, old, score)
+			}
+			result[member] = score
+		}
+	}
+	return result
+}
+
+// zinter computes the intersection of operands
+func (spec *zsetOpSpec) zinter(operands []map[string]float64) map[string]float64 {
+	result := make(map[string]float64)
+	for member, score := range operands[0] {
+		score = weightScore(score, spec.weights[0])
+		found := true
+		for i := 1; i < len(operands); i++ {
+			other, ok := operands[i][member]
+			if !ok {
+				found = false
+				break
+			}
+			score = aggregateScores(spec.aggregate, score, weightScore(other, spec.weights[i]))
+		}
+		if found {
+			result[member] = score
+		}
+	}
+	return result
+}
+
+// zdiff returns the members of the first operand that are in none of the others, with their original scores
+func zdiff(operands []map[string]float64) map[string]float64 {
+	result := make(map[string]float64)
+	for member, score := range operands[0] {
+		found := false
+		for _, members := range operands[1:] {
+			if _, ok := members[member]; ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result[member] = score
+		}
+	}
+	return result
+}
+
+// sortedElements returns members in (score, member) order
+func sortedElements(members map[string]float64) []zset.Element {
+	elements := make([]zset.Element, 0, len(members))
+	for member, score := range members {
+		elements = append(elements, zset.Element{Member: member, Score: score})
+	}
+	sort.Slice(elements, func(i, j int) bool {
+		a, b := elements[i], elements[j]
+		return a.Score < b.Score || (a.Score == b.Score && a.Member < b.Member)
+	})
+	return elements
+}
+
+// zsetOpGeneric runs op on the zsets at keys and replies with the result
+func zsetOpGeneric(db *DB, spec *zsetOpSpec, op func(operands []map[string]float64) map[string]float64) resp.Reply {
+	sortedKeys := utils.DedupSortedKeys(spec.keys)
+	locks := make([]*KeyLockHandle, len(sortedKeys))
+	for i, key := range sortedKeys {
+		locks[i] = db.lockMgr.RLock(key)
+	}
+	defer func() {
+		for _, lock := range locks {
+			db.lockMgr.RUnlock(lock)
+		}
+	}()
+
+	operands, errReply := getZSetOperands(db, spec.keys)
+	if errReply != nil {
+		return errReply
+	}
+	return zsetElementsReply(sortedElements(op(operands)), spec.withScores)
+}
+
+// zsetOpStoreGeneric runs op on the zsets at keys and stores the result in dst.
+// dst and all the source keys are locked together, so the result is computed from a consistent snapshot
+func zsetOpStoreGeneric(db *DB, cmdName string, args [][]byte, spec *zsetOpSpec,
+	op func(operands []map[string]float64) map[string]float64) resp.Reply {
+	dst := string(args[0])
+	handle := db.lockMgr.LockKeys(append([]string{dst}, spec.keys...))
+	defer db.lockMgr.UnlockKeys(handle)
+
+	operands, errReply := getZSetOperands(db, spec.keys)
+	if errReply != nil {
+		return errReply
+	}
+	members := op(operands)
+
+	if len(members) == 0 {
+		db.Remove(dst)
+	} else {
+		destZSet := zset.NewZSet()
+		for member, score := range members {
+			destZSet.Add(member, score)
+		}
+		db.PutEntity(dst, &database.DataEntity{Data: destZSet})
+		db.Persist(dst)
+	}
+	db.addAof(utils.ToCmdLineWithName(cmdName, args...))
+	return reply.GetIntReply(int64(len(members)))
+}
+
+// execZUnion implements the ZUNION command
+// ZUNION numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]
+func execZUnion(db *DB, args [][]byte) resp.Reply {
+	spec, errReply := parseZSetOpSpec("zunion", args, true, true)
+	if errReply != nil {
+		return errReply
+	}
+	return zsetOpGeneric(db, spec, spec.zunion)
+}
+
+// execZInter implements the ZINTER command
+// ZINTER numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]
+func execZInter(db *DB, args [][]byte) resp.Reply {
+	spec, errReply := parseZSetOpSpec("zinter", args, true, true)
+	if errReply != nil {
+		return errReply
+	}
+	return zsetOpGeneric(db, spec, spec.zinter)
+}
+
+// execZDiff implements the ZDIFF command
+// ZDIFF numkeys key [key ...] [WITHSCORES]
+func execZDiff(db *DB, args [][]byte) resp.Reply {
+	spec, errReply := parseZSetOpSpec("zdiff", args, false, true)
+	if errReply != nil {
+		return errReply
+	}
+	return zsetOpGeneric(db, spec, zdiff)
+}
+
+// execZUnionStore implements the ZUNIONSTORE command
+// ZUNIONSTORE destination numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX]
+func execZUnionStore(db *DB, args [][]byte) resp.Reply {
+	spec, errReply := parseZSetOpSpec("zunionstore", args[1:], true, false)
+	if errReply != nil {
+		return errReply
+	}
+	return zsetOpStoreGeneric(db, "ZUNIONSTORE", args, spec, spec.zunion)
+}
+
+// execZInterStore implements the ZINTERSTORE command
+// ZINTERSTORE destination numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX]
+func execZInterStore(db *DB, args [][]byte) resp.Reply {
+	spec, errReply := parseZSetOpSpec("zinterstore", args[1:], true, false)
+	if errReply != nil {
+		return errReply
+	}
+	return zsetOpStoreGeneric(db, "ZINTERSTORE", args, spec, spec.zinter)
+}
+
+// execZDiffStore implements the ZDIFFSTORE command
+// ZDIFFSTORE destination numkeys key [key ...]
+func execZDiffStore(db *DB, args [][]byte) resp.Reply {
+	spec, errReply := parseZSetOpSpec("zdiffstore", args[1:], false, false)
+	if errReply != nil {
+		return errReply
+	}
+	return zsetOpStoreGeneric(db, "ZDIFFSTORE", args, spec, zdiff)
+}
+
+// execZInterCard returns the size of the intersection, stopping once it reaches limit if limit is not 0
+// ZINTERCARD numkeys key [key ...] [LIMIT limit]
+func execZInterCard(db *DB, args [][]byte) resp.Reply {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil || numKeys <= 0 {
+		return reply.GetStandardErrorReply("ERR numkeys should be greater than 0")
+	}
+	if numKeys > len(args)-1 {
+		return reply.GetStandardErrorReply("ERR Number of keys can't be greater than number of args")
+	}
+	keys := make([]string, numKeys)
+	for i := range keys {
+		keys[i] = string(args[1+i])
+	}
+
+	limit := 0
+	options := args[1+numKeys:]
+	if len(options) > 0 {
+		if len(options) != 2 || strings.ToUpper(string(options[0])) != "LIMIT" {
+			return reply.GetSyntaxErrReply()
+		}
+		limit, err = strconv.Atoi(string(options[1]))
+		if err != nil {
+			return reply.GetStandardErrorReply("ERR value is not an integer or out of range")
+		}
+		if limit < 0 {
+			return reply.GetStandardErrorReply("ERR LIMIT can't be negative")
+		}
+	}
+
+	sortedKeys := utils.DedupSortedKeys(keys)
+	locks := make([]*KeyLockHandle, len(sortedKeys))
+	for i, key := range sortedKeys {
+		locks[i] = db.lockMgr.RLock(key)
+	}
+	defer func() {
+		for _, lock := range locks {
+			db.lockMgr.RUnlock(lock)
+		}
+	}()
+
+	operands, errReply := getZSetOperands(db, keys)
+	if errReply != nil {
+		return errReply
+	}
+	// 从最小的输入开始遍历, 减少查找次数
+	sort.Slice(operands, func(i, j int) bool {
+		return len(operands[i]) < len(operands[j])
+	})
+	count := 0
+	for member := range operands[0] {
+		found := true
+		for _, members := range operands[1:] {
+			if _, ok := members[member]; !ok {
+				found = false
+				break
+			}
+		}
+		if found {
+			count++
+			if count == limit {
+				break
+			}
+		}
+	}
+	return reply.GetIntReply(int64(count))
+}
+
+func init() {
+	RegisterCommand("ZUNION", execZUnion, -3)           // numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]
+	RegisterCommand("ZINTER", execZInter, -3)           // numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]
+	RegisterCommand("ZDIFF", execZDiff, -3)             // numkeys key [key ...] [WITHSCORES]
+	RegisterCommand("ZUNIONSTORE", execZUnionStore, -4) // destination numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX]
+	RegisterCommand("ZINTERSTORE", execZInterStore, -4) // destination numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX]
+	RegisterCommand("ZDIFFSTORE", execZDiffStore, -4)   // destination numkeys key [key ...]
+	RegisterCommand("ZINTERCARD", execZInterCard, -3)   // numkeys key [key ...] [LIMIT limit]
+}
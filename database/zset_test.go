@@ -0,0 +1,61 @@
+package database
+
+import "testing"
+
+func TestZAddFlags(t *testing.T) {
+	ab := [][]string{{"ZADD", "z", "1", "a", "2", "b"}}
+	runCmdCases(t, []cmdCase{
+		{"add", nil, []string{"ZADD", "z", "1", "a", "2", "b"}, ":2"},
+		{"update counts nothing", ab, []string{"ZADD", "z", "5", "a"}, ":0"},
+		{"ch counts updates", ab, []string{"ZADD", "z", "CH", "5", "a", "2", "b", "3", "c"}, ":2"},
+		{"nx skips existing", ab, []string{"ZADD", "z", "NX", "5", "a", "3", "c"}, ":1"},
+		{"nx keeps the score", [][]string{ab[0], {"ZADD", "z", "NX", "5", "a"}}, []string{"ZSCORE", "z", "a"}, "$1 1"},
+		{"xx skips new", ab, []string{"ZADD", "z", "XX", "CH", "5", "a", "3", "c"}, ":1"},
+		{"xx adds nothing", [][]string{ab[0], {"ZADD", "z", "XX", "3", "c"}}, []string{"ZCARD", "z"}, ":2"},
+		// GT 和 LT 只限制更新, 新成员照常添加
+		{"gt", [][]string{ab[0], {"ZADD", "z", "GT", "0", "a", "5", "b", "3", "c"}},
+			[]string{"ZRANGE", "z", "0", "-1", "WITHSCORES"}, "*6 $1 a $1 1 $1 c $1 3 $1 b $1 5"},
+		{"lt", [][]string{ab[0], {"ZADD", "z", "LT", "0", "a", "5", "b", "3", "c"}},
+			[]string{"ZRANGE", "z", "0", "-1", "WITHSCORES"}, "*6 $1 a $1 0 $1 b $1 2 $1 c $1 3"},
+		{"gt ch", ab, []string{"ZADD", "z", "GT", "CH", "0", "a", "5", "b"}, ":1"},
+
+		{"incr", ab, []string{"ZADD", "z", "INCR", "5", "a"}, "$1 6"},
+		{"incr new member", nil, []string{"ZADD", "z", "INCR", "5", "a"}, "$1 5"},
+		{"incr nx on existing", ab, []string{"ZADD", "z", "NX", "INCR", "5", "a"}, "$-1"},
+		{"incr xx on missing", ab, []string{"ZADD", "z", "XX", "INCR", "5", "c"}, "$-1"},
+		{"incr gt going down", ab, []string{"ZADD", "z", "GT", "INCR", "-1", "a"}, "$-1"},
+		{"incr lt going down", ab, []string{"ZADD", "z", "LT", "INCR", "-1", "a"}, "$1 0"},
+		{"incr to nan", [][]string{{"ZADD", "z", "+inf", "a"}}, []string{"ZADD", "z", "INCR", "-inf", "a"},
+			"-ERR resulting score is not a number (NaN)"},
+		{"incr pairs", nil, []string{"ZADD", "z", "INCR", "5", "a", "1", "b"},
+			"-ERR INCR option supports a single increment-element pair"},
+
+		{"nx and xx", nil, []string{"ZADD", "z", "NX", "XX", "1", "a"}, "-ERR XX and NX options at the same time are not compatible"},
+		{"gt and lt", nil, []string{"ZADD", "z", "GT", "LT", "1", "a"},
+			"-ERR GT, LT, and/or NX options at the same time are not compatible"},
+		{"nx and gt", nil, []string{"ZADD", "z", "NX", "GT", "1", "a"},
+			"-ERR GT, LT, and/or NX options at the same time are not compatible"},
+		{"nan score", nil, []string{"ZADD", "z", "nan", "a"}, "-ERR value is not a valid float"},
+		{"bad score adds nothing", [][]string{{"ZADD", "z", "1", "a", "x", "b"}}, []string{"EXISTS", "z"}, ":0"},
+		{"missing member", nil, []string{"ZADD", "z", "1", "a", "2"}, "-ERR syntax error"},
+		{"wrong type", [][]string{{"SET", "z", "v"}}, []string{"ZADD", "z", "1", "a"},
+			"-WRONGTYPE Operation against a key holding the wrong kind of value"},
+	})
+}
+
+func TestZRandMember(t *testing.T) {
+	a := [][]string{{"ZADD", "z", "1", "a"}}
+	runCmdCases(t, []cmdCase{
+		{"no count", a, []string{"ZRANDMEMBER", "z"}, "$1 a"},
+		{"missing key", nil, []string{"ZRANDMEMBER", "z"}, "$-1"},
+		{"missing key with count", nil, []string{"ZRANDMEMBER", "z", "3"}, "*0"},
+		{"distinct", a, []string{"ZRANDMEMBER", "z", "3", "WITHSCORES"}, "*2 $1 a $1 1"},
+		{"repeated", a, []string{"ZRANDMEMBER", "z", "-2", "WITHSCORES"}, "*4 $1 a $1 1 $1 a $1 1"},
+		// 负数 count 的回复是先在内存中构造的, 过大时直接拒绝
+		{"min int64", a, []string{"ZRANDMEMBER", "z", "-9223372036854775808"}, "-ERR value is out of range"},
+		{"huge negative", a, []string{"ZRANDMEMBER", "z", "-9223372036854775807"}, "-ERR value is out of range"},
+		{"pairs overflow", a, []string{"ZRANDMEMBER", "z", "-4611686018427387904", "WITHSCORES"}, "-ERR value is out of range"},
+		{"reply too long", a, []string{"ZRANDMEMBER", "z", "-16777216", "WITHSCORES"}, "-ERR value is out of range"},
+		{"bad option", a, []string{"ZRANDMEMBER", "z", "1", "WITHVALUES"}, "-ERR syntax error"},
+	})
+}
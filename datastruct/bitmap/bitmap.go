@@ -0,0 +1,249 @@
+// Package bitmap implements the bit level operations behind the Redis bitmap commands.
+// Bits are numbered from the most significant bit of the first byte, as in Redis,
+// and bits past the end of the buffer read as 0
+package bitmap
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// GetBit returns the bit at offset
+func GetBit(buf []byte, offset int64) byte {
+	idx := offset >> 3
+	if idx >= int64(len(buf)) {
+		return 0
+	}
+	return (buf[idx] >> (7 - uint(offset&7))) & 1
+}
+
+// SetBit sets the bit at offset to value, which must be 0 or 1. buf must be long enough to hold it
+func SetBit(buf []byte, offset int64, value byte) {
+	idx := offset >> 3
+	mask := byte(1) << (7 - uint(offset&7))
+	if value != 0 {
+		buf[idx] |= mask
+	} else {
+		buf[idx] &^= mask
+	}
+}
+
+// popcount counts the set bits of buf, a word at a time
+func popcount(buf []byte) int64 {
+	var count int
+	for len(buf) >= 8 {
+		count += bits.OnesCount64(binary.LittleEndian.Uint64(buf))
+		buf = buf[8:]
+	}
+	for _, b := range buf {
+		count += bits.OnesCount8(b)
+	}
+	return int64(count)
+}
+
+// Count returns the number of set bits between the bit offsets start and end, inclusive.
+// Both must lie within buf
+func Count(buf []byte, start, end int64) int64 {
+	if start > end {
+		return 0
+	}
+	firstByte, lastByte := start>>3, end>>3
+	count := popcount(buf[firstByte : lastByte+1])
+	// 减去首尾字节中不在范围内的位
+	if head := uint(start & 7); head != 0 {
+		count -= int64(bits.OnesCount8(buf[firstByte] >> (8 - head)))
+	}
+	if tail := uint(7 - (end & 7)); tail != 0 {
+		count -= int64(bits.OnesCount8(buf[lastByte] << (8 - tail)))
+	}
+	return count
+}
+
+// Pos returns the offset of the first bit equal to bit between the bit offsets start and end, inclusive,
+// or -1 if there is none. Both offsets must lie within buf
+func Pos(buf []byte, bit byte, start, end int64) int64 {
+	// 整字节 (以及整 64 位字) 全为 skip 时可以直接跳过
+	var skip byte
+	if bit == 0 {
+		skip = 0xff
+	}
+	skipWord := uint64(0)
+	if bit == 0 {
+		skipWord = ^uint64(0)
+	}
+
+	for i := start; i <= end; {
+		if i&63 == 0 && i+63 <= end && binary.BigEndian.Uint64(buf[i>>3:]) == skipWord {
+			i += 64
+			continue
+		}
+		if i&7 == 0 && i+7 <= end && buf[i>>3] == skip {
+			i += 8
+			continue
+		}
+		if GetBit(buf, i) == bit {
+			return i
+		}
+		i++
+	}
+	return -1
+}
+
+// Op names a BITOP operation
+type Op int
+
+const (
+	OpAnd Op = iota
+	OpOr
+	OpXor
+	OpNot
+)
+
+// Apply combines srcs with op into a new buffer as long as the longest of them,
+// shorter sources being padded with zeros. OpNot takes a single source
+func Apply(op Op, srcs [][]byte) []byte {
+	size := 0
+	for _, src := range srcs {
+		size = max(size, len(src))
+	}
+	result := make([]byte, size)
+	if op == OpNot {
+		for i, b := range srcs[0] {
+			result[i] = ^b
+		}
+		return result
+	}
+
+	copy(result, srcs[0])
+	for _, src := range srcs[1:] {
+		switch op {
+		case OpAnd:
+			for i := range result {
+				if i < len(src) {
+					result[i] &= src[i]
+				} else {
+					result[i] = 0
+				}
+			}
+		case OpOr:
+			for i, b := range src {
+				result[i] |= b
+			}
+		case OpXor:
+			for i, b := range src {
+				result[i] ^= b
+			}
+		}
+	}
+	return result
+}
+
+// GetUnsigned reads the width bits starting at offset as an unsigned integer, 1 <= width <= 64
+func GetUnsigned(buf []byte, offset int64, width uint) uint64 {
+	var value uint64
+	for i := int64(0); i < int64(width); i++ {
+		value = value<<1 | uint64(GetBit(buf, offset+i))
+	}
+	return value
+}
+
+// GetSigned reads the width bits starting at offset as a two's complement integer, 1 <= width <= 64
+func GetSigned(buf []byte, offset int64, width uint) int64 {
+	value := GetUnsigned(buf, offset, width)
+	if width < 64 && value&(1<<(width-1)) != 0 {
+		value |= ^uint64(0) << width // 符号扩展
+	}
+	return int64(value)
+}
+
+// SetInteger writes the low width bits of value starting at offset. buf must be long enough to hold them
+func SetInteger(buf []byte, offset int64, width uint, value uint64) {
+	for i := uint(0); i < width; i++ {
+		SetBit(buf, offset+int64(i), byte(value>>(width-1-i))&1)
+	}
+}
+
+// Overflow is the behaviour of BITFIELD SET and INCRBY when a value doesn't fit its field
+type Overflow int
+
+const (
+	OverflowWrap Overflow = iota
+	OverflowSat
+	OverflowFail
+)
+
+// AddUnsigned adds incr to the width bits wide unsigned value and handles overflow as requested.
+// ok is false if the result doesn't fit and overflow is OverflowFail.
+// With an incr of 0 it checks whether value itself fits, which is what SET needs
+func AddUnsigned(value uint64, incr int64, width uint, overflow Overflow) (result uint64, ok bool) {
+	maxValue := ^uint64(0)
+	if width < 64 {
+		maxValue = 1<<width - 1
+	}
+	sum := value + uint64(incr)
+	var fits bool
+	var limit uint64
+	switch {
+	case value > maxValue:
+		fits, limit = false, maxValue
+	case incr > 0:
+		fits, limit = uint64(incr) <= maxValue-value, maxValue
+	case incr < 0:
+		fits, limit = uint64(-incr) <= value, 0
+	default:
+		fits = true
+	}
+	if fits {
+		return sum, true
+	}
+	switch overflow {
+	case OverflowSat:
+		return limit, true
+	case OverflowFail:
+		return 0, false
+	}
+	return sum & maxValue, true
+}
+
+// AddSigned adds incr to the width bits wide signed value and handles overflow as requested.
+// ok is false if the result doesn't fit and overflow is OverflowFail.
+// With an incr of 0 it checks whether value itself fits, which is what SET needs
+func AddSigned(value int64, incr int64, width uint, overflow Overflow) (result int64, ok bool) {
+	maxValue := int64(1<<63 - 1)
+	if width < 64 {
+		maxValue = 1<<(width-1) - 1
+	}
+	minValue := -maxValue - 1
+
+	sum := int64(uint64(value) + uint64(incr)) // 按无符号相加, 溢出时回绕
+	var fits bool
+	var limit int64
+	switch {
+	case value > maxValue:
+		fits, limit = false, maxValue
+	case value < minValue:
+		fits, limit = false, minValue
+	case incr > 0:
+		// 64 位时 value 为负加正数不会上溢, 先判断它可避免 maxValue-value 本身溢出; 更窄的类型不会溢出
+		fits, limit = width == 64 && value < 0 || incr <= maxValue-value, maxValue
+	case incr < 0:
+		fits, limit = width == 64 && value >= 0 || incr >= minValue-value, minValue
+	default:
+		fits = true
+	}
+	if fits {
+		return sum, true
+	}
+	switch overflow {
+	case OverflowSat:
+		return limit, true
+	case OverflowFail:
+		return 0, false
+	}
+	if width < 64 {
+		// 按符号位扩展到 64 位
+		shift := 64 - width
+		sum = sum << shift >> shift
+	}
+	return sum, true
+}
@@ -0,0 +1,352 @@
+// Package bloom implements a scalable Bloom filter, as the BF commands of RedisBloom use.
+//
+// A filter is a chain of sub-filters. Items are added to the last one, and when it holds its capacity a new
+// sub-filter is appended with expansion times the capacity and half the error rate, so that the overall
+// false positive rate stays below the configured one however many items are added.
+package bloom
+
+import (
+	"Redis_Go/lib/codec"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math"
+)
+
+const (
+	// DefaultErrorRate and DefaultCapacity configure the filters BF.ADD creates
+	DefaultErrorRate = 0.01
+	DefaultCapacity  = 100
+	// DefaultExpansion is the capacity growth factor of the sub-filters
+	DefaultExpansion = 2
+
+	// MaxBits caps the bit arrays of a filter, sub-filters included, at 1GB
+	MaxBits = 1 << 33
+	// MaxExpansion caps the capacity growth factor of the sub-filters
+	MaxExpansion = 1 << 15
+
+	// tighteningRatio is the error rate of each sub-filter relative to the previous one
+	tighteningRatio = 0.5
+)
+
+var (
+	ErrErrorRate = errors.New("ERR (0 < error rate range < 1)")
+	ErrExpansion = errors.New("ERR expansion should be between 1 and 32768")
+	ErrTooLarge  = errors.New("ERR filter would be larger than 1GB")
+	// ErrFull is returned by Add when a filter that doesn't scale holds its capacity
+	ErrFull = errors.New("ERR non scaling filter is full")
+	// ErrMaxSize is returned by Add when the next sub-filter would take the filter past MaxBits
+	ErrMaxSize = errors.New("ERR filter reached its maximum size")
+)
+
+// subFilter is a fixed size Bloom filter
+type subFilter struct {
+	bits     []uint64
+	numBits  uint64
+	hashes   int
+	capacity uint64
+	count    uint64
+}
+
+// bitsPerItem returns the bits per item a Bloom filter needs for errorRate, -ln(p) / ln(2)^2
+func bitsPerItem(errorRate float64) float64 {
+	return -math.Log(errorRate) / (math.Ln2 * math.Ln2)
+}
+
+// subFilterBits returns the number of bits of a sub-filter, as a float so that callers can check it
+// against MaxBits before it overflows
+func subFilterBits(capacity uint64, errorRate float64) float64 {
+	return max(math.Ceil(float64(capacity)*bitsPerItem(errorRate)), 64)
+}
+
+// subFilterHashes returns the number of hashes per item of a sub-filter
+func subFilterHashes(errorRate float64) int {
+	return max(int(math.Ceil(bitsPerItem(errorRate)*math.Ln2)), 1)
+}
+
+func newSubFilter(capacity uint64, errorRate float64) *subFilter {
+	// m = -n ln(p) / ln(2)^2, k = m/n ln(2)
+	numBits := uint64(subFilterBits(capacity, errorRate))
+	hashes := subFilterHashes(errorRate)
+	return &subFilter{
+		bits:     make([]uint64, (numBits+63)/64),
+		numBits:  numBits,
+		hashes:   hashes,
+		capacity: capacity,
+	}
+}
+
+// itemHash returns the two hashes the bit positions of an item are derived from, by double hashing
+func itemHash(item []byte) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write(item)
+	sum := h.Sum64()
+	// FNV 的低位在相似的输入间分布不均，用 splitmix64 的终结函数打散
+	return mix(sum), mix(sum^0x9e3779b97f4a7c15) | 1
+}
+
+// mix is the finalizer of splitmix64
+func mix(x uint64) uint64 {
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+func (f *subFilter) test(h1, h2 uint64) bool {
+	for i := 0; i < f.hashes; i++ {
+		pos := (h1 + uint64(i)*h2) % f.numBits
+		if f.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// set sets the bits of an item and reports whether any of them was clear
+func (f *subFilter) set(h1, h2 uint64) bool {
+	changed := false
+	for i := 0; i < f.hashes; i++ {
+		pos := (h1 + uint64(i)*h2) % f.numBits
+		mask := uint64(1) << (pos % 64)
+		if f.bits[pos/64]&mask == 0 {
+			f.bits[pos/64] |= mask
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Filter is a scalable Bloom filter
+type Filter struct {
+	errorRate  float64
+	capacity   uint64
+	expansion  uint64 // 0 for a filter that doesn't scale
+	subFilters []*subFilter
+}
+
+// Validate checks the settings of a new filter: the error rate must lie in (0, 1), the expansion must not
+// exceed MaxExpansion and the first sub-filter must fit in MaxBits. An expansion of 0 is a filter that
+// doesn't scale
+func Validate(errorRate float64, capacity, expansion uint64) error {
+	if !(errorRate > 0 && errorRate < 1) {
+		return ErrErrorRate
+	}
+	if expansion > MaxExpansion {
+		return ErrExpansion
+	}
+	if subFilterBits(capacity, errorRate*tighteningRatio) > MaxBits {
+		return ErrTooLarge
+	}
+	return nil
+}
+
+// New creates a filter holding capacity items with the given false positive rate before it scales.
+// A filter with expansion 0 doesn't scale and refuses items once full. The settings must pass Validate
+func New(errorRate float64, capacity, expansion uint64) *Filter {
+	return &Filter{
+		errorRate:  errorRate,
+		capacity:   capacity,
+		expansion:  expansion,
+		subFilters: []*subFilter{newSubFilter(capacity, errorRate*tighteningRatio)},
+	}
+}
+
+// Exists reports whether item may have been added. It is false for sure if the item wasn't
+func (f *Filter) Exists(item []byte) bool {
+	h1, h2 := itemHash(item)
+	for _, sf := range f.subFilters {
+		if sf.test(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add adds an item and reports whether it wasn't there already. It fails with ErrFull if the filter doesn't
+// scale and holds its capacity, and with ErrMaxSize if scaling would take it past MaxBits
+func (f *Filter) Add(item []byte) (added bool, err error) {
+	h1, h2 := itemHash(item)
+	for _, sf := range f.subFilters {
+		if sf.test(h1, h2) {
+			return false, nil
+		}
+	}
+
+	last := f.subFilters[len(f.subFilters)-1]
+	if last.count >= last.capacity {
+		if f.expansion == 0 {
+			return false, ErrFull
+		}
+		if last.capacity > math.MaxUint64/f.expansion {
+			return false, ErrMaxSize
+		}
+		capacity := last.capacity * f.expansion
+		errorRate := f.subFilterErrorRate(len(f.subFilters))
+		if float64(f.numBits())+subFilterBits(capacity, errorRate) > MaxBits {
+			return false, ErrMaxSize
+		}
+		last = newSubFilter(capacity, errorRate)
+		f.subFilters = append(f.subFilters, last)
+	}
+	if last.set(h1, h2) {
+		last.count++
+	}
+	return true, nil
+}
+
+// subFilterErrorRate returns the error rate of the i-th sub-filter, which tightens with every one
+func (f *Filter) subFilterErrorRate(i int) float64 {
+	return f.errorRate * math.Pow(tighteningRatio, float64(i+1))
+}
+
+// numBits returns the number of bits of all the sub-filters
+func (f *Filter) numBits() uint64 {
+	var n uint64
+	for _, sf := range f.subFilters {
+		n += sf.numBits
+	}
+	return n
+}
+
+// ErrorRate returns the configured false positive rate
+func (f *Filter) ErrorRate() float64 {
+	return f.errorRate
+}
+
+// Capacity returns the number of items the filter holds before it scales
+func (f *Filter) Capacity() uint64 {
+	return f.capacity
+}
+
+// Expansion returns the capacity growth factor of the sub-filters, 0 if the filter doesn't scale
+func (f *Filter) Expansion() uint64 {
+	return f.expansion
+}
+
+// SubFilters returns the number of sub-filters
+func (f *Filter) SubFilters() int {
+	return len(f.subFilters)
+}
+
+// Count returns the number of items added
+func (f *Filter) Count() uint64 {
+	var count uint64
+	for _, sf := range f.subFilters {
+		count += sf.count
+	}
+	return count
+}
+
+// Size returns the number of bytes taken by the bit arrays
+func (f *Filter) Size() int {
+	size := 0
+	for _, sf := range f.subFilters {
+		size += len(sf.bits) * 8
+	}
+	return size
+}
+
+// Clone returns a deep copy of the filter
+func (f *Filter) Clone() *Filter {
+	clone := *f
+	clone.subFilters = make([]*subFilter, len(f.subFilters))
+	for i, sf := range f.subFilters {
+		sfClone := *sf
+		sfClone.bits = append([]uint64(nil), sf.bits...)
+		clone.subFilters[i] = &sfClone
+	}
+	return &clone
+}
+
+// Marshal serializes the filter
+func (f *Filter) Marshal() []byte {
+	buf := codec.AppendFloat(nil, f.errorRate)
+	buf = codec.AppendUvarint(buf, f.capacity)
+	buf = codec.AppendUvarint(buf, f.expansion)
+	buf = codec.AppendUvarint(buf, uint64(len(f.subFilters)))
+	for _, sf := range f.subFilters {
+		buf = codec.AppendUvarint(buf, sf.numBits)
+		buf = codec.AppendUvarint(buf, uint64(sf.hashes))
+		buf = codec.AppendUvarint(buf, sf.capacity)
+		buf = codec.AppendUvarint(buf, sf.count)
+		for _, word := range sf.bits {
+			buf = binary.LittleEndian.AppendUint64(buf, word)
+		}
+	}
+	return buf
+}
+
+// Unmarshal restores a filter serialized by Marshal.
+// The capacity, size and number of hashes of each sub-filter follow from the settings of the filter, as Add
+// derives them, and must match the payload; so must the limits of Add: at most MaxBits bits in all, and no
+// more items in a sub-filter than it holds
+func Unmarshal(data []byte) (*Filter, error) {
+	r := codec.NewReader(data)
+	f := &Filter{
+		errorRate: r.ReadFloat(),
+		capacity:  r.ReadUvarint(),
+		expansion: r.ReadUvarint(),
+	}
+	n := r.ReadUvarint()
+	if r.Err() != nil {
+		return nil, r.Err()
+	}
+	if f.capacity == 0 || Validate(f.errorRate, f.capacity, f.expansion) != nil {
+		return nil, codec.ErrBadFormat
+	}
+	// 每个子过滤器至少有 64 位; 不扩容的过滤器只有一个子过滤器
+	if n == 0 || n > uint64(r.Remaining())/8 || f.expansion == 0 && n > 1 {
+		return nil, codec.ErrBadFormat
+	}
+
+	capacity := f.capacity
+	var totalBits float64
+	for i := 0; uint64(i) < n; i++ {
+		if i > 0 {
+			if capacity > math.MaxUint64/f.expansion {
+				return nil, codec.ErrBadFormat
+			}
+			capacity *= f.expansion
+		}
+		errorRate := f.subFilterErrorRate(i)
+		// 先用浮点数比较, 避免位数在转换成 uint64 时溢出
+		totalBits += subFilterBits(capacity, errorRate)
+		if totalBits > MaxBits {
+			return nil, codec.ErrBadFormat
+		}
+
+		sf := &subFilter{
+			numBits:  r.ReadUvarint(),
+			hashes:   int(r.ReadUvarint()),
+			capacity: r.ReadUvarint(),
+			count:    r.ReadUvarint(),
+		}
+		if r.Err() != nil {
+			return nil, r.Err()
+		}
+		if sf.numBits != uint64(subFilterBits(capacity, errorRate)) || sf.hashes != subFilterHashes(errorRate) ||
+			sf.capacity != capacity || sf.count > sf.capacity {
+			return nil, codec.ErrBadFormat
+		}
+		words := (sf.numBits + 63) / 64
+		if words > uint64(r.Remaining())/8 {
+			return nil, codec.ErrBadFormat
+		}
+		sf.bits = make([]uint64, words)
+		for j := range sf.bits {
+			var word [8]byte
+			for k := range word {
+				word[k] = r.ReadUint8()
+			}
+			sf.bits[j] = binary.LittleEndian.Uint64(word[:])
+		}
+		f.subFilters = append(f.subFilters, sf)
+	}
+	if r.Err() != nil {
+		return nil, r.Err()
+	}
+	if r.Remaining() != 0 {
+		return nil, codec.ErrBadFormat
+	}
+	return f, nil
+}
@@ -0,0 +1,119 @@
+package bloom
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+// falsePositiveRate adds n items to f and returns the rate of false positives among 100000 other items
+func falsePositiveRate(t *testing.T, f *Filter, n int) float64 {
+	for i := 0; i < n; i++ {
+		if _, err := f.Add([]byte("item:" + strconv.Itoa(i))); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	for i := 0; i < n; i++ {
+		if !f.Exists([]byte("item:" + strconv.Itoa(i))) {
+			t.Fatalf("item:%d was added but isn't found", i)
+		}
+	}
+	const probes = 100000
+	positives := 0
+	for i := 0; i < probes; i++ {
+		if f.Exists([]byte("absent:" + strconv.Itoa(i))) {
+			positives++
+		}
+	}
+	return float64(positives) / probes
+}
+
+func TestFalsePositiveRate(t *testing.T) {
+	tests := []struct {
+		errorRate float64
+		capacity  uint64
+		expansion uint64
+		items     int
+	}{
+		{0.01, 10000, DefaultExpansion, 10000},
+		{0.001, 10000, DefaultExpansion, 10000},
+		{0.1, 1000, 0, 1000},
+		// 扩容多次后整体的误判率仍不超过设定值
+		{0.01, 100, DefaultExpansion, 50000},
+		{0.01, 100, 4, 50000},
+	}
+	for _, tt := range tests {
+		if err := Validate(tt.errorRate, tt.capacity, tt.expansion); err != nil {
+			t.Fatalf("Validate: %v", err)
+		}
+		f := New(tt.errorRate, tt.capacity, tt.expansion)
+		rate := falsePositiveRate(t, f, tt.items)
+		if rate > tt.errorRate {
+			t.Errorf("error rate %g, capacity %d, expansion %d, %d items: false positive rate %g",
+				tt.errorRate, tt.capacity, tt.expansion, tt.items, rate)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		errorRate float64
+		capacity  uint64
+		expansion uint64
+		want      error
+	}{
+		{0.01, 100, DefaultExpansion, nil},
+		{0.01, 100, 0, nil},
+		{0.01, 100, MaxExpansion, nil},
+		{0, 100, DefaultExpansion, ErrErrorRate},
+		{1, 100, DefaultExpansion, ErrErrorRate},
+		{-0.5, 100, DefaultExpansion, ErrErrorRate},
+		{math.NaN(), 100, DefaultExpansion, ErrErrorRate},
+		{0.01, 100, MaxExpansion + 1, ErrExpansion},
+		{0.01, 100, math.MaxInt64, ErrExpansion},
+		// BF.RESERVE k 1e-54 4294967295 would take about 1TB
+		{1e-54, 4294967295, DefaultExpansion, ErrTooLarge},
+		{0.01, math.MaxUint64, DefaultExpansion, ErrTooLarge},
+	}
+	for _, tt := range tests {
+		if err := Validate(tt.errorRate, tt.capacity, tt.expansion); err != tt.want {
+			t.Errorf("Validate(%g, %d, %d) = %v, want %v", tt.errorRate, tt.capacity, tt.expansion, err, tt.want)
+		}
+	}
+}
+
+func TestAddStopsAtMaxSize(t *testing.T) {
+	f := New(0.01, 1<<20, MaxExpansion)
+	// 第二个子过滤器的容量为 2^35, 远超 MaxBits, 不应分配
+	f.subFilters[0].count = f.subFilters[0].capacity
+	if _, err := f.Add([]byte("item")); err != ErrMaxSize {
+		t.Fatalf("Add to a filter at its maximum size returned %v, want %v", err, ErrMaxSize)
+	}
+	if f.SubFilters() != 1 {
+		t.Fatalf("filter has %d sub-filters, want 1", f.SubFilters())
+	}
+
+	f = New(0.01, 10, 0)
+	f.subFilters[0].count = f.subFilters[0].capacity
+	if _, err := f.Add([]byte("item")); err != ErrFull {
+		t.Fatalf("Add to a full non scaling filter returned %v, want %v", err, ErrFull)
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	f := New(0.01, 100, DefaultExpansion)
+	falsePositiveRate(t, f, 500)
+	restored, err := Unmarshal(f.Marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Count() != f.Count() || restored.SubFilters() != f.SubFilters() || restored.Size() != f.Size() {
+		t.Fatalf("restored filter has count %d, %d sub-filters, size %d, want %d, %d, %d",
+			restored.Count(), restored.SubFilters(), restored.Size(), f.Count(), f.SubFilters(), f.Size())
+	}
+	for i := 0; i < 500; i++ {
+		if !restored.Exists([]byte("item:" + strconv.Itoa(i))) {
+			t.Fatalf("item:%d is missing after the round trip", i)
+		}
+	}
+}
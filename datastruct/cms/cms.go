@@ -0,0 +1,161 @@
+// Package cms implements the Count-Min sketch, as the CMS commands of RedisBloom use.
+//
+// The sketch is a depth x width matrix of counters. An item increments one counter in each row, chosen by a
+// hash of the item, and its count is estimated as the smallest of them. Estimates never fall below the true
+// count, and exceed it by more than 2/width of the total count with probability at most 0.5^depth.
+package cms
+
+import (
+	"Redis_Go/lib/codec"
+	"hash/fnv"
+	"math"
+)
+
+// Sketch is a Count-Min sketch
+type Sketch struct {
+	width    uint64
+	depth    uint64
+	counters []uint64
+	count    uint64
+}
+
+// New creates a sketch with the given dimensions
+func New(width, depth uint64) *Sketch {
+	return &Sketch{width: width, depth: depth, counters: make([]uint64, width*depth)}
+}
+
+// DimensionsForError returns the dimensions of a sketch whose estimates exceed the true counts by more than
+// overestimation times the total count with at most the given probability
+func DimensionsForError(overestimation, probability float64) (width, depth uint64) {
+	width = uint64(math.Ceil(2 / overestimation))
+	depth = uint64(math.Ceil(math.Log10(probability) / math.Log10(0.5)))
+	return width, max(depth, 1)
+}
+
+// Width returns the number of counters in each row
+func (s *Sketch) Width() uint64 {
+	return s.width
+}
+
+// Depth returns the number of rows
+func (s *Sketch) Depth() uint64 {
+	return s.depth
+}
+
+// Count returns the total of the increments
+func (s *Sketch) Count() uint64 {
+	return s.count
+}
+
+// positions returns the counter an item increments in each row, derived from two hashes by double hashing
+func (s *Sketch) positions(item []byte) []uint64 {
+	h := fnv.New64a()
+	h.Write(item)
+	sum := h.Sum64()
+	h1, h2 := mix(sum), mix(sum^0x9e3779b97f4a7c15)|1
+	positions := make([]uint64, s.depth)
+	for row := uint64(0); row < s.depth; row++ {
+		positions[row] = row*s.width + (h1+row*h2)%s.width
+	}
+	return positions
+}
+
+// mix is the finalizer of splitmix64, it spreads the FNV hash which is weak in the low bits for similar items
+func mix(x uint64) uint64 {
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+func addSaturating(a, b uint64) uint64 {
+	if a > math.MaxUint64-b {
+		return math.MaxUint64
+	}
+	return a + b
+}
+
+// IncrBy adds increment to the count of item and returns its new estimate
+func (s *Sketch) IncrBy(item []byte, increment uint64) uint64 {
+	estimate := uint64(math.MaxUint64)
+	for _, pos := range s.positions(item) {
+		s.counters[pos] = addSaturating(s.counters[pos], increment)
+		estimate = min(estimate, s.counters[pos])
+	}
+	s.count = addSaturating(s.count, increment)
+	return estimate
+}
+
+// Query returns the estimated count of item
+func (s *Sketch) Query(item []byte) uint64 {
+	estimate := uint64(math.MaxUint64)
+	for _, pos := range s.positions(item) {
+		estimate = min(estimate, s.counters[pos])
+	}
+	return estimate
+}
+
+// Merge sets the sketch to the sum of the sources, each multiplied by its weight.
+// The sources must have the same dimensions as s, and may include s itself
+func (s *Sketch) Merge(sources []*Sketch, weights []uint64) {
+	counters := make([]uint64, len(s.counters))
+	var count uint64
+	for i, src := range sources {
+		for j, c := range src.counters {
+			counters[j] = addSaturating(counters[j], mulSaturating(c, weights[i]))
+		}
+		count = addSaturating(count, mulSaturating(src.count, weights[i]))
+	}
+	s.counters, s.count = counters, count
+}
+
+func mulSaturating(a, b uint64) uint64 {
+	if a != 0 && b > math.MaxUint64/a {
+		return math.MaxUint64
+	}
+	return a * b
+}
+
+// Size returns the number of bytes taken by the counters
+func (s *Sketch) Size() int {
+	return len(s.counters) * 8
+}
+
+// Clone returns a deep copy of the sketch
+func (s *Sketch) Clone() *Sketch {
+	clone := *s
+	clone.counters = append([]uint64(nil), s.counters...)
+	return &clone
+}
+
+// Marshal serializes the sketch
+func (s *Sketch) Marshal() []byte {
+	buf := codec.AppendUvarint(nil, s.width)
+	buf = codec.AppendUvarint(buf, s.depth)
+	buf = codec.AppendUvarint(buf, s.count)
+	for _, c := range s.counters {
+		buf = codec.AppendUvarint(buf, c)
+	}
+	return buf
+}
+
+// Unmarshal restores a sketch serialized by Marshal
+func Unmarshal(data []byte) (*Sketch, error) {
+	r := codec.NewReader(data)
+	width, depth := r.ReadUvarint(), r.ReadUvarint()
+	// 每个计数器至少占 1 字节; 先除后比较, width*depth 可能溢出
+	if width == 0 || depth == 0 || width > uint64(r.Remaining())/depth {
+		return nil, codec.ErrBadFormat
+	}
+	s := New(width, depth)
+	s.count = r.ReadUvarint()
+	for i := range s.counters {
+		s.counters[i] = r.ReadUvarint()
+	}
+	if r.Err() != nil {
+		return nil, r.Err()
+	}
+	if r.Remaining() != 0 {
+		return nil, codec.ErrBadFormat
+	}
+	return s, nil
+}
@@ -0,0 +1,80 @@
+package cms
+
+import (
+	"Redis_Go/lib/codec"
+	"strconv"
+	"testing"
+)
+
+func TestEstimateBounds(t *testing.T) {
+	const overestimation, probability = 0.001, 0.01
+	s := New(DimensionsForError(overestimation, probability))
+	counts := make(map[string]uint64)
+	total := uint64(0)
+	for i := 0; i < 5000; i++ {
+		item := "item:" + strconv.Itoa(i)
+		increment := uint64(1 + i%50)
+		s.IncrBy([]byte(item), increment)
+		counts[item] += increment
+		total += increment
+	}
+
+	over := 0
+	for item, count := range counts {
+		estimate := s.Query([]byte(item))
+		if estimate < count {
+			t.Fatalf("%s: estimate %d is below the true count %d", item, estimate, count)
+		}
+		if float64(estimate-count) > overestimation*float64(total) {
+			over++
+		}
+	}
+	if rate := float64(over) / float64(len(counts)); rate > probability {
+		t.Errorf("%.2f%% of the estimates exceed the bound, want at most %.2f%%", rate*100, probability*100)
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	s := New(100, 5)
+	for i := 0; i < 1000; i++ {
+		s.IncrBy([]byte(strconv.Itoa(i%37)), 3)
+	}
+	restored, err := Unmarshal(s.Marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Width() != 100 || restored.Depth() != 5 || restored.Count() != s.Count() {
+		t.Fatalf("restored %dx%d count %d, want 100x5 count %d", restored.Width(), restored.Depth(), restored.Count(), s.Count())
+	}
+	for i := 0; i < 37; i++ {
+		item := []byte(strconv.Itoa(i))
+		if restored.Query(item) != s.Query(item) {
+			t.Fatalf("%d: restored estimate %d, want %d", i, restored.Query(item), s.Query(item))
+		}
+	}
+}
+
+func TestUnmarshalRejectsBadPayloads(t *testing.T) {
+	// dims builds a payload of the given dimensions, a count of 0 and pad bytes of counters
+	dims := func(width, depth uint64, pad int) []byte {
+		buf := codec.AppendUvarint(nil, width)
+		buf = codec.AppendUvarint(buf, depth)
+		buf = codec.AppendUvarint(buf, 0)
+		return append(buf, make([]byte, pad)...)
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"zero width", dims(0, 1, 0)},
+		{"zero depth", dims(1, 0, 0)},
+		{"more counters than data", dims(100, 100, 16)},
+		// width*depth 在 uint64 中溢出为 2, 两个计数器的数据就能通过检查, 之后的 CMS.QUERY 会按 depth 分配内存
+		{"overflowing dimensions", dims(3, (1<<64-1)/3+1, 2)},
+	}
+	for _, tt := range tests {
+		if _, err := Unmarshal(tt.data); err == nil {
+			t.Errorf("%s: payload accepted", tt.name)
+		}
+	}
+}
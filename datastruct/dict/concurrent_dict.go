@@ -0,0 +1,279 @@
+package dict
+
+import (
+	"Redis_Go/datastruct/hashtable"
+	"math/bits"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+)
+
+// ConcurrentDict 将 key 按哈希分到若干个分片中, 每个分片是一个由读写锁保护的 hashtable.Table,
+// 不同分片上的操作互不阻塞.
+//
+// hashtable.Table 暴露了桶结构, 因此 Scan 可以在分片内按桶推进, 游标在两次调用之间经过扩容缩容
+// 仍然有效; 元素总数用原子计数维护, Len 是 O(1) 的
+type ConcurrentDict struct {
+	shards    []*dictShard
+	shardBits int // log2(len(shards)), 游标的低 shardBits 位是分片下标
+	count     atomic.Int64
+}
+
+type dictShard struct {
+	mu    sync.RWMutex
+	table *hashtable.Table[interface{}]
+}
+
+// GetConcurrentDict 创建一个至少有 shardCount 个分片的字典, 分片数会向上取整为 2 的幂
+func GetConcurrentDict(shardCount int) *ConcurrentDict {
+	size := 1
+	for size < shardCount {
+		size <<= 1
+	}
+	shards := make([]*dictShard, size)
+	for i := range shards {
+		shards[i] = &dictShard{table: hashtable.New[interface{}](0)}
+	}
+	return &ConcurrentDict{shards: shards, shardBits: bits.TrailingZeros(uint(size))}
+}
+
+// fnv32 是内联的 FNV-1a 哈希, 避免每次访问都分配 hasher
+func fnv32(key string) uint32 {
+	const prime32 = uint32(16777619)
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= prime32
+	}
+	return hash
+}
+
+// shardIndex 返回 key 所在分片的下标
+func (dict *ConcurrentDict) shardIndex(key string) int {
+	return int(fnv32(key) & uint32(len(dict.shards)-1))
+}
+
+func (dict *ConcurrentDict) getShard(key string) *dictShard {
+	return dict.shards[dict.shardIndex(key)]
+}
+
+func (dict *ConcurrentDict) Get(key string) (val interface{}, exists bool) {
+	shard := dict.getShard(key)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	return shard.table.Get(key)
+}
+
+func (dict *ConcurrentDict) Put(key string, val interface{}) (result int) {
+	shard := dict.getShard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if !shard.table.Set(key, val) {
+		return 0
+	}
+	dict.count.Add(1)
+	return 1
+}
+
+func (dict *ConcurrentDict) PutIfAbsent(key string, val interface{}) (result int) {
+	shard := dict.getShard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if _, ok := shard.table.Get(key); ok {
+		return 0
+	}
+	shard.table.Set(key, val)
+	dict.count.Add(1)
+	return 1
+}
+
+func (dict *ConcurrentDict) PutIfExists(key string, val interface{}) (result int) {
+	shard := dict.getShard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if _, ok := shard.table.Get(key); !ok {
+		return 0
+	}
+	shard.table.Set(key, val)
+	return 1
+}
+
+func (dict *ConcurrentDict) Len() int {
+	return int(dict.count.Load())
+}
+
+func (dict *ConcurrentDict) Remove(key string) (result int) {
+	shard := dict.getShard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if !shard.table.Delete(key) {
+		return 0
+	}
+	dict.count.Add(-1)
+	return 1
+}
+
+// ForEach 逐个分片遍历, consumer 返回 false 时停止.
+// 遍历某个分片时持有它的读锁, consumer 中不能修改该字典
+func (dict *ConcurrentDict) ForEach(consumer Consumer) {
+	for _, shard := range dict.shards {
+		if !shard.forEach(consumer) {
+			return
+		}
+	}
+}
+
+func (shard *dictShard) forEach(consumer Consumer) bool {
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	for it := shard.table.Iterate(); it.Next(); {
+		if !consumer(it.Key(), it.Value()) {
+			return false
+		}
+	}
+	return true
+}
+
+func (dict *ConcurrentDict) Keys() []string {
+	keys := make([]string, 0, dict.Len())
+	dict.ForEach(func(key string, value interface{}) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// randomKey 按各分片大小加权选出一个分片, 再用 hashtable.Table.Random 在分片内选取,
+// 因此每个 key 被选中的概率大致相同.
+// sizes 和 total 是调用方取得的分片大小快照; 快照过期导致选中空分片时重试
+func (dict *ConcurrentDict) randomKey(sizes []int, total int) (string, bool) {
+	for attempt := 0; attempt < 8; attempt++ {
+		r := rand.Intn(total)
+		i := 0
+		for r >= sizes[i] {
+			r -= sizes[i]
+			i++
+		}
+		shard := dict.shards[i]
+		shard.mu.RLock()
+		key, _, ok := shard.table.Random()
+		shard.mu.RUnlock()
+		if ok {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// shardSizes 返回各分片当前的元素个数及总数
+func (dict *ConcurrentDict) shardSizes() ([]int, int) {
+	sizes := make([]int, len(dict.shards))
+	total := 0
+	for i, shard := range dict.shards {
+		shard.mu.RLock()
+		sizes[i] = shard.table.Len()
+		shard.mu.RUnlock()
+		total += sizes[i]
+	}
+	return sizes, total
+}
+
+// RandomKeys 均匀地随机返回 n 个 key, 可能重复
+func (dict *ConcurrentDict) RandomKeys(n int) []string {
+	if n <= 0 {
+		return nil
+	}
+	sizes, total := dict.shardSizes()
+	if total == 0 {
+		return nil
+	}
+	res := make([]string, 0, n)
+	for len(res) < n {
+		key, ok := dict.randomKey(sizes, total)
+		if !ok {
+			// 快照已严重过期, 重新获取
+			if sizes, total = dict.shardSizes(); total == 0 {
+				break
+			}
+			continue
+		}
+		res = append(res, key)
+	}
+	return res
+}
+
+// RandomDistinctKeys 均匀地随机返回至多 n 个互不相同的 key
+func (dict *ConcurrentDict) RandomDistinctKeys(n int) []string {
+	if n <= 0 {
+		return []string{}
+	}
+	// 要取的 key 占了大半时, 直接打乱全部 key 更快
+	if n*2 >= dict.Len() {
+		keys := dict.Keys()
+		for i := 0; i < min(len(keys), n); i++ {
+			j := i + rand.Intn(len(keys)-i)
+			keys[i], keys[j] = keys[j], keys[i]
+		}
+		return keys[:min(len(keys), n)]
+	}
+
+	sizes, total := dict.shardSizes()
+	seen := make(map[string]struct{}, n)
+	res := make([]string, 0, n)
+	for len(res) < n && len(res) < total {
+		key, ok := dict.randomKey(sizes, total)
+		if !ok {
+			sizes, total = dict.shardSizes()
+			continue
+		}
+		if _, dup := seen[key]; dup {
+			continue
+		}
+		seen[key] = struct{}{}
+		res = append(res, key)
+	}
+	return res
+}
+
+func (dict *ConcurrentDict) Clear() {
+	for _, shard := range dict.shards {
+		shard.mu.Lock()
+		dict.count.Add(-int64(shard.table.Len()))
+		shard.table = hashtable.New[interface{}](0)
+		shard.mu.Unlock()
+	}
+}
+
+// Scan 依次遍历各个分片, 在分片内用 hashtable.Table.Scan 按桶推进, 访问了大约 count 个元素后返回.
+// 游标的低 shardBits 位是当前分片的下标, 其余高位是该分片内的桶游标.
+// 分片数固定, 而桶游标在分片扩容缩容后仍然有效, 因此在整个遍历期间一直存在的 key 至少被返回一次.
+// consumer 返回 false 时, 当前桶中剩下的元素不再访问, 返回的游标从下一个桶开始
+func (dict *ConcurrentDict) Scan(cursor uint64, count int, consumer Consumer) uint64 {
+	mask := uint64(len(dict.shards) - 1)
+	index := cursor & mask
+	bucketCursor := cursor >> dict.shardBits
+	visited := 0
+	stop := false
+	for {
+		shard := dict.shards[index]
+		shard.mu.RLock()
+		bucketCursor = shard.table.Scan(bucketCursor, count-visited, func(key string, value interface{}) {
+			if stop {
+				return
+			}
+			visited++
+			stop = !consumer(key, value)
+		})
+		shard.mu.RUnlock()
+		if bucketCursor == 0 {
+			// 分片遍历完了, 转到下一个分片的第一个桶
+			index++
+			if index == uint64(len(dict.shards)) {
+				return 0
+			}
+		}
+		if stop || visited >= count {
+			return bucketCursor<<dict.shardBits | index
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package dict
+
+import (
+	"strconv"
+	"testing"
+)
+
+// TestConcurrentDictScan checks that each call visits about count entries rather than whole shards,
+// that a stable dict is returned exactly once, and that keys present for the whole scan are returned
+// even though the shards grow or shrink between calls
+func TestConcurrentDictScan(t *testing.T) {
+	d := GetConcurrentDict(16)
+	for i := 0; i < 5000; i++ {
+		d.Put("k"+strconv.Itoa(i), i)
+	}
+	seen := make(map[string]int)
+	cursor, calls := uint64(0), 0
+	for {
+		visited := 0
+		cursor = d.Scan(cursor, 10, func(key string, _ interface{}) bool {
+			seen[key]++
+			visited++
+			return true
+		})
+		calls++
+		// 一个桶里通常只有一两个元素, 每次最多多访问一个桶
+		if visited > 20 {
+			t.Fatalf("a call with COUNT 10 visited %d entries", visited)
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+	if len(seen) != 5000 {
+		t.Fatalf("scan returned %d keys, want 5000", len(seen))
+	}
+	for key, n := range seen {
+		if n != 1 {
+			t.Fatalf("%s returned %d times", key, n)
+		}
+	}
+	if calls < 5000/20 {
+		t.Fatalf("scan finished in %d calls, it isn't incremental within shards", calls)
+	}
+
+	for _, grow := range []bool{true, false} {
+		d := GetConcurrentDict(16)
+		for i := 0; i < 1000; i++ {
+			d.Put("stable:"+strconv.Itoa(i), i)
+		}
+		if !grow {
+			for i := 0; i < 10000; i++ {
+				d.Put("extra:"+strconv.Itoa(i), i)
+			}
+		}
+		seen := make(map[string]bool)
+		cursor, extra := uint64(0), 0
+		for {
+			cursor = d.Scan(cursor, 10, func(key string, _ interface{}) bool {
+				seen[key] = true
+				return true
+			})
+			if cursor == 0 {
+				break
+			}
+			// 每次调用之间插入或删除一批键, 使各分片的哈希表扩容或缩容
+			for i := 0; i < 50 && extra < 10000; i++ {
+				if grow {
+					d.Put("extra:"+strconv.Itoa(extra), extra)
+				} else {
+					d.Remove("extra:" + strconv.Itoa(extra))
+				}
+				extra++
+			}
+		}
+		for i := 0; i < 1000; i++ {
+			if !seen["stable:"+strconv.Itoa(i)] {
+				t.Fatalf("grow=%v: stable:%d was never returned", grow, i)
+			}
+		}
+	}
+}
+
+func TestConcurrentDictScanStops(t *testing.T) {
+	d := GetConcurrentDict(4)
+	for i := 0; i < 100; i++ {
+		d.Put(strconv.Itoa(i), i)
+	}
+	calls := 0
+	cursor := d.Scan(0, 50, func(string, interface{}) bool {
+		calls++
+		return false
+	})
+	if calls != 1 || cursor == 0 {
+		t.Fatalf("consumer called %d times, cursor %d, want 1 call and a cursor to continue from", calls, cursor)
+	}
+}
+
+func TestConcurrentDictOps(t *testing.T) {
+	d := GetConcurrentDict(8)
+	if d.Put("a", 1) != 1 || d.Put("a", 2) != 0 {
+		t.Fatal("Put should report only new keys")
+	}
+	if d.PutIfAbsent("a", 3) != 0 || d.PutIfAbsent("b", 3) != 1 {
+		t.Fatal("PutIfAbsent should only add missing keys")
+	}
+	if d.PutIfExists("c", 4) != 0 || d.PutIfExists("b", 4) != 1 {
+		t.Fatal("PutIfExists should only update present keys")
+	}
+	if v, _ := d.Get("a"); v != 2 {
+		t.Fatalf("a is %v, want 2", v)
+	}
+	if v, _ := d.Get("b"); v != 4 {
+		t.Fatalf("b is %v, want 4", v)
+	}
+	if d.Len() != 2 || d.Remove("a") != 1 || d.Remove("a") != 0 || d.Len() != 1 {
+		t.Fatalf("Len is %d after removing a, want 1", d.Len())
+	}
+	for _, key := range d.RandomKeys(5) {
+		if key != "b" {
+			t.Fatalf("RandomKeys returned %s", key)
+		}
+	}
+
+	d.Put("x", 1)
+	d.Clear()
+	if d.Len() != 0 || len(d.Keys()) != 0 {
+		t.Fatal("Clear left keys behind")
+	}
+}
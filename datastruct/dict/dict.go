@@ -14,4 +14,8 @@ type Dict interface {
 	RandomKeys(n int) []string
 	RandomDistinctKeys(n int) []string
 	Clear() // clear all key-value pairs
+	// Scan calls consumer for the entries at cursor and after, stopping once about count entries are visited,
+	// and returns the cursor to continue from, which is 0 when the iteration is complete.
+	// An entry present for the whole iteration is visited at least once
+	Scan(cursor uint64, count int, consumer Consumer) uint64
 }
@@ -0,0 +1,107 @@
+package dict
+
+import (
+	"math/rand"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+// The benchmarks follow the redis-benchmark runs of the benchmark report: 50 and 100 clients
+// writing key:__rand_int__ with -r 10000, that is over a keyspace of 10000 random keys
+const (
+	benchKeyspace = 10000
+	// benchShards is the shard count of the keyspace dict of a DB, database.dataDictShards
+	benchShards = 1024
+)
+
+var benchKeys = func() []string {
+	keys := make([]string, benchKeyspace)
+	for i := range keys {
+		keys[i] = "key:" + strconv.Itoa(i)
+	}
+	return keys
+}()
+
+var benchDicts = []struct {
+	name string
+	new  func() Dict
+}{
+	{"ConcurrentDict", func() Dict { return GetConcurrentDict(benchShards) }},
+	{"SyncDict", func() Dict { return GetSyncDict() }},
+}
+
+func filledDict(newDict func() Dict) Dict {
+	d := newDict()
+	for _, key := range benchKeys {
+		d.Put(key, key)
+	}
+	return d
+}
+
+// runParallel runs op on random keys from clients goroutines, like the clients of redis-benchmark
+func runParallel(b *testing.B, clients int, op func(key string)) {
+	// RunParallel starts parallelism * GOMAXPROCS goroutines
+	procs := runtime.GOMAXPROCS(0)
+	b.SetParallelism((clients + procs - 1) / procs)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		r := rand.New(rand.NewSource(rand.Int63()))
+		for pb.Next() {
+			op(benchKeys[r.Intn(benchKeyspace)])
+		}
+	})
+}
+
+// BenchmarkSet is SET key:__rand_int__ value:__rand_int__
+func BenchmarkSet(b *testing.B) {
+	for _, clients := range []int{50, 100} {
+		for _, bd := range benchDicts {
+			b.Run(bd.name+"/c="+strconv.Itoa(clients), func(b *testing.B) {
+				d := bd.new()
+				runParallel(b, clients, func(key string) { d.Put(key, key) })
+			})
+		}
+	}
+}
+
+// BenchmarkGet is GET key:__rand_int__ on a full keyspace
+func BenchmarkGet(b *testing.B) {
+	for _, clients := range []int{50, 100} {
+		for _, bd := range benchDicts {
+			b.Run(bd.name+"/c="+strconv.Itoa(clients), func(b *testing.B) {
+				d := filledDict(bd.new)
+				runParallel(b, clients, func(key string) { d.Get(key) })
+			})
+		}
+	}
+}
+
+// BenchmarkLen is DBSIZE, which SyncDict answers by iterating the whole map
+func BenchmarkLen(b *testing.B) {
+	for _, bd := range benchDicts {
+		b.Run(bd.name, func(b *testing.B) {
+			d := filledDict(bd.new)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				d.Len()
+			}
+		})
+	}
+}
+
+// BenchmarkRandomKeys is RANDOMKEY
+func BenchmarkRandomKeys(b *testing.B) {
+	for _, bd := range benchDicts {
+		b.Run(bd.name, func(b *testing.B) {
+			d := filledDict(bd.new)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				d.RandomKeys(1)
+			}
+		})
+	}
+}
@@ -2,12 +2,19 @@ package dict
 
 import (
 	"Redis_Go/lib/sync/wait"
+	"Redis_Go/lib/utils"
 	"math/rand"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// scanItem 是 Scan 中暂存的一个键值对
+type scanItem struct {
+	key   string
+	value interface{}
+}
+
 type SyncDict struct {
 	m       sync.Map
 	wg      wait.Wait
@@ -248,3 +255,20 @@ func (dict *SyncDict) Clear() {
 	_ = dict.wg.WaitWithTimeout(10 * time.Second)
 	*dict = *GetSyncDict()
 }
+
+// Scan 按 key 的哈希值顺序遍历, 游标为下一个待访问的哈希值.
+// sync.Map 没有稳定的桶结构, 因此每次调用都要遍历全部 key, 仅适合小字典
+func (dict *SyncDict) Scan(cursor uint64, count int, consumer Consumer) uint64 {
+	scanner := utils.NewScanner[scanItem](cursor)
+	dict.ForEach(func(key string, value interface{}) bool {
+		scanner.Add(key, scanItem{key: key, value: value})
+		return true
+	})
+	items, next := scanner.Page(count)
+	for _, item := range items {
+		if !consumer(item.key, item.value) {
+			break
+		}
+	}
+	return next
+}
@@ -0,0 +1,134 @@
+package hash
+
+import (
+	"slices"
+	"sort"
+	"time"
+)
+
+// Fields may carry an expiration time, kept in a side table shared by both encodings.
+// An expired field is invisible to every read but stays in storage until it is
+// overwritten, deleted, or reclaimed by RemoveExpired, so that reads never modify the hash.
+// The same times are also kept sorted in deadlines, so that Len only has to look at the earliest one
+// while no field has expired, and counts the expired fields with a binary search otherwise.
+
+// nowMillis returns the current time in unix milliseconds
+func nowMillis() int64 {
+	return time.Now().UnixMilli()
+}
+
+// exists reports whether field is stored in the hash, expired or not
+func (h *Hash) exists(field string) bool {
+	if h.encoding == encodingListpack {
+		for _, entry := range h.listpack {
+			if entry[0] == field {
+				return true
+			}
+		}
+		return false
+	}
+	_, ok := h.dict.Get(field)
+	return ok
+}
+
+// isExpired reports whether field has an expiration time that has passed
+func (h *Hash) isExpired(field string) bool {
+	if len(h.expires) == 0 {
+		return false
+	}
+	return h.isExpiredAt(field, nowMillis())
+}
+
+// isExpiredAt reports whether field has an expiration time at or before now, in unix milliseconds
+func (h *Hash) isExpiredAt(field string, now int64) bool {
+	at, ok := h.expires[field]
+	return ok && at <= now
+}
+
+// countExpired returns the number of fields that have expired but are still stored
+func (h *Hash) countExpired() int {
+	if len(h.deadlines) == 0 {
+		return 0
+	}
+	now := nowMillis()
+	if h.deadlines[0] > now {
+		return 0
+	}
+	return sort.Search(len(h.deadlines), func(i int) bool { return h.deadlines[i] > now })
+}
+
+// removeIfExpired removes field from storage if it has expired
+func (h *Hash) removeIfExpired(field string) {
+	if h.isExpired(field) {
+		h.Delete(field)
+	}
+}
+
+// SetExpire sets the expiration time of an existing field, in unix milliseconds
+func (h *Hash) SetExpire(field string, at int64) {
+	h.clearExpire(field)
+	if h.expires == nil {
+		h.expires = make(map[string]int64)
+	}
+	h.expires[field] = at
+	i, _ := slices.BinarySearch(h.deadlines, at)
+	h.deadlines = slices.Insert(h.deadlines, i, at)
+}
+
+// clearExpire removes the expiration time of field from both expires and deadlines,
+// returning whether it had one
+func (h *Hash) clearExpire(field string) bool {
+	at, ok := h.expires[field]
+	if !ok {
+		return false
+	}
+	delete(h.expires, field)
+	i, _ := slices.BinarySearch(h.deadlines, at)
+	h.deadlines = slices.Delete(h.deadlines, i, i+1)
+	if len(h.expires) == 0 {
+		h.expires = nil
+		h.deadlines = nil
+	}
+	return true
+}
+
+// ExpireTime returns the expiration time of field in unix milliseconds.
+// exists is false if the field doesn't exist, ok is false if it has no expiration time
+func (h *Hash) ExpireTime(field string) (at int64, exists bool, ok bool) {
+	if _, exists = h.Get(field); !exists {
+		return 0, false, false
+	}
+	at, ok = h.expires[field]
+	return at, true, ok
+}
+
+// Persist removes the expiration time of field, returning whether it had one
+func (h *Hash) Persist(field string) bool {
+	if _, exists := h.Get(field); !exists {
+		return false
+	}
+	return h.clearExpire(field)
+}
+
+// HasExpires reports whether any field of the hash has an expiration time
+func (h *Hash) HasExpires() bool {
+	return len(h.expires) > 0
+}
+
+// RemoveExpired deletes the expired fields from storage and returns their names
+func (h *Hash) RemoveExpired() []string {
+	if h.countExpired() == 0 {
+		return nil
+	}
+	now := nowMillis()
+	var removed []string
+	for field, at := range h.expires {
+		if at <= now {
+			removed = append(removed, field)
+		}
+	}
+	for _, field := range removed {
+		h.Delete(field)
+	}
+	return removed
+}
@@ -1,5 +1,17 @@
 package hash
 
+import (
+	"Redis_Go/datastruct/hashtable"
+	"Redis_Go/lib/codec"
+	"Redis_Go/lib/wildcard"
+	"errors"
+	"maps"
+	"math"
+	"math/rand"
+	"slices"
+	"strconv"
+)
+
 const (
 	// If the number of entries in the hash exceeds this value, it will be converted to a hash table
 	hashMaxListpackEntries = 512
@@ -13,10 +25,19 @@ const (
 	encodingHashTable
 )
 
+var (
+	ErrNotInteger = errors.New("ERR hash value is not an integer")
+	ErrNotFloat   = errors.New("ERR hash value is not a float")
+	ErrOverflow   = errors.New("ERR increment or decrement would overflow")
+	ErrNaNOrInf   = errors.New("ERR increment would produce NaN or Infinity")
+)
+
 type Hash struct {
-	encoding int         // The encoding type of the hash
-	listpack [][2]string // Using Go slice to simulate the listpack
-	dict     map[string]string
+	encoding  int         // The encoding type of the hash
+	listpack  [][2]string // Using Go slice to simulate the listpack
+	dict      *hashtable.Table[string]
+	expires   map[string]int64 // field -> expiration time in unix milliseconds, nil if no field has one
+	deadlines []int64          // the values of expires in ascending order
 }
 
 // MakeHash creates a new Hash instance
@@ -24,7 +45,6 @@ func MakeHash() *Hash {
 	return &Hash{
 		encoding: encodingListpack, // Use listpack encoding by default
 		listpack: make([][2]string, 0),
-		dict:     make(map[string]string),
 	}
 }
 
@@ -34,19 +54,35 @@ func (h *Hash) Get(field string) (val string, exists bool) {
 	if h.encoding == encodingListpack {
 		for _, entry := range h.listpack {
 			if entry[0] == field {
+				if h.isExpired(field) {
+					return "", false
+				}
 				return entry[1], true
 			}
 		}
 		return "", false
 	}
 
-	val, exists = h.dict[field]
+	val, exists = h.dict.Get(field)
+	if exists && h.isExpired(field) {
+		return "", false
+	}
 	return
 }
 
-// Set sets the value for the given key in the hash
+// Set sets the value for the given key in the hash and clears the expiration time of the field
 // If the field already exists, it updates the value and returns 0 else 1 if it is a new entry
 func (h *Hash) Set(field, value string) int {
+	expired := h.isExpired(field)
+	h.clearExpire(field)
+	if h.setValue(field, value) == 0 && !expired {
+		return 0
+	}
+	return 1
+}
+
+// setValue sets the value of field without touching its expiration time
+func (h *Hash) setValue(field, value string) int {
 	if h.encoding == encodingListpack {
 		// If the size of the listpack exceeds the maximum entries or the length of the field or value exceeds the maximum value, convert to hash table
 		if len(h.listpack) >= hashMaxListpackEntries || len(field) > hashMaxListpackValue || len(value) > hashMaxListpackValue {
@@ -68,17 +104,18 @@ func (h *Hash) Set(field, value string) int {
 		return 1
 	}
 
-	_, exsists := h.dict[field]
-	h.dict[field] = value
-	if exsists {
+	if !h.dict.Set(field, value) {
 		return 0 // Updated existing entry
 	}
 	return 1 // Added new entry
 }
 
 // Delete removes the given field from the hash
+// An expired field is removed as well but isn't counted
 func (h *Hash) Delete(field string) int {
 	count := 0
+	expired := h.isExpired(field)
+	h.clearExpire(field)
 
 	if h.encoding == encodingListpack {
 		for i, entry := range h.listpack {
@@ -94,21 +131,23 @@ func (h *Hash) Delete(field string) int {
 		}
 	} else {
 		// Delete the field from the hash table
-		if _, exists := h.dict[field]; exists {
-			delete(h.dict, field)
+		if h.dict.Delete(field) {
 			count++
 		}
 	}
 
+	if expired {
+		return 0
+	}
 	return count
 }
 
-// Len returns the number of entries in the hash
+// Len returns the number of entries in the hash, not counting expired fields
 func (h *Hash) Len() int {
 	if h.encoding == encodingListpack {
-		return len(h.listpack)
+		return len(h.listpack) - h.countExpired()
 	}
-	return len(h.dict)
+	return h.dict.Len() - h.countExpired()
 }
 
 // GetAll returns all the fields and values in the hash
@@ -117,11 +156,15 @@ func (h *Hash) GetAll() map[string]string {
 
 	if h.encoding == encodingListpack {
 		for _, entry := range h.listpack {
-			result[entry[0]] = entry[1]
+			if !h.isExpired(entry[0]) {
+				result[entry[0]] = entry[1]
+			}
 		}
 	} else {
-		for field, value := range h.dict {
-			result[field] = value
+		for it := h.dict.Iterate(); it.Next(); {
+			if !h.isExpired(it.Key()) {
+				result[it.Key()] = it.Value()
+			}
 		}
 	}
 	return result
@@ -130,16 +173,20 @@ func (h *Hash) GetAll() map[string]string {
 // Fields returns all the fields in the hash
 func (h *Hash) Fields() []string {
 	if h.encoding == encodingListpack {
-		fields := make([]string, len(h.listpack))
-		for i, entry := range h.listpack {
-			fields[i] = entry[0]
+		fields := make([]string, 0, len(h.listpack))
+		for _, entry := range h.listpack {
+			if !h.isExpired(entry[0]) {
+				fields = append(fields, entry[0])
+			}
 		}
 		return fields
 	}
 
-	fields := make([]string, 0, len(h.dict))
-	for field := range h.dict {
-		fields = append(fields, field)
+	fields := make([]string, 0, h.dict.Len())
+	for it := h.dict.Iterate(); it.Next(); {
+		if !h.isExpired(it.Key()) {
+			fields = append(fields, it.Key())
+		}
 	}
 	return fields
 }
@@ -147,16 +194,20 @@ func (h *Hash) Fields() []string {
 // Values returns all the values in the hash
 func (h *Hash) Values() []string {
 	if h.encoding == encodingListpack {
-		values := make([]string, len(h.listpack))
-		for i, entry := range h.listpack {
-			values[i] = entry[1]
+		values := make([]string, 0, len(h.listpack))
+		for _, entry := range h.listpack {
+			if !h.isExpired(entry[0]) {
+				values = append(values, entry[1])
+			}
 		}
 		return values
 	}
 
-	values := make([]string, 0, len(h.dict))
-	for _, value := range h.dict {
-		values = append(values, value)
+	values := make([]string, 0, h.dict.Len())
+	for it := h.dict.Iterate(); it.Next(); {
+		if !h.isExpired(it.Key()) {
+			values = append(values, it.Value())
+		}
 	}
 	return values
 }
@@ -167,16 +218,112 @@ func (h *Hash) Exists(field string) bool {
 	return exists
 }
 
+// StrLen returns the length of the value of field, or 0 if the field doesn't exist
+func (h *Hash) StrLen(field string) int {
+	val, _ := h.Get(field)
+	return len(val)
+}
+
+// IncrBy adds delta to the integer value of field, treating a missing field as 0.
+// The expiration time of the field is kept
+func (h *Hash) IncrBy(field string, delta int64) (int64, error) {
+	h.removeIfExpired(field)
+	var current int64
+	if val, exists := h.Get(field); exists {
+		var err error
+		current, err = strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return 0, ErrNotInteger
+		}
+	}
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return 0, ErrOverflow
+	}
+	current += delta
+	h.setValue(field, strconv.FormatInt(current, 10))
+	return current, nil
+}
+
+// IncrByFloat adds delta to the float value of field, treating a missing field as 0.
+// It returns the new value formatted as it is stored, and keeps the expiration time of the field
+func (h *Hash) IncrByFloat(field string, delta float64) (string, error) {
+	h.removeIfExpired(field)
+	var current float64
+	if val, exists := h.Get(field); exists {
+		var err error
+		current, err = strconv.ParseFloat(val, 64)
+		if err != nil || math.IsNaN(current) || math.IsInf(current, 0) {
+			return "", ErrNotFloat
+		}
+	}
+	current += delta
+	if math.IsNaN(current) || math.IsInf(current, 0) {
+		return "", ErrNaNOrInf
+	}
+	formatted := strconv.FormatFloat(current, 'f', -1, 64)
+	h.setValue(field, formatted)
+	return formatted, nil
+}
+
+// RandomFields returns count random fields.
+// If distinct is true no field is returned twice and at most Len() fields are returned
+func (h *Hash) RandomFields(count int, distinct bool) []string {
+	fields := h.Fields()
+	if len(fields) == 0 || count <= 0 {
+		return []string{}
+	}
+
+	if !distinct {
+		result := make([]string, count)
+		for i := range result {
+			result[i] = fields[rand.Intn(len(fields))]
+		}
+		return result
+	}
+
+	if count >= len(fields) {
+		return fields
+	}
+	// Partial Fisher-Yates shuffle
+	for i := 0; i < count; i++ {
+		j := i + rand.Intn(len(fields)-i)
+		fields[i], fields[j] = fields[j], fields[i]
+	}
+	return fields[:count]
+}
+
+// Scan returns about count fields (with their values) from cursor on, together with the cursor to continue
+// from, which is 0 once the scan is complete.
+// The hash table encoding is walked incrementally by hashtable.Table.Scan, so a field present for the whole
+// scan is returned at least once. A listpack is small and, as in Redis, is returned whole in a single call
+func (h *Hash) Scan(cursor uint64, count int, pattern string) (fields []string, values []string, next uint64) {
+	matcher := wildcard.CompilePattern(pattern)
+	add := func(field, value string) {
+		if !h.isExpired(field) && matcher.IsMatch(field) {
+			fields = append(fields, field)
+			values = append(values, value)
+		}
+	}
+	if h.encoding == encodingListpack {
+		for _, entry := range h.listpack {
+			add(entry[0], entry[1])
+		}
+		return fields, values, 0
+	}
+	next = h.dict.Scan(cursor, count, add)
+	return fields, values, next
+}
+
 // convertToHashTable converts the hash from listpack to hash table encoding
 func (h *Hash) convertToHashTable() {
 	if h.encoding == encodingHashTable {
 		return
 	}
 
-	h.dict = make(map[string]string, len(h.listpack))
+	h.dict = hashtable.New[string](len(h.listpack))
 
 	for _, entry := range h.listpack {
-		h.dict[entry[0]] = entry[1]
+		h.dict.Set(entry[0], entry[1])
 	}
 
 	h.encoding = encodingHashTable
@@ -189,9 +336,126 @@ func (h *Hash) Encoding() int {
 	return h.encoding
 }
 
+// Clone returns a deep copy of the hash, field expiration times included
+func (h *Hash) Clone() *Hash {
+	return &Hash{
+		encoding:  h.encoding,
+		listpack:  slices.Clone(h.listpack),
+		dict:      h.dict.Clone(),
+		expires:   maps.Clone(h.expires),
+		deadlines: slices.Clone(h.deadlines),
+	}
+}
+
 // Clear clears all entries in the hash
 func (h *Hash) Clear() {
 	h.listpack = nil
 	h.dict = nil
+	h.expires = nil
+	h.deadlines = nil
 	h.encoding = encodingListpack
 }
+
+// Marshal serializes the hash, keeping its encoding and the listpack entry order.
+// Field expiration times follow the entries; expired fields are left out.
+// Expiry is checked against a single instant, so that the counts match the entries written
+func (h *Hash) Marshal() []byte {
+	now := nowMillis()
+	var entries [][2]string
+	if h.encoding == encodingListpack {
+		for _, entry := range h.listpack {
+			if !h.isExpiredAt(entry[0], now) {
+				entries = append(entries, entry)
+			}
+		}
+	} else {
+		for it := h.dict.Iterate(); it.Next(); {
+			if !h.isExpiredAt(it.Key(), now) {
+				entries = append(entries, [2]string{it.Key(), it.Value()})
+			}
+		}
+	}
+
+	buf := make([]byte, 0, 16+len(entries)*16)
+	buf = append(buf, byte(h.encoding))
+	buf = codec.AppendUvarint(buf, uint64(len(entries)))
+	for _, entry := range entries {
+		buf = codec.AppendString(buf, entry[0])
+		buf = codec.AppendString(buf, entry[1])
+	}
+
+	var live []string
+	for field := range h.expires {
+		if !h.isExpiredAt(field, now) {
+			live = append(live, field)
+		}
+	}
+	if len(live) == 0 {
+		return buf
+	}
+	buf = codec.AppendUvarint(buf, uint64(len(live)))
+	for _, field := range live {
+		buf = codec.AppendString(buf, field)
+		buf = codec.AppendUvarint(buf, uint64(h.expires[field]))
+	}
+	return buf
+}
+
+// UnmarshalHash restores a hash serialized by Marshal
+func UnmarshalHash(data []byte) (*Hash, error) {
+	r := codec.NewReader(data)
+	encoding := int(r.ReadUint8())
+	n := r.ReadUvarint()
+	if r.Err() != nil {
+		return nil, r.Err()
+	}
+	if encoding != encodingListpack && encoding != encodingHashTable {
+		return nil, codec.ErrBadFormat
+	}
+
+	// Every entry takes at least two bytes, and a listpack holds at most hashMaxListpackEntries of them
+	if n > uint64(r.Remaining())/2 || encoding == encodingListpack && n > hashMaxListpackEntries {
+		return nil, codec.ErrBadFormat
+	}
+
+	h := MakeHash()
+	if encoding == encodingHashTable {
+		h.convertToHashTable()
+	}
+	for i := uint64(0); i < n; i++ {
+		field := r.ReadString()
+		value := r.ReadString()
+		if r.Err() != nil {
+			return nil, r.Err()
+		}
+		// Duplicate fields would make Len disagree with the entries
+		if h.exists(field) {
+			return nil, codec.ErrBadFormat
+		}
+		if h.encoding == encodingListpack {
+			h.listpack = append(h.listpack, [2]string{field, value})
+		} else {
+			h.dict.Set(field, value)
+		}
+	}
+
+	// Field expiration times are only present if some field has one
+	if r.Remaining() != 0 {
+		n = r.ReadUvarint()
+		for i := uint64(0); i < n; i++ {
+			field := r.ReadString()
+			at := r.ReadUvarint()
+			if r.Err() != nil {
+				return nil, r.Err()
+			}
+			if !h.exists(field) {
+				return nil, codec.ErrBadFormat
+			}
+			h.SetExpire(field, int64(at))
+		}
+	}
+	if r.Remaining() != 0 {
+		return nil, codec.ErrBadFormat
+	}
+	return h, nil
+}
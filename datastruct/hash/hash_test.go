@@ -0,0 +1,146 @@
+package hash
+
+import (
+	"Redis_Go/lib/codec"
+	"math/rand"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMarshalRoundTrip(t *testing.T) {
+	for _, n := range []int{0, 3, hashMaxListpackEntries, hashMaxListpackEntries + 1} {
+		h := MakeHash()
+		for i := 0; i < n; i++ {
+			h.Set("f"+strconv.Itoa(i), "v"+strconv.Itoa(i))
+		}
+		future := time.Now().Add(time.Hour).UnixMilli()
+		if n > 0 {
+			h.SetExpire("f0", future)
+		}
+		restored, err := UnmarshalHash(h.Marshal())
+		if err != nil {
+			t.Fatalf("n=%d: %v", n, err)
+		}
+		if restored.Len() != n || restored.Encoding() != h.Encoding() {
+			t.Fatalf("n=%d: restored len %d encoding %d, want %d %d", n, restored.Len(), restored.Encoding(), n, h.Encoding())
+		}
+		for i := 0; i < n; i++ {
+			field := "f" + strconv.Itoa(i)
+			if value, ok := restored.Get(field); !ok || value != "v"+strconv.Itoa(i) {
+				t.Fatalf("n=%d: %s is %q, %v", n, field, value, ok)
+			}
+		}
+		if n > 0 {
+			if at, _, ok := restored.ExpireTime("f0"); !ok || at != future {
+				t.Fatalf("n=%d: f0 expires at %d, %v, want %d", n, at, ok, future)
+			}
+		}
+	}
+}
+
+func TestMarshalLeavesOutExpiredFields(t *testing.T) {
+	h := MakeHash()
+	h.Set("live", "1")
+	h.Set("dead", "2")
+	h.SetExpire("dead", time.Now().Add(-time.Second).UnixMilli())
+	restored, err := UnmarshalHash(h.Marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Len() != 1 || restored.Exists("dead") || restored.HasExpires() {
+		t.Fatalf("restored len %d, dead exists %v, has expires %v", restored.Len(), restored.Exists("dead"), restored.HasExpires())
+	}
+}
+
+// payload builds a Marshal payload from fields and values, which Marshal itself would never produce
+func payload(encoding int, n uint64, fields ...string) []byte {
+	buf := []byte{byte(encoding)}
+	buf = codec.AppendUvarint(buf, n)
+	for _, field := range fields {
+		buf = codec.AppendString(buf, field)
+		buf = codec.AppendString(buf, "v")
+	}
+	return buf
+}
+
+func TestUnmarshalRejectsBadPayloads(t *testing.T) {
+	tooLong := make([]string, hashMaxListpackEntries+1)
+	for i := range tooLong {
+		tooLong[i] = strconv.Itoa(i)
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"huge count", payload(encodingListpack, 1<<40)},
+		{"huge count hash table", payload(encodingHashTable, 1<<40)},
+		{"count past the data", payload(encodingHashTable, 3, "a")},
+		{"unknown encoding", payload(7, 0)},
+		{"duplicate in listpack", payload(encodingListpack, 2, "a", "a")},
+		{"duplicate in hash table", payload(encodingHashTable, 2, "a", "a")},
+		{"listpack too long", payload(encodingListpack, uint64(len(tooLong)), tooLong...)},
+	}
+	for _, tt := range tests {
+		if _, err := UnmarshalHash(tt.data); err == nil {
+			t.Errorf("%s: payload accepted", tt.name)
+		}
+	}
+}
+
+// TestLenCountsExpiredFields checks Len and the sorted deadlines against a plain count over expires
+// while fields are set, expired, persisted and deleted at random
+func TestLenCountsExpiredFields(t *testing.T) {
+	h := MakeHash()
+	r := rand.New(rand.NewSource(1))
+	now := nowMillis()
+	for i := 0; i < 5000; i++ {
+		field := "f" + strconv.Itoa(r.Intn(300))
+		switch r.Intn(5) {
+		case 0:
+			h.Set(field, "v")
+		case 1:
+			if h.exists(field) {
+				// 一半已经过期, 一半一小时后过期
+				h.SetExpire(field, now+int64(r.Intn(2)*2-1)*int64(r.Intn(3600000)+1))
+			}
+		case 2:
+			h.Persist(field)
+		case 3:
+			h.Delete(field)
+		default:
+			h.setValue(field, "v")
+		}
+
+		stored := len(h.listpack)
+		if h.encoding == encodingHashTable {
+			stored = h.dict.Len()
+		}
+		expired := 0
+		var deadlines []int64
+		for _, at := range h.expires {
+			deadlines = append(deadlines, at)
+			if at <= nowMillis() {
+				expired++
+			}
+		}
+		slices.Sort(deadlines)
+		if !slices.Equal(deadlines, h.deadlines) {
+			t.Fatalf("step %d: deadlines %v, want %v", i, h.deadlines, deadlines)
+		}
+		if h.Len() != stored-expired {
+			t.Fatalf("step %d: Len is %d, want %d", i, h.Len(), stored-expired)
+		}
+	}
+
+	h.RemoveExpired()
+	for _, at := range h.deadlines {
+		if at <= nowMillis() {
+			t.Fatalf("RemoveExpired left a deadline at %d", at)
+		}
+	}
+	if len(h.deadlines) != len(h.expires) {
+		t.Fatalf("%d deadlines for %d expiration times", len(h.deadlines), len(h.expires))
+	}
+}
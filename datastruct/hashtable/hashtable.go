@@ -0,0 +1,215 @@
+// Package hashtable implements the hashtable encoding of sets, hashes and sorted sets, and the shards of
+// the keyspace dict.
+//
+// It is a chained hash table with a power of two number of buckets, like the dict of Redis. Unlike a Go map
+// it exposes its buckets, so that Scan can walk them with a cursor that survives inserts, removals and
+// resizes between calls. Tables aren't safe for concurrent use, their owners are guarded by the key locks
+// or, in dict.ConcurrentDict, by the shard locks.
+package hashtable
+
+import (
+	"hash/maphash"
+	"math/bits"
+	"math/rand"
+)
+
+const (
+	minBuckets = 4
+	// shrinkRatio is the load below which a table halves its buckets, as Redis shrinks under 1/8 full
+	shrinkRatio = 8
+)
+
+// seed is shared by all tables, so that a member falls in the same bucket of tables of the same size
+var seed = maphash.MakeSeed()
+
+type entry[V any] struct {
+	key   string
+	value V
+	next  *entry[V]
+}
+
+// Table maps strings to values of type V
+type Table[V any] struct {
+	buckets []*entry[V]
+	count   int
+}
+
+// New creates a table sized for hint entries
+func New[V any](hint int) *Table[V] {
+	return &Table[V]{buckets: make([]*entry[V], bucketsFor(hint))}
+}
+
+// bucketsFor returns the smallest power of two holding n entries at a load of 1
+func bucketsFor(n int) int {
+	size := minBuckets
+	for size < n {
+		size <<= 1
+	}
+	return size
+}
+
+func (t *Table[V]) bucket(key string) int {
+	return int(maphash.String(seed, key) & uint64(len(t.buckets)-1))
+}
+
+// Len returns the number of entries
+func (t *Table[V]) Len() int {
+	return t.count
+}
+
+// Get returns the value of key
+func (t *Table[V]) Get(key string) (value V, ok bool) {
+	for e := t.buckets[t.bucket(key)]; e != nil; e = e.next {
+		if e.key == key {
+			return e.value, true
+		}
+	}
+	return value, false
+}
+
+// Set sets the value of key and reports whether key is new
+func (t *Table[V]) Set(key string, value V) bool {
+	idx := t.bucket(key)
+	for e := t.buckets[idx]; e != nil; e = e.next {
+		if e.key == key {
+			e.value = value
+			return false
+		}
+	}
+	t.buckets[idx] = &entry[V]{key: key, value: value, next: t.buckets[idx]}
+	t.count++
+	if t.count > len(t.buckets) {
+		t.resize(len(t.buckets) * 2)
+	}
+	return true
+}
+
+// Delete removes key and reports whether it was present
+func (t *Table[V]) Delete(key string) bool {
+	for p := &t.buckets[t.bucket(key)]; *p != nil; p = &(*p).next {
+		if (*p).key == key {
+			*p = (*p).next
+			t.count--
+			if len(t.buckets) > minBuckets && t.count < len(t.buckets)/shrinkRatio {
+				t.resize(bucketsFor(t.count))
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// resize rehashes all the entries into size buckets at once, so that the table is never half rehashed
+// when Scan runs
+func (t *Table[V]) resize(size int) {
+	old := t.buckets
+	t.buckets = make([]*entry[V], size)
+	for _, e := range old {
+		for e != nil {
+			next := e.next
+			idx := t.bucket(e.key)
+			e.next = t.buckets[idx]
+			t.buckets[idx] = e
+			e = next
+		}
+	}
+}
+
+// Clone returns a copy of the table, nil for a nil table
+func (t *Table[V]) Clone() *Table[V] {
+	if t == nil {
+		return nil
+	}
+	clone := &Table[V]{buckets: make([]*entry[V], len(t.buckets)), count: t.count}
+	for i, e := range t.buckets {
+		for ; e != nil; e = e.next {
+			clone.buckets[i] = &entry[V]{key: e.key, value: e.value, next: clone.buckets[i]}
+		}
+	}
+	return clone
+}
+
+// Iterator walks the entries of a table, which must not be modified meanwhile
+type Iterator[V any] struct {
+	table  *Table[V]
+	bucket int
+	cur    *entry[V]
+}
+
+// Iterate returns an iterator positioned before the first entry
+func (t *Table[V]) Iterate() *Iterator[V] {
+	return &Iterator[V]{table: t, bucket: -1}
+}
+
+// Next moves to the next entry and reports whether there is one
+func (it *Iterator[V]) Next() bool {
+	if it.cur != nil {
+		it.cur = it.cur.next
+	}
+	for it.cur == nil {
+		it.bucket++
+		if it.bucket >= len(it.table.buckets) {
+			return false
+		}
+		it.cur = it.table.buckets[it.bucket]
+	}
+	return true
+}
+
+// Key returns the key of the current entry
+func (it *Iterator[V]) Key() string {
+	return it.cur.key
+}
+
+// Value returns the value of the current entry
+func (it *Iterator[V]) Value() V {
+	return it.cur.value
+}
+
+// Random returns a random entry: a random non-empty bucket, then a random entry of its chain.
+// Chains are short at a load of at most 1, so this is close to uniform, as in Redis
+func (t *Table[V]) Random() (key string, value V, ok bool) {
+	if t.count == 0 {
+		return "", value, false
+	}
+	var head *entry[V]
+	for head == nil {
+		head = t.buckets[rand.Intn(len(t.buckets))]
+	}
+	n := 0
+	for e := head; e != nil; e = e.next {
+		n++
+	}
+	e := head
+	for i := rand.Intn(n); i > 0; i-- {
+		e = e.next
+	}
+	return e.key, e.value, true
+}
+
+// Scan calls fn for the entries of the buckets from cursor on, until about count entries are visited,
+// and returns the cursor to continue from, 0 once the scan is complete.
+//
+// Buckets are visited in the order of the reversed bits of their index, as Redis's dictScan does. When the
+// table grows, the buckets a visited bucket splits into have all been visited too, and when it shrinks,
+// a bucket already visited may only be merged into one visited again. So an entry present for the whole
+// scan is returned at least once, and it is returned more than once only if the table shrinks meanwhile
+func (t *Table[V]) Scan(cursor uint64, count int, fn func(key string, value V)) uint64 {
+	if t.count == 0 {
+		return 0
+	}
+	mask := uint64(len(t.buckets) - 1)
+	visited := 0
+	for {
+		for e := t.buckets[cursor&mask]; e != nil; e = e.next {
+			fn(e.key, e.value)
+			visited++
+		}
+		// 对 cursor 的高位部分做反向二进制加一
+		cursor |= ^mask
+		cursor = bits.Reverse64(bits.Reverse64(cursor) + 1)
+		if cursor == 0 || visited >= count {
+			return cursor
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package hashtable
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestTableMatchesMap(t *testing.T) {
+	table := New[int](0)
+	want := make(map[string]int)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20000; i++ {
+		key := strconv.Itoa(r.Intn(2000))
+		if r.Intn(3) == 0 {
+			_, existed := want[key]
+			if table.Delete(key) != existed {
+				t.Fatalf("Delete(%s) reported %v", key, !existed)
+			}
+			delete(want, key)
+			continue
+		}
+		_, existed := want[key]
+		if table.Set(key, i) == existed {
+			t.Fatalf("Set(%s) reported new=%v", key, existed)
+		}
+		want[key] = i
+	}
+
+	if table.Len() != len(want) {
+		t.Fatalf("Len is %d, want %d", table.Len(), len(want))
+	}
+	seen := 0
+	for it := table.Iterate(); it.Next(); {
+		if v, ok := want[it.Key()]; !ok || v != it.Value() {
+			t.Fatalf("iterated %s=%d, want %d", it.Key(), it.Value(), v)
+		}
+		seen++
+	}
+	if seen != len(want) {
+		t.Fatalf("iterated %d entries, want %d", seen, len(want))
+	}
+	clone := table.Clone()
+	for key, v := range want {
+		if got, ok := clone.Get(key); !ok || got != v {
+			t.Fatalf("clone has %s=%d, want %d", key, got, v)
+		}
+	}
+}
+
+// TestScanSurvivesResize checks that keys present for the whole scan are returned even though the table
+// grows and shrinks between calls, and that a scan of a stable table returns every key once
+func TestScanSurvivesResize(t *testing.T) {
+	for _, grow := range []bool{true, false} {
+		table := New[struct{}](0)
+		for i := 0; i < 1000; i++ {
+			table.Set("stable:"+strconv.Itoa(i), struct{}{})
+		}
+		if !grow {
+			for i := 0; i < 10000; i++ {
+				table.Set("extra:"+strconv.Itoa(i), struct{}{})
+			}
+		}
+
+		seen := make(map[string]int)
+		cursor, calls, extra := uint64(0), 0, 0
+		for {
+			cursor = table.Scan(cursor, 10, func(key string, _ struct{}) { seen[key]++ })
+			calls++
+			if cursor == 0 {
+				break
+			}
+			// 每次调用之间插入或删除一批键, 使哈希表扩容或缩容, 共 10000 个
+			for i := 0; i < 100 && extra < 10000; i++ {
+				if grow {
+					table.Set("extra:"+strconv.Itoa(extra), struct{}{})
+				} else {
+					table.Delete("extra:" + strconv.Itoa(extra))
+				}
+				extra++
+			}
+		}
+		for i := 0; i < 1000; i++ {
+			if seen["stable:"+strconv.Itoa(i)] == 0 {
+				t.Fatalf("grow=%v: stable:%d was never returned", grow, i)
+			}
+		}
+		if calls < 10 {
+			t.Fatalf("grow=%v: scan finished in %d calls, it isn't incremental", grow, calls)
+		}
+	}
+
+	table := New[struct{}](0)
+	for i := 0; i < 1000; i++ {
+		table.Set(strconv.Itoa(i), struct{}{})
+	}
+	seen := make(map[string]int)
+	for cursor := table.Scan(0, 1, func(key string, _ struct{}) { seen[key]++ }); cursor != 0; {
+		cursor = table.Scan(cursor, 1, func(key string, _ struct{}) { seen[key]++ })
+	}
+	for key, n := range seen {
+		if n != 1 {
+			t.Fatalf("%s returned %d times", key, n)
+		}
+	}
+	if len(seen) != 1000 {
+		t.Fatalf("scan returned %d keys, want 1000", len(seen))
+	}
+}
@@ -0,0 +1,320 @@
+// Package hyperloglog implements the HyperLogLog cardinality estimator of Redis, using the same
+// byte layout so that the values can be stored as plain strings and exchanged with Redis.
+//
+// A HyperLogLog has 2^14 registers of 6 bits each, which gives a standard error of 0.81%.
+// It starts in the sparse representation, a run length encoding of the registers,
+// and is converted to the dense one, the registers packed 6 bits each, once it grows too large.
+//
+// The 16 byte header is the magic "HYLL", the encoding, 3 unused bytes and the cached cardinality
+// as a little endian uint64 whose most significant bit marks the cache as stale.
+//
+// Functions that modify a HyperLogLog do so in place and may return a different slice,
+// so callers that share the value must pass a copy
+package hyperloglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+const (
+	precision     = 14
+	registerCount = 1 << precision
+	registerBits  = 6
+	registerMax   = 1<<registerBits - 1
+	// q is the number of hash bits used for counting leading zeros
+	q = 64 - precision
+
+	headerSize = 16
+	denseSize  = headerSize + (registerCount*registerBits+7)/8
+
+	encodingDense  = 0
+	encodingSparse = 1
+
+	// sparseMaxBytes is the size above which a sparse HyperLogLog is converted to dense,
+	// the default of hll-sparse-max-bytes
+	sparseMaxBytes = 3000
+
+	sparseValMax      = 32
+	sparseValMaxLen   = 4
+	sparseZeroMaxLen  = 64
+	sparseXZeroMaxLen = 16384
+
+	hashSeed = 0xadc83b19
+	alphaInf = 0.721347520444481703680 // 1 / (2 ln 2)
+)
+
+var magic = []byte("HYLL")
+
+// New returns an empty HyperLogLog in the sparse representation
+func New() []byte {
+	buf := make([]byte, headerSize, headerSize+2)
+	copy(buf, magic)
+	buf[4] = encodingSparse
+	return appendZeros(buf, registerCount)
+}
+
+// Valid reports whether buf holds a well formed HyperLogLog
+func Valid(buf []byte) bool {
+	if len(buf) < headerSize || !bytes.Equal(buf[:4], magic) {
+		return false
+	}
+	switch buf[4] {
+	case encodingDense:
+		return len(buf) == denseSize
+	case encodingSparse:
+		covered := 0
+		for p := headerSize; p < len(buf); {
+			op, ok := readOp(buf, p)
+			if !ok {
+				return false
+			}
+			covered += op.length
+			p += op.size
+		}
+		return covered == registerCount
+	}
+	return false
+}
+
+// IsSparse reports whether buf uses the sparse representation
+func IsSparse(buf []byte) bool {
+	return buf[4] == encodingSparse
+}
+
+// CachedCount returns the cardinality cached in the header, ok is false if the cache is stale
+func CachedCount(buf []byte) (count uint64, ok bool) {
+	if buf[15]&0x80 != 0 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint64(buf[8:16]), true
+}
+
+// SetCachedCount stores count as the cached cardinality
+func SetCachedCount(buf []byte, count uint64) {
+	binary.LittleEndian.PutUint64(buf[8:16], count)
+}
+
+func invalidateCache(buf []byte) {
+	buf[15] |= 0x80
+}
+
+// Add adds element to the HyperLogLog and reports whether a register changed,
+// in which case the cached cardinality is invalidated
+func Add(buf []byte, element []byte) ([]byte, bool) {
+	index, count := hashElement(element)
+	var changed bool
+	if buf[4] == encodingDense {
+		changed = setDense(buf[headerSize:], index, count)
+	} else {
+		buf, changed = setSparse(buf, index, count)
+	}
+	if changed {
+		invalidateCache(buf)
+	}
+	return buf, changed
+}
+
+// Count estimates the cardinality of buf, ignoring the cache
+func Count(buf []byte) uint64 {
+	var regs Registers
+	regs.Merge(buf)
+	return regs.Count()
+}
+
+// murmurHash64A is the 64 bit MurmurHash2 Redis uses to hash HyperLogLog elements
+func murmurHash64A(key []byte, seed uint64) uint64 {
+	const m = 0xc6a4a7935bd1e995
+	const r = 47
+	h := seed ^ uint64(len(key))*m
+
+	for len(key) >= 8 {
+		k := binary.LittleEndian.Uint64(key)
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+		key = key[8:]
+	}
+	if len(key) > 0 {
+		for i := len(key) - 1; i >= 0; i-- {
+			h ^= uint64(key[i]) << (8 * uint(i))
+		}
+		h *= m
+	}
+
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
+
+// hashElement returns the register element falls into and the value it proposes for it,
+// the length of the run of zeros in the rest of the hash plus one
+func hashElement(element []byte) (index int, count uint8) {
+	hash := murmurHash64A(element, hashSeed)
+	index = int(hash & (registerCount - 1))
+	hash >>= precision
+	hash |= 1 << q // 保证循环一定结束
+	count = 1
+	for bit := uint64(1); hash&bit == 0; bit <<= 1 {
+		count++
+	}
+	return index, count
+}
+
+// getDense returns register i of the dense registers regs
+func getDense(regs []byte, i int) uint8 {
+	pos := i * registerBits
+	b, fb := pos/8, uint(pos&7)
+	value := uint16(regs[b]) >> fb
+	if b+1 < len(regs) {
+		value |= uint16(regs[b+1]) << (8 - fb)
+	}
+	return uint8(value & registerMax)
+}
+
+// setDense raises register i of the dense registers regs to count, reporting whether it changed
+func setDense(regs []byte, i int, count uint8) bool {
+	if getDense(regs, i) >= count {
+		return false
+	}
+	pos := i * registerBits
+	b, fb := pos/8, uint(pos&7)
+	regs[b] &^= registerMax << fb
+	regs[b] |= count << fb
+	if b+1 < len(regs) {
+		regs[b+1] &^= registerMax >> (8 - fb)
+		regs[b+1] |= count >> (8 - fb)
+	}
+	return true
+}
+
+// estimate computes the cardinality from a histogram of the register values,
+// with the estimator of Otmar Ertl used by Redis
+func estimate(histogram *[registerMax + 1]int) uint64 {
+	m := float64(registerCount)
+	z := m * tau((m-float64(histogram[q+1]))/m)
+	for j := q; j >= 1; j-- {
+		z += float64(histogram[j])
+		z *= 0.5
+	}
+	z += m * sigma(float64(histogram[0])/m)
+	return uint64(math.Round(alphaInf * m * m / z))
+}
+
+func sigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y, z := 1.0, x
+	for {
+		x *= x
+		zPrime := z
+		z += x * y
+		y += y
+		if zPrime == z {
+			return z
+		}
+	}
+}
+
+func tau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y, z := 1.0, 1-x
+	for {
+		x = math.Sqrt(x)
+		zPrime := z
+		y *= 0.5
+		z -= (1 - x) * (1 - x) * y
+		if zPrime == z {
+			return z / 3
+		}
+	}
+}
+
+// Registers holds decoded registers, used to count and merge HyperLogLogs
+type Registers [registerCount]uint8
+
+// Merge raises every register to its value in buf, which must be valid
+func (r *Registers) Merge(buf []byte) {
+	if buf[4] == encodingDense {
+		regs := buf[headerSize:]
+		for i := range r {
+			r[i] = max(r[i], getDense(regs, i))
+		}
+		return
+	}
+
+	i := 0
+	for p := headerSize; p < len(buf); {
+		op, _ := readOp(buf, p)
+		if op.value > 0 {
+			for end := i + op.length; i < end; i++ {
+				r[i] = max(r[i], op.value)
+			}
+		} else {
+			i += op.length
+		}
+		p += op.size
+	}
+}
+
+// Count estimates the cardinality of the registers
+func (r *Registers) Count() uint64 {
+	var histogram [registerMax + 1]int
+	for _, value := range r {
+		histogram[value]++
+	}
+	return estimate(&histogram)
+}
+
+// Encode returns a HyperLogLog holding the registers, with a stale cache.
+// It uses the sparse representation if sparse is true and the registers fit in it
+func (r *Registers) Encode(sparse bool) []byte {
+	if sparse {
+		if buf, ok := r.encodeSparse(); ok {
+			return buf
+		}
+	}
+	buf := make([]byte, denseSize)
+	copy(buf, magic)
+	buf[4] = encodingDense
+	for i, value := range r {
+		setDense(buf[headerSize:], i, value)
+	}
+	invalidateCache(buf)
+	return buf
+}
+
+func (r *Registers) encodeSparse() ([]byte, bool) {
+	buf := make([]byte, headerSize, headerSize+64)
+	copy(buf, magic)
+	buf[4] = encodingSparse
+	invalidateCache(buf)
+
+	for i := 0; i < registerCount; {
+		value := r[i]
+		if value > sparseValMax {
+			return nil, false
+		}
+		run := 1
+		for i+run < registerCount && r[i+run] == value {
+			run++
+		}
+		if value == 0 {
+			buf = appendZeros(buf, run)
+		} else {
+			buf = appendVal(buf, value, run)
+		}
+		if len(buf) > sparseMaxBytes {
+			return nil, false
+		}
+		i += run
+	}
+	return buf, true
+}
@@ -0,0 +1,90 @@
+package hyperloglog
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+// stdError is the standard error of a HyperLogLog with 2^14 registers, 1.04 / sqrt(m)
+var stdError = 1.04 / math.Sqrt(registerCount)
+
+func TestCountAccuracy(t *testing.T) {
+	for _, n := range []int{10, 100, 1000, 10000, 100000, 1000000} {
+		buf := New()
+		for i := 0; i < n; i++ {
+			buf, _ = Add(buf, []byte("element:"+strconv.Itoa(i)))
+		}
+		if !Valid(buf) {
+			t.Fatalf("n=%d: invalid HyperLogLog", n)
+		}
+		// 哈希是确定的, 所以误差也是; 允许 3 个标准误差
+		got := Count(buf)
+		if diff := math.Abs(float64(got)-float64(n)) / float64(n); diff > 3*stdError {
+			t.Errorf("n=%d: count %d is off by %.2f%%, want within %.2f%%", n, got, diff*100, 3*stdError*100)
+		}
+	}
+}
+
+func TestAddDuplicates(t *testing.T) {
+	buf := New()
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 1000; i++ {
+			var changed bool
+			buf, changed = Add(buf, []byte(strconv.Itoa(i)))
+			if round > 0 && changed {
+				t.Fatalf("round %d: adding %d again changed a register", round, i)
+			}
+		}
+	}
+	if got := Count(buf); math.Abs(float64(got)-1000)/1000 > 3*stdError {
+		t.Fatalf("count %d, want about 1000", got)
+	}
+}
+
+func TestSparseToDense(t *testing.T) {
+	buf := New()
+	var last []byte
+	for n := 0; IsSparse(buf); n++ {
+		last = append(last[:0], buf...)
+		buf, _ = Add(buf, []byte(strconv.Itoa(n)))
+	}
+	if len(buf) != denseSize || !Valid(buf) {
+		t.Fatalf("dense size %d, want %d", len(buf), denseSize)
+	}
+
+	// 同样的寄存器在稀疏和稠密表示下估计值相同
+	var regs Registers
+	regs.Merge(last)
+	dense := regs.Encode(false)
+	if IsSparse(dense) || !Valid(dense) {
+		t.Fatal("Encode(false) didn't return a valid dense HyperLogLog")
+	}
+	if Count(dense) != Count(last) {
+		t.Fatalf("dense count %d, sparse count %d", Count(dense), Count(last))
+	}
+}
+
+func TestMergeUnion(t *testing.T) {
+	// 三个有重叠的集合: [0, 6000), [4000, 10000), [8000, 14000), 并集有 14000 个元素
+	var regs Registers
+	for k := 0; k < 3; k++ {
+		buf := New()
+		for i := k * 4000; i < k*4000+6000; i++ {
+			buf, _ = Add(buf, []byte(strconv.Itoa(i)))
+		}
+		regs.Merge(buf)
+	}
+	got := regs.Count()
+	if diff := math.Abs(float64(got)-14000) / 14000; diff > 3*stdError {
+		t.Fatalf("union count %d is off by %.2f%%", got, diff*100)
+	}
+
+	all := New()
+	for i := 0; i < 14000; i++ {
+		all, _ = Add(all, []byte(strconv.Itoa(i)))
+	}
+	if got != Count(all) {
+		t.Fatalf("merged count %d, count of the union %d", got, Count(all))
+	}
+}
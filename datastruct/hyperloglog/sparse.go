@@ -0,0 +1,132 @@
+package hyperloglog
+
+// The sparse representation is a sequence of opcodes, each covering a run of registers:
+//
+//	ZERO  00xxxxxx           xxxxxx+1 registers (1 to 64) set to 0
+//	XZERO 01xxxxxx yyyyyyyy  xxxxxxyyyyyyyy+1 registers (1 to 16384) set to 0
+//	VAL   1vvvvvxx           xx+1 registers (1 to 4) set to vvvvv+1 (1 to 32)
+
+// sparseOp is a decoded opcode
+type sparseOp struct {
+	value  uint8 // 0 for ZERO and XZERO
+	length int   // number of registers covered
+	size   int   // number of bytes of the opcode
+}
+
+// readOp decodes the opcode at buf[p], ok is false if it is truncated
+func readOp(buf []byte, p int) (op sparseOp, ok bool) {
+	b := buf[p]
+	switch {
+	case b&0xc0 == 0x00:
+		return sparseOp{length: int(b&0x3f) + 1, size: 1}, true
+	case b&0xc0 == 0x40:
+		if p+1 >= len(buf) {
+			return op, false
+		}
+		return sparseOp{length: (int(b&0x3f)<<8 | int(buf[p+1])) + 1, size: 2}, true
+	}
+	return sparseOp{value: (b>>2)&0x1f + 1, length: int(b&0x3) + 1, size: 1}, true
+}
+
+// appendZeros appends opcodes setting n registers to 0
+func appendZeros(buf []byte, n int) []byte {
+	for n > 0 {
+		run := min(n, sparseXZeroMaxLen)
+		if run <= sparseZeroMaxLen {
+			buf = append(buf, byte(run-1))
+		} else {
+			buf = append(buf, byte((run-1)>>8)|0x40, byte(run-1))
+		}
+		n -= run
+	}
+	return buf
+}
+
+// appendVal appends opcodes setting n registers to value, which must be at most sparseValMax
+func appendVal(buf []byte, value uint8, n int) []byte {
+	for n > 0 {
+		run := min(n, sparseValMaxLen)
+		buf = append(buf, valOpcode(value, run))
+		n -= run
+	}
+	return buf
+}
+
+func valOpcode(value uint8, n int) byte {
+	return 0x80 | (value-1)<<2 | byte(n-1)
+}
+
+// appendRun appends opcodes setting n registers to value
+func appendRun(buf []byte, value uint8, n int) []byte {
+	if value == 0 {
+		return appendZeros(buf, n)
+	}
+	return appendVal(buf, value, n)
+}
+
+// setSparse raises register index of the sparse HyperLogLog buf to count, reporting whether it changed.
+// The HyperLogLog is converted to dense if count doesn't fit a VAL opcode or it grows past sparseMaxBytes
+func setSparse(buf []byte, index int, count uint8) ([]byte, bool) {
+	// 找到覆盖 index 的操作码
+	p, first := headerSize, 0
+	var op sparseOp
+	for p < len(buf) {
+		op, _ = readOp(buf, p)
+		if index < first+op.length {
+			break
+		}
+		first += op.length
+		p += op.size
+	}
+	if op.value >= count {
+		return buf, false
+	}
+	if count > sparseValMax {
+		return toDenseWith(buf, index, count), true
+	}
+
+	// 把该操作码拆成 前段 + 新值 + 后段
+	var seq []byte
+	seq = appendRun(seq, op.value, index-first)
+	seq = appendVal(seq, count, 1)
+	seq = appendRun(seq, op.value, first+op.length-index-1)
+
+	result := make([]byte, 0, len(buf)+len(seq))
+	result = append(result, buf[:p]...)
+	result = append(result, seq...)
+	result = append(result, buf[p+op.size:]...)
+	result = mergeVals(result)
+	if len(result) > sparseMaxBytes {
+		return toDenseWith(result, -1, 0), true
+	}
+	return result, true
+}
+
+// mergeVals joins adjacent VAL opcodes of the same value, as long as the result fits a single opcode.
+// It compacts buf in place
+func mergeVals(buf []byte) []byte {
+	out := buf[:headerSize]
+	var prev sparseOp
+	for p := headerSize; p < len(buf); {
+		op, _ := readOp(buf, p)
+		if op.value > 0 && op.value == prev.value && prev.length+op.length <= sparseValMaxLen {
+			prev.length += op.length
+			out[len(out)-1] = valOpcode(prev.value, prev.length)
+		} else {
+			out = append(out, buf[p:p+op.size]...)
+			prev = op
+		}
+		p += op.size
+	}
+	return out
+}
+
+// toDenseWith converts the sparse HyperLogLog buf to dense, then raises register index to count if index >= 0
+func toDenseWith(buf []byte, index int, count uint8) []byte {
+	var regs Registers
+	regs.Merge(buf)
+	if index >= 0 {
+		regs[index] = max(regs[index], count)
+	}
+	return regs.Encode(false)
+}
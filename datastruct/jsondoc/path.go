@@ -0,0 +1,440 @@
+package jsondoc
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Path is a parsed JSONPath. The supported subset is the root $ followed by any of
+//
+//	.name ["name"] ['name']   child of an object
+//	.* [*]                    every child of an object or array
+//	[i] [i,j] ["a","b"]       elements of an array, negative indexes counting from the end, or children of an object
+//	[start:end:step]          slice of an array
+//	..name ..* ..[...]        recursive descent: the same, applied to the value and all its descendants
+//
+// Paths not starting with $ are legacy paths, like .a.b or a[0], where "." alone is the root.
+// Commands reply to a legacy path with the first value it matches rather than an array of all of them
+type Path struct {
+	text     string
+	Legacy   bool
+	segments []segment
+}
+
+type segment struct {
+	recursive bool
+	sel       selector
+}
+
+type selectorKind int
+
+const (
+	selectName selectorKind = iota
+	selectWildcard
+	selectUnion // names and indexes
+	selectSlice
+)
+
+type selector struct {
+	kind selectorKind
+	name string
+	// union
+	names   []string
+	indexes []int
+	// slice
+	start, end, step int
+	hasStart, hasEnd bool
+}
+
+// ErrPathSyntax is returned for paths outside of the supported subset
+var ErrPathSyntax = errors.New("ERR invalid JSONPath syntax")
+
+// ParsePath parses a JSONPath, or a legacy path if it doesn't start with $
+func ParsePath(text string) (*Path, error) {
+	p := &Path{text: text}
+	s := text
+	switch {
+	case strings.HasPrefix(s, "$"):
+		s = s[1:]
+	case s == ".":
+		p.Legacy, s = true, ""
+	case strings.HasPrefix(s, ".") || strings.HasPrefix(s, "["):
+		p.Legacy = true
+	default:
+		p.Legacy, s = true, "."+s
+	}
+
+	for len(s) > 0 {
+		var seg segment
+		switch {
+		case strings.HasPrefix(s, ".."):
+			seg.recursive = true
+			s = s[2:]
+			if strings.HasPrefix(s, "[") {
+				break
+			}
+			fallthrough
+		case strings.HasPrefix(s, "."):
+			s = strings.TrimPrefix(s, ".")
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			name := s[:end]
+			s = s[end:]
+			switch name {
+			case "":
+				return nil, ErrPathSyntax
+			case "*":
+				seg.sel = selector{kind: selectWildcard}
+			default:
+				seg.sel = selector{kind: selectName, name: name}
+			}
+			p.segments = append(p.segments, seg)
+			continue
+		case !strings.HasPrefix(s, "["):
+			return nil, ErrPathSyntax
+		}
+
+		sel, rest, err := parseBracket(s[1:])
+		if err != nil {
+			return nil, err
+		}
+		seg.sel, s = sel, rest
+		p.segments = append(p.segments, seg)
+	}
+	return p, nil
+}
+
+// parseBracket parses the selector after a "[" up to and including the closing "]"
+func parseBracket(s string) (selector, string, error) {
+	s = strings.TrimLeft(s, " ")
+	if rest, ok := strings.CutPrefix(s, "*"); ok {
+		rest = strings.TrimLeft(rest, " ")
+		if !strings.HasPrefix(rest, "]") {
+			return selector{}, "", ErrPathSyntax
+		}
+		return selector{kind: selectWildcard}, rest[1:], nil
+	}
+
+	sel := selector{kind: selectUnion}
+	for {
+		s = strings.TrimLeft(s, " ")
+		if s == "" {
+			return selector{}, "", ErrPathSyntax
+		}
+		if s[0] == '"' || s[0] == '\'' {
+			name, rest, err := parseQuoted(s)
+			if err != nil {
+				return selector{}, "", err
+			}
+			sel.names = append(sel.names, name)
+			s = rest
+		} else {
+			end := strings.IndexAny(s, ",]")
+			if end < 0 {
+				return selector{}, "", ErrPathSyntax
+			}
+			item := strings.TrimSpace(s[:end])
+			if strings.Contains(item, ":") {
+				// 切片只能单独出现
+				if len(sel.names) > 0 || len(sel.indexes) > 0 || s[end] != ']' {
+					return selector{}, "", ErrPathSyntax
+				}
+				slice, err := parseSlice(item)
+				if err != nil {
+					return selector{}, "", err
+				}
+				return slice, s[end+1:], nil
+			}
+			index, err := strconv.Atoi(item)
+			if err != nil {
+				return selector{}, "", ErrPathSyntax
+			}
+			sel.indexes = append(sel.indexes, index)
+			s = s[end:]
+		}
+
+		s = strings.TrimLeft(s, " ")
+		switch {
+		case strings.HasPrefix(s, "]"):
+			return sel, s[1:], nil
+		case strings.HasPrefix(s, ","):
+			s = s[1:]
+		default:
+			return selector{}, "", ErrPathSyntax
+		}
+	}
+}
+
+// parseQuoted parses a name quoted with ' or ", where a backslash escapes the next character
+func parseQuoted(s string) (string, string, error) {
+	quote := s[0]
+	var name strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 == len(s) {
+				return "", "", ErrPathSyntax
+			}
+			i++
+			switch s[i] {
+			case 'n':
+				name.WriteByte('\n')
+			case 't':
+				name.WriteByte('\t')
+			case 'r':
+				name.WriteByte('\r')
+			case 'u':
+				if i+4 >= len(s) {
+					return "", "", ErrPathSyntax
+				}
+				r, err := strconv.ParseUint(s[i+1:i+5], 16, 16)
+				if err != nil {
+					return "", "", ErrPathSyntax
+				}
+				name.WriteRune(rune(r))
+				i += 4
+			default:
+				name.WriteByte(s[i])
+			}
+		case quote:
+			return name.String(), s[i+1:], nil
+		default:
+			name.WriteByte(s[i])
+		}
+	}
+	return "", "", ErrPathSyntax
+}
+
+func parseSlice(item string) (selector, error) {
+	parts := strings.Split(item, ":")
+	if len(parts) > 3 {
+		return selector{}, ErrPathSyntax
+	}
+	sel := selector{kind: selectSlice, step: 1}
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return selector{}, ErrPathSyntax
+		}
+		switch i {
+		case 0:
+			sel.start, sel.hasStart = n, true
+		case 1:
+			sel.end, sel.hasEnd = n, true
+		case 2:
+			if n <= 0 {
+				return selector{}, ErrPathSyntax
+			}
+			sel.step = n
+		}
+	}
+	return sel, nil
+}
+
+// String returns the path as it was given
+func (p *Path) String() string {
+	return p.text
+}
+
+// IsRoot reports whether the path is the root itself
+func (p *Path) IsRoot() bool {
+	return len(p.segments) == 0
+}
+
+// Parent splits a path ending with a plain child name, like $.a.b, into the path of the parent and the name,
+// which is where JSON.SET adds a key that doesn't exist yet
+func (p *Path) Parent() (*Path, string, bool) {
+	n := len(p.segments)
+	if n == 0 {
+		return nil, "", false
+	}
+	last := p.segments[n-1]
+	if last.recursive {
+		return nil, "", false
+	}
+	name := last.sel.name
+	switch {
+	case last.sel.kind == selectName:
+	case last.sel.kind == selectUnion && len(last.sel.names) == 1 && len(last.sel.indexes) == 0:
+		name = last.sel.names[0]
+	default:
+		return nil, "", false
+	}
+	return &Path{text: p.text, Legacy: p.Legacy, segments: p.segments[:n-1]}, name, true
+}
+
+// Match is a value found by a path, together with where it is stored so that it can be replaced or deleted
+type Match struct {
+	Value any
+	// Path is the normalized path of the value, like $["a"][0]
+	Path   string
+	parent any // *Object or *Array, nil for the root
+	key    string
+	index  int
+}
+
+func (m *Match) child(key string, v any) *Match {
+	path := AppendString([]byte(m.Path+"["), key)
+	return &Match{Value: v, Path: string(path) + "]", parent: m.Value, key: key}
+}
+
+func (m *Match) element(index int, v any) *Match {
+	return &Match{Value: v, Path: m.Path + "[" + strconv.Itoa(index) + "]", parent: m.Value, index: index}
+}
+
+// IsRoot reports whether the match is the root of the document
+func (m *Match) IsRoot() bool {
+	return m.parent == nil
+}
+
+// Find returns the values the path matches in root, in document order
+func (p *Path) Find(root any) []*Match {
+	matches := []*Match{{Value: root, Path: "$"}}
+	for _, seg := range p.segments {
+		var next []*Match
+		for _, m := range matches {
+			if !seg.recursive {
+				next = seg.sel.apply(m, next)
+				continue
+			}
+			for _, d := range descendants(m, nil) {
+				next = seg.sel.apply(d, next)
+			}
+		}
+		matches = next
+	}
+	return matches
+}
+
+// descendants appends m and all the values nested in it, parents before their children
+func descendants(m *Match, out []*Match) []*Match {
+	out = append(out, m)
+	for _, c := range children(m) {
+		out = descendants(c, out)
+	}
+	return out
+}
+
+func children(m *Match) []*Match {
+	var out []*Match
+	switch val := m.Value.(type) {
+	case *Object:
+		for _, key := range val.keys {
+			out = append(out, m.child(key, val.values[key]))
+		}
+	case *Array:
+		for i, elem := range val.Elems {
+			out = append(out, m.element(i, elem))
+		}
+	}
+	return out
+}
+
+func (sel *selector) apply(m *Match, out []*Match) []*Match {
+	switch val := m.Value.(type) {
+	case *Object:
+		switch sel.kind {
+		case selectName:
+			if v, ok := val.values[sel.name]; ok {
+				out = append(out, m.child(sel.name, v))
+			}
+		case selectWildcard:
+			out = append(out, children(m)...)
+		case selectUnion:
+			for _, name := range sel.names {
+				if v, ok := val.values[name]; ok {
+					out = append(out, m.child(name, v))
+				}
+			}
+		}
+	case *Array:
+		n := len(val.Elems)
+		switch sel.kind {
+		case selectWildcard:
+			out = append(out, children(m)...)
+		case selectUnion:
+			for _, index := range sel.indexes {
+				if index < 0 {
+					index += n
+				}
+				if index >= 0 && index < n {
+					out = append(out, m.element(index, val.Elems[index]))
+				}
+			}
+		case selectSlice:
+			start, end := 0, n
+			if sel.hasStart {
+				start = clampIndex(sel.start, n)
+			}
+			if sel.hasEnd {
+				end = clampIndex(sel.end, n)
+			}
+			for i := start; i < end; i += sel.step {
+				out = append(out, m.element(i, val.Elems[i]))
+			}
+		}
+	}
+	return out
+}
+
+func clampIndex(i, n int) int {
+	if i < 0 {
+		i += n
+	}
+	return min(max(i, 0), n)
+}
+
+// Replace sets the value m was found at to v
+func (d *Document) Replace(m *Match, v any) {
+	switch parent := m.parent.(type) {
+	case nil:
+		d.Root = v
+	case *Object:
+		parent.Set(m.key, v)
+	case *Array:
+		parent.Elems[m.index] = v
+	}
+	m.Value = v
+}
+
+// Delete removes the values of matches from their parents and returns how many were removed.
+// Matches of the root are ignored
+func (d *Document) Delete(matches []*Match) int {
+	deleted := 0
+	indexes := make(map[*Array][]int)
+	var arrays []*Array
+	for _, m := range matches {
+		switch parent := m.parent.(type) {
+		case *Object:
+			if parent.Delete(m.key) {
+				deleted++
+			}
+		case *Array:
+			if _, seen := indexes[parent]; !seen {
+				arrays = append(arrays, parent)
+			}
+			indexes[parent] = append(indexes[parent], m.index)
+		}
+	}
+	// 同一数组中的元素从后往前删除, 下标才不会错位
+	for _, arr := range arrays {
+		list := indexes[arr]
+		sort.Sort(sort.Reverse(sort.IntSlice(list)))
+		for i, index := range list {
+			if i > 0 && index == list[i-1] {
+				continue
+			}
+			arr.Elems = append(arr.Elems[:index], arr.Elems[index+1:]...)
+			deleted++
+		}
+	}
+	return deleted
+}
@@ -0,0 +1,308 @@
+// Package jsondoc implements the JSON document type: a tree of JSON values keeping the order of object keys,
+// and the subset of JSONPath used to address values in it.
+//
+// A value is one of nil, bool, int64, float64, string, *Array and *Object. Integers and floating point
+// numbers are kept apart, as the JSON type of Redis does.
+package jsondoc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Document is a JSON document stored at a key
+type Document struct {
+	Root any
+}
+
+// Array is a JSON array
+type Array struct {
+	Elems []any
+}
+
+// Object is a JSON object, keeping its keys in insertion order
+type Object struct {
+	keys   []string
+	values map[string]any
+}
+
+// NewObject creates an empty object
+func NewObject() *Object {
+	return &Object{values: make(map[string]any)}
+}
+
+// Len returns the number of keys
+func (o *Object) Len() int {
+	return len(o.keys)
+}
+
+// Keys returns the keys in insertion order
+func (o *Object) Keys() []string {
+	return append([]string(nil), o.keys...)
+}
+
+// Get returns the value of key
+func (o *Object) Get(key string) (any, bool) {
+	v, ok := o.values[key]
+	return v, ok
+}
+
+// Set sets the value of key, which keeps its position if it already exists
+func (o *Object) Set(key string, v any) {
+	if _, exists := o.values[key]; !exists {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = v
+}
+
+// Delete removes key
+func (o *Object) Delete(key string) bool {
+	if _, exists := o.values[key]; !exists {
+		return false
+	}
+	delete(o.values, key)
+	for i, k := range o.keys {
+		if k == key {
+			o.keys = append(o.keys[:i], o.keys[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// TypeName returns the name of the JSON type of v, as JSON.TYPE reports it
+func TypeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case int64:
+		return "integer"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case *Array:
+		return "array"
+	case *Object:
+		return "object"
+	}
+	return "unknown"
+}
+
+// Clone returns a deep copy of v
+func Clone(v any) any {
+	switch val := v.(type) {
+	case *Array:
+		elems := make([]any, len(val.Elems))
+		for i, elem := range val.Elems {
+			elems[i] = Clone(elem)
+		}
+		return &Array{Elems: elems}
+	case *Object:
+		obj := &Object{keys: append([]string(nil), val.keys...), values: make(map[string]any, len(val.values))}
+		for k, elem := range val.values {
+			obj.values[k] = Clone(elem)
+		}
+		return obj
+	}
+	return v
+}
+
+var errTrailingData = errors.New("trailing characters after JSON value")
+
+// Parse parses a JSON text into a value
+func Parse(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	v, err := parseValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errTrailingData
+	}
+	return v, nil
+}
+
+func parseValue(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '[':
+			arr := &Array{Elems: []any{}}
+			for dec.More() {
+				elem, err := parseValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				arr.Elems = append(arr.Elems, elem)
+			}
+			_, err = dec.Token()
+			return arr, err
+		case '{':
+			obj := NewObject()
+			for dec.More() {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				elem, err := parseValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				obj.Set(keyTok.(string), elem)
+			}
+			_, err = dec.Token()
+			return obj, err
+		}
+	case json.Number:
+		if n, err := strconv.ParseInt(string(t), 10, 64); err == nil {
+			return n, nil
+		}
+		f, err := strconv.ParseFloat(string(t), 64)
+		if err != nil || math.IsInf(f, 0) {
+			return nil, errors.New("number out of range: " + string(t))
+		}
+		return f, nil
+	case string, bool, nil:
+		return t, nil
+	}
+	return nil, errors.New("unexpected token")
+}
+
+// Marshal formats v as compact JSON
+func Marshal(v any) []byte {
+	return appendValue(nil, v, &format{}, 0)
+}
+
+// MarshalIndent formats v as JSON with indent before each nested level, newline after each element
+// and space after each colon, as the INDENT, NEWLINE and SPACE options of JSON.GET do
+func MarshalIndent(v any, indent, newline, space string) []byte {
+	return appendValue(nil, v, &format{indent: indent, newline: newline, space: space}, 0)
+}
+
+type format struct {
+	indent, newline, space string
+}
+
+func (f *format) appendBreak(buf []byte, level int) []byte {
+	buf = append(buf, f.newline...)
+	for i := 0; i < level; i++ {
+		buf = append(buf, f.indent...)
+	}
+	return buf
+}
+
+func appendValue(buf []byte, v any, f *format, level int) []byte {
+	switch val := v.(type) {
+	case nil:
+		return append(buf, "null"...)
+	case bool:
+		return strconv.AppendBool(buf, val)
+	case int64:
+		return strconv.AppendInt(buf, val, 10)
+	case float64:
+		return AppendFloat(buf, val)
+	case string:
+		return AppendString(buf, val)
+	case *Array:
+		if len(val.Elems) == 0 {
+			return append(buf, "[]"...)
+		}
+		buf = append(buf, '[')
+		for i, elem := range val.Elems {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = f.appendBreak(buf, level+1)
+			buf = appendValue(buf, elem, f, level+1)
+		}
+		buf = f.appendBreak(buf, level)
+		return append(buf, ']')
+	case *Object:
+		if len(val.keys) == 0 {
+			return append(buf, "{}"...)
+		}
+		buf = append(buf, '{')
+		for i, key := range val.keys {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = f.appendBreak(buf, level+1)
+			buf = AppendString(buf, key)
+			buf = append(buf, ':')
+			buf = append(buf, f.space...)
+			buf = appendValue(buf, val.values[key], f, level+1)
+		}
+		buf = f.appendBreak(buf, level)
+		return append(buf, '}')
+	}
+	return buf
+}
+
+// AppendFloat formats a floating point number the way JSON.GET shows it, always with a fraction or an exponent
+// so that it reads back as a float
+func AppendFloat(buf []byte, f float64) []byte {
+	start := len(buf)
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		buf = strconv.AppendFloat(buf, f, 'e', -1, 64)
+		// 与 encoding/json 相同, 把 e-07 写作 e-7
+		if n := len(buf); n-start >= 4 && buf[n-4] == 'e' && buf[n-3] == '-' && buf[n-2] == '0' {
+			buf[n-2] = buf[n-1]
+			buf = buf[:n-1]
+		}
+		return buf
+	}
+	buf = strconv.AppendFloat(buf, f, 'f', -1, 64)
+	if bytes.IndexByte(buf[start:], '.') < 0 {
+		buf = append(buf, ".0"...)
+	}
+	return buf
+}
+
+const hexDigits = "0123456789abcdef"
+
+// AppendString formats s as a JSON string
+func AppendString(buf []byte, s string) []byte {
+	buf = append(buf, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				buf = append(buf, '\\', c)
+			case c == '\n':
+				buf = append(buf, '\\', 'n')
+			case c == '\r':
+				buf = append(buf, '\\', 'r')
+			case c == '\t':
+				buf = append(buf, '\\', 't')
+			case c < 0x20:
+				buf = append(buf, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			default:
+				buf = append(buf, c)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf = append(buf, `\ufffd`...)
+		} else {
+			buf = append(buf, s[i:i+size]...)
+		}
+		i += size
+	}
+	return append(buf, '"')
+}
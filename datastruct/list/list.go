@@ -0,0 +1,76 @@
+// Package list implements the list value, which SORT ... STORE creates and LRANGE, LLEN and LINDEX read.
+//
+// Elements are kept in a slice in their order, like a listpack. Lists are only written as a whole,
+// so there is no need for the quicklist of Redis, which makes pushes and pops at both ends cheap.
+package list
+
+import "Redis_Go/lib/codec"
+
+// listpackMaxEntries is the length up to which OBJECT ENCODING reports a list as a listpack, as Redis would
+const listpackMaxEntries = 128
+
+// List is a list of strings
+type List struct {
+	elements []string
+}
+
+// New creates a list holding elements, which it takes ownership of
+func New(elements []string) *List {
+	return &List{elements: elements}
+}
+
+// Len returns the number of elements
+func (l *List) Len() int {
+	return len(l.elements)
+}
+
+// Elements returns the elements in order. The slice is shared with the list and must not be modified
+func (l *List) Elements() []string {
+	return l.elements
+}
+
+// Encoding returns 0 for a listpack and 1 for a quicklist, the encodings Redis would use for the list
+func (l *List) Encoding() int {
+	if len(l.elements) <= listpackMaxEntries {
+		return 0
+	}
+	return 1
+}
+
+// Clone returns a copy of the list
+func (l *List) Clone() *List {
+	return New(append([]string(nil), l.elements...))
+}
+
+// Marshal 序列化列表
+func (l *List) Marshal() []byte {
+	buf := make([]byte, 0, 8+len(l.elements)*8)
+	buf = codec.AppendUvarint(buf, uint64(len(l.elements)))
+	for _, elem := range l.elements {
+		buf = codec.AppendString(buf, elem)
+	}
+	return buf
+}
+
+// Unmarshal 反序列化由 Marshal 生成的数据
+func Unmarshal(data []byte) (*List, error) {
+	r := codec.NewReader(data)
+	n := r.ReadUvarint()
+	if r.Err() != nil {
+		return nil, r.Err()
+	}
+	if n > uint64(r.Remaining()) {
+		return nil, codec.ErrBadFormat
+	}
+	elements := make([]string, n)
+	for i := range elements {
+		elements[i] = r.ReadString()
+		if r.Err() != nil {
+			return nil, r.Err()
+		}
+	}
+	if r.Remaining() != 0 {
+		return nil, codec.ErrBadFormat
+	}
+	return New(elements), nil
+}
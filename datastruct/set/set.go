@@ -1,35 +1,87 @@
 package set
 
 import (
+	"Redis_Go/datastruct/hashtable"
+	"Redis_Go/lib/codec"
+	"Redis_Go/lib/wildcard"
 	"math/rand"
+	"slices"
+	"sort"
+	"strconv"
 )
 
 const (
 	encodingListpack = 0
 	encodingDict     = 1
+	encodingIntset   = 2
 
 	// 编码转换阈值
 	setMaxListpackEntries = 128 // 元素数量超过此值转换为哈希表
+	setMaxIntsetEntries   = 512 // intset 元素数量超过此值转换为哈希表
 )
 
 // Set 集合数据结构
-// 使用 listpack（slice）+ 哈希表（map）的混合编码
+// 使用 intset（有序 int64 切片）、listpack（slice）、哈希表的混合编码.
+// 新集合从 intset 开始, 出现非整数元素后升级为 listpack 或哈希表, 不会再降级
 type Set struct {
-	encoding  int              // 当前编码
-	listpack  []string         // listpack 编码：紧凑存储
-	dict      map[string]struct{} // 哈希表编码：O(1) 查找
+	encoding int                        // 当前编码
+	intset   []int64                    // intset 编码：升序存储的整数
+	listpack []string                   // listpack 编码：紧凑存储
+	dict     *hashtable.Table[struct{}] // 哈希表编码：O(1) 查找
 }
 
 // NewSet 创建新的 Set
 func NewSet() *Set {
 	return &Set{
-		encoding: encodingListpack,
-		listpack: make([]string, 0),
+		encoding: encodingIntset,
+		intset:   make([]int64, 0),
 	}
 }
 
+// parseIntMember 判断元素能否以整数存储: 必须是 int64 范围内的规范十进制写法,
+// 这样转换回字符串后与原值相同 (例如 "01" 和 "+1" 不是)
+func parseIntMember(member string) (int64, bool) {
+	v, err := strconv.ParseInt(member, 10, 64)
+	if err != nil || strconv.FormatInt(v, 10) != member {
+		return 0, false
+	}
+	return v, true
+}
+
+// intsetSearch 返回 v 在 intset 中的位置, 不存在时返回应插入的位置
+func (s *Set) intsetSearch(v int64) (int, bool) {
+	i := sort.Search(len(s.intset), func(i int) bool {
+		return s.intset[i] >= v
+	})
+	return i, i < len(s.intset) && s.intset[i] == v
+}
+
 // Add 添加元素，返回是否新增
 func (s *Set) Add(member string) bool {
+	if s.encoding == encodingIntset {
+		v, ok := parseIntMember(member)
+		if !ok {
+			// 出现非整数元素, 升级编码后再添加
+			if len(s.intset) < setMaxListpackEntries {
+				s.convertToListpack()
+			} else {
+				s.convertToDict()
+			}
+			return s.Add(member)
+		}
+		i, exists := s.intsetSearch(v)
+		if exists {
+			return false
+		}
+		s.intset = append(s.intset, 0)
+		copy(s.intset[i+1:], s.intset[i:])
+		s.intset[i] = v
+		if len(s.intset) > setMaxIntsetEntries {
+			s.convertToDict()
+		}
+		return true
+	}
+
 	// 检查是否需要转换编码
 	if s.encoding == encodingListpack {
 		// 先检查是否已存在
@@ -41,7 +93,7 @@ func (s *Set) Add(member string) bool {
 		// 检查是否需要转换
 		if len(s.listpack) >= setMaxListpackEntries {
 			s.convertToDict()
-			s.dict[member] = struct{}{}
+			s.dict.Set(member, struct{}{})
 			return true
 		}
 		s.listpack = append(s.listpack, member)
@@ -49,15 +101,24 @@ func (s *Set) Add(member string) bool {
 	}
 
 	// 哈希表编码
-	if _, exists := s.dict[member]; exists {
-		return false
-	}
-	s.dict[member] = struct{}{}
-	return true
+	return s.dict.Set(member, struct{}{})
 }
 
 // Remove 删除元素，返回是否删除成功
 func (s *Set) Remove(member string) bool {
+	if s.encoding == encodingIntset {
+		v, ok := parseIntMember(member)
+		if !ok {
+			return false
+		}
+		i, exists := s.intsetSearch(v)
+		if !exists {
+			return false
+		}
+		s.intset = append(s.intset[:i], s.intset[i+1:]...)
+		return true
+	}
+
 	if s.encoding == encodingListpack {
 		for i, m := range s.listpack {
 			if m == member {
@@ -68,15 +129,20 @@ func (s *Set) Remove(member string) bool {
 		return false
 	}
 
-	if _, exists := s.dict[member]; !exists {
-		return false
-	}
-	delete(s.dict, member)
-	return true
+	return s.dict.Delete(member)
 }
 
 // Contains 检查元素是否存在
 func (s *Set) Contains(member string) bool {
+	if s.encoding == encodingIntset {
+		v, ok := parseIntMember(member)
+		if !ok {
+			return false
+		}
+		_, exists := s.intsetSearch(v)
+		return exists
+	}
+
 	if s.encoding == encodingListpack {
 		for _, m := range s.listpack {
 			if m == member {
@@ -86,31 +152,85 @@ func (s *Set) Contains(member string) bool {
 		return false
 	}
 
-	_, exists := s.dict[member]
+	_, exists := s.dict.Get(member)
 	return exists
 }
 
-// Len 返回元素数量
+// Len 返回集合大小
 func (s *Set) Len() int {
-	if s.encoding == encodingListpack {
+	switch s.encoding {
+	case encodingIntset:
+		return len(s.intset)
+	case encodingListpack:
 		return len(s.listpack)
 	}
-	return len(s.dict)
+	return s.dict.Len()
+}
+
+// ForEach 遍历所有元素, consumer 返回 false 时停止. 遍历期间不能修改集合
+func (s *Set) ForEach(consumer func(member string) bool) {
+	switch s.encoding {
+	case encodingIntset:
+		for _, v := range s.intset {
+			if !consumer(strconv.FormatInt(v, 10)) {
+				return
+			}
+		}
+	case encodingListpack:
+		for _, m := range s.listpack {
+			if !consumer(m) {
+				return
+			}
+		}
+	default:
+		for it := s.dict.Iterate(); it.Next(); {
+			if !consumer(it.Key()) {
+				return
+			}
+		}
+	}
 }
 
 // Members 返回所有元素
 func (s *Set) Members() []string {
-	if s.encoding == encodingListpack {
-		result := make([]string, len(s.listpack))
-		copy(result, s.listpack)
-		return result
+	result := make([]string, 0, s.Len())
+	s.ForEach(func(member string) bool {
+		result = append(result, member)
+		return true
+	})
+	return result
+}
+
+// memberAt 返回 intset 或 listpack 编码下第 i 个元素
+func (s *Set) memberAt(i int) string {
+	if s.encoding == encodingIntset {
+		return strconv.FormatInt(s.intset[i], 10)
 	}
+	return s.listpack[i]
+}
 
-	result := make([]string, 0, len(s.dict))
-	for member := range s.dict {
-		result = append(result, member)
+// Scan 返回从 cursor 开始的约 count 个元素及下一次的游标, 游标为 0 表示扫描结束.
+// 哈希表编码按 hashtable.Table.Scan 的游标逐步遍历, 在整个扫描期间一直存在的元素至少返回一次;
+// intset 和 listpack 元素很少, 和 Redis 一样一次返回全部元素
+func (s *Set) Scan(cursor uint64, count int, pattern string) ([]string, uint64) {
+	matcher := wildcard.CompilePattern(pattern)
+	var result []string
+	add := func(member string) {
+		if matcher.IsMatch(member) {
+			result = append(result, member)
+		}
 	}
-	return result
+	if s.encoding == encodingDict {
+		next := s.dict.Scan(cursor, count, func(member string, _ struct{}) {
+			add(member)
+		})
+		return result, next
+	}
+	s.ForEach(func(member string) bool {
+		add(member)
+		return true
+	})
+	return result, 0
 }
 
 // RandomMember 随机返回一个元素
@@ -119,20 +239,12 @@ func (s *Set) RandomMember() (string, bool) {
 		return "", false
 	}
 
-	if s.encoding == encodingListpack {
-		idx := rand.Intn(len(s.listpack))
-		return s.listpack[idx], true
+	if s.encoding != encodingDict {
+		return s.memberAt(rand.Intn(s.Len())), true
 	}
 
-	// 从 map 中随机取一个
-	idx := rand.Intn(len(s.dict))
-	for member := range s.dict {
-		if idx == 0 {
-			return member, true
-		}
-		idx--
-	}
-	return "", false
+	member, _, ok := s.dict.Random()
+	return member, ok
 }
 
 // RandomMembers 随机返回多个元素（可能重复）
@@ -142,19 +254,17 @@ func (s *Set) RandomMembers(count int) []string {
 	}
 
 	result := make([]string, 0, count)
-	if s.encoding == encodingListpack {
+	if s.encoding != encodingDict {
 		for i := 0; i < count; i++ {
-			idx := rand.Intn(len(s.listpack))
-			result = append(result, s.listpack[idx])
+			result = append(result, s.memberAt(rand.Intn(s.Len())))
 		}
 		return result
 	}
 
 	// 哈希表编码
-	members := s.Members()
 	for i := 0; i < count; i++ {
-		idx := rand.Intn(len(members))
-		result = append(result, members[idx])
+		member, _, _ := s.dict.Random()
+		result = append(result, member)
 	}
 	return result
 }
@@ -171,21 +281,9 @@ func (s *Set) RandomDistinctMembers(count int) []string {
 		return s.Members()
 	}
 
-	result := make([]string, 0, count)
-	if s.encoding == encodingListpack {
-		// 使用 Fisher-Yates 洗牌算法
-		shuffled := make([]string, size)
-		copy(shuffled, s.listpack)
-		for i := 0; i < count; i++ {
-			j := i + rand.Intn(size-i)
-			shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
-			result = append(result, shuffled[i])
-		}
-		return result
-	}
-
-	// 哈希表编码
+	// 使用 Fisher-Yates 洗牌算法
 	members := s.Members()
+	result := make([]string, 0, count)
 	for i := 0; i < count; i++ {
 		j := i + rand.Intn(size-i)
 		members[i], members[j] = members[j], members[i]
@@ -204,15 +302,27 @@ func (s *Set) Pop(count int) []string {
 	// 如果请求数量大于等于集合大小，弹出所有元素
 	if count >= size {
 		result := s.Members()
-		if s.encoding == encodingListpack {
+		switch s.encoding {
+		case encodingIntset:
+			s.intset = s.intset[:0]
+		case encodingListpack:
 			s.listpack = s.listpack[:0]
-		} else {
-			s.dict = make(map[string]struct{})
+		default:
+			s.dict = hashtable.New[struct{}](0)
 		}
 		return result
 	}
 
 	result := make([]string, 0, count)
+	if s.encoding == encodingIntset {
+		for i := 0; i < count; i++ {
+			idx := rand.Intn(len(s.intset))
+			result = append(result, strconv.FormatInt(s.intset[idx], 10))
+			s.intset = append(s.intset[:idx], s.intset[idx+1:]...)
+		}
+		return result
+	}
+
 	if s.encoding == encodingListpack {
 		for i := 0; i < count; i++ {
 			idx := rand.Intn(len(s.listpack))
@@ -224,11 +334,9 @@ func (s *Set) Pop(count int) []string {
 
 	// 哈希表编码
 	for i := 0; i < count; i++ {
-		for member := range s.dict {
-			result = append(result, member)
-			delete(s.dict, member)
-			break
-		}
+		member, _, _ := s.dict.Random()
+		s.dict.Delete(member)
+		result = append(result, member)
 	}
 	return result
 }
@@ -237,27 +345,13 @@ func (s *Set) Pop(count int) []string {
 func (s *Set) Union(other *Set) *Set {
 	result := NewSet()
 
-	// 添加当前集合的所有元素
-	if s.encoding == encodingListpack {
-		for _, m := range s.listpack {
-			result.Add(m)
-		}
-	} else {
-		for m := range s.dict {
-			result.Add(m)
-		}
-	}
-
-	// 添加其他集合的所有元素
-	if other.encoding == encodingListpack {
-		for _, m := range other.listpack {
-			result.Add(m)
-		}
-	} else {
-		for m := range other.dict {
-			result.Add(m)
-		}
+	// 添加两个集合的所有元素
+	add := func(m string) bool {
+		result.Add(m)
+		return true
 	}
+	s.ForEach(add)
+	other.ForEach(add)
 
 	return result
 }
@@ -270,19 +364,12 @@ func (s *Set) Intersect(other *Set) *Set {
 	}
 
 	result := NewSet()
-	if s.encoding == encodingListpack {
-		for _, m := range s.listpack {
-			if other.Contains(m) {
-				result.Add(m)
-			}
-		}
-	} else {
-		for m := range s.dict {
-			if other.Contains(m) {
-				result.Add(m)
-			}
+	s.ForEach(func(m string) bool {
+		if other.Contains(m) {
+			result.Add(m)
 		}
-	}
+		return true
+	})
 
 	return result
 }
@@ -290,19 +377,12 @@ func (s *Set) Intersect(other *Set) *Set {
 // Diff 返回与其他集合的差集（在 s 中但不在 other 中）
 func (s *Set) Diff(other *Set) *Set {
 	result := NewSet()
-	if s.encoding == encodingListpack {
-		for _, m := range s.listpack {
-			if !other.Contains(m) {
-				result.Add(m)
-			}
-		}
-	} else {
-		for m := range s.dict {
-			if !other.Contains(m) {
-				result.Add(m)
-			}
+	s.ForEach(func(m string) bool {
+		if !other.Contains(m) {
+			result.Add(m)
 		}
-	}
+		return true
+	})
 
 	return result
 }
@@ -312,20 +392,113 @@ func (s *Set) Encoding() int {
 	return s.encoding
 }
 
+// Clone 返回集合的深拷贝, 保持原编码
+func (s *Set) Clone() *Set {
+	return &Set{
+		encoding: s.encoding,
+		intset:   slices.Clone(s.intset),
+		listpack: slices.Clone(s.listpack),
+		dict:     s.dict.Clone(),
+	}
+}
+
 // Clear 清空集合
 func (s *Set) Clear() {
 	s.listpack = nil
 	s.dict = nil
+	s.encoding = encodingIntset
+	s.intset = make([]int64, 0)
+}
+
+// convertToListpack 将 intset 转换为 listpack 编码
+func (s *Set) convertToListpack() {
+	s.listpack = make([]string, 0, len(s.intset)+1)
+	for _, v := range s.intset {
+		s.listpack = append(s.listpack, strconv.FormatInt(v, 10))
+	}
+	s.intset = nil
 	s.encoding = encodingListpack
-	s.listpack = make([]string, 0)
 }
 
 // convertToDict 转换为哈希表编码
 func (s *Set) convertToDict() {
-	s.dict = make(map[string]struct{}, len(s.listpack))
-	for _, m := range s.listpack {
-		s.dict[m] = struct{}{}
-	}
+	dict := hashtable.New[struct{}](s.Len())
+	s.ForEach(func(m string) bool {
+		dict.Set(m, struct{}{})
+		return true
+	})
+	s.dict = dict
+	s.intset = nil
 	s.listpack = nil
 	s.encoding = encodingDict
 }
+
+// Marshal 序列化集合，保留编码以及 listpack 中的元素顺序
+func (s *Set) Marshal() []byte {
+	buf := make([]byte, 0, 16+s.Len()*8)
+	buf = append(buf, byte(s.encoding))
+	buf = codec.AppendUvarint(buf, uint64(s.Len()))
+	s.ForEach(func(m string) bool {
+		buf = codec.AppendString(buf, m)
+		return true
+	})
+	return buf
+}
+
+// UnmarshalSet 反序列化由 Marshal 生成的数据
+func UnmarshalSet(data []byte) (*Set, error) {
+	r := codec.NewReader(data)
+	encoding := int(r.ReadUint8())
+	n := r.ReadUvarint()
+	if r.Err() != nil {
+		return nil, r.Err()
+	}
+
+	s := NewSet()
+	switch encoding {
+	case encodingIntset:
+	case encodingListpack:
+		s.convertToListpack()
+	case encodingDict:
+		s.convertToDict()
+	default:
+		return nil, codec.ErrBadFormat
+	}
+	// 每个元素至少占一个字节; 紧凑编码的元素数不能超过转换阈值
+	if n > uint64(r.Remaining()) ||
+		encoding == encodingIntset && n > setMaxIntsetEntries ||
+		encoding == encodingListpack && n > setMaxListpackEntries {
+		return nil, codec.ErrBadFormat
+	}
+	for i := uint64(0); i < n; i++ {
+		m := r.ReadString()
+		if r.Err() != nil {
+			return nil, r.Err()
+		}
+		switch s.encoding {
+		case encodingIntset:
+			v, ok := parseIntMember(m)
+			if !ok {
+				return nil, codec.ErrBadFormat
+			}
+			// Marshal 按升序写出, 直接追加即可
+			if len(s.intset) > 0 && v <= s.intset[len(s.intset)-1] {
+				return nil, codec.ErrBadFormat
+			}
+			s.intset = append(s.intset, v)
+		case encodingListpack:
+			if slices.Contains(s.listpack, m) {
+				return nil, codec.ErrBadFormat
+			}
+			s.listpack = append(s.listpack, m)
+		default:
+			if !s.dict.Set(m, struct{}{}) {
+				return nil, codec.ErrBadFormat
+			}
+		}
+	}
+	if r.Remaining() != 0 {
+		return nil, codec.ErrBadFormat
+	}
+	return s, nil
+}
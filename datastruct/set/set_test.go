@@ -0,0 +1,82 @@
+package set
+
+import (
+	"Redis_Go/lib/codec"
+	"strconv"
+	"testing"
+)
+
+func TestMarshalRoundTrip(t *testing.T) {
+	sets := map[string]func() *Set{
+		"intset":   func() *Set { return setOf(10, "") },
+		"listpack": func() *Set { return setOf(10, "m") },
+		"dict":     func() *Set { return setOf(setMaxListpackEntries+1, "m") },
+		"big ints": func() *Set { return setOf(setMaxIntsetEntries+1, "") },
+		"empty":    NewSet,
+	}
+	for name, newSet := range sets {
+		s := newSet()
+		restored, err := UnmarshalSet(s.Marshal())
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if restored.Len() != s.Len() || restored.Encoding() != s.Encoding() {
+			t.Fatalf("%s: restored len %d encoding %d, want %d %d", name, restored.Len(), restored.Encoding(), s.Len(), s.Encoding())
+		}
+		s.ForEach(func(member string) bool {
+			if !restored.Contains(member) {
+				t.Fatalf("%s: %s is missing", name, member)
+			}
+			return true
+		})
+	}
+}
+
+// setOf returns a set of n members, integers if prefix is empty
+func setOf(n int, prefix string) *Set {
+	s := NewSet()
+	for i := 0; i < n; i++ {
+		s.Add(prefix + strconv.Itoa(i))
+	}
+	return s
+}
+
+// payload builds a Marshal payload from members, which Marshal itself would never produce
+func payload(encoding int, n uint64, members ...string) []byte {
+	buf := []byte{byte(encoding)}
+	buf = codec.AppendUvarint(buf, n)
+	for _, member := range members {
+		buf = codec.AppendString(buf, member)
+	}
+	return buf
+}
+
+func TestUnmarshalRejectsBadPayloads(t *testing.T) {
+	ints := func(n int) []string {
+		members := make([]string, n)
+		for i := range members {
+			members[i] = strconv.Itoa(i)
+		}
+		return members
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"huge count", payload(encodingDict, 1<<40)},
+		{"count past the data", payload(encodingDict, 3, "a")},
+		{"unknown encoding", payload(7, 0)},
+		{"duplicate in intset", payload(encodingIntset, 2, "1", "1")},
+		{"unsorted intset", payload(encodingIntset, 2, "2", "1")},
+		{"non integer in intset", payload(encodingIntset, 1, "a")},
+		{"duplicate in listpack", payload(encodingListpack, 2, "a", "a")},
+		{"duplicate in dict", payload(encodingDict, 2, "a", "a")},
+		{"intset too long", payload(encodingIntset, setMaxIntsetEntries+1, ints(setMaxIntsetEntries+1)...)},
+		{"listpack too long", payload(encodingListpack, setMaxListpackEntries+1, ints(setMaxListpackEntries+1)...)},
+	}
+	for _, tt := range tests {
+		if _, err := UnmarshalSet(tt.data); err == nil {
+			t.Errorf("%s: payload accepted", tt.name)
+		}
+	}
+}
@@ -21,7 +21,6 @@ type SkipList struct {
 	tail   *Node
 	level  int
 	length int
-	rand   *rand.Rand
 	dict   map[string]*Node // member -> Node，O(1) 查找
 }
 
@@ -34,14 +33,14 @@ func NewSkipList() *SkipList {
 		tail:   nil,
 		level:  1,
 		length: 0,
-		rand:   rand.New(rand.NewSource(0)),
 		dict:   make(map[string]*Node),
 	}
 }
 
 func (sl *SkipList) randomLevel() int {
 	level := 1
-	for level < maxLevel && sl.rand.Float32() < 0.25 {
+	// 使用全局随机源: 它在启动时随机播种, 也不必为每个跳表分配一个 rand.Source
+	for level < maxLevel && rand.Float32() < 0.25 {
 		level++
 	}
 	return level
@@ -99,8 +98,8 @@ func (sl *SkipList) insertNode(member string, score float64) {
 		for i := sl.level; i < level; i++ {
 			rank[i] = 0
 			update[i] = sl.head
-			// 新层的 span 指向即将插入的节点（span=1）含义：如果这里插入一个节点，从 head 走到它，需要 1 步。
-			sl.head.Levels[i].Span = sl.length + 1
+			// 新层此前为空，head 在这一层跨过了全部 length 个节点
+			sl.head.Levels[i].Span = sl.length
 		}
 		sl.level = level
 	}
@@ -160,10 +159,12 @@ func (sl *SkipList) Delete(member string, score float64) bool {
 		// 在所有层级中移除目标节点，并更新 span
 		for i := 0; i < sl.level; i++ {
 			if update[i].Levels[i].Forward != targetNode {
-				break // 目标节点不在这一层
+				// 目标节点不在这一层，但它被前驱节点的 span 跨过，需要减一
+				update[i].Levels[i].Span--
+				continue
 			}
-			// 前驱节点的 span += 目标节点的 span
-			update[i].Levels[i].Span += targetNode.Levels[i].Span
+			// 前驱节点的 span += 目标节点的 span - 1 (目标节点本身被移除)
+			update[i].Levels[i].Span += targetNode.Levels[i].Span - 1
 			// 前驱节点的 forward 指向目标节点的下一个节点
 			update[i].Levels[i].Forward = targetNode.Levels[i].Forward
 		}
@@ -294,3 +295,43 @@ func (sl *SkipList) GetRank(member string, score float64) int {
 
 	return -1 // 未找到
 }
+
+// CountWhile returns the number of leading nodes for which pred holds.
+// pred must hold for a prefix of the list, which makes the result the rank of the last such node
+// Time complexity: O(log n) using span information
+func (sl *SkipList) CountWhile(pred func(member string, score float64) bool) int {
+	rank := 0
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.Levels[i].Forward != nil && pred(x.Levels[i].Forward.Member, x.Levels[i].Forward.Score) {
+			rank += x.Levels[i].Span
+			x = x.Levels[i].Forward
+		}
+	}
+	return rank
+}
+
+// GetByRank returns the node with the given rank (1-based), or nil if it is out of range
+// Time complexity: O(log n) using span information
+func (sl *SkipList) GetByRank(rank int) *Node {
+	if rank < 1 || rank > sl.length {
+		return nil
+	}
+	traversed := 0
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.Levels[i].Forward != nil && traversed+x.Levels[i].Span <= rank {
+			traversed += x.Levels[i].Span
+			x = x.Levels[i].Forward
+		}
+		if traversed == rank {
+			return x
+		}
+	}
+	return nil
+}
+
+// Len returns the number of nodes in the skip list
+func (sl *SkipList) Len() int {
+	return sl.length
+}
@@ -0,0 +1,195 @@
+package stream
+
+import (
+	"sort"
+)
+
+// PendingEntry is an entry delivered to a consumer of a group and not acknowledged yet
+type PendingEntry struct {
+	ID            ID
+	Consumer      *Consumer
+	DeliveryTime  int64 // unix time in milliseconds of the last delivery
+	DeliveryCount int64
+}
+
+// Consumer is a consumer of a group
+type Consumer struct {
+	Name       string
+	SeenTime   int64 // unix time in milliseconds of the last interaction
+	ActiveTime int64 // unix time in milliseconds of the last successful read or claim, -1 if none
+	pending    []*PendingEntry
+}
+
+// Group is a consumer group
+type Group struct {
+	Name        string
+	LastID      ID    // the last entry delivered to the group
+	EntriesRead int64 // the number of entries delivered to the group, InvalidEntriesRead if unknown
+	pending     []*PendingEntry
+	consumers   map[string]*Consumer
+}
+
+func newGroup(name string, lastID ID, entriesRead int64) *Group {
+	return &Group{
+		Name:        name,
+		LastID:      lastID,
+		EntriesRead: entriesRead,
+		consumers:   make(map[string]*Consumer),
+	}
+}
+
+// searchPending returns the position of the first pending entry of list whose ID is not less than id
+func searchPending(list []*PendingEntry, id ID) int {
+	return sort.Search(len(list), func(i int) bool {
+		return !list[i].ID.Less(id)
+	})
+}
+
+func insertPending(list []*PendingEntry, pe *PendingEntry) []*PendingEntry {
+	i := searchPending(list, pe.ID)
+	list = append(list, nil)
+	copy(list[i+1:], list[i:])
+	list[i] = pe
+	return list
+}
+
+func removePending(list []*PendingEntry, id ID) []*PendingEntry {
+	if i := searchPending(list, id); i < len(list) && list[i].ID == id {
+		return append(list[:i], list[i+1:]...)
+	}
+	return list
+}
+
+// pendingFrom returns up to count pending entries of list from the one at or after start, all of them if count <= 0
+func pendingFrom(list []*PendingEntry, start ID, count int) []*PendingEntry {
+	rest := list[searchPending(list, start):]
+	if count > 0 && count < len(rest) {
+		rest = rest[:count]
+	}
+	return append([]*PendingEntry(nil), rest...)
+}
+
+// clone returns a deep copy of the group, its consumers and pending entries
+func (g *Group) clone() *Group {
+	clone := newGroup(g.Name, g.LastID, g.EntriesRead)
+	consumers := make(map[*Consumer]*Consumer, len(g.consumers))
+	for name, c := range g.consumers {
+		consumers[c] = &Consumer{Name: c.Name, SeenTime: c.SeenTime, ActiveTime: c.ActiveTime}
+		clone.consumers[name] = consumers[c]
+	}
+	// 组和消费者的 PEL 共享同一批 PendingEntry
+	clone.pending = make([]*PendingEntry, len(g.pending))
+	for i, pe := range g.pending {
+		peClone := *pe
+		peClone.Consumer = consumers[pe.Consumer]
+		peClone.Consumer.pending = append(peClone.Consumer.pending, &peClone)
+		clone.pending[i] = &peClone
+	}
+	return clone
+}
+
+// Consumer returns the consumer with the given name
+func (g *Group) Consumer(name string) (*Consumer, bool) {
+	c, ok := g.consumers[name]
+	return c, ok
+}
+
+// CreateConsumer creates a consumer, ok is false if it already exists
+func (g *Group) CreateConsumer(name string, nowMs int64) (c *Consumer, ok bool) {
+	if c, exists := g.consumers[name]; exists {
+		return c, false
+	}
+	c = &Consumer{Name: name, SeenTime: nowMs, ActiveTime: -1}
+	g.consumers[name] = c
+	return c, true
+}
+
+// DeleteConsumer removes a consumer together with its pending entries, and returns how many it had
+func (g *Group) DeleteConsumer(name string) (pending int, ok bool) {
+	c, exists := g.consumers[name]
+	if !exists {
+		return 0, false
+	}
+	for _, pe := range c.pending {
+		g.pending = removePending(g.pending, pe.ID)
+	}
+	delete(g.consumers, name)
+	return len(c.pending), true
+}
+
+// Consumers returns the consumers ordered by name
+func (g *Group) Consumers() []*Consumer {
+	consumers := make([]*Consumer, 0, len(g.consumers))
+	for _, c := range g.consumers {
+		consumers = append(consumers, c)
+	}
+	sort.Slice(consumers, func(i, j int) bool {
+		return consumers[i].Name < consumers[j].Name
+	})
+	return consumers
+}
+
+// PendingLen returns the number of pending entries of the group
+func (g *Group) PendingLen() int {
+	return len(g.pending)
+}
+
+// Pending returns the pending entry with the given ID
+func (g *Group) Pending(id ID) (*PendingEntry, bool) {
+	if i := searchPending(g.pending, id); i < len(g.pending) && g.pending[i].ID == id {
+		return g.pending[i], true
+	}
+	return nil, false
+}
+
+// PendingFrom returns up to count pending entries from the one at or after start, all of them if count <= 0
+func (g *Group) PendingFrom(start ID, count int) []*PendingEntry {
+	return pendingFrom(g.pending, start, count)
+}
+
+// Deliver records that the entry id was delivered to c at nowMs.
+// An entry already pending, possibly for another consumer, is moved to c with its delivery count reset to 1
+func (g *Group) Deliver(id ID, c *Consumer, nowMs int64) *PendingEntry {
+	if pe, ok := g.Pending(id); ok {
+		pe.Consumer.pending = removePending(pe.Consumer.pending, id)
+		pe.Consumer, pe.DeliveryTime, pe.DeliveryCount = c, nowMs, 1
+		c.pending = insertPending(c.pending, pe)
+		return pe
+	}
+	pe := &PendingEntry{ID: id, Consumer: c, DeliveryTime: nowMs, DeliveryCount: 1}
+	g.pending = insertPending(g.pending, pe)
+	c.pending = insertPending(c.pending, pe)
+	return pe
+}
+
+// Claim moves the pending entry pe to c
+func (g *Group) Claim(pe *PendingEntry, c *Consumer) {
+	if pe.Consumer == c {
+		return
+	}
+	pe.Consumer.pending = removePending(pe.Consumer.pending, pe.ID)
+	pe.Consumer = c
+	c.pending = insertPending(c.pending, pe)
+}
+
+// Ack removes the entry id from the pending entries
+func (g *Group) Ack(id ID) bool {
+	pe, ok := g.Pending(id)
+	if !ok {
+		return false
+	}
+	g.pending = removePending(g.pending, id)
+	pe.Consumer.pending = removePending(pe.Consumer.pending, id)
+	return true
+}
+
+// PendingLen returns the number of pending entries of the consumer
+func (c *Consumer) PendingLen() int {
+	return len(c.pending)
+}
+
+// PendingFrom returns up to count pending entries of the consumer from the one at or after start,
+// all of them if count <= 0
+func (c *Consumer) PendingFrom(start ID, count int) []*PendingEntry {
+	return pendingFrom(c.pending, start, count)
+}
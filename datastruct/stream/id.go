@@ -0,0 +1,109 @@
+package stream
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ID identifies a stream entry: the millisecond time it was added at and a sequence number within that millisecond
+type ID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+var (
+	// MinID is the smallest possible ID, 0-0
+	MinID = ID{}
+	// MaxID is the largest possible ID
+	MaxID = ID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+
+	ErrInvalidID = errors.New("ERR Invalid stream ID specified as stream command argument")
+)
+
+// String formats the ID as ms-seq
+func (id ID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+// Compare returns -1, 0 or 1 as id is smaller than, equal to or greater than other
+func (id ID) Compare(other ID) int {
+	switch {
+	case id.Ms < other.Ms:
+		return -1
+	case id.Ms > other.Ms:
+		return 1
+	case id.Seq < other.Seq:
+		return -1
+	case id.Seq > other.Seq:
+		return 1
+	}
+	return 0
+}
+
+// Less reports whether id is smaller than other
+func (id ID) Less(other ID) bool {
+	return id.Compare(other) < 0
+}
+
+// IsZero reports whether id is 0-0
+func (id ID) IsZero() bool {
+	return id == MinID
+}
+
+// Next returns the smallest ID greater than id, ok is false if id is MaxID
+func (id ID) Next() (next ID, ok bool) {
+	switch {
+	case id.Seq < math.MaxUint64:
+		return ID{Ms: id.Ms, Seq: id.Seq + 1}, true
+	case id.Ms < math.MaxUint64:
+		return ID{Ms: id.Ms + 1}, true
+	}
+	return id, false
+}
+
+// Prev returns the greatest ID smaller than id, ok is false if id is MinID
+func (id ID) Prev() (prev ID, ok bool) {
+	switch {
+	case id.Seq > 0:
+		return ID{Ms: id.Ms, Seq: id.Seq - 1}, true
+	case id.Ms > 0:
+		return ID{Ms: id.Ms - 1, Seq: math.MaxUint64}, true
+	}
+	return id, false
+}
+
+// ParseID parses an ID in the ms-seq or ms form, the sequence of the latter being defaultSeq
+func ParseID(s string, defaultSeq uint64) (ID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return ID{}, ErrInvalidID
+	}
+	if !hasSeq {
+		return ID{Ms: ms, Seq: defaultSeq}, nil
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return ID{}, ErrInvalidID
+	}
+	return ID{Ms: ms, Seq: seq}, nil
+}
+
+// ParseRangeID parses a bound of XRANGE and similar commands: "-" and "+" stand for the smallest and greatest IDs,
+// and a missing sequence defaults to defaultSeq. exclusive is true for bounds prefixed with "("
+func ParseRangeID(s string, defaultSeq uint64) (id ID, exclusive bool, err error) {
+	switch s {
+	case "-":
+		return MinID, false, nil
+	case "+":
+		return MaxID, false, nil
+	}
+	if strings.HasPrefix(s, "(") {
+		exclusive = true
+		s = s[1:]
+	}
+	id, err = ParseID(s, defaultSeq)
+	return id, exclusive, err
+}
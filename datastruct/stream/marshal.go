@@ -0,0 +1,144 @@
+package stream
+
+import (
+	"Redis_Go/lib/codec"
+)
+
+func appendID(buf []byte, id ID) []byte {
+	buf = codec.AppendUvarint(buf, id.Ms)
+	return codec.AppendUvarint(buf, id.Seq)
+}
+
+func readID(r *codec.Reader) ID {
+	return ID{Ms: r.ReadUvarint(), Seq: r.ReadUvarint()}
+}
+
+// appendInt appends a signed value, which may be -1
+func appendInt(buf []byte, v int64) []byte {
+	return codec.AppendUvarint(buf, uint64(v))
+}
+
+func readInt(r *codec.Reader) int64 {
+	return int64(r.ReadUvarint())
+}
+
+// Marshal serializes the stream with its consumer groups and their pending entries, keeping the chunk layout
+func (s *Stream) Marshal() []byte {
+	buf := make([]byte, 0, 64+s.length*32)
+	buf = codec.AppendUvarint(buf, uint64(len(s.chunks)))
+	for _, c := range s.chunks {
+		buf = codec.AppendUvarint(buf, uint64(len(c.entries)))
+		for _, entry := range c.entries {
+			buf = appendID(buf, entry.ID)
+			buf = codec.AppendUvarint(buf, uint64(len(entry.Fields)))
+			for _, field := range entry.Fields {
+				buf = codec.AppendString(buf, field)
+			}
+		}
+	}
+	buf = appendID(buf, s.lastID)
+	buf = appendID(buf, s.maxDeletedID)
+	buf = codec.AppendUvarint(buf, s.entriesAdded)
+
+	groups := s.Groups()
+	buf = codec.AppendUvarint(buf, uint64(len(groups)))
+	for _, g := range groups {
+		buf = codec.AppendString(buf, g.Name)
+		buf = appendID(buf, g.LastID)
+		buf = appendInt(buf, g.EntriesRead)
+
+		consumers := g.Consumers()
+		buf = codec.AppendUvarint(buf, uint64(len(consumers)))
+		for _, c := range consumers {
+			buf = codec.AppendString(buf, c.Name)
+			buf = appendInt(buf, c.SeenTime)
+			buf = appendInt(buf, c.ActiveTime)
+		}
+		buf = codec.AppendUvarint(buf, uint64(len(g.pending)))
+		for _, pe := range g.pending {
+			buf = appendID(buf, pe.ID)
+			buf = codec.AppendString(buf, pe.Consumer.Name)
+			buf = appendInt(buf, pe.DeliveryTime)
+			buf = appendInt(buf, pe.DeliveryCount)
+		}
+	}
+	return buf
+}
+
+// Unmarshal restores a stream serialized by Marshal
+func Unmarshal(data []byte) (*Stream, error) {
+	r := codec.NewReader(data)
+	s := New()
+
+	var prev ID
+	chunkCount := r.ReadUvarint()
+	for i := uint64(0); i < chunkCount && r.Err() == nil; i++ {
+		n := r.ReadUvarint()
+		if n == 0 || n > uint64(r.Remaining()) {
+			return nil, codec.ErrBadFormat
+		}
+		c := &chunk{entries: make([]Entry, 0, n)}
+		for j := uint64(0); j < n && r.Err() == nil; j++ {
+			id := readID(r)
+			fieldCount := r.ReadUvarint()
+			if fieldCount > uint64(r.Remaining()) {
+				return nil, codec.ErrBadFormat
+			}
+			fields := make([]string, fieldCount)
+			for k := range fields {
+				fields[k] = r.ReadString()
+			}
+			// 条目必须严格递增
+			if (s.length > 0 || len(c.entries) > 0) && !prev.Less(id) {
+				return nil, codec.ErrBadFormat
+			}
+			prev = id
+			c.entries = append(c.entries, Entry{ID: id, Fields: fields})
+		}
+		s.chunks = append(s.chunks, c)
+		s.length += len(c.entries)
+	}
+	s.lastID = readID(r)
+	s.maxDeletedID = readID(r)
+	s.entriesAdded = r.ReadUvarint()
+	if last, ok := s.Last(); ok && s.lastID.Less(last.ID) {
+		return nil, codec.ErrBadFormat
+	}
+
+	groupCount := r.ReadUvarint()
+	for i := uint64(0); i < groupCount && r.Err() == nil; i++ {
+		g, ok := s.CreateGroup(r.ReadString(), readID(r), readInt(r))
+		if !ok {
+			return nil, codec.ErrBadFormat
+		}
+		consumerCount := r.ReadUvarint()
+		for j := uint64(0); j < consumerCount && r.Err() == nil; j++ {
+			c, ok := g.CreateConsumer(r.ReadString(), readInt(r))
+			if !ok {
+				return nil, codec.ErrBadFormat
+			}
+			c.ActiveTime = readInt(r)
+		}
+		pendingCount := r.ReadUvarint()
+		for j := uint64(0); j < pendingCount && r.Err() == nil; j++ {
+			id := readID(r)
+			c, ok := g.Consumer(r.ReadString())
+			if !ok {
+				return nil, codec.ErrBadFormat
+			}
+			if _, dup := g.Pending(id); dup {
+				return nil, codec.ErrBadFormat
+			}
+			pe := g.Deliver(id, c, readInt(r))
+			pe.DeliveryCount = readInt(r)
+		}
+	}
+
+	if r.Err() != nil {
+		return nil, r.Err()
+	}
+	if r.Remaining() != 0 {
+		return nil, codec.ErrBadFormat
+	}
+	return s, nil
+}
@@ -0,0 +1,385 @@
+// Package stream implements the Redis stream type: an append-only log of entries identified by
+// ms-seq IDs, with consumer groups tracking what each consumer has read and not yet acknowledged.
+//
+// Entries are kept in chunks of at most ChunkMaxEntries entries ordered by ID, playing the role of
+// the listpacks Redis stores in its radix tree. Lookups binary search the chunks, then the entries,
+// and approximate trimming removes whole chunks only.
+package stream
+
+import (
+	"math"
+	"slices"
+	"sort"
+)
+
+// ChunkMaxEntries is the number of entries a chunk holds before a new one is started,
+// the default of stream-node-max-entries
+const ChunkMaxEntries = 100
+
+// InvalidEntriesRead marks the entries read counter of a group as unknown
+const InvalidEntriesRead = -1
+
+// Entry is a stream entry, Fields holds its field value pairs one after the other
+type Entry struct {
+	ID     ID
+	Fields []string
+}
+
+type chunk struct {
+	entries []Entry
+}
+
+func (c *chunk) lastID() ID {
+	return c.entries[len(c.entries)-1].ID
+}
+
+// Stream is a stream value
+type Stream struct {
+	chunks       []*chunk
+	length       int
+	lastID       ID
+	maxDeletedID ID
+	entriesAdded uint64
+	groups       map[string]*Group
+}
+
+// New creates an empty stream
+func New() *Stream {
+	return &Stream{groups: make(map[string]*Group)}
+}
+
+// Len returns the number of entries
+func (s *Stream) Len() int {
+	return s.length
+}
+
+// LastID returns the ID of the last entry ever added, which remains after the entry is deleted
+func (s *Stream) LastID() ID {
+	return s.lastID
+}
+
+// MaxDeletedID returns the greatest ID removed by XDEL
+func (s *Stream) MaxDeletedID() ID {
+	return s.maxDeletedID
+}
+
+// EntriesAdded returns the number of entries ever added
+func (s *Stream) EntriesAdded() uint64 {
+	return s.entriesAdded
+}
+
+// ChunkCount returns the number of chunks holding the entries
+func (s *Stream) ChunkCount() int {
+	return len(s.chunks)
+}
+
+// First returns the first entry
+func (s *Stream) First() (Entry, bool) {
+	if s.length == 0 {
+		return Entry{}, false
+	}
+	return s.chunks[0].entries[0], true
+}
+
+// Last returns the last entry
+func (s *Stream) Last() (Entry, bool) {
+	if s.length == 0 {
+		return Entry{}, false
+	}
+	c := s.chunks[len(s.chunks)-1]
+	return c.entries[len(c.entries)-1], true
+}
+
+// NextID returns the ID XADD * gives the next entry at time nowMs, ok is false if no greater ID exists
+func (s *Stream) NextID(nowMs uint64) (ID, bool) {
+	if nowMs > s.lastID.Ms {
+		return ID{Ms: nowMs}, true
+	}
+	return s.lastID.Next()
+}
+
+// NextSeqID returns the ID XADD ms-* gives the next entry, ok is false if no ID greater than the last one has ms
+func (s *Stream) NextSeqID(ms uint64) (ID, bool) {
+	switch {
+	case ms > s.lastID.Ms:
+		return ID{Ms: ms}, true
+	case ms == s.lastID.Ms && s.lastID.Seq < math.MaxUint64:
+		return ID{Ms: ms, Seq: s.lastID.Seq + 1}, true
+	}
+	return ID{}, false
+}
+
+// Add appends an entry, whose ID must be greater than LastID
+func (s *Stream) Add(id ID, fields []string) {
+	n := len(s.chunks)
+	if n == 0 || len(s.chunks[n-1].entries) >= ChunkMaxEntries {
+		s.chunks = append(s.chunks, &chunk{entries: make([]Entry, 0, 8)})
+		n++
+	}
+	last := s.chunks[n-1]
+	last.entries = append(last.entries, Entry{ID: id, Fields: fields})
+	s.length++
+	s.lastID = id
+	s.entriesAdded++
+}
+
+// seek returns the position of the first entry whose ID is not less than id
+func (s *Stream) seek(id ID) (chunkIdx, entryIdx int) {
+	chunkIdx = sort.Search(len(s.chunks), func(i int) bool {
+		return !s.chunks[i].lastID().Less(id)
+	})
+	if chunkIdx == len(s.chunks) {
+		return chunkIdx, 0
+	}
+	entries := s.chunks[chunkIdx].entries
+	entryIdx = sort.Search(len(entries), func(i int) bool {
+		return !entries[i].ID.Less(id)
+	})
+	return chunkIdx, entryIdx
+}
+
+// Get returns the entry with the given ID
+func (s *Stream) Get(id ID) (Entry, bool) {
+	ci, ei := s.seek(id)
+	if ci < len(s.chunks) && s.chunks[ci].entries[ei].ID == id {
+		return s.chunks[ci].entries[ei], true
+	}
+	return Entry{}, false
+}
+
+// Range returns the entries with IDs between start and end, inclusive, at most count of them if count > 0.
+// If reverse is true they are walked from end down to start
+func (s *Stream) Range(start, end ID, count int, reverse bool) []Entry {
+	var result []Entry
+	if end.Less(start) {
+		return result
+	}
+	full := func() bool {
+		return count > 0 && len(result) >= count
+	}
+
+	if !reverse {
+		ci, ei := s.seek(start)
+		for ; ci < len(s.chunks); ci, ei = ci+1, 0 {
+			for _, entry := range s.chunks[ci].entries[ei:] {
+				if end.Less(entry.ID) || full() {
+					return result
+				}
+				result = append(result, entry)
+			}
+		}
+		return result
+	}
+
+	// 从 end 之后的第一个位置往回走
+	ci, ei := len(s.chunks), 0
+	if next, ok := end.Next(); ok {
+		ci, ei = s.seek(next)
+	}
+	for {
+		if ei == 0 {
+			if ci == 0 {
+				return result
+			}
+			ci--
+			ei = len(s.chunks[ci].entries)
+		}
+		ei--
+		entry := s.chunks[ci].entries[ei]
+		if entry.ID.Less(start) || full() {
+			return result
+		}
+		result = append(result, entry)
+	}
+}
+
+// Delete removes the entry with the given ID, as XDEL does
+func (s *Stream) Delete(id ID) bool {
+	ci, ei := s.seek(id)
+	if ci == len(s.chunks) || s.chunks[ci].entries[ei].ID != id {
+		return false
+	}
+	s.removeAt(ci, ei)
+	if s.maxDeletedID.Less(id) {
+		s.maxDeletedID = id
+	}
+	return true
+}
+
+func (s *Stream) removeAt(ci, ei int) {
+	c := s.chunks[ci]
+	c.entries = append(c.entries[:ei], c.entries[ei+1:]...)
+	if len(c.entries) == 0 {
+		s.chunks = append(s.chunks[:ci], s.chunks[ci+1:]...)
+	}
+	s.length--
+}
+
+// TrimByLen removes the oldest entries until at most maxLen remain and returns how many were removed.
+// With approx only whole chunks are removed, so a few more than maxLen may remain.
+// limit caps the number of entries removed if it is positive
+func (s *Stream) TrimByLen(maxLen int, approx bool, limit int) int {
+	return s.trim(func(c *chunk) int {
+		excess := s.length - maxLen
+		if excess <= 0 {
+			return 0
+		}
+		return min(excess, len(c.entries))
+	}, approx, limit)
+}
+
+// TrimByMinID removes the entries with IDs smaller than minID and returns how many were removed.
+// With approx only whole chunks are removed. limit caps the number of entries removed if it is positive
+func (s *Stream) TrimByMinID(minID ID, approx bool, limit int) int {
+	return s.trim(func(c *chunk) int {
+		return sort.Search(len(c.entries), func(i int) bool {
+			return !c.entries[i].ID.Less(minID)
+		})
+	}, approx, limit)
+}
+
+// trim removes entries from the head of the stream. removable returns how many entries at the head of
+// the first chunk may be removed
+func (s *Stream) trim(removable func(c *chunk) int, approx bool, limit int) int {
+	removed := 0
+	for len(s.chunks) > 0 {
+		c := s.chunks[0]
+		n := removable(c)
+		if n == 0 {
+			break
+		}
+		if n == len(c.entries) {
+			if limit > 0 && removed+n > limit {
+				break
+			}
+			s.chunks = s.chunks[1:]
+			s.length -= n
+			removed += n
+			continue
+		}
+		// 近似裁剪只删除整个块
+		if approx {
+			break
+		}
+		if limit > 0 {
+			n = min(n, limit-removed)
+		}
+		c.entries = append(c.entries[:0:0], c.entries[n:]...)
+		s.length -= n
+		removed += n
+		break
+	}
+	return removed
+}
+
+// HasTombstones reports whether entries with IDs not less than start may have been deleted by XDEL
+func (s *Stream) HasTombstones(start ID) bool {
+	if s.length == 0 || s.maxDeletedID.IsZero() {
+		return false
+	}
+	return !s.maxDeletedID.Less(start)
+}
+
+// EstimateEntriesRead returns the number of entries added up to and including id,
+// or InvalidEntriesRead if deletions make it impossible to know
+func (s *Stream) EstimateEntriesRead(id ID) int64 {
+	if s.entriesAdded == 0 {
+		return 0
+	}
+	if s.length == 0 && !s.lastID.Less(id) {
+		return int64(s.entriesAdded)
+	}
+	switch s.lastID.Compare(id) {
+	case 0:
+		return int64(s.entriesAdded)
+	case -1:
+		return InvalidEntriesRead
+	}
+
+	first, _ := s.First()
+	if s.maxDeletedID.IsZero() || s.maxDeletedID.Less(first.ID) {
+		// 首个条目之后没有被删除的条目
+		switch id.Compare(first.ID) {
+		case -1:
+			return int64(s.entriesAdded) - int64(s.length)
+		case 0:
+			return int64(s.entriesAdded) - int64(s.length) + 1
+		}
+	}
+	return InvalidEntriesRead
+}
+
+// Lag returns the number of entries the group has yet to read, ok is false if it can't be known
+func (s *Stream) Lag(g *Group) (lag int64, ok bool) {
+	if s.entriesAdded == 0 {
+		return 0, true
+	}
+	if g.EntriesRead != InvalidEntriesRead && !s.HasTombstones(g.LastID) {
+		return int64(s.entriesAdded) - g.EntriesRead, true
+	}
+	if read := s.EstimateEntriesRead(g.LastID); read != InvalidEntriesRead {
+		return int64(s.entriesAdded) - read, true
+	}
+	return 0, false
+}
+
+// MarkRead advances the entries read counter of the group past the entry id, which it has just been given
+func (s *Stream) MarkRead(g *Group, id ID) {
+	if g.EntriesRead != InvalidEntriesRead && !s.HasTombstones(id) {
+		g.EntriesRead++
+	} else if s.entriesAdded > 0 {
+		g.EntriesRead = s.EstimateEntriesRead(id)
+	}
+}
+
+// Group returns the consumer group with the given name
+func (s *Stream) Group(name string) (*Group, bool) {
+	g, ok := s.groups[name]
+	return g, ok
+}
+
+// CreateGroup creates a consumer group, ok is false if it already exists
+func (s *Stream) CreateGroup(name string, lastID ID, entriesRead int64) (*Group, bool) {
+	if _, exists := s.groups[name]; exists {
+		return nil, false
+	}
+	g := newGroup(name, lastID, entriesRead)
+	s.groups[name] = g
+	return g, true
+}
+
+// DestroyGroup removes a consumer group
+func (s *Stream) DestroyGroup(name string) bool {
+	if _, exists := s.groups[name]; !exists {
+		return false
+	}
+	delete(s.groups, name)
+	return true
+}
+
+// Clone returns a deep copy of the stream and its consumer groups.
+// Entries are never modified in place, so the copy shares their fields
+func (s *Stream) Clone() *Stream {
+	clone := *s
+	clone.chunks = make([]*chunk, len(s.chunks))
+	for i, c := range s.chunks {
+		clone.chunks[i] = &chunk{entries: slices.Clone(c.entries)}
+	}
+	clone.groups = make(map[string]*Group, len(s.groups))
+	for name, g := range s.groups {
+		clone.groups[name] = g.clone()
+	}
+	return &clone
+}
+
+// Groups returns the consumer groups ordered by name
+func (s *Stream) Groups() []*Group {
+	groups := make([]*Group, 0, len(s.groups))
+	for _, g := range s.groups {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+	return groups
+}
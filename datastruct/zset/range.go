@@ -0,0 +1,281 @@
+package zset
+
+import (
+	"Redis_Go/lib/wildcard"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+)
+
+var (
+	ErrInvalidScoreBorder = errors.New("ERR min or max is not a float")
+	ErrInvalidLexBorder   = errors.New("ERR min or max not valid string range item")
+)
+
+// Element is a member of a sorted set together with its score
+type Element struct {
+	Member string
+	Score  float64
+}
+
+// ScoreBorder is one end of a score range, such as "1.5", "(1.5", "-inf" or "+inf"
+type ScoreBorder struct {
+	Value   float64
+	Exclude bool
+}
+
+// ParseScoreBorder parses a score range bound, where a leading '(' makes it exclusive
+func ParseScoreBorder(s string) (ScoreBorder, error) {
+	border := ScoreBorder{}
+	if len(s) > 0 && s[0] == '(' {
+		border.Exclude = true
+		s = s[1:]
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(value) {
+		return ScoreBorder{}, ErrInvalidScoreBorder
+	}
+	border.Value = value
+	return border, nil
+}
+
+// below reports whether score lies before the range starting at this border
+func (b ScoreBorder) below(score float64) bool {
+	return score < b.Value || (b.Exclude && score == b.Value)
+}
+
+// within reports whether score doesn't go past the range ending at this border
+func (b ScoreBorder) within(score float64) bool {
+	return score < b.Value || (!b.Exclude && score == b.Value)
+}
+
+// LexBorder is one end of a lexicographical range, such as "[a", "(a", "-" or "+"
+type LexBorder struct {
+	Value   string
+	Exclude bool
+	Inf     int // -1 for "-", 1 for "+", 0 for a bounded border
+}
+
+// ParseLexBorder parses a lexicographical range bound
+func ParseLexBorder(s string) (LexBorder, error) {
+	switch {
+	case s == "-":
+		return LexBorder{Inf: -1}, nil
+	case s == "+":
+		return LexBorder{Inf: 1}, nil
+	case len(s) > 0 && s[0] == '(':
+		return LexBorder{Value: s[1:], Exclude: true}, nil
+	case len(s) > 0 && s[0] == '[':
+		return LexBorder{Value: s[1:]}, nil
+	}
+	return LexBorder{}, ErrInvalidLexBorder
+}
+
+// below reports whether member lies before the range starting at this border
+func (b LexBorder) below(member string) bool {
+	if b.Inf != 0 {
+		return b.Inf > 0
+	}
+	return member < b.Value || (b.Exclude && member == b.Value)
+}
+
+// within reports whether member doesn't go past the range ending at this border
+func (b LexBorder) within(member string) bool {
+	if b.Inf != 0 {
+		return b.Inf > 0
+	}
+	return member < b.Value || (!b.Exclude && member == b.Value)
+}
+
+// elementLess orders elements by score, then by member
+func elementLess(a, b Element) bool {
+	return a.Score < b.Score || (a.Score == b.Score && a.Member < b.Member)
+}
+
+// elementMembers returns the members of elements
+func elementMembers(elements []Element) []string {
+	members := make([]string, len(elements))
+	for i, element := range elements {
+		members[i] = element.Member
+	}
+	return members
+}
+
+// countWhile returns the number of leading elements, in (score, member) order, for which pred holds.
+// pred must hold for a prefix of the elements
+func (z *zset) countWhile(pred func(member string, score float64) bool) int {
+	if z.encoding == encodingSkiplist {
+		return z.skiplist.CountWhile(pred)
+	}
+	return sort.Search(len(z.listpack), func(i int) bool {
+		return !pred(z.listpack[i].Member, z.listpack[i].Score)
+	})
+}
+
+// elementsByRank returns the elements ranked start to stop (0-based, inclusive, within bounds).
+// If reverse is true they are returned from stop down to start
+func (z *zset) elementsByRank(start, stop int, reverse bool) []Element {
+	result := make([]Element, 0, stop-start+1)
+	if z.encoding == encodingSkiplist {
+		node := z.skiplist.GetByRank(start + 1)
+		for i := start; i <= stop && node != nil; i++ {
+			result = append(result, Element{Member: node.Member, Score: node.Score})
+			node = node.Levels[0].Forward
+		}
+	} else {
+		result = append(result, z.listpack[start:stop+1]...)
+	}
+	if reverse {
+		for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+			result[i], result[j] = result[j], result[i]
+		}
+	}
+	return result
+}
+
+// limitRanks applies offset and count to the ranks lo to hi-1, walked in the requested direction,
+// and returns the resulting ranks as an inclusive range. A negative count means no limit
+func limitRanks(lo, hi, offset, count int, reverse bool) (start, stop int, ok bool) {
+	n := hi - lo
+	if offset < 0 || offset >= n {
+		return 0, 0, false
+	}
+	take := n - offset
+	if count >= 0 && count < take {
+		take = count
+	}
+	if take == 0 {
+		return 0, 0, false
+	}
+	if reverse {
+		return hi - offset - take, hi - 1 - offset, true
+	}
+	return lo + offset, lo + offset + take - 1, true
+}
+
+// RangeByRankElements returns the elements ranked start to stop, where negative ranks count from the end.
+// If reverse is true ranks count from the highest score down
+func (z *zset) RangeByRankElements(start, stop int, reverse bool) []Element {
+	size := z.Len()
+	if start < 0 {
+		start += size
+	}
+	if stop < 0 {
+		stop += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= size {
+		stop = size - 1
+	}
+	if start > stop || start >= size {
+		return []Element{}
+	}
+	if reverse {
+		start, stop = size-1-stop, size-1-start
+	}
+	return z.elementsByRank(start, stop, reverse)
+}
+
+// scoreRanks returns the ranks lo to hi-1 of the elements whose scores lie between min and max
+func (z *zset) scoreRanks(min, max ScoreBorder) (lo, hi int) {
+	lo = z.countWhile(func(member string, score float64) bool {
+		return min.below(score)
+	})
+	hi = z.countWhile(func(member string, score float64) bool {
+		return max.within(score)
+	})
+	if hi < lo {
+		hi = lo
+	}
+	return lo, hi
+}
+
+// lexRanks returns the ranks lo to hi-1 of the members between min and max.
+// Like in Redis, it assumes all the members share the same score
+func (z *zset) lexRanks(min, max LexBorder) (lo, hi int) {
+	lo = z.countWhile(func(member string, score float64) bool {
+		return min.below(member)
+	})
+	hi = z.countWhile(func(member string, score float64) bool {
+		return max.within(member)
+	})
+	if hi < lo {
+		hi = lo
+	}
+	return lo, hi
+}
+
+// RangeByScoreElements returns the elements with scores between min and max, skipping offset of them
+// and returning at most count (all if count is negative). If reverse is true they are walked from max down
+func (z *zset) RangeByScoreElements(min, max ScoreBorder, offset, count int, reverse bool) []Element {
+	lo, hi := z.scoreRanks(min, max)
+	start, stop, ok := limitRanks(lo, hi, offset, count, reverse)
+	if !ok {
+		return []Element{}
+	}
+	return z.elementsByRank(start, stop, reverse)
+}
+
+// RangeByLexElements returns the members between min and max, skipping offset of them
+// and returning at most count (all if count is negative). If reverse is true they are walked from max down
+func (z *zset) RangeByLexElements(min, max LexBorder, offset, count int, reverse bool) []Element {
+	lo, hi := z.lexRanks(min, max)
+	start, stop, ok := limitRanks(lo, hi, offset, count, reverse)
+	if !ok {
+		return []Element{}
+	}
+	return z.elementsByRank(start, stop, reverse)
+}
+
+// CountByScore returns the number of elements with scores between min and max
+func (z *zset) CountByScore(min, max ScoreBorder) int {
+	lo, hi := z.scoreRanks(min, max)
+	return hi - lo
+}
+
+// CountByLex returns the number of members between min and max
+func (z *zset) CountByLex(min, max LexBorder) int {
+	lo, hi := z.lexRanks(min, max)
+	return hi - lo
+}
+
+// Rank returns the 0-based rank of member, counted from the highest score if reverse is true
+func (z *zset) Rank(member string, reverse bool) (int, bool) {
+	score, exists := z.Score(member)
+	if !exists {
+		return 0, false
+	}
+	target := Element{Member: member, Score: score}
+	rank := z.countWhile(func(m string, s float64) bool {
+		return elementLess(Element{Member: m, Score: s}, target)
+	})
+	if reverse {
+		rank = z.Len() - 1 - rank
+	}
+	return rank, true
+}
+
+// Scan returns about count elements from cursor on, together with the cursor to continue from, which is 0
+// once the scan is complete. The skiplist encoding is walked incrementally through its dict by
+// hashtable.Table.Scan, so an element present for the whole scan is returned at least once.
+// A listpack is small and, as in Redis, is returned whole in a single call
+func (z *zset) Scan(cursor uint64, count int, pattern string) ([]Element, uint64) {
+	matcher := wildcard.CompilePattern(pattern)
+	var result []Element
+	add := func(member string, score float64) {
+		if matcher.IsMatch(member) {
+			result = append(result, Element{Member: member, Score: score})
+		}
+	}
+	if z.encoding == encodingListpack {
+		for _, element := range z.listpack {
+			add(element.Member, element.Score)
+		}
+		return result, 0
+	}
+	next := z.dict.Scan(cursor, count, add)
+	return result, next
+}
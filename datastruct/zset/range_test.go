@@ -0,0 +1,65 @@
+package zset
+
+import (
+	"strconv"
+	"testing"
+)
+
+// boundarySizes are the largest listpack and the smallest skiplist
+var boundarySizes = []int{listpackMaxSize, listpackMaxSize + 1}
+
+func newBenchZSet(b *testing.B, n int) ZSet {
+	z := NewZSet()
+	for i := 0; i < n; i++ {
+		z.Add("member:"+strconv.Itoa(i), float64(i*3%n))
+	}
+	want := encodingListpack
+	if n > listpackMaxSize {
+		want = encodingSkiplist
+	}
+	if z.Encoding() != want {
+		b.Fatalf("a zset of %d elements has encoding %d, want %d", n, z.Encoding(), want)
+	}
+	return z
+}
+
+func encodingName(z ZSet) string {
+	if z.Encoding() == encodingListpack {
+		return "listpack"
+	}
+	return "skiplist"
+}
+
+// BenchmarkZRange measures ZRANGE key 0 9 and ZRANGE key 0 -1 on both sides of the conversion
+func BenchmarkZRange(b *testing.B) {
+	for _, n := range boundarySizes {
+		z := newBenchZSet(b, n)
+		for _, stop := range []int{9, -1} {
+			b.Run(strconv.Itoa(n)+"-"+encodingName(z)+"/stop="+strconv.Itoa(stop), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					z.RangeByRankElements(0, stop, false)
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkZRank measures ZRANK of members spread over the zset on both sides of the conversion
+func BenchmarkZRank(b *testing.B) {
+	for _, n := range boundarySizes {
+		z := newBenchZSet(b, n)
+		members := make([]string, n)
+		for i := range members {
+			members[i] = "member:" + strconv.Itoa(i)
+		}
+		b.Run(strconv.Itoa(n)+"-"+encodingName(z), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, ok := z.Rank(members[i%n], false); !ok {
+					b.Fatal("member not found")
+				}
+			}
+		})
+	}
+}
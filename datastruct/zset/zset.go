@@ -1,10 +1,13 @@
 package zset
 
 import (
+	"Redis_Go/datastruct/hashtable"
 	"Redis_Go/datastruct/skiplist"
-	"fmt"
+	"Redis_Go/lib/codec"
+	"math"
+	"math/rand"
+	"slices"
 	"sort"
-	"strconv"
 )
 
 const (
@@ -25,15 +28,27 @@ type ZSet interface {
 	RangeByScore(min, max float64, offset, count int) []string
 	RangeByRank(start, stop int) []string
 	RemoveRangeByRank(start, stop int) int
-	RemoveRangeByScore(min, max float64) int
+	RemoveRangeByScore(min, max ScoreBorder) int
+	RemoveRangeByLex(min, max LexBorder) int
 	Encoding() int
 	GetSkiplist() *skiplist.SkipList
+	Marshal() []byte
+	Clone() ZSet
+
+	RangeByRankElements(start, stop int, reverse bool) []Element
+	RangeByScoreElements(min, max ScoreBorder, offset, count int, reverse bool) []Element
+	RangeByLexElements(min, max LexBorder, offset, count int, reverse bool) []Element
+	CountByScore(min, max ScoreBorder) int
+	CountByLex(min, max LexBorder) int
+	Rank(member string, reverse bool) (int, bool)
+	RandomElements(count int, distinct bool) []Element
+	Scan(cursor uint64, count int, pattern string) ([]Element, uint64)
 }
 
 type zset struct {
 	encoding int
-	listpack [][2]string
-	dict     map[string]float64
+	listpack []Element // ordered by (score, member), so ranges and ranks are found by binary search
+	dict     *hashtable.Table[float64]
 	skiplist *skiplist.SkipList
 }
 
@@ -41,7 +56,7 @@ type zset struct {
 func NewZSet() ZSet {
 	return &zset{
 		encoding: encodingListpack,
-		listpack: make([][2]string, 0),
+		listpack: make([]Element, 0),
 	}
 }
 
@@ -51,26 +66,34 @@ func (z *zset) Add(member string, score float64) bool {
 	// Check if we're using listpack encoding
 	if z.encoding == encodingListpack {
 		// Check if member already exists in listpack
-		for i, pair := range z.listpack {
-			if pair[0] == member {
-				// Update score if member already exists
-				z.listpack[i][1] = formatScore(score)
+		isNew := true
+		if i := z.listpackIndex(member); i >= 0 {
+			if z.listpack[i].Score == score {
 				return false
 			}
+			// Take the member out, it is inserted again at the position of its new score
+			z.listpack = append(z.listpack[:i], z.listpack[i+1:]...)
+			isNew = false
 		}
 
-		// Add new member to listpack
-		z.listpack = append(z.listpack, [2]string{member, formatScore(score)})
+		// Insert the member keeping the listpack ordered
+		element := Element{Member: member, Score: score}
+		pos := sort.Search(len(z.listpack), func(i int) bool {
+			return !elementLess(z.listpack[i], element)
+		})
+		z.listpack = append(z.listpack, Element{})
+		copy(z.listpack[pos+1:], z.listpack[pos:])
+		z.listpack[pos] = element
 
 		// Convert to skiplist encoding if listpack grows too large
 		if len(z.listpack) > listpackMaxSize {
 			z.convertToSkiplist()
 		}
-		return true
+		return isNew
 	}
 
 	// Using skiplist encoding
-	existingScore, exists := z.dict[member]
+	existingScore, exists := z.dict.Get(member)
 	if exists {
 		// If score changed, update both dict and skiplist
 		if existingScore != score {
@@ -79,25 +102,25 @@ func (z *zset) Add(member string, score float64) bool {
 			// Insert with new score
 			z.skiplist.Insert(member, score)
 			// Update score in dict
-			z.dict[member] = score
+			z.dict.Set(member, score)
 		}
 		return false
 	}
 
 	// Add new member to both dict and skiplist
-	z.dict[member] = score
+	z.dict.Set(member, score)
 	z.skiplist.Insert(member, score)
 	return true
 }
 
-// Helper function to format score as string
-func formatScore(score float64) string {
-	return fmt.Sprintf("%f", score)
-}
-
-// Helper function to parse score string to float64
-func parseScore(scoreStr string) (float64, error) {
-	return strconv.ParseFloat(scoreStr, 64)
+// listpackIndex returns the position of member in the listpack, or -1 if it is absent
+func (z *zset) listpackIndex(member string) int {
+	for i := range z.listpack {
+		if z.listpack[i].Member == member {
+			return i
+		}
+	}
+	return -1
 }
 
 // Convert from listpack to skiplist encoding
@@ -108,14 +131,12 @@ func (z *zset) convertToSkiplist() {
 
 	// Initialize skiplist and dict
 	z.skiplist = skiplist.NewSkipList()
-	z.dict = make(map[string]float64, len(z.listpack))
+	z.dict = hashtable.New[float64](len(z.listpack))
 
 	// Transfer all elements from listpack to skiplist and dict
-	for _, pair := range z.listpack {
-		member := pair[0]
-		score, _ := parseScore(pair[1])
-		z.dict[member] = score
-		z.skiplist.Insert(member, score)
+	for _, element := range z.listpack {
+		z.dict.Set(element.Member, element.Score)
+		z.skiplist.Insert(element.Member, element.Score)
 	}
 
 	// Update encoding and clear listpack
@@ -126,54 +147,30 @@ func (z *zset) convertToSkiplist() {
 // Score returns the score of a member, and a boolean indicating if the member exists
 func (z *zset) Score(member string) (float64, bool) {
 	if z.encoding == encodingListpack {
-		for _, pair := range z.listpack {
-			if pair[0] == member {
-				score, err := parseScore(pair[1])
-				if err != nil {
-					return 0, false
-				}
-				return score, true
-			}
+		if i := z.listpackIndex(member); i >= 0 {
+			return z.listpack[i].Score, true
 		}
 		return 0, false
 	}
 
 	// Using skiplist encoding
-	score, exists := z.dict[member]
-	return score, exists
+	return z.dict.Get(member)
 }
 
 // Exists checks if a member exists in the sorted set
 func (z *zset) Exists(member string) bool {
 	if z.encoding == encodingListpack {
-		for _, pair := range z.listpack {
-			if pair[0] == member {
-				return true
-			}
-		}
-		return false
+		return z.listpackIndex(member) >= 0
 	}
 
 	// Using skiplist encoding
-	_, exists := z.dict[member]
+	_, exists := z.dict.Get(member)
 	return exists
 }
 
 // Count returns the number of elements in the specified score range
 func (z *zset) Count(min, max float64) int {
-	if z.encoding == encodingListpack {
-		count := 0
-		for _, pair := range z.listpack {
-			score, _ := parseScore(pair[1])
-			if score >= min && score <= max {
-				count++
-			}
-		}
-		return count
-	}
-
-	// Using skiplist encoding
-	return z.skiplist.CountInRange(min, max)
+	return z.CountByScore(ScoreBorder{Value: min}, ScoreBorder{Value: max})
 }
 
 // Len returns the number of elements in the sorted set
@@ -181,48 +178,17 @@ func (z *zset) Len() int {
 	if z.encoding == encodingListpack {
 		return len(z.listpack)
 	}
-	return len(z.dict)
+	return z.dict.Len()
 }
 
 // RangeByScore returns members with scores between min and max
 // Limit: if offset >=0 and count > 0, return at most count members starting from offset
 func (z *zset) RangeByScore(min, max float64, offset, count int) []string {
 	if z.encoding == encodingListpack {
-		// Get matching elements from listpack
-		var matches [][2]string
-		for _, pair := range z.listpack {
-			score, _ := parseScore(pair[1])
-			if score >= min && score <= max {
-				matches = append(matches, pair)
-			}
-		}
-
-		// Sort matches by score
-		sort.Slice(matches, func(i, j int) bool {
-			scoreI, _ := parseScore(matches[i][1])
-			scoreJ, _ := parseScore(matches[j][1])
-			return scoreI < scoreJ
-		})
-
-		// Apply offset and count if specified
-		if offset >= 0 && count > 0 {
-			end := offset + count
-			if end > len(matches) {
-				end = len(matches)
-			}
-			if offset < len(matches) {
-				matches = matches[offset:end]
-			} else {
-				matches = nil
-			}
+		if offset < 0 || count <= 0 {
+			offset, count = 0, -1
 		}
-
-		// Extract member names
-		result := make([]string, len(matches))
-		for i, pair := range matches {
-			result[i] = pair[0]
-		}
-		return result
+		return elementMembers(z.RangeByScoreElements(ScoreBorder{Value: min}, ScoreBorder{Value: max}, offset, count, false))
 	}
 
 	// Using skiplist encoding
@@ -233,40 +199,7 @@ func (z *zset) RangeByScore(min, max float64, offset, count int) []string {
 // Returns members between start and stop ranks (inclusive, 0-based)
 func (z *zset) RangeByRank(start, stop int) []string {
 	if z.encoding == encodingListpack {
-		// Copy and sort listpack elements by score
-		pairs := make([][2]string, len(z.listpack))
-		copy(pairs, z.listpack)
-
-		sort.Slice(pairs, func(i, j int) bool {
-			scoreI, _ := parseScore(pairs[i][1])
-			scoreJ, _ := parseScore(pairs[j][1])
-			return scoreI < scoreJ
-		})
-
-		// Handle negative indices and out of range
-		size := len(pairs)
-		if start < 0 {
-			start = size + start
-		}
-		if stop < 0 {
-			stop = size + stop
-		}
-		if start < 0 {
-			start = 0
-		}
-		if stop >= size {
-			stop = size - 1
-		}
-		if start > stop || start >= size {
-			return []string{}
-		}
-
-		// Extract member names
-		result := make([]string, 0, stop-start+1)
-		for i := start; i <= stop; i++ {
-			result = append(result, pairs[i][0])
-		}
-		return result
+		return elementMembers(z.RangeByRankElements(start, stop, false))
 	}
 
 	// Using skiplist encoding
@@ -277,21 +210,19 @@ func (z *zset) RangeByRank(start, stop int) []string {
 // Returns true if the member was removed, false if it didn't exist
 func (z *zset) Remove(member string) bool {
 	if z.encoding == encodingListpack {
-		for i, pair := range z.listpack {
-			if pair[0] == member {
-				// Remove the member by slicing it out
-				z.listpack = append(z.listpack[:i], z.listpack[i+1:]...)
-				return true
-			}
+		if i := z.listpackIndex(member); i >= 0 {
+			// Remove the member by slicing it out
+			z.listpack = append(z.listpack[:i], z.listpack[i+1:]...)
+			return true
 		}
 		return false
 	}
 
 	// Using skiplist encoding
-	score, exists := z.dict[member]
+	score, exists := z.dict.Get(member)
 	if exists {
 		z.skiplist.Delete(member, score)
-		delete(z.dict, member)
+		z.dict.Delete(member)
 		return true
 	}
 	return false
@@ -312,38 +243,61 @@ func (z *zset) RemoveRangeByRank(start, stop int) int {
 
 // RemoveRangeByScore removes all members with scores between min and max
 // Returns number of members removed
-func (z *zset) RemoveRangeByScore(min, max float64) int {
-	if z.encoding == encodingListpack {
-		// Find members to remove
-		toRemove := make([]string, 0)
-		for _, pair := range z.listpack {
-			score, _ := parseScore(pair[1])
-			if score >= min && score <= max {
-				toRemove = append(toRemove, pair[0])
-			}
-		}
+func (z *zset) RemoveRangeByScore(min, max ScoreBorder) int {
+	return z.removeElements(z.RangeByScoreElements(min, max, 0, -1, false))
+}
 
-		// Remove the identified members
-		count := 0
-		for _, member := range toRemove {
-			if z.Remove(member) {
-				count++
-			}
-		}
-		return count
-	}
+// RemoveRangeByLex removes all members between min and max
+// Returns number of members removed
+func (z *zset) RemoveRangeByLex(min, max LexBorder) int {
+	return z.removeElements(z.RangeByLexElements(min, max, 0, -1, false))
+}
 
-	// Using skiplist encoding
-	members := z.skiplist.RangeByScore(min, max, 0, -1)
+func (z *zset) removeElements(elements []Element) int {
 	count := 0
-	for _, member := range members {
-		if z.Remove(member) {
+	for _, element := range elements {
+		if z.Remove(element.Member) {
 			count++
 		}
 	}
 	return count
 }
 
+// RandomElements returns count random elements.
+// If distinct is true no element is returned twice, so at most Len() elements are returned
+func (z *zset) RandomElements(count int, distinct bool) []Element {
+	size := z.Len()
+	if size == 0 || count <= 0 {
+		return []Element{}
+	}
+
+	if !distinct {
+		result := make([]Element, count)
+		if z.encoding == encodingSkiplist {
+			for i := range result {
+				node := z.skiplist.GetByRank(rand.Intn(size) + 1)
+				result[i] = Element{Member: node.Member, Score: node.Score}
+			}
+			return result
+		}
+		for i := range result {
+			result[i] = z.listpack[rand.Intn(size)]
+		}
+		return result
+	}
+
+	elements := z.RangeByRankElements(0, -1, false)
+	if count >= size {
+		return elements
+	}
+	// Partial Fisher-Yates shuffle
+	for i := 0; i < count; i++ {
+		j := i + rand.Intn(size-i)
+		elements[i], elements[j] = elements[j], elements[i]
+	}
+	return elements[:count]
+}
+
 // Encoding returns the current encoding type of the zset (0 for listpack, 1 for skiplist)
 func (z *zset) Encoding() int {
 	return z.encoding
@@ -357,3 +311,92 @@ func (z *zset) GetSkiplist() *skiplist.SkipList {
 	}
 	return nil
 }
+
+// Clone returns a deep copy of the sorted set, keeping its encoding
+func (z *zset) Clone() ZSet {
+	clone := &zset{
+		encoding: z.encoding,
+		listpack: slices.Clone(z.listpack),
+	}
+	if z.encoding == encodingSkiplist {
+		clone.dict = z.dict.Clone()
+		clone.skiplist = skiplist.NewSkipList()
+		for it := z.dict.Iterate(); it.Next(); {
+			clone.skiplist.Insert(it.Key(), it.Value())
+		}
+	}
+	return clone
+}
+
+// Marshal serializes the sorted set, keeping its encoding
+func (z *zset) Marshal() []byte {
+	buf := make([]byte, 0, 16+z.Len()*16)
+	buf = append(buf, byte(z.encoding))
+	buf = codec.AppendUvarint(buf, uint64(z.Len()))
+	if z.encoding == encodingListpack {
+		for _, element := range z.listpack {
+			buf = codec.AppendString(buf, element.Member)
+			buf = codec.AppendFloat(buf, element.Score)
+		}
+		return buf
+	}
+	for it := z.dict.Iterate(); it.Next(); {
+		buf = codec.AppendString(buf, it.Key())
+		buf = codec.AppendFloat(buf, it.Value())
+	}
+	return buf
+}
+
+// UnmarshalZSet restores a sorted set serialized by Marshal
+func UnmarshalZSet(data []byte) (ZSet, error) {
+	r := codec.NewReader(data)
+	encoding := int(r.ReadUint8())
+	n := r.ReadUvarint()
+	if r.Err() != nil {
+		return nil, r.Err()
+	}
+	if encoding != encodingListpack && encoding != encodingSkiplist {
+		return nil, codec.ErrBadFormat
+	}
+	// 每个元素至少占一个字节, 先检查 n 再按它分配内存
+	if n > uint64(r.Remaining()) || encoding == encodingListpack && n > listpackMaxSize {
+		return nil, codec.ErrBadFormat
+	}
+
+	z := &zset{
+		encoding: encodingListpack,
+		listpack: make([]Element, 0, n),
+	}
+	if encoding == encodingSkiplist {
+		z.convertToSkiplist()
+	}
+	for i := uint64(0); i < n; i++ {
+		member := r.ReadString()
+		score := r.ReadFloat()
+		if r.Err() != nil {
+			return nil, r.Err()
+		}
+		if math.IsNaN(score) {
+			return nil, codec.ErrBadFormat
+		}
+		if z.encoding == encodingListpack {
+			if z.listpackIndex(member) >= 0 {
+				return nil, codec.ErrBadFormat
+			}
+			z.listpack = append(z.listpack, Element{Member: member, Score: score})
+		} else {
+			if !z.dict.Set(member, score) {
+				return nil, codec.ErrBadFormat
+			}
+			z.skiplist.Insert(member, score)
+		}
+	}
+	if r.Remaining() != 0 {
+		return nil, codec.ErrBadFormat
+	}
+	// Older dumps kept the listpack in insertion order
+	sort.Slice(z.listpack, func(i, j int) bool {
+		return elementLess(z.listpack[i], z.listpack[j])
+	})
+	return z, nil
+}
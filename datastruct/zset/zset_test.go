@@ -0,0 +1,68 @@
+package zset
+
+import (
+	"Redis_Go/lib/codec"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestMarshalRoundTrip(t *testing.T) {
+	for _, n := range []int{0, 3, listpackMaxSize, listpackMaxSize + 1, 1000} {
+		z := NewZSet()
+		for i := 0; i < n; i++ {
+			z.Add("m"+strconv.Itoa(i), float64(i%7))
+		}
+		restored, err := UnmarshalZSet(z.(*zset).Marshal())
+		if err != nil {
+			t.Fatalf("n=%d: %v", n, err)
+		}
+		if restored.Len() != n || restored.Encoding() != z.Encoding() {
+			t.Fatalf("n=%d: restored len %d encoding %d, want %d %d", n, restored.Len(), restored.Encoding(), n, z.Encoding())
+		}
+		got, want := restored.RangeByRankElements(0, -1, false), z.RangeByRankElements(0, -1, false)
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("n=%d: element %d is %v, want %v", n, i, got[i], want[i])
+			}
+		}
+	}
+}
+
+// payload builds a Marshal payload from members and scores, which Marshal itself would never produce
+func payload(encoding int, n uint64, members []string, scores []float64) []byte {
+	buf := []byte{byte(encoding)}
+	buf = codec.AppendUvarint(buf, n)
+	for i, member := range members {
+		buf = codec.AppendString(buf, member)
+		buf = codec.AppendFloat(buf, scores[i])
+	}
+	return buf
+}
+
+func TestUnmarshalRejectsBadPayloads(t *testing.T) {
+	tooLong := make([]string, listpackMaxSize+1)
+	tooLongScores := make([]float64, len(tooLong))
+	for i := range tooLong {
+		tooLong[i] = strconv.Itoa(i)
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"huge count", payload(encodingListpack, 1<<40, nil, nil)},
+		{"huge count skiplist", payload(encodingSkiplist, 1<<40, nil, nil)},
+		{"count past the data", payload(encodingSkiplist, 3, []string{"a"}, []float64{1})},
+		{"unknown encoding", payload(7, 0, nil, nil)},
+		{"duplicate in listpack", payload(encodingListpack, 2, []string{"a", "a"}, []float64{1, 2})},
+		{"duplicate in skiplist", payload(encodingSkiplist, 2, []string{"a", "a"}, []float64{1, 2})},
+		{"listpack too long", payload(encodingListpack, uint64(len(tooLong)), tooLong, tooLongScores)},
+		{"NaN score", payload(encodingListpack, 1, []string{"a"}, []float64{math.NaN()})},
+		{"trailing bytes", append(payload(encodingListpack, 1, []string{"a"}, []float64{1}), 0)},
+	}
+	for _, tt := range tests {
+		if _, err := UnmarshalZSet(tt.data); err == nil {
+			t.Errorf("%s: payload accepted", tt.name)
+		}
+	}
+}
@@ -12,4 +12,9 @@ type Database interface {
 
 type DataEntity struct {
 	Data interface{}
+	// LastAccess (unix seconds) and Freq (a logarithmic access counter) are the access stats
+	// reported by OBJECT IDLETIME and OBJECT FREQ. Keys are read under shared locks, so they are
+	// only accessed atomically
+	LastAccess uint32
+	Freq       uint32
 }
@@ -0,0 +1,106 @@
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// ErrBadFormat is returned when a payload is truncated or malformed
+var ErrBadFormat = errors.New("bad data format")
+
+// AppendUvarint appends v as an unsigned varint
+func AppendUvarint(buf []byte, v uint64) []byte {
+	return binary.AppendUvarint(buf, v)
+}
+
+// AppendString appends s prefixed by its length
+func AppendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// AppendFloat appends the IEEE 754 bits of f in little endian order
+func AppendFloat(buf []byte, f float64) []byte {
+	return binary.LittleEndian.AppendUint64(buf, math.Float64bits(f))
+}
+
+// Reader decodes values written by the Append* helpers.
+// The first decoding error sticks, so callers can check Err once at the end.
+type Reader struct {
+	buf []byte
+	pos int
+	err error
+}
+
+// NewReader creates a Reader over data
+func NewReader(data []byte) *Reader {
+	return &Reader{buf: data}
+}
+
+// Err returns the first error encountered while reading
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// Remaining returns the number of unread bytes
+func (r *Reader) Remaining() int {
+	return len(r.buf) - r.pos
+}
+
+// ReadUint8 reads a single byte
+func (r *Reader) ReadUint8() uint8 {
+	if r.err != nil {
+		return 0
+	}
+	if r.pos >= len(r.buf) {
+		r.err = ErrBadFormat
+		return 0
+	}
+	b := r.buf[r.pos]
+	r.pos++
+	return b
+}
+
+// ReadUvarint reads an unsigned varint
+func (r *Reader) ReadUvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	if n <= 0 {
+		r.err = ErrBadFormat
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+// ReadString reads a length prefixed string
+func (r *Reader) ReadString() string {
+	n := r.ReadUvarint()
+	if r.err != nil {
+		return ""
+	}
+	if uint64(r.Remaining()) < n {
+		r.err = ErrBadFormat
+		return ""
+	}
+	s := string(r.buf[r.pos : r.pos+int(n)])
+	r.pos += int(n)
+	return s
+}
+
+// ReadFloat reads a float64 written by AppendFloat
+func (r *Reader) ReadFloat() float64 {
+	if r.err != nil {
+		return 0
+	}
+	if r.Remaining() < 8 {
+		r.err = ErrBadFormat
+		return 0
+	}
+	bits := binary.LittleEndian.Uint64(r.buf[r.pos:])
+	r.pos += 8
+	return math.Float64frombits(bits)
+}
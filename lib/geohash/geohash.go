@@ -0,0 +1,306 @@
+// Package geohash encodes coordinates as the 52 bit interleaved geohashes Redis uses as GEO scores,
+// and computes the cells a radius or box search has to look at
+package geohash
+
+import (
+	"math"
+)
+
+const (
+	// MaxStep is the number of bits per coordinate of a full precision geohash
+	MaxStep = 26
+
+	LonMin = -180.0
+	LonMax = 180.0
+	// Latitudes are limited to the range of the Web Mercator projection
+	LatMin = -85.05112878
+	LatMax = 85.05112878
+
+	// EarthRadius is the earth radius in meters used by Redis
+	EarthRadius = 6372797.560856
+	// mercatorMax is half the length of the equator in the Web Mercator projection
+	mercatorMax = 20037726.37
+)
+
+// Hash is a geohash of step bits per coordinate, longitude bits at odd positions and latitude bits at even ones
+type Hash struct {
+	Bits uint64
+	Step uint
+}
+
+// Range is an interval of a coordinate
+type Range struct {
+	Min, Max float64
+}
+
+// Area is the cell a Hash covers
+type Area struct {
+	Hash      Hash
+	Longitude Range
+	Latitude  Range
+}
+
+// Valid reports whether the coordinates can be encoded
+func Valid(lon, lat float64) bool {
+	return lon >= LonMin && lon <= LonMax && lat >= LatMin && lat <= LatMax
+}
+
+// interleave spreads the bits of x over the even positions and those of y over the odd ones
+func interleave(x, y uint32) uint64 {
+	return spread(x) | spread(y)<<1
+}
+
+func spread(v uint32) uint64 {
+	x := uint64(v)
+	x = (x | x<<16) & 0x0000FFFF0000FFFF
+	x = (x | x<<8) & 0x00FF00FF00FF00FF
+	x = (x | x<<4) & 0x0F0F0F0F0F0F0F0F
+	x = (x | x<<2) & 0x3333333333333333
+	x = (x | x<<1) & 0x5555555555555555
+	return x
+}
+
+// deinterleave is the inverse of interleave
+func deinterleave(v uint64) (x, y uint32) {
+	return squash(v), squash(v >> 1)
+}
+
+func squash(v uint64) uint32 {
+	x := v & 0x5555555555555555
+	x = (x | x>>1) & 0x3333333333333333
+	x = (x | x>>2) & 0x0F0F0F0F0F0F0F0F
+	x = (x | x>>4) & 0x00FF00FF00FF00FF
+	x = (x | x>>8) & 0x0000FFFF0000FFFF
+	x = (x | x>>16) & 0x00000000FFFFFFFF
+	return uint32(x)
+}
+
+// encodeRange encodes the coordinates within the given ranges
+func encodeRange(lonRange, latRange Range, lon, lat float64, step uint) Hash {
+	latOffset := (lat - latRange.Min) / (latRange.Max - latRange.Min)
+	lonOffset := (lon - lonRange.Min) / (lonRange.Max - lonRange.Min)
+	latOffset *= float64(uint64(1) << step)
+	lonOffset *= float64(uint64(1) << step)
+	return Hash{Bits: interleave(uint32(latOffset), uint32(lonOffset)), Step: step}
+}
+
+// Encode encodes valid coordinates with step bits per coordinate
+func Encode(lon, lat float64, step uint) Hash {
+	return encodeRange(Range{LonMin, LonMax}, Range{LatMin, LatMax}, lon, lat, step)
+}
+
+// EncodeStandard encodes the coordinates with the latitude range of the geohash.org strings, -90 to 90
+func EncodeStandard(lon, lat float64, step uint) Hash {
+	return encodeRange(Range{LonMin, LonMax}, Range{-90, 90}, lon, lat, step)
+}
+
+// Decode returns the cell covered by hash
+func Decode(hash Hash) Area {
+	latBits, lonBits := deinterleave(hash.Bits)
+	cells := float64(uint64(1) << hash.Step)
+	latScale, lonScale := LatMax-LatMin, LonMax-LonMin
+	return Area{
+		Hash: hash,
+		Latitude: Range{
+			Min: LatMin + float64(latBits)/cells*latScale,
+			Max: LatMin + (float64(latBits)+1)/cells*latScale,
+		},
+		Longitude: Range{
+			Min: LonMin + float64(lonBits)/cells*lonScale,
+			Max: LonMin + (float64(lonBits)+1)/cells*lonScale,
+		},
+	}
+}
+
+// DecodeScore returns the coordinates of the center of the cell of a 52 bit GEO score
+func DecodeScore(score float64) (lon, lat float64) {
+	area := Decode(Hash{Bits: uint64(score), Step: MaxStep})
+	lon = (area.Longitude.Min + area.Longitude.Max) / 2
+	lat = (area.Latitude.Min + area.Latitude.Max) / 2
+	return min(max(lon, LonMin), LonMax), min(max(lat, LatMin), LatMax)
+}
+
+// String returns the 11 character geohash.org string of a 52 bit GEO score
+func String(score float64) string {
+	const alphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+	lon, lat := DecodeScore(score)
+	bits := EncodeStandard(lon, lat, MaxStep).Bits
+
+	buf := make([]byte, 11)
+	for i := range buf {
+		idx := 0
+		// 52 位只够 10 个字符, 最后一个字符补 0
+		if i < 10 {
+			idx = int(bits>>(52-(i+1)*5)) & 0x1f
+		}
+		buf[i] = alphabet[idx]
+	}
+	return string(buf)
+}
+
+func degRad(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func radDeg(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
+
+// Distance returns the great circle distance in meters between two points
+func Distance(lon1, lat1, lon2, lat2 float64) float64 {
+	lat1r, lat2r := degRad(lat1), degRad(lat2)
+	u := math.Sin((lat2r - lat1r) / 2)
+	v := math.Sin((degRad(lon2) - degRad(lon1)) / 2)
+	a := u*u + math.Cos(lat1r)*math.Cos(lat2r)*v*v
+	return 2 * EarthRadius * math.Asin(math.Sqrt(a))
+}
+
+// latDistance returns the distance in meters between two latitudes on the same meridian
+func latDistance(lat1, lat2 float64) float64 {
+	return EarthRadius * math.Abs(degRad(lat2)-degRad(lat1))
+}
+
+// InRadius reports whether the point lies within radius meters of the center, and its distance
+func InRadius(centerLon, centerLat, lon, lat, radius float64) (float64, bool) {
+	dist := Distance(centerLon, centerLat, lon, lat)
+	return dist, dist <= radius
+}
+
+// InBox reports whether the point lies within the box of width by height meters around the center,
+// and its distance to the center
+func InBox(centerLon, centerLat, lon, lat, width, height float64) (float64, bool) {
+	// 纬度方向的距离计算更便宜, 先检查它
+	if latDistance(centerLat, lat) > height/2 {
+		return 0, false
+	}
+	if Distance(lon, lat, centerLon, lat) > width/2 {
+		return 0, false
+	}
+	return Distance(centerLon, centerLat, lon, lat), true
+}
+
+// moveX moves hash d cells east (d > 0) or west (d < 0), wrapping around
+func moveX(hash Hash, d int) Hash {
+	if d == 0 {
+		return hash
+	}
+	x := hash.Bits & 0xaaaaaaaaaaaaaaaa
+	y := hash.Bits & 0x5555555555555555
+	zz := uint64(0x5555555555555555) >> (64 - hash.Step*2)
+	if d > 0 {
+		x += zz + 1
+	} else {
+		x |= zz
+		x -= zz + 1
+	}
+	x &= 0xaaaaaaaaaaaaaaaa >> (64 - hash.Step*2)
+	return Hash{Bits: x | y, Step: hash.Step}
+}
+
+// moveY moves hash d cells north (d > 0) or south (d < 0), wrapping around
+func moveY(hash Hash, d int) Hash {
+	if d == 0 {
+		return hash
+	}
+	x := hash.Bits & 0xaaaaaaaaaaaaaaaa
+	y := hash.Bits & 0x5555555555555555
+	zz := uint64(0xaaaaaaaaaaaaaaaa) >> (64 - hash.Step*2)
+	if d > 0 {
+		y += zz + 1
+	} else {
+		y |= zz
+		y -= zz + 1
+	}
+	y &= 0x5555555555555555 >> (64 - hash.Step*2)
+	return Hash{Bits: x | y, Step: hash.Step}
+}
+
+// estimateStep returns the precision of the cells that cover a search of radius meters at the given latitude
+func estimateStep(radius, lat float64) uint {
+	if radius == 0 {
+		return MaxStep
+	}
+	step := 1
+	for radius < mercatorMax {
+		radius *= 2
+		step++
+	}
+	step -= 2 // 确保覆盖范围足够大
+
+	// 高纬度地区单元格更窄
+	if lat > 66 || lat < -66 {
+		step--
+		if lat > 80 || lat < -80 {
+			step--
+		}
+	}
+	return uint(min(max(step, 1), MaxStep))
+}
+
+// boundingBox returns the longitude and latitude ranges of a box of width by height meters around the center
+func boundingBox(lon, lat, width, height float64) (lonRange, latRange Range) {
+	latDelta := radDeg(height / 2 / EarthRadius)
+	lonDeltaTop := radDeg(width / 2 / EarthRadius / math.Cos(degRad(lat+latDelta)))
+	lonDeltaBottom := radDeg(width / 2 / EarthRadius / math.Cos(degRad(lat-latDelta)))
+	// 经线向两极汇聚, 靠近极点的一边更宽
+	lonDelta := lonDeltaTop
+	if lat < 0 {
+		lonDelta = lonDeltaBottom
+	}
+	return Range{lon - lonDelta, lon + lonDelta}, Range{lat - latDelta, lat + latDelta}
+}
+
+// SearchAreas returns the cells whose members may lie within a box of width by height meters around the center,
+// the cell of the center and its eight neighbours, without the ones that can't contain a match.
+// A radius search passes a box of twice the radius on each side, and radius is the distance
+// from the center to the farthest point of the shape
+func SearchAreas(lon, lat, width, height, radius float64) []Hash {
+	lonBounds, latBounds := boundingBox(lon, lat, width, height)
+	step := estimateStep(radius, lat)
+
+	center := Encode(lon, lat, step)
+	area := Decode(center)
+	// 中心点太靠近所在单元格的边缘时, 邻居单元格可能覆盖不了整个范围, 需要再降低一级精度
+	north, south := Decode(moveY(center, 1)), Decode(moveY(center, -1))
+	east, west := Decode(moveX(center, 1)), Decode(moveX(center, -1))
+	if step > 1 && (Distance(lon, lat, lon, north.Latitude.Max) < radius ||
+		Distance(lon, lat, lon, south.Latitude.Min) < radius ||
+		Distance(lon, lat, east.Longitude.Max, lat) < radius ||
+		Distance(lon, lat, west.Longitude.Min, lat) < radius) {
+		step--
+		center = Encode(lon, lat, step)
+		area = Decode(center)
+	}
+
+	// 不与搜索范围相交的邻居不必查找
+	skipSouth := step >= 2 && area.Latitude.Min < latBounds.Min
+	skipNorth := step >= 2 && area.Latitude.Max > latBounds.Max
+	skipWest := step >= 2 && area.Longitude.Min < lonBounds.Min
+	skipEast := step >= 2 && area.Longitude.Max > lonBounds.Max
+
+	hashes := make([]Hash, 0, 9)
+	seen := make(map[uint64]bool, 9)
+	for dy := -1; dy <= 1; dy++ {
+		if (dy < 0 && skipSouth) || (dy > 0 && skipNorth) {
+			continue
+		}
+		for dx := -1; dx <= 1; dx++ {
+			if (dx < 0 && skipWest) || (dx > 0 && skipEast) {
+				continue
+			}
+			hash := moveY(moveX(center, dx), dy)
+			// 精度很低时邻居可能回绕成同一个单元格
+			if !seen[hash.Bits] {
+				seen[hash.Bits] = true
+				hashes = append(hashes, hash)
+			}
+		}
+	}
+	return hashes
+}
+
+// ScoreRange returns the range [min, max) of the 52 bit GEO scores inside the cell of hash
+func ScoreRange(hash Hash) (min, max uint64) {
+	shift := MaxStep*2 - hash.Step*2
+	return hash.Bits << shift, (hash.Bits + 1) << shift
+}
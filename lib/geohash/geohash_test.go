@@ -0,0 +1,127 @@
+package geohash
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// the members of the GEOADD examples of Redis, with their scores and geohash strings
+var sicily = []struct {
+	name     string
+	lon, lat float64
+	score    uint64
+	str      string
+}{
+	{"Palermo", 13.361389, 38.115556, 3479099956230698, "sqc8b49rny0"},
+	{"Catania", 15.087269, 37.502669, 3479447370796909, "sqdtr74hyu0"},
+}
+
+func TestEncodeKnownScores(t *testing.T) {
+	for _, c := range sicily {
+		hash := Encode(c.lon, c.lat, MaxStep)
+		if hash.Bits != c.score {
+			t.Errorf("%s: score %d, want %d", c.name, hash.Bits, c.score)
+		}
+		if s := String(float64(c.score)); s != c.str {
+			t.Errorf("%s: geohash %s, want %s", c.name, s, c.str)
+		}
+		lon, lat := DecodeScore(float64(c.score))
+		if math.Abs(lon-c.lon) > 1e-5 || math.Abs(lat-c.lat) > 1e-5 {
+			t.Errorf("%s: decoded %f,%f, want %f,%f", c.name, lon, lat, c.lon, c.lat)
+		}
+	}
+
+	// GEODIST Sicily Palermo Catania 是 166274.1516 米
+	lon1, lat1 := DecodeScore(float64(sicily[0].score))
+	lon2, lat2 := DecodeScore(float64(sicily[1].score))
+	if dist := Distance(lon1, lat1, lon2, lat2); math.Abs(dist-166274.1516) > 1e-4 {
+		t.Errorf("distance %f, want 166274.1516", dist)
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	points := [][2]float64{{LonMin, LatMin}, {0, 0}, {LonMax - 1e-9, LatMax - 1e-9}}
+	for i := 0; i < 1000; i++ {
+		points = append(points, [2]float64{
+			LonMin + rnd.Float64()*(LonMax-LonMin),
+			LatMin + rnd.Float64()*(LatMax-LatMin),
+		})
+	}
+	for _, p := range points {
+		lon, lat := p[0], p[1]
+		for _, step := range []uint{1, 5, 13, MaxStep} {
+			area := Decode(Encode(lon, lat, step))
+			if lon < area.Longitude.Min || lon > area.Longitude.Max || lat < area.Latitude.Min || lat > area.Latitude.Max {
+				t.Fatalf("step %d: %f,%f outside its cell %+v", step, lon, lat, area)
+			}
+		}
+		// 完整精度的单元格中心离原坐标不超过半个单元格
+		decodedLon, decodedLat := DecodeScore(float64(Encode(lon, lat, MaxStep).Bits))
+		if math.Abs(decodedLon-lon) > (LonMax-LonMin)/(1<<MaxStep) ||
+			math.Abs(decodedLat-lat) > (LatMax-LatMin)/(1<<MaxStep) {
+			t.Fatalf("%f,%f decoded to %f,%f", lon, lat, decodedLon, decodedLat)
+		}
+	}
+}
+
+func TestInterleave(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		x, y := rnd.Uint32(), rnd.Uint32()
+		if gotX, gotY := deinterleave(interleave(x, y)); gotX != x || gotY != y {
+			t.Fatalf("deinterleave(interleave(%x, %x)) = %x, %x", x, y, gotX, gotY)
+		}
+	}
+}
+
+func TestMoveWraps(t *testing.T) {
+	hash := Encode(LonMax-1e-9, 0, 4)
+	east := moveX(hash, 1)
+	if area := Decode(east); area.Longitude.Min != LonMin {
+		t.Fatalf("moving east of the last column gave %+v, want the first column", area.Longitude)
+	}
+	if moveX(east, -1) != hash {
+		t.Fatal("moving back west didn't return to the start")
+	}
+	north := moveY(hash, 1)
+	if moveY(north, -1) != hash {
+		t.Fatal("moving back south didn't return to the start")
+	}
+}
+
+func TestSearchAreasCoverRadius(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		// 避开经度 ±180 附近, Redis 在那里同样不跨越日期变更线查找
+		centerLon := -170 + rnd.Float64()*340
+		centerLat := -80 + rnd.Float64()*160
+		radius := math.Pow(10, rnd.Float64()*6) // 1 米到 1000 公里
+		areas := SearchAreas(centerLon, centerLat, radius*2, radius*2, radius)
+
+		lonRange, latRange := boundingBox(centerLon, centerLat, radius*2, radius*2)
+		for j := 0; j < 200; j++ {
+			lon := lonRange.Min + rnd.Float64()*(lonRange.Max-lonRange.Min)
+			lat := latRange.Min + rnd.Float64()*(latRange.Max-latRange.Min)
+			if !Valid(lon, lat) {
+				continue
+			}
+			score := Encode(lon, lat, MaxStep).Bits
+			pointLon, pointLat := DecodeScore(float64(score))
+			if _, ok := InRadius(centerLon, centerLat, pointLon, pointLat, radius); !ok {
+				continue
+			}
+			covered := false
+			for _, area := range areas {
+				if lo, hi := ScoreRange(area); score >= lo && score < hi {
+					covered = true
+					break
+				}
+			}
+			if !covered {
+				t.Fatalf("%f,%f within %f meters of %f,%f isn't in any search area", lon, lat, radius, centerLon, centerLat)
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"hash/fnv"
+	"sort"
+)
+
+// ScanPosition maps a member to its position in the scan order.
+// It is 63 bits wide so that cursors fit in a signed integer reply
+func ScanPosition(member string) uint64 {
+	hasher := fnv.New64a()
+	_, _ = hasher.Write([]byte(member))
+	return hasher.Sum64() >> 1
+}
+
+// Scanner builds one page of a cursor based scan over a collection that keeps no scan state.
+//
+// Members are visited in order of ScanPosition, which depends neither on the encoding of the collection
+// nor on which other members exist. A member present for the whole scan is therefore returned exactly once,
+// however the collection is modified or converted between calls.
+type Scanner[T any] struct {
+	cursor uint64
+	items  []scanItem[T]
+}
+
+type scanItem[T any] struct {
+	pos   uint64
+	value T
+}
+
+// NewScanner creates a scanner for the page starting at cursor
+func NewScanner[T any](cursor uint64) *Scanner[T] {
+	return &Scanner[T]{cursor: cursor}
+}
+
+// Add offers a member of the collection to the scanner, value being what the page returns for it
+func (s *Scanner[T]) Add(member string, value T) {
+	if pos := ScanPosition(member); pos >= s.cursor {
+		s.items = append(s.items, scanItem[T]{pos: pos, value: value})
+	}
+}
+
+// Page returns up to count of the offered values, together with the cursor to continue from,
+// which is 0 once the scan is complete. A count of 0 or less returns all of them
+func (s *Scanner[T]) Page(count int) (values []T, next uint64) {
+	sort.Slice(s.items, func(i, j int) bool {
+		return s.items[i].pos < s.items[j].pos
+	})
+
+	end := len(s.items)
+	if count > 0 && count < end {
+		end = count
+		// Members sharing a position must be returned together, or the cursor would skip some of them
+		for end < len(s.items) && s.items[end].pos == s.items[end-1].pos {
+			end++
+		}
+	}
+	if end < len(s.items) {
+		next = s.items[end-1].pos + 1
+	}
+
+	values = make([]T, end)
+	for i := range values {
+		values[i] = s.items[i].value
+	}
+	return values, next
+}
@@ -49,3 +49,13 @@ func (r *NoReply) ToBytes() []byte {
 func GetNoReply() *NoReply {
 	return &NoReply{}
 }
+
+type NullMultiBulkReply struct {
+}
+
+func (r *NullMultiBulkReply) ToBytes() []byte {
+	return []byte("*-1\r\n")
+}
+func GetNullMultiBulkReply() *NullMultiBulkReply {
+	return &NullMultiBulkReply{}
+}
@@ -47,10 +47,10 @@ func GetSyntaxErrReply() *SyntaxErrReply {
 type WrongTypeErrReply struct{}
 
 func (r *WrongTypeErrReply) Error() string {
-	return "WRONG TYPE Operation against a key holding the wrong kind of value"
+	return "WRONGTYPE Operation against a key holding the wrong kind of value"
 }
 func (r *WrongTypeErrReply) ToBytes() []byte {
-	return []byte("-WRONG TYPE Operation against a key holding the wrong kind of value\r\n")
+	return []byte("-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
 }
 func GetWrongTypeErrReply() *WrongTypeErrReply {
 	return &WrongTypeErrReply{}
@@ -69,6 +69,28 @@ func GetMultiBulkReply(args [][]byte) *MultiBulkReply {
 	}
 }
 
+// MultiRawReply 由任意回复组成的数组, 用于元素不全是 bulk string 的数组回复
+type MultiRawReply struct {
+	Replies []resp.Reply
+}
+
+func (r *MultiRawReply) ToBytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('*')
+	buf.WriteString(strconv.Itoa(len(r.Replies)))
+	buf.WriteString(CRLF)
+	for _, rep := range r.Replies {
+		buf.Write(rep.ToBytes())
+	}
+	return buf.Bytes()
+}
+
+func GetMultiRawReply(replies []resp.Reply) *MultiRawReply {
+	return &MultiRawReply{
+		Replies: replies,
+	}
+}
+
 // StandardErrorReply 状态回复(通用错误回复)
 type StandardErrorReply struct {
 	Status string